@@ -0,0 +1,558 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUserNotFound is returned when no user has the requested name or token
+	ErrUserNotFound = errors.New("user not found")
+	// ErrPermissionDenied is returned when the acting user's role does not allow an operation
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Environment variables identifying the acting user when -as is not given
+const (
+	userEnv     = "GOPLAYGROUND_USER"
+	apiTokenEnv = "GOPLAYGROUND_API_TOKEN"
+)
+
+// User roles
+const (
+	roleViewer   = "viewer"
+	roleEditor   = "editor"
+	roleApprover = "approver"
+	roleAdmin    = "admin"
+)
+
+// roles lists every role in the order they are documented
+var roles = []string{roleViewer, roleEditor, roleApprover, roleAdmin}
+
+// Permission is an operation access control decides on
+type Permission string
+
+const (
+	// permRead allows reading contracts and their history
+	permRead Permission = "read"
+	// permStore allows storing new contracts and changing stored ones, except for their status
+	permStore Permission = "store"
+	// permTransition allows changing the status of stored contracts
+	permTransition Permission = "transition"
+	// permDelete allows deleting contracts
+	permDelete Permission = "delete"
+	// permApprove allows deciding the approval requests of contracts, see ApprovalGate
+	permApprove Permission = "approve"
+	// permAdmin allows managing users, webhooks and encryption keys
+	permAdmin Permission = "admin"
+)
+
+// permissionDescriptions completes "cannot ..." in permission errors
+var permissionDescriptions = map[Permission]string{
+	permRead:       "read contracts",
+	permStore:      "store contracts",
+	permTransition: "change the status of contracts",
+	permDelete:     "delete contracts",
+	permApprove:    "approve contracts",
+	permAdmin:      "manage users, webhooks and encryption keys",
+}
+
+// rolePermissions lists what each role allows
+var rolePermissions = map[string][]Permission{
+	roleViewer:   {permRead},
+	roleEditor:   {permRead, permStore},
+	roleApprover: {permRead, permTransition, permApprove},
+	roleAdmin:    {permRead, permStore, permTransition, permDelete, permApprove, permAdmin},
+}
+
+// User is someone commands act for, with a role that decides what they may do
+type User struct {
+	Name string `json:"name"`
+	// Tenant is the tenant the user works in, see selectTenant
+	Tenant string `json:"tenant"`
+	Role   string `json:"role"`
+	// TokenHash is the SHA-256 hash of the user's API token, empty without a token
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt" table:"created"`
+}
+
+// Can reports whether the user's role allows the operation
+func (u *User) Can(perm Permission) bool {
+	for _, allowed := range rolePermissions[u.Role] {
+		if allowed == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// require returns an ErrPermissionDenied error unless the user's role allows the operation
+func (u *User) require(perm Permission) error {
+	if u.Can(perm) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is a%s %s and cannot %s", ErrPermissionDenied, u.Name, article(u.Role), u.Role, permissionDescriptions[perm])
+}
+
+// isOperator reports whether the user is an admin of the default tenant, who
+// operates the whole database
+func (u *User) isOperator() bool {
+	return u.Role == roleAdmin && u.Tenant == defaultTenant
+}
+
+// article returns the "n" of "an" for roles starting with a vowel
+func article(word string) string {
+	if word != "" && strings.ContainsRune("aeiou", rune(word[0])) {
+		return "n"
+	}
+	return ""
+}
+
+// validateRole checks that role is a known role
+func validateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("unknown role %q: use %s", role, strings.Join(roles, ", "))
+	}
+	return nil
+}
+
+// UserStore is implemented by stores that keep the users access control checks
+// commands against. User names are unique across tenants; listing, updating and
+// removing users is limited to the tenant of the store.
+type UserStore interface {
+	// AddUser stores a new user and sets its creation time
+	AddUser(user *User) error
+	Users() ([]User, error)
+	// HasUsers reports whether any tenant has users
+	HasUsers() (bool, error)
+	// GetUser returns a user of any tenant by name
+	GetUser(name string) (*User, error)
+	// UserForToken returns the user an API token was issued to, given the hash of the token
+	UserForToken(tokenHash string) (*User, error)
+	// UpdateUser records the role and token hash of a user
+	UpdateUser(user *User) error
+	RemoveUser(name string) error
+}
+
+var _ UserStore = (*DB)(nil)
+
+// newAPIToken returns a random API token and the hash stored for it
+func newAPIToken() (string, string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", "", fmt.Errorf("error generating API token: %v", err)
+	}
+	encoded := hex.EncodeToString(token)
+	return encoded, hashAPIToken(encoded), nil
+}
+
+// hashAPIToken returns the hash of an API token kept in the users table, so that
+// reading the database does not reveal the tokens
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// configuredActor returns the user name given with -as, or the API token or user
+// name in the environment. Names are taken on trust: the roles of users guard
+// against mistakes, not against someone who can open the store anyway.
+func configuredActor() (name, token string) {
+	if *actingUser != "" {
+		return *actingUser, ""
+	}
+	if token := os.Getenv(apiTokenEnv); token != "" {
+		return "", token
+	}
+	return os.Getenv(userEnv), ""
+}
+
+// resolveActor returns the user with the given name, or the user the API token was
+// issued to. It returns nil while the store has no users, so that stores keep
+// working without access control until the first user is added.
+func resolveActor(users UserStore, name, token string) (*User, error) {
+	if found, err := users.HasUsers(); err != nil || !found {
+		return nil, err
+	}
+
+	switch {
+	case name != "":
+		user, err := users.GetUser(name)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, fmt.Errorf("unknown user %s", name)
+		}
+		return user, err
+	case token != "":
+		user, err := users.UserForToken(hashAPIToken(token))
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, fmt.Errorf("invalid API token")
+		}
+		return user, err
+	default:
+		return nil, fmt.Errorf("the contract store has users: act as one of them with -as <name>, $%s or $%s", userEnv, apiTokenEnv)
+	}
+}
+
+// AccessStore is a ContractStore that checks every operation against the role of
+// the user it acts for
+type AccessStore struct {
+	ContractStore
+	actor *User
+}
+
+// NewAccessStore wraps a store so that operations through it are limited to what
+// the actor's role allows
+func NewAccessStore(store ContractStore, actor *User) *AccessStore {
+	return &AccessStore{ContractStore: store, actor: actor}
+}
+
+// Unwrap returns the wrapped store
+func (s *AccessStore) Unwrap() ContractStore {
+	return s.ContractStore
+}
+
+// Actor returns the user the store acts for
+func (s *AccessStore) Actor() *User {
+	return s.actor
+}
+
+// GetContract retrieves a contract if the actor may read contracts
+func (s *AccessStore) GetContract(id string) (*Contract, error) {
+	if err := s.actor.require(permRead); err != nil {
+		return nil, err
+	}
+	return s.ContractStore.GetContract(id)
+}
+
+// GetAllContracts retrieves every contract if the actor may read contracts
+func (s *AccessStore) GetAllContracts() ([]*Contract, error) {
+	if err := s.actor.require(permRead); err != nil {
+		return nil, err
+	}
+	return s.ContractStore.GetAllContracts()
+}
+
+// StoreContract stores the contract if the actor may make the change: storing a new
+// contract or changing anything but the status needs store, changing the status
+// needs transition. Storing a contract unchanged needs neither.
+func (s *AccessStore) StoreContract(contract *Contract) error {
+	previous, err := s.ContractStore.GetContract(contract.ID)
+	if err != nil && !errors.Is(err, ErrContractNotFound) {
+		return err
+	}
+	needed, err := storePermissions(previous, contract)
+	if err != nil {
+		return err
+	}
+	for _, perm := range needed {
+		if err := s.actor.require(perm); err != nil {
+			return err
+		}
+	}
+	return s.ContractStore.StoreContract(contract)
+}
+
+// storePermissions returns the permissions storing contract over previous needs;
+// previous is nil for a new contract
+func storePermissions(previous, contract *Contract) ([]Permission, error) {
+	if previous == nil {
+		return []Permission{permStore}, nil
+	}
+
+	var needed []Permission
+	if previous.Status != contract.Status {
+		needed = append(needed, permTransition)
+	}
+	withStatus := *previous
+	withStatus.Status = contract.Status
+	oldHash, err := withStatus.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	newHash, err := contract.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	if oldHash != newHash {
+		needed = append(needed, permStore)
+	}
+	return needed, nil
+}
+
+// DeleteContract deletes a contract if the actor may delete contracts
+func (s *AccessStore) DeleteContract(id string) error {
+	if err := s.actor.require(permDelete); err != nil {
+		return err
+	}
+	return s.ContractStore.DeleteContract(id)
+}
+
+// ContractRevisions lists the versions of a contract if the actor may read contracts
+func (s *AccessStore) ContractRevisions(id string) ([]ContractRevision, error) {
+	revisions, err := s.revisionStore()
+	if err != nil {
+		return nil, err
+	}
+	return revisions.ContractRevisions(id)
+}
+
+// GetContractVersion retrieves a version of a contract if the actor may read contracts
+func (s *AccessStore) GetContractVersion(id string, version int) (*Contract, error) {
+	revisions, err := s.revisionStore()
+	if err != nil {
+		return nil, err
+	}
+	return revisions.GetContractVersion(id, version)
+}
+
+// revisionStore returns the RevisionStore behind the store after checking that the
+// actor may read contracts
+func (s *AccessStore) revisionStore() (RevisionStore, error) {
+	if err := s.actor.require(permRead); err != nil {
+		return nil, err
+	}
+	revisions, ok := asRevisionStore(s.ContractStore)
+	if !ok {
+		return nil, fmt.Errorf("the contract store does not keep contract versions")
+	}
+	return revisions, nil
+}
+
+// requirePermission checks an operation that bypasses the ContractStore methods,
+// such as managing webhooks, against the user an opened store acts for. Stores
+// without access control allow everything.
+func requirePermission(store ContractStore, perm Permission) error {
+	access, ok := unwrapStore[*AccessStore](store)
+	if !ok {
+		return nil
+	}
+	return access.actor.require(perm)
+}
+
+// requireOperator checks an operation that spans every tenant, such as verifying
+// or re-encrypting the database, against the user an opened store acts for
+func requireOperator(store ContractStore, operation string) error {
+	access, ok := unwrapStore[*AccessStore](store)
+	if !ok || access.actor.isOperator() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s spans every tenant, so only admins of the %s tenant can run it", ErrPermissionDenied, operation, defaultTenant)
+}
+
+// findUser returns the user with the given name from a list of users
+func findUser(users []User, name string) (*User, error) {
+	for i := range users {
+		if users[i].Name == name {
+			return &users[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, name)
+}
+
+// countAdmins returns how many of the users are admins
+func countAdmins(users []User) int {
+	n := 0
+	for _, user := range users {
+		if user.Role == roleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// checkRemoveUsers returns an error unless every named user exists and removing them
+// all leaves an admin among the remaining users, if any remain
+func checkRemoveUsers(registered []User, names []string) error {
+	removed := make(map[string]bool)
+	for _, name := range names {
+		if _, err := findUser(registered, name); err != nil {
+			return err
+		}
+		removed[name] = true
+	}
+	var remaining []User
+	for _, user := range registered {
+		if !removed[user.Name] {
+			remaining = append(remaining, user)
+		}
+	}
+	if len(remaining) > 0 && countAdmins(remaining) == 0 {
+		return fmt.Errorf("removing %s would leave no admin; make another user admin first", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// addUserResult is the result record of an added user, with the API token issued
+// with -token, which is shown only once
+type addUserResult struct {
+	Name      string    `json:"name"`
+	Tenant    string    `json:"tenant"`
+	Role      string    `json:"role"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"createdAt" table:"created"`
+}
+
+// tokenResult is the result record of a new API token, which is shown only once
+type tokenResult struct {
+	User  string `json:"user"`
+	Token string `json:"token"`
+}
+
+// removeUserResult is the result record of a removed user
+type removeUserResult struct {
+	Name    string `json:"name"`
+	Removed bool   `json:"removed"`
+}
+
+// runUsers implements the users command and its subcommands
+func runUsers(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("users requires a subcommand: add, list, role, token or remove")
+	}
+	subcommand, args := args[0], args[1:]
+
+	fs := newFlagSet("users " + subcommand)
+	var role *string
+	var withToken *bool
+	switch subcommand {
+	case "add":
+		role = fs.String("role", roleViewer, "Role of the user: "+strings.Join(roles, ", "))
+		withToken = fs.Bool("token", false, "Issue an API token for the user, printed once")
+	case "list", "role", "token", "remove":
+	default:
+		return fmt.Errorf("unknown users subcommand %q: use add, list, role, token or remove", subcommand)
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	store, err := openBareStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := requirePermission(store, permAdmin); err != nil {
+		return err
+	}
+	users, ok := unwrapStore[UserStore](store)
+	if !ok {
+		return fmt.Errorf("users require a SQLite or PostgreSQL store")
+	}
+	registered, err := users.Users()
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "add":
+		if len(positional) != 1 {
+			return fmt.Errorf("users add requires exactly one user name")
+		}
+		if err := validateRole(*role); err != nil {
+			return err
+		}
+		if len(registered) == 0 && *role != roleAdmin {
+			return fmt.Errorf("the first user must be an admin, so that someone can manage users")
+		}
+		user := &User{Name: positional[0], Role: *role}
+		var token string
+		if *withToken {
+			if token, user.TokenHash, err = newAPIToken(); err != nil {
+				return err
+			}
+		}
+		if err := users.AddUser(user); err != nil {
+			return err
+		}
+		result := addUserResult{Name: user.Name, Tenant: user.Tenant, Role: user.Role, Token: token, CreatedAt: user.CreatedAt}
+		return printResults(result, func() {
+			fmt.Printf("User %s added as %s\n", user.Name, user.Role)
+			if token != "" {
+				fmt.Printf("API token (shown only once): %s\n", token)
+			}
+		})
+
+	case "list":
+		if registered == nil {
+			registered = []User{}
+		}
+		return printResults(registered, func() {
+			if len(registered) == 0 {
+				if found, _ := users.HasUsers(); found {
+					fmt.Println("No users in this tenant")
+				} else {
+					fmt.Println("No users; access control is off")
+				}
+				return
+			}
+			writeResults(os.Stdout, outputTable, registered)
+		})
+
+	case "role":
+		if len(positional) != 2 {
+			return fmt.Errorf("users role requires a user name and a role")
+		}
+		if err := validateRole(positional[1]); err != nil {
+			return err
+		}
+		user, err := findUser(registered, positional[0])
+		if err != nil {
+			return err
+		}
+		if user.Role == roleAdmin && positional[1] != roleAdmin && countAdmins(registered) == 1 {
+			return fmt.Errorf("%s is the last admin; make another user admin first", user.Name)
+		}
+		user.Role = positional[1]
+		if err := users.UpdateUser(user); err != nil {
+			return err
+		}
+		return printResults(user, func() {
+			fmt.Printf("User %s is now %s\n", user.Name, user.Role)
+		})
+
+	case "token":
+		if len(positional) != 1 {
+			return fmt.Errorf("users token requires exactly one user name")
+		}
+		user, err := findUser(registered, positional[0])
+		if err != nil {
+			return err
+		}
+		var token string
+		if token, user.TokenHash, err = newAPIToken(); err != nil {
+			return err
+		}
+		if err := users.UpdateUser(user); err != nil {
+			return err
+		}
+		return printResults(tokenResult{User: user.Name, Token: token}, func() {
+			fmt.Printf("API token for %s, replacing any earlier one (shown only once): %s\n", user.Name, token)
+		})
+
+	default: // remove
+		if len(positional) == 0 {
+			return fmt.Errorf("users remove requires at least one user name")
+		}
+		if err := checkRemoveUsers(registered, positional); err != nil {
+			return err
+		}
+		results := make([]removeUserResult, 0, len(positional))
+		for _, name := range positional {
+			if err := users.RemoveUser(name); err != nil {
+				return err
+			}
+			results = append(results, removeUserResult{Name: name, Removed: true})
+		}
+		return printResults(results, func() {
+			for _, result := range results {
+				fmt.Printf("User %s removed\n", result.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testUserStore runs the user store tests against an empty store
+func testUserStore(t *testing.T, store UserStore) {
+	alice := &User{Name: "alice", Role: roleAdmin, TokenHash: hashAPIToken("alice-token")}
+	if err := store.AddUser(alice); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	if err := store.AddUser(&User{Name: "bob", Role: roleViewer}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	if alice.CreatedAt.IsZero() {
+		t.Errorf("Expected a creation time")
+	}
+	if err := store.AddUser(&User{Name: "alice", Role: roleViewer}); err == nil || !strings.Contains(err.Error(), "user alice already exists") {
+		t.Errorf("Expected a duplicate user error, got %v", err)
+	}
+
+	users, err := store.Users()
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[0].TokenHash != alice.TokenHash || users[1].Role != roleViewer {
+		t.Errorf("Unexpected users %+v", users)
+	}
+
+	user, err := store.UserForToken(hashAPIToken("alice-token"))
+	if err != nil || user.Name != "alice" {
+		t.Errorf("Expected the token to identify alice, got %+v: %v", user, err)
+	}
+	if _, err := store.UserForToken(""); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected an empty token to identify nobody, got %v", err)
+	}
+
+	bob, err := store.GetUser("bob")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	bob.Role = roleEditor
+	if err := store.UpdateUser(bob); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if bob, err := store.GetUser("bob"); err != nil || bob.Role != roleEditor {
+		t.Errorf("Expected bob to be an editor, got %+v: %v", bob, err)
+	}
+
+	if err := store.RemoveUser("bob"); err != nil {
+		t.Fatalf("Failed to remove user: %v", err)
+	}
+	if _, err := store.GetUser("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := store.RemoveUser("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := store.UpdateUser(bob); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testUserStore(t, db)
+}
+
+func TestResolveActor(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	t.Run("NoUsers", func(t *testing.T) {
+		if actor, err := resolveActor(db, "alice", ""); actor != nil || err != nil {
+			t.Errorf("Expected no access control without users, got %+v: %v", actor, err)
+		}
+	})
+
+	token, hash, err := newAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to create API token: %v", err)
+	}
+	if err := db.AddUser(&User{Name: "alice", Role: roleAdmin, TokenHash: hash}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		token    string
+		expected string
+		err      string
+	}{
+		{"ByName", "alice", "", "alice", ""},
+		{"ByToken", "", token, "alice", ""},
+		{"NameBeforeToken", "alice", "invalid", "alice", ""},
+		{"UnknownUser", "mallory", "", "", "unknown user mallory"},
+		{"InvalidToken", "", "invalid", "", "invalid API token"},
+		{"Anonymous", "", "", "", "the contract store has users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor, err := resolveActor(db, tt.user, tt.token)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || actor == nil || actor.Name != tt.expected {
+				t.Errorf("Expected to act as %s, got %+v: %v", tt.expected, actor, err)
+			}
+		})
+	}
+}
+
+func TestCheckRemoveUsers(t *testing.T) {
+	registered := []User{{Name: "alice", Role: roleAdmin}, {Name: "bob", Role: roleAdmin}, {Name: "carol", Role: roleEditor}}
+
+	tests := []struct {
+		name  string
+		users []string
+		err   string
+	}{
+		{"OneOfTwoAdmins", []string{"alice"}, ""},
+		{"Editor", []string{"carol"}, ""},
+		{"Everyone", []string{"carol", "alice", "bob"}, ""},
+		{"AllAdmins", []string{"alice", "bob"}, "removing alice, bob would leave no admin"},
+		// The order of the names does not matter
+		{"AllAdminsReversed", []string{"bob", "alice"}, "removing bob, alice would leave no admin"},
+		{"Unknown", []string{"carol", "dave"}, "user not found: dave"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRemoveUsers(registered, tt.users)
+			if tt.err == "" && err != nil {
+				t.Errorf("Expected the users to be removable, got %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAccessStore(t *testing.T) {
+	edited := newTestContract("TEST-001", "pending")
+	edited.Title = "Edited Contract"
+
+	operations := []struct {
+		name string
+		run  func(store ContractStore) error
+	}{
+		{"Read", func(store ContractStore) error {
+			_, err := store.GetContract("TEST-001")
+			return err
+		}},
+		{"List", func(store ContractStore) error {
+			_, err := store.GetAllContracts()
+			return err
+		}},
+		{"History", func(store ContractStore) error {
+			_, err := store.(RevisionStore).ContractRevisions("TEST-001")
+			return err
+		}},
+		{"Create", func(store ContractStore) error {
+			created := newTestContract("TEST-001", "pending")
+			created.ID = "TEST-002"
+			return store.StoreContract(created)
+		}},
+		{"Edit", func(store ContractStore) error { return store.StoreContract(edited) }},
+		{"Transition", func(store ContractStore) error { return store.StoreContract(newTestContract("TEST-001", "active")) }},
+		{"Unchanged", func(store ContractStore) error { return store.StoreContract(newTestContract("TEST-001", "pending")) }},
+		{"Delete", func(store ContractStore) error { return store.DeleteContract("TEST-001") }},
+	}
+
+	allowed := map[string][]string{
+		roleViewer:   {"Read", "List", "History", "Unchanged"},
+		roleEditor:   {"Read", "List", "History", "Create", "Edit", "Unchanged"},
+		roleApprover: {"Read", "List", "History", "Transition", "Unchanged"},
+		roleAdmin:    {"Read", "List", "History", "Create", "Edit", "Transition", "Unchanged", "Delete"},
+	}
+	for _, role := range roles {
+		for _, op := range operations {
+			t.Run(role+"/"+op.name, func(t *testing.T) {
+				memory := NewMemoryStore()
+				if err := memory.StoreContract(newTestContract("TEST-001", "pending")); err != nil {
+					t.Fatalf("Failed to store contract: %v", err)
+				}
+				store := NewAccessStore(memory, &User{Name: "user", Role: role})
+
+				expected := false
+				for _, name := range allowed[role] {
+					expected = expected || name == op.name
+				}
+				err := op.run(store)
+				if expected && err != nil {
+					t.Errorf("Expected a %s to be allowed, got %v", role, err)
+				}
+				if !expected && !errors.Is(err, ErrPermissionDenied) {
+					t.Errorf("Expected a %s to be denied, got %v", role, err)
+				}
+			})
+		}
+	}
+
+	t.Run("EditAndTransition", func(t *testing.T) {
+		memory := NewMemoryStore()
+		memory.StoreContract(newTestContract("TEST-001", "pending"))
+		changed := newTestContract("TEST-001", "active")
+		changed.Title = "Edited Contract"
+		err := NewAccessStore(memory, &User{Name: "ann", Role: roleApprover}).StoreContract(changed)
+		if err == nil || err.Error() != "permission denied: ann is an approver and cannot store contracts" {
+			t.Errorf("Expected the approver to need store for the edit, got %v", err)
+		}
+	})
+
+	t.Run("RequirePermission", func(t *testing.T) {
+		store := NewEventStore(NewAccessStore(NewMemoryStore(), &User{Name: "ed", Role: roleEditor}))
+		if err := requirePermission(store, permAdmin); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected a wrapped access store to deny admin to an editor, got %v", err)
+		}
+		if err := requirePermission(NewMemoryStore(), permAdmin); err != nil {
+			t.Errorf("Expected a store without access control to allow everything, got %v", err)
+		}
+	})
+}
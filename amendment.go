@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Amendment records a change to a contract that takes effect on a given date
+type Amendment struct {
+	EffectiveDate string           `json:"effectiveDate"`
+	Description   string           `json:"description"`
+	Changes       AmendmentChanges `json:"changes"`
+}
+
+// AmendmentChanges holds the fields changed by an amendment.
+// Fields that are not set keep the value they had before the amendment.
+type AmendmentChanges struct {
+	Title    *string  `json:"title,omitempty"`
+	Status   *string  `json:"status,omitempty"`
+	Parties  []Party  `json:"parties,omitempty"`
+	EndDate  *string  `json:"endDate,omitempty"`
+	Value    *float64 `json:"value,omitempty"`
+	Currency *string  `json:"currency,omitempty"`
+}
+
+// IsEmpty reports whether the amendment changes no fields
+func (ch AmendmentChanges) IsEmpty() bool {
+	return ch.Title == nil && ch.Status == nil && ch.Parties == nil &&
+		ch.EndDate == nil && ch.Value == nil && ch.Currency == nil
+}
+
+// Summary describes the changed fields in a single line
+func (ch AmendmentChanges) Summary() string {
+	return ch.LocalSummary(nil)
+}
+
+// LocalSummary describes the changed fields in a single line in the given locale
+func (ch AmendmentChanges) LocalSummary(l *Locale) string {
+	var parts []string
+	if ch.Title != nil {
+		parts = append(parts, fmt.Sprintf("%s %q", l.T("title"), *ch.Title))
+	}
+	if ch.Status != nil {
+		parts = append(parts, l.T("status")+" "+l.T(*ch.Status))
+	}
+	if ch.Parties != nil {
+		parts = append(parts, l.Tf("%d parties", len(ch.Parties)))
+	}
+	if ch.EndDate != nil {
+		parts = append(parts, l.T("end date")+" "+l.Date(*ch.EndDate))
+	}
+	if ch.Value != nil {
+		parts = append(parts, l.T("value")+" "+l.Number(*ch.Value, 2))
+	}
+	if ch.Currency != nil {
+		parts = append(parts, l.T("currency")+" "+*ch.Currency)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// apply applies the changes to the contract in place
+func (ch AmendmentChanges) apply(c *Contract) {
+	if ch.Title != nil {
+		c.Title = *ch.Title
+	}
+	if ch.Status != nil {
+		c.Status = *ch.Status
+	}
+	if ch.Parties != nil {
+		c.Parties = append([]Party(nil), ch.Parties...)
+	}
+	if ch.EndDate != nil {
+		c.Terms.EndDate = *ch.EndDate
+	}
+	if ch.Value != nil {
+		c.Terms.Value = *ch.Value
+	}
+	if ch.Currency != nil {
+		c.Terms.Currency = *ch.Currency
+	}
+}
+
+// sortedAmendments returns the amendments ordered by effective date, keeping the
+// file order for amendments that take effect on the same day
+func (c *Contract) sortedAmendments() []Amendment {
+	amendments := append([]Amendment(nil), c.Amendments...)
+	sort.SliceStable(amendments, func(i, j int) bool {
+		return amendments[i].EffectiveDate < amendments[j].EffectiveDate
+	})
+	return amendments
+}
+
+// EffectiveAt returns a copy of the contract with every amendment effective on or
+// before date applied. The copy only lists the amendments that were applied.
+func (c *Contract) EffectiveAt(date time.Time) *Contract {
+	effective := *c
+	effective.Parties = append([]Party(nil), c.Parties...)
+	effective.Amendments = nil
+
+	day := date.Format(dateLayout)
+	for _, amendment := range c.sortedAmendments() {
+		// Dates use the YYYY-MM-DD layout, so they compare chronologically as strings
+		if amendment.EffectiveDate > day {
+			break
+		}
+		amendment.Changes.apply(&effective)
+		effective.Amendments = append(effective.Amendments, amendment)
+	}
+
+	return &effective
+}
+
+// latestTerms returns the contract with all of its amendments applied
+func (c *Contract) latestTerms() *Contract {
+	effective := *c
+	effective.Parties = append([]Party(nil), c.Parties...)
+	effective.Amendments = nil
+	for _, amendment := range c.sortedAmendments() {
+		amendment.Changes.apply(&effective)
+	}
+	return &effective
+}
+
+// validateAmendments checks every amendment and the terms that result from applying them
+func (c *Contract) validateAmendments() error {
+	for i, amendment := range c.Amendments {
+		if amendment.EffectiveDate == "" {
+			return fmt.Errorf("amendment %d: effective date is required", i+1)
+		}
+		if _, err := time.Parse(dateLayout, amendment.EffectiveDate); err != nil {
+			return fmt.Errorf("amendment %d: invalid effective date format: %v", i+1, err)
+		}
+		if amendment.Description == "" {
+			return fmt.Errorf("amendment %d: description is required", i+1)
+		}
+		if amendment.Changes.IsEmpty() {
+			return fmt.Errorf("amendment %d: at least one changed field is required", i+1)
+		}
+		if c.Terms.StartDate != "" && amendment.EffectiveDate < c.Terms.StartDate {
+			return fmt.Errorf("amendment %d: effective date is before the contract start date", i+1)
+		}
+	}
+
+	if err := c.latestTerms().Validate(); err != nil {
+		return fmt.Errorf("amended contract is invalid: %v", err)
+	}
+	return nil
+}
+
+// renewalIDPattern matches IDs of renewed contracts such as CONTRACT-001-R2
+var renewalIDPattern = regexp.MustCompile(`^(.*)-R(\d+)$`)
+
+// NextRenewalID returns the default ID for a renewal of the contract with the given ID
+func NextRenewalID(id string) string {
+	if match := renewalIDPattern.FindStringSubmatch(id); match != nil {
+		n, _ := strconv.Atoi(match[2])
+		return fmt.Sprintf("%s-R%d", match[1], n+1)
+	}
+	return id + "-R1"
+}
+
+// Renew creates a new contract that follows this one for the given number of months.
+// The renewal starts the day after the amended end date, carries over the amended
+// parties and terms except the payment schedule, and links back to this contract
+// through PredecessorID.
+func (c *Contract) Renew(newID string, months int, status string) (*Contract, error) {
+	if months <= 0 {
+		return nil, fmt.Errorf("renewal period must be at least one month")
+	}
+
+	current := c.latestTerms()
+	if current.Terms.EndDate == "" {
+		return nil, fmt.Errorf("contract %s has no end date to renew from", c.ID)
+	}
+	endDate, err := time.Parse(dateLayout, current.Terms.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date format: %v", err)
+	}
+
+	if newID == "" {
+		newID = NextRenewalID(c.ID)
+	}
+	start := endDate.AddDate(0, 0, 1)
+	end := start.AddDate(0, months, -1)
+
+	renewal := &Contract{
+		ID:            newID,
+		Title:         current.Title,
+		Parties:       current.Parties,
+		Terms:         current.Terms,
+		Status:        status,
+		PredecessorID: c.ID,
+	}
+	renewal.Terms.StartDate = start.Format(dateLayout)
+	renewal.Terms.EndDate = end.Format(dateLayout)
+	// The payment schedule belongs to the renewed term
+	renewal.Terms.Payments = nil
+
+	if err := renewal.Validate(); err != nil {
+		return nil, fmt.Errorf("renewed contract is invalid: %v", err)
+	}
+	return renewal, nil
+}
+
+// runRenew implements the renew command
+func runRenew(args []string) error {
+	fs := newFlagSet("renew")
+	months := fs.Int("months", 12, "Length of the renewal in months")
+	newID := fs.String("id", "", "ID of the renewed contract (default: <id>-R1, <id>-R2, ...)")
+	status := fs.String("status", "pending", "Status of the renewed contract")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("renew requires exactly one contract ID")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	contract, err := store.GetContract(positional[0])
+	if err != nil {
+		return err
+	}
+
+	renewal, err := contract.Renew(*newID, *months, *status)
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.GetContract(renewal.ID); err == nil {
+		return fmt.Errorf("contract %s already exists", renewal.ID)
+	} else if !errors.Is(err, ErrContractNotFound) {
+		return err
+	}
+
+	if err := store.StoreContract(renewal); err != nil {
+		return err
+	}
+	return printResults(summarizeContract(renewal), func() {
+		fmt.Printf("Contract %s renewed as %s (%s to %s)\n", contract.ID, renewal.ID, renewal.Terms.StartDate, renewal.Terms.EndDate)
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustParseDate parses a YYYY-MM-DD date or fails the test
+func mustParseDate(t *testing.T, value string) time.Time {
+	t.Helper()
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		t.Fatalf("Failed to parse date %s: %v", value, err)
+	}
+	return date
+}
+
+func TestContractEffectiveAt(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+
+	tests := []struct {
+		date       string
+		value      float64
+		endDate    string
+		amendments int
+	}{
+		{"2024-03-31", 1000.00, "2024-12-31", 0},
+		{"2024-04-01", 1200.00, "2024-12-31", 1},
+		{"2024-10-15", 1200.00, "2025-03-31", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			effective := contract.EffectiveAt(mustParseDate(t, tt.date))
+			if effective.Terms.Value != tt.value {
+				t.Errorf("Expected value %.2f, got %.2f", tt.value, effective.Terms.Value)
+			}
+			if effective.Terms.EndDate != tt.endDate {
+				t.Errorf("Expected end date %s, got %s", tt.endDate, effective.Terms.EndDate)
+			}
+			if len(effective.Amendments) != tt.amendments {
+				t.Errorf("Expected %d applied amendments, got %d", tt.amendments, len(effective.Amendments))
+			}
+		})
+	}
+
+	if contract.Terms.Value != 1000.00 || len(contract.Amendments) != 2 {
+		t.Error("EffectiveAt must not modify the original contract")
+	}
+}
+
+func TestAmendmentValidation(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		if err := newTestContract("TEST-001", "active").Validate(); err != nil {
+			t.Errorf("Expected amended contract to be valid: %v", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		modify func(*Contract)
+	}{
+		{"MissingEffectiveDate", func(c *Contract) { c.Amendments[0].EffectiveDate = "" }},
+		{"InvalidEffectiveDate", func(c *Contract) { c.Amendments[0].EffectiveDate = "01/09/2024" }},
+		{"BeforeStart", func(c *Contract) { c.Amendments[0].EffectiveDate = "2023-12-01" }},
+		{"MissingDescription", func(c *Contract) { c.Amendments[0].Description = "" }},
+		{"NoChanges", func(c *Contract) { c.Amendments[0].Changes = AmendmentChanges{} }},
+		{"InvalidResult", func(c *Contract) { c.Amendments[1].Changes.Value = floatPtr(-5) }},
+		{"OwnPredecessor", func(c *Contract) { c.PredecessorID = c.ID }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := newTestContract("TEST-001", "active")
+			tt.modify(contract)
+			if err := contract.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestContractRenew(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+
+	renewal, err := contract.Renew("", 12, "pending")
+	if err != nil {
+		t.Fatalf("Failed to renew contract: %v", err)
+	}
+
+	if renewal.ID != "TEST-001-R1" {
+		t.Errorf("Expected ID TEST-001-R1, got %s", renewal.ID)
+	}
+	if renewal.PredecessorID != contract.ID {
+		t.Errorf("Expected predecessor %s, got %s", contract.ID, renewal.PredecessorID)
+	}
+	// The renewal follows the amended end date and carries over the amended value
+	if renewal.Terms.StartDate != "2025-04-01" || renewal.Terms.EndDate != "2026-03-31" {
+		t.Errorf("Expected period 2025-04-01 to 2026-03-31, got %s to %s", renewal.Terms.StartDate, renewal.Terms.EndDate)
+	}
+	if renewal.Terms.Value != 1200.00 {
+		t.Errorf("Expected value 1200.00, got %.2f", renewal.Terms.Value)
+	}
+	if renewal.Status != "pending" || len(renewal.Amendments) != 0 {
+		t.Errorf("Expected a pending renewal without amendments, got %+v", renewal)
+	}
+
+	t.Run("PaymentsNotCarriedOver", func(t *testing.T) {
+		contract := newTestContract("TEST-001", "active")
+		contract.Terms.NoticePeriodDays = 30
+		contract.Terms.Payments = []Payment{{DueDate: "2024-06-30", Amount: 1000}}
+
+		renewal, err := contract.Renew("", 12, "pending")
+		if err != nil {
+			t.Fatalf("Failed to renew contract: %v", err)
+		}
+		if len(renewal.Terms.Payments) != 0 {
+			t.Errorf("Expected the renewal to have no payments, got %+v", renewal.Terms.Payments)
+		}
+		if renewal.Terms.NoticePeriodDays != 30 {
+			t.Errorf("Expected the notice period to be carried over, got %d", renewal.Terms.NoticePeriodDays)
+		}
+	})
+
+	t.Run("NoEndDate", func(t *testing.T) {
+		open := newTestContract("TEST-001", "active")
+		open.Terms.EndDate = ""
+		open.Amendments = nil
+		if _, err := open.Renew("", 12, "pending"); err == nil {
+			t.Error("Expected error renewing a contract without end date")
+		}
+	})
+
+	t.Run("InvalidMonths", func(t *testing.T) {
+		if _, err := contract.Renew("", 0, "pending"); err == nil {
+			t.Error("Expected error for zero months")
+		}
+	})
+}
+
+func TestNextRenewalID(t *testing.T) {
+	tests := map[string]string{
+		"CONTRACT-001":     "CONTRACT-001-R1",
+		"CONTRACT-001-R1":  "CONTRACT-001-R2",
+		"CONTRACT-001-R9":  "CONTRACT-001-R10",
+		"CONTRACT-RENEWAL": "CONTRACT-RENEWAL-R1",
+	}
+	for id, expected := range tests {
+		if got := NextRenewalID(id); got != expected {
+			t.Errorf("NextRenewalID(%s): expected %s, got %s", id, expected, got)
+		}
+	}
+}
+
+func TestContractToMarkdownAt(t *testing.T) {
+	markdown, err := newTestContract("TEST-001", "active").ToMarkdownAt(mustParseDate(t, "2024-05-01"))
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+
+	expectedStrings := []string{
+		"Effective as of: 2024-05-01",
+		"* Value: 1200.00 USD",
+		"### Amendments",
+		"* 2024-04-01: Price increase",
+		"  - Changes: value 1200.00",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("Expected markdown to contain '%s'", expected)
+		}
+	}
+	if strings.Contains(markdown, "Extension") {
+		t.Error("Expected future amendment to be left out")
+	}
+}
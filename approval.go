@@ -0,0 +1,655 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrApprovalNotFound is returned when no approval request has the requested ID
+	ErrApprovalNotFound = errors.New("approval request not found")
+	// ErrApprovalRequired is returned when a contract would become active without the approvals it needs
+	ErrApprovalRequired = errors.New("approval required")
+)
+
+// activeStatus is the contract status that approval chains guard
+const activeStatus = "active"
+
+// Approval request statuses
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+	approvalRejected = "rejected"
+	// approvalSuperseded marks a pending request replaced by a newer request for the same contract
+	approvalSuperseded = "superseded"
+)
+
+// approvalStatuses lists every approval request status in the order they are documented
+var approvalStatuses = []string{approvalPending, approvalApproved, approvalRejected, approvalSuperseded}
+
+// ApprovalCondition selects the contracts an approval chain applies to. Every
+// condition that is set must hold; a condition without any applies to every contract.
+type ApprovalCondition struct {
+	// ValueOver matches contracts whose value, before or after amendments, is above it
+	ValueOver *float64 `json:"valueOver,omitempty"`
+	// Currency matches contracts in this currency
+	Currency string `json:"currency,omitempty"`
+}
+
+// matches reports whether the contract meets the condition
+func (w ApprovalCondition) matches(c *Contract) bool {
+	latest := c.latestTerms()
+	if w.ValueOver != nil && c.Terms.Value <= *w.ValueOver && latest.Terms.Value <= *w.ValueOver {
+		return false
+	}
+	if w.Currency != "" && latest.Terms.Currency != w.Currency {
+		return false
+	}
+	return true
+}
+
+// ApprovalStep is an approval a chain needs, such as finance or legal
+type ApprovalStep struct {
+	Name string `json:"name"`
+	// Approvers names the users who may approve the step; no approvers means any
+	// user whose role allows approving
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// ApprovalChain lists the approvals contracts matching a condition need before they become active
+type ApprovalChain struct {
+	Name  string            `json:"name"`
+	When  ApprovalCondition `json:"when"`
+	Steps []ApprovalStep    `json:"steps"`
+}
+
+// validate checks that the chain has a name and named steps
+func (c ApprovalChain) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("chain name is required")
+	}
+	if c.When.ValueOver != nil && *c.When.ValueOver < 0 {
+		return fmt.Errorf("chain %s: valueOver cannot be negative", c.Name)
+	}
+	if c.When.Currency != "" && !isValidCurrency(c.When.Currency) {
+		return fmt.Errorf("chain %s: invalid currency code: %s", c.Name, c.When.Currency)
+	}
+	if len(c.Steps) == 0 {
+		return fmt.Errorf("chain %s: at least one step is required", c.Name)
+	}
+	seen := make(map[string]bool)
+	for i, step := range c.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("chain %s, step %d: step name is required", c.Name, i+1)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("chain %s: step %s appears more than once", c.Name, step.Name)
+		}
+		seen[step.Name] = true
+	}
+	return nil
+}
+
+// ApprovalConfig holds the approval chains of the config file
+type ApprovalConfig struct {
+	Chains []ApprovalChain `json:"chains"`
+}
+
+// validate checks every chain of the config and that chain names are unique
+func (c *ApprovalConfig) validate() error {
+	names := make(map[string]bool)
+	for _, chain := range c.Chains {
+		if err := chain.validate(); err != nil {
+			return err
+		}
+		if names[chain.Name] {
+			return fmt.Errorf("chain %s appears more than once", chain.Name)
+		}
+		names[chain.Name] = true
+	}
+	return nil
+}
+
+// LoadApprovalConfig reads and validates an approval config file
+func LoadApprovalConfig(path string) (*ApprovalConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading approval config: %v", err)
+	}
+
+	var config ApprovalConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing approval config %s: %v", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid approval config %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// Requests returns the approvals the contract needs before it becomes active, as
+// pending requests for its current content. Steps with the same name in several
+// matching chains are needed once, from any approver of those chains.
+func (c *ApprovalConfig) Requests(contract *Contract) ([]*ApprovalRequest, error) {
+	var requests []*ApprovalRequest
+	byStep := make(map[string]*ApprovalRequest)
+	for _, chain := range c.Chains {
+		if !chain.When.matches(contract) {
+			continue
+		}
+		for _, step := range chain.Steps {
+			if request, ok := byStep[step.Name]; ok {
+				request.Chain += "," + chain.Name
+				if len(request.Approvers) > 0 && len(step.Approvers) > 0 {
+					request.Approvers = mergeApprovers(request.Approvers, step.Approvers)
+				} else {
+					request.Approvers = nil
+				}
+				continue
+			}
+			request := &ApprovalRequest{
+				ContractID: contract.ID,
+				Chain:      chain.Name,
+				Step:       step.Name,
+				Approvers:  append([]string(nil), step.Approvers...),
+				Status:     approvalPending,
+			}
+			byStep[step.Name] = request
+			requests = append(requests, request)
+		}
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	hash, err := approvalHash(contract)
+	if err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		request.ContentHash = hash
+	}
+	return requests, nil
+}
+
+// mergeApprovers returns the approvers of both lists, sorted and without duplicates
+func mergeApprovers(a, b []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, name := range append(append([]string(nil), a...), b...) {
+		if !seen[name] {
+			seen[name] = true
+			merged = append(merged, name)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// approvalHash returns the hash approvals are bound to: the content hash of the
+// contract without its status and signatures, so that activating or signing an
+// approved contract keeps its approvals while any other change needs new ones
+func approvalHash(c *Contract) (string, error) {
+	approved := *c
+	approved.Status = ""
+	approved.Signatures = nil
+	return approved.ContentHash()
+}
+
+// ApprovalRequest asks for one step of an approval chain for a version of a contract
+type ApprovalRequest struct {
+	ID         int64  `json:"id"`
+	ContractID string `json:"contractId" table:"contract"`
+	// Chain names the chains that need the step, separated by commas
+	Chain string `json:"chain"`
+	Step  string `json:"step"`
+	// Approvers names the users who may decide the request; none means any user
+	// whose role allows approving
+	Approvers []string `json:"approvers,omitempty"`
+	// Status is pending, approved, rejected or superseded
+	Status      string `json:"status"`
+	RequestedBy string `json:"requestedBy,omitempty" table:"requested by"`
+	DecidedBy   string `json:"decidedBy,omitempty" table:"decided by"`
+	Comment     string `json:"comment,omitempty"`
+	// ContentHash is the approval hash of the contract when approval was requested, see approvalHash
+	ContentHash string     `json:"contentHash" table:"-"`
+	CreatedAt   time.Time  `json:"createdAt" table:"created"`
+	DecidedAt   *time.Time `json:"decidedAt,omitempty" table:"decided"`
+}
+
+// allows reports whether the named user may decide the request
+func (r *ApprovalRequest) allows(name string) bool {
+	if len(r.Approvers) == 0 {
+		return true
+	}
+	for _, approver := range r.Approvers {
+		if approver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalStore is implemented by stores that keep approval requests. Requests
+// belong to the tenant of the store.
+type ApprovalStore interface {
+	// RequestApprovals supersedes the pending requests of a contract and adds new
+	// ones, setting their IDs and creation times
+	RequestApprovals(contractID string, requests []*ApprovalRequest) error
+	// ApprovalRequests returns the requests of a contract, or of every contract when
+	// contractID is empty, with the given status or any status, oldest first
+	ApprovalRequests(contractID, status string) ([]ApprovalRequest, error)
+	GetApprovalRequest(id int64) (*ApprovalRequest, error)
+	// DecideApprovalRequest records the status, decider, comment and decision time
+	// of a pending request
+	DecideApprovalRequest(request *ApprovalRequest) error
+	// ApprovalConfig returns the approval chains set for the store, or nil when
+	// none were set
+	ApprovalConfig() (*ApprovalConfig, error)
+	// SetApprovalConfig replaces the approval chains of the store
+	SetApprovalConfig(config *ApprovalConfig) error
+}
+
+var _ ApprovalStore = (*DB)(nil)
+
+// asApprovalStore returns the ApprovalStore behind a store and the stores wrapping it
+func asApprovalStore(store ContractStore) (ApprovalStore, bool) {
+	return unwrapStore[ApprovalStore](store)
+}
+
+// missingApprovals returns the required requests that no approved request for the
+// same step and content satisfies
+func missingApprovals(required []*ApprovalRequest, recorded []ApprovalRequest) []*ApprovalRequest {
+	var missing []*ApprovalRequest
+	for _, request := range required {
+		approved := false
+		for _, r := range recorded {
+			approved = approved || (r.Step == request.Step && r.ContentHash == request.ContentHash && r.Status == approvalApproved)
+		}
+		if !approved {
+			missing = append(missing, request)
+		}
+	}
+	return missing
+}
+
+// ApprovalGate is a ContractStore that keeps contracts from becoming active until
+// every step of the approval chains they match is approved for their current content
+type ApprovalGate struct {
+	ContractStore
+	approvals ApprovalStore
+	config    *ApprovalConfig
+}
+
+// NewApprovalGate wraps a store so that contracts stored through it only become
+// active with the approvals the config requires, as recorded in approvals
+func NewApprovalGate(store ContractStore, approvals ApprovalStore, config *ApprovalConfig) *ApprovalGate {
+	return &ApprovalGate{ContractStore: store, approvals: approvals, config: config}
+}
+
+// Unwrap returns the wrapped store
+func (s *ApprovalGate) Unwrap() ContractStore {
+	return s.ContractStore
+}
+
+// StoreContract stores the contract unless it is active without the approvals its
+// current content needs. An active contract is checked again whenever a change
+// other than to its status or signatures is stored.
+func (s *ApprovalGate) StoreContract(contract *Contract) error {
+	if strings.EqualFold(contract.Status, activeStatus) {
+		previous, err := s.ContractStore.GetContract(contract.ID)
+		if err != nil && !errors.Is(err, ErrContractNotFound) {
+			return err
+		}
+		changed := true
+		if previous != nil && strings.EqualFold(previous.Status, activeStatus) {
+			before, err := approvalHash(previous)
+			if err != nil {
+				return err
+			}
+			after, err := approvalHash(contract)
+			if err != nil {
+				return err
+			}
+			changed = before != after
+		}
+		if changed {
+			if err := s.checkApprovals(contract, previous != nil && strings.EqualFold(previous.Status, activeStatus)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.ContractStore.StoreContract(contract)
+}
+
+// checkApprovals returns an ErrApprovalRequired error naming the steps the contract
+// still needs, unless every one of them is approved. wasActive tells a change of an
+// active contract from its activation.
+func (s *ApprovalGate) checkApprovals(contract *Contract, wasActive bool) error {
+	required, err := s.config.Requests(contract)
+	if err != nil || len(required) == 0 {
+		return err
+	}
+	recorded, err := s.approvals.ApprovalRequests(contract.ID, "")
+	if err != nil {
+		return err
+	}
+	missing := missingApprovals(required, recorded)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var steps, pending, rejected []string
+	for _, request := range missing {
+		steps = append(steps, request.Step)
+		for _, r := range recorded {
+			if r.Step != request.Step || r.ContentHash != request.ContentHash {
+				continue
+			}
+			switch r.Status {
+			case approvalPending:
+				pending = append(pending, strconv.FormatInt(r.ID, 10))
+			case approvalRejected:
+				rejected = append(rejected, fmt.Sprintf("%s in request %d", r.Step, r.ID))
+			}
+		}
+	}
+	msg := fmt.Sprintf("%s cannot become active until it is approved by %s", contract.ID, strings.Join(steps, ", "))
+	if wasActive {
+		msg = fmt.Sprintf("%s is active, so changing it needs approval by %s", contract.ID, strings.Join(steps, ", "))
+	}
+	switch {
+	case len(rejected) > 0:
+		msg += fmt.Sprintf("; it was rejected by %s", strings.Join(rejected, ", "))
+	case len(pending) > 0:
+		msg += fmt.Sprintf("; waiting for approval requests %s", strings.Join(pending, ", "))
+	case wasActive:
+		msg += fmt.Sprintf("; store the change with another status, such as pending, and request approval with: approvals request %s", contract.ID)
+	default:
+		msg += fmt.Sprintf("; request approval with: approvals request %s", contract.ID)
+	}
+	return fmt.Errorf("%w: %s", ErrApprovalRequired, msg)
+}
+
+// loadApprovalGate wraps a store in an ApprovalGate for the approval chains set
+// in it, or returns it unchanged when it has none
+func loadApprovalGate(store ContractStore) (ContractStore, error) {
+	approvals, ok := asApprovalStore(store)
+	if !ok {
+		return store, nil
+	}
+	config, err := approvals.ApprovalConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || len(config.Chains) == 0 {
+		return store, nil
+	}
+	return NewApprovalGate(store, approvals, config), nil
+}
+
+// actorName returns the name of the user an opened store acts for, or the name
+// given with -as or in the environment while the store has no users
+func actorName(store ContractStore) string {
+	if access, ok := unwrapStore[*AccessStore](store); ok {
+		return access.actor.Name
+	}
+	name, _ := configuredActor()
+	return name
+}
+
+// runApprovals implements the approvals command and its subcommands
+func runApprovals(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("approvals requires a subcommand: chains, request or list")
+	}
+	subcommand, args := args[0], args[1:]
+
+	fs := newFlagSet("approvals " + subcommand)
+	var status *string
+	switch subcommand {
+	case "list":
+		status = fs.String("status", "", "Only requests with this status: "+strings.Join(approvalStatuses, ", "))
+	case "chains", "request":
+	default:
+		return fmt.Errorf("unknown approvals subcommand %q: use chains, request or list", subcommand)
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	approvals, ok := asApprovalStore(store)
+	if !ok {
+		return fmt.Errorf("approvals require a SQLite or PostgreSQL store")
+	}
+
+	if subcommand == "chains" {
+		return approvalChains(store, approvals, positional)
+	}
+	if subcommand == "list" {
+		if len(positional) > 1 {
+			return fmt.Errorf("approvals list takes at most one contract ID")
+		}
+		if err := requirePermission(store, permRead); err != nil {
+			return err
+		}
+		contractID := ""
+		if len(positional) == 1 {
+			contractID = positional[0]
+		}
+		requests, err := approvals.ApprovalRequests(contractID, *status)
+		if err != nil {
+			return err
+		}
+		if requests == nil {
+			requests = []ApprovalRequest{}
+		}
+		return printResults(requests, func() {
+			if len(requests) == 0 {
+				fmt.Println("No approval requests")
+				return
+			}
+			writeResults(os.Stdout, outputTable, requests)
+		})
+	}
+
+	// request
+	if len(positional) != 1 {
+		return fmt.Errorf("approvals request requires exactly one contract ID")
+	}
+	if err := requirePermission(store, permStore); err != nil {
+		return err
+	}
+	config, err := approvals.ApprovalConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil || len(config.Chains) == 0 {
+		return fmt.Errorf("the store has no approval chains: set them with approvals chains <file>")
+	}
+	contract, err := store.GetContract(positional[0])
+	if err != nil {
+		return err
+	}
+	required, err := config.Requests(contract)
+	if err != nil {
+		return err
+	}
+	recorded, err := approvals.ApprovalRequests(contract.ID, "")
+	if err != nil {
+		return err
+	}
+	missing := missingApprovals(required, recorded)
+	if len(missing) == 0 {
+		if missing == nil {
+			missing = []*ApprovalRequest{}
+		}
+		return printResults(missing, func() {
+			if len(required) == 0 {
+				fmt.Printf("%s needs no approval\n", contract.ID)
+			} else {
+				fmt.Printf("%s is already approved\n", contract.ID)
+			}
+		})
+	}
+
+	requestedBy := actorName(store)
+	for _, request := range missing {
+		request.RequestedBy = requestedBy
+	}
+	if err := approvals.RequestApprovals(contract.ID, missing); err != nil {
+		return err
+	}
+	return printResults(missing, func() {
+		for _, request := range missing {
+			fmt.Printf("Approval request %d: %s for %s (chain %s)\n", request.ID, request.Step, contract.ID, request.Chain)
+		}
+	})
+}
+
+// approvalChainRow is a step of an approval chain as the approvals chains command lists it
+type approvalChainRow struct {
+	Chain     string   `json:"chain"`
+	ValueOver *float64 `json:"valueOver,omitempty" table:"value over"`
+	Currency  string   `json:"currency,omitempty"`
+	Step      string   `json:"step"`
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// approvalChains lists the approval chains of the store or, given a config file,
+// replaces them, which takes the admin permission
+func approvalChains(store ContractStore, approvals ApprovalStore, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("approvals chains takes at most one approval config file")
+	}
+	if len(args) == 1 {
+		if err := requirePermission(store, permAdmin); err != nil {
+			return err
+		}
+		config, err := LoadApprovalConfig(args[0])
+		if err != nil {
+			return err
+		}
+		if err := approvals.SetApprovalConfig(config); err != nil {
+			return err
+		}
+	} else if err := requirePermission(store, permRead); err != nil {
+		return err
+	}
+
+	config, err := approvals.ApprovalConfig()
+	if err != nil {
+		return err
+	}
+	rows := []approvalChainRow{}
+	if config != nil {
+		for _, chain := range config.Chains {
+			for _, step := range chain.Steps {
+				rows = append(rows, approvalChainRow{Chain: chain.Name, ValueOver: chain.When.ValueOver, Currency: chain.When.Currency, Step: step.Name, Approvers: step.Approvers})
+			}
+		}
+	}
+	return printResults(rows, func() {
+		if len(rows) == 0 {
+			fmt.Println("No approval chains")
+			return
+		}
+		writeResults(os.Stdout, outputTable, rows)
+	})
+}
+
+// runApprove implements the approve command
+func runApprove(args []string) error {
+	return decideApproval(approvalApproved, args)
+}
+
+// runReject implements the reject command
+func runReject(args []string) error {
+	return decideApproval(approvalRejected, args)
+}
+
+// decideApproval approves or rejects the pending approval request given in args
+// for the acting user, provided the contract has not changed since it was requested
+func decideApproval(decision string, args []string) error {
+	cmd := "approve"
+	if decision == approvalRejected {
+		cmd = "reject"
+	}
+	fs := newFlagSet(cmd)
+	comment := fs.String("comment", "", "Comment recorded with the decision")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%s requires exactly one approval request ID", cmd)
+	}
+	id, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid approval request ID %q", positional[0])
+	}
+	if decision == approvalRejected && *comment == "" {
+		return fmt.Errorf("reject requires a -comment giving the reason")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	approvals, ok := asApprovalStore(store)
+	if !ok {
+		return fmt.Errorf("approvals require a SQLite or PostgreSQL store")
+	}
+	if err := requirePermission(store, permApprove); err != nil {
+		return err
+	}
+	approver := actorName(store)
+	if approver == "" {
+		return fmt.Errorf("%s records who decided: act as a user with -as <name> or $%s", cmd, userEnv)
+	}
+
+	request, err := approvals.GetApprovalRequest(id)
+	if err != nil {
+		return err
+	}
+	if request.Status != approvalPending {
+		return fmt.Errorf("approval request %d is %s, not pending", id, request.Status)
+	}
+	if !request.allows(approver) {
+		return fmt.Errorf("%w: the %s step of approval request %d can only be decided by %s", ErrPermissionDenied, request.Step, id, strings.Join(request.Approvers, ", "))
+	}
+	contract, err := store.GetContract(request.ContractID)
+	if err != nil {
+		return err
+	}
+	hash, err := approvalHash(contract)
+	if err != nil {
+		return err
+	}
+	if hash != request.ContentHash {
+		return fmt.Errorf("%s changed after approval request %d was made; request approval again with: approvals request %s", contract.ID, id, contract.ID)
+	}
+
+	request.Status = decision
+	request.DecidedBy = approver
+	request.Comment = *comment
+	if err := approvals.DecideApprovalRequest(request); err != nil {
+		return err
+	}
+	return printResults(request, func() {
+		fmt.Printf("Approval request %d (%s for %s) %s by %s\n", id, request.Step, request.ContractID, decision, approver)
+	})
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testApprovalConfig needs finance and legal for EUR contracts over 50,000, and
+// legal for every contract over 100,000
+var testApprovalConfig = &ApprovalConfig{Chains: []ApprovalChain{
+	{
+		Name:  "large-eur",
+		When:  ApprovalCondition{ValueOver: floatPtr(50000), Currency: "EUR"},
+		Steps: []ApprovalStep{{Name: "finance", Approvers: []string{"fiona"}}, {Name: "legal", Approvers: []string{"lena"}}},
+	},
+	{
+		Name:  "very-large",
+		When:  ApprovalCondition{ValueOver: floatPtr(100000)},
+		Steps: []ApprovalStep{{Name: "legal", Approvers: []string{"larry"}}},
+	},
+}}
+
+// approveAll records the requests as approved
+func approveAll(t *testing.T, store ApprovalStore, requests []*ApprovalRequest) {
+	t.Helper()
+	for _, request := range requests {
+		request.Status = approvalApproved
+		request.DecidedBy = "tester"
+		if err := store.DecideApprovalRequest(request); err != nil {
+			t.Fatalf("Failed to approve request %d: %v", request.ID, err)
+		}
+	}
+}
+
+func TestLoadApprovalConfig(t *testing.T) {
+	t.Run("Repository", func(t *testing.T) {
+		config, err := LoadApprovalConfig("approvals.json")
+		if err != nil {
+			t.Fatalf("Failed to load approval config: %v", err)
+		}
+		if len(config.Chains) == 0 {
+			t.Errorf("Expected approval chains")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"NoName", `{"chains":[{"steps":[{"name":"legal"}]}]}`, "chain name is required"},
+		{"NoSteps", `{"chains":[{"name":"a"}]}`, "chain a: at least one step is required"},
+		{"UnnamedStep", `{"chains":[{"name":"a","steps":[{}]}]}`, "chain a, step 1: step name is required"},
+		{"RepeatedStep", `{"chains":[{"name":"a","steps":[{"name":"legal"},{"name":"legal"}]}]}`, "step legal appears more than once"},
+		{"RepeatedChain", `{"chains":[{"name":"a","steps":[{"name":"legal"}]},{"name":"a","steps":[{"name":"legal"}]}]}`, "chain a appears more than once"},
+		{"Currency", `{"chains":[{"name":"a","when":{"currency":"euro"},"steps":[{"name":"legal"}]}]}`, "invalid currency code: euro"},
+		{"NegativeValue", `{"chains":[{"name":"a","when":{"valueOver":-1},"steps":[{"name":"legal"}]}]}`, "valueOver cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "approvals.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			if _, err := LoadApprovalConfig(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestApprovalConfigRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *Contract)
+		expected []string
+	}{
+		{"Small", func(c *Contract) { c.Terms.Value = 50000 }, nil},
+		{"LargeEUR", func(c *Contract) { c.Terms.Value = 60000 }, []string{"large-eur/finance[fiona]", "large-eur/legal[lena]"}},
+		{
+			name: "AmendedOverLimit",
+			change: func(c *Contract) {
+				c.Terms.Value = 40000
+				c.Amendments = []Amendment{{EffectiveDate: "2024-06-01", Description: "Scope increase", Changes: AmendmentChanges{Value: floatPtr(60000)}}}
+			},
+			expected: []string{"large-eur/finance[fiona]", "large-eur/legal[lena]"},
+		},
+		{"OtherCurrency", func(c *Contract) { c.Terms.Value, c.Terms.Currency = 60000, "USD" }, nil},
+		{"BothChains", func(c *Contract) { c.Terms.Value = 150000 }, []string{"large-eur/finance[fiona]", "large-eur,very-large/legal[larry lena]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := newTestContract("TEST-001", "pending")
+			contract.Amendments = nil
+			contract.Terms.Currency = "EUR"
+			tt.change(contract)
+
+			requests, err := testApprovalConfig.Requests(contract)
+			if err != nil {
+				t.Fatalf("Failed to get required approvals: %v", err)
+			}
+			var steps []string
+			for _, request := range requests {
+				steps = append(steps, request.Chain+"/"+request.Step+"["+strings.Join(request.Approvers, " ")+"]")
+				if request.ContractID != contract.ID || request.Status != approvalPending || request.ContentHash == "" {
+					t.Errorf("Unexpected request %+v", request)
+				}
+			}
+			if strings.Join(steps, ";") != strings.Join(tt.expected, ";") {
+				t.Errorf("Expected steps %v, got %v", tt.expected, steps)
+			}
+		})
+	}
+
+	t.Run("ApprovalHash", func(t *testing.T) {
+		contract := newTestContract("TEST-001", "pending")
+		contract.Amendments = nil
+		contract.Terms.Value, contract.Terms.Currency = 60000, "EUR"
+		hash, _ := approvalHash(contract)
+		contract.Status = activeStatus
+		contract.Signatures = []Signature{{Party: "Test Client"}}
+		if signed, _ := approvalHash(contract); signed != hash {
+			t.Errorf("Expected the status and signatures not to change the approval hash")
+		}
+		contract.Terms.Value = 70000
+		if changed, _ := approvalHash(contract); changed == hash {
+			t.Errorf("Expected a change of value to change the approval hash")
+		}
+	})
+}
+
+// testApprovalStore runs the approval store tests against an empty database
+func testApprovalStore(t *testing.T, db *DB) {
+	contract := newTestContract("TEST-001", "pending")
+	contract.Amendments = nil
+	contract.Terms.Value, contract.Terms.Currency = 60000, "EUR"
+	first, err := testApprovalConfig.Requests(contract)
+	if err != nil {
+		t.Fatalf("Failed to get required approvals: %v", err)
+	}
+	first[0].RequestedBy = "ed"
+	if err := db.RequestApprovals("TEST-001", first); err != nil {
+		t.Fatalf("Failed to request approvals: %v", err)
+	}
+	if first[0].ID == 0 || first[1].ID == first[0].ID || first[0].CreatedAt.IsZero() {
+		t.Errorf("Expected IDs and creation times, got %+v", first)
+	}
+
+	request, err := db.GetApprovalRequest(first[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get approval request: %v", err)
+	}
+	if request.Step != "finance" || request.Chain != "large-eur" || request.RequestedBy != "ed" || request.ContentHash != first[0].ContentHash ||
+		strings.Join(request.Approvers, ",") != "fiona" || request.Status != approvalPending || request.DecidedAt != nil {
+		t.Errorf("Unexpected approval request %+v", request)
+	}
+	if _, err := db.GetApprovalRequest(999); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("Expected ErrApprovalNotFound, got %v", err)
+	}
+
+	request.Status = approvalApproved
+	request.DecidedBy = "fiona"
+	request.Comment = "Budget confirmed"
+	if err := db.DecideApprovalRequest(request); err != nil {
+		t.Fatalf("Failed to decide approval request: %v", err)
+	}
+	if request.DecidedAt == nil {
+		t.Errorf("Expected a decision time")
+	}
+	if err := db.DecideApprovalRequest(request); err == nil || !strings.Contains(err.Error(), "no longer pending") {
+		t.Errorf("Expected a decided request to stay decided, got %v", err)
+	}
+	if decided, err := db.GetApprovalRequest(request.ID); err != nil || decided.DecidedBy != "fiona" || decided.Comment != "Budget confirmed" || decided.DecidedAt == nil {
+		t.Errorf("Expected the decision to be recorded, got %+v: %v", decided, err)
+	}
+
+	// Requesting again supersedes the pending legal request but keeps the decided one
+	second, _ := testApprovalConfig.Requests(contract)
+	if err := db.RequestApprovals("TEST-001", second[1:]); err != nil {
+		t.Fatalf("Failed to request approvals: %v", err)
+	}
+	requests, err := db.ApprovalRequests("TEST-001", "")
+	if err != nil {
+		t.Fatalf("Failed to list approval requests: %v", err)
+	}
+	var statuses []string
+	for _, r := range requests {
+		statuses = append(statuses, r.Step+":"+r.Status)
+	}
+	if strings.Join(statuses, ",") != "finance:approved,legal:superseded,legal:pending" {
+		t.Errorf("Unexpected approval requests %v", statuses)
+	}
+
+	if pending, err := db.ApprovalRequests("", approvalPending); err != nil || len(pending) != 1 || pending[0].ID != second[1].ID {
+		t.Errorf("Expected one pending request, got %+v: %v", pending, err)
+	}
+	if other, err := db.ApprovalRequests("TEST-002", ""); err != nil || len(other) != 0 {
+		t.Errorf("Expected no requests for another contract, got %+v: %v", other, err)
+	}
+
+	if config, err := db.ApprovalConfig(); err != nil || config != nil {
+		t.Errorf("Expected no approval chains before they are set, got %+v: %v", config, err)
+	}
+	if err := db.SetApprovalConfig(&ApprovalConfig{Chains: []ApprovalChain{{Name: "a"}}}); err == nil || !strings.Contains(err.Error(), "at least one step") {
+		t.Errorf("Expected an invalid config to be refused, got %v", err)
+	}
+	for _, config := range []*ApprovalConfig{{Chains: testApprovalConfig.Chains[:1]}, testApprovalConfig} {
+		if err := db.SetApprovalConfig(config); err != nil {
+			t.Fatalf("Failed to set approval config: %v", err)
+		}
+	}
+	config, err := db.ApprovalConfig()
+	if err != nil || len(config.Chains) != 2 || *config.Chains[1].When.ValueOver != 100000 || config.Chains[0].Steps[1].Approvers[0] != "lena" {
+		t.Errorf("Expected the last config to be kept, got %+v: %v", config, err)
+	}
+
+	useTenant(t, db, "acme")
+	if config, err := db.ApprovalConfig(); err != nil || config != nil {
+		t.Errorf("Expected no approval chains in another tenant, got %+v: %v", config, err)
+	}
+	if other, err := db.ApprovalRequests("", ""); err != nil || len(other) != 0 {
+		t.Errorf("Expected no requests in another tenant, got %+v: %v", other, err)
+	}
+	if _, err := db.GetApprovalRequest(request.ID); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("Expected requests of another tenant to be hidden, got %v", err)
+	}
+	useTenant(t, db, defaultTenant)
+}
+
+func TestSQLiteApprovals(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testApprovalStore(t, db)
+}
+
+func TestApprovalGate(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	gate := NewApprovalGate(db, db, testApprovalConfig)
+
+	activate := func(contract *Contract) error {
+		active := *contract
+		active.Status = activeStatus
+		return gate.StoreContract(&active)
+	}
+
+	contract := newTestContract("TEST-001", "pending")
+	contract.Amendments = nil
+	contract.Terms.Value, contract.Terms.Currency = 60000, "EUR"
+	if err := gate.StoreContract(contract); err != nil {
+		t.Fatalf("Expected a pending contract to be stored, got %v", err)
+	}
+
+	t.Run("NotRequested", func(t *testing.T) {
+		err := activate(contract)
+		if !errors.Is(err, ErrApprovalRequired) || !strings.Contains(err.Error(), "approved by finance, legal; request approval with: approvals request TEST-001") {
+			t.Errorf("Expected activation to need approval, got %v", err)
+		}
+		if stored, _ := db.GetContract(contract.ID); stored.Status != "pending" {
+			t.Errorf("Expected the contract to stay pending, got %s", stored.Status)
+		}
+	})
+
+	requests, _ := testApprovalConfig.Requests(contract)
+	if err := db.RequestApprovals(contract.ID, requests); err != nil {
+		t.Fatalf("Failed to request approvals: %v", err)
+	}
+
+	t.Run("PartlyApproved", func(t *testing.T) {
+		approveAll(t, db, requests[:1])
+		err := activate(contract)
+		if !errors.Is(err, ErrApprovalRequired) || !strings.Contains(err.Error(), "approved by legal; waiting for approval requests 2") {
+			t.Errorf("Expected activation to wait for legal, got %v", err)
+		}
+	})
+
+	t.Run("ChangedAfterApproval", func(t *testing.T) {
+		approveAll(t, db, requests[1:])
+		changed := *contract
+		changed.Terms.Value = 65000
+		if err := activate(&changed); !errors.Is(err, ErrApprovalRequired) {
+			t.Errorf("Expected approvals of other content not to count, got %v", err)
+		}
+	})
+
+	t.Run("Approved", func(t *testing.T) {
+		if err := activate(contract); err != nil {
+			t.Errorf("Expected the approved contract to become active, got %v", err)
+		}
+		// Signing an active contract keeps its approvals
+		active, _ := db.GetContract(contract.ID)
+		active.Signatures = []Signature{{Party: "Test Client"}}
+		if err := gate.StoreContract(active); err != nil {
+			t.Errorf("Expected a signed active contract to be stored, got %v", err)
+		}
+	})
+
+	t.Run("ActiveChanged", func(t *testing.T) {
+		active, _ := db.GetContract(contract.ID)
+		active.Title = "Renamed"
+		err := gate.StoreContract(active)
+		if !errors.Is(err, ErrApprovalRequired) || !strings.Contains(err.Error(), "TEST-001 is active, so changing it needs approval by finance, legal; store the change with another status") {
+			t.Errorf("Expected a change of an active contract to need approval, got %v", err)
+		}
+
+		// The change is approved while the contract is pending
+		active.Status = "pending"
+		if err := gate.StoreContract(active); err != nil {
+			t.Fatalf("Failed to store the change as pending: %v", err)
+		}
+		requests, _ := testApprovalConfig.Requests(active)
+		db.RequestApprovals(active.ID, requests)
+		approveAll(t, db, requests)
+		if err := activate(active); err != nil {
+			t.Errorf("Expected the approved change to become active, got %v", err)
+		}
+	})
+
+	t.Run("ActiveRaisedOverLimit", func(t *testing.T) {
+		small := newTestContract("TEST-004", activeStatus)
+		small.Amendments = nil
+		small.Terms.Value, small.Terms.Currency = 1000, "EUR"
+		if err := gate.StoreContract(small); err != nil {
+			t.Fatalf("Expected a small contract to become active, got %v", err)
+		}
+		small.Terms.Value = 90000
+		if err := gate.StoreContract(small); !errors.Is(err, ErrApprovalRequired) {
+			t.Errorf("Expected raising an active contract over the limit to need approval, got %v", err)
+		}
+		if stored, _ := db.GetContract(small.ID); stored.Terms.Value != 1000 {
+			t.Errorf("Expected the stored value to stay 1000, got %v", stored.Terms.Value)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		rejected := newTestContract("TEST-002", "pending")
+		rejected.Amendments = nil
+		rejected.Terms.Value, rejected.Terms.Currency = 60000, "EUR"
+		if err := gate.StoreContract(rejected); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		requests, _ := testApprovalConfig.Requests(rejected)
+		db.RequestApprovals(rejected.ID, requests)
+		requests[1].Status = approvalRejected
+		db.DecideApprovalRequest(requests[1])
+		err := activate(rejected)
+		if !errors.Is(err, ErrApprovalRequired) || !strings.Contains(err.Error(), fmt.Sprintf("it was rejected by legal in request %d", requests[1].ID)) {
+			t.Errorf("Expected activation to report the rejection, got %v", err)
+		}
+	})
+
+	t.Run("ActiveInOtherCase", func(t *testing.T) {
+		for _, status := range []string{"Active", "ACTIVE"} {
+			contract := newTestContract("TEST-005", status)
+			contract.Amendments = nil
+			contract.Terms.Value, contract.Terms.Currency = 60000, "EUR"
+			if err := gate.StoreContract(contract); !errors.Is(err, ErrApprovalRequired) {
+				t.Errorf("Expected status %s to need approval, got %v", status, err)
+			}
+		}
+		if _, err := db.GetContract("TEST-005"); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected the unapproved contract not to be stored, got %v", err)
+		}
+	})
+
+	t.Run("NoChainMatches", func(t *testing.T) {
+		small := newTestContract("TEST-003", activeStatus)
+		small.Amendments = nil
+		small.Terms.Value, small.Terms.Currency = 1000, "EUR"
+		if err := gate.StoreContract(small); err != nil {
+			t.Errorf("Expected a contract without approval chains to become active, got %v", err)
+		}
+	})
+}
+
+func TestLoadApprovalGate(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if store, err := loadApprovalGate(db); err != nil || store != ContractStore(db) {
+		t.Errorf("Expected a store without approval chains to stay unwrapped, got %T: %v", store, err)
+	}
+	if err := db.SetApprovalConfig(testApprovalConfig); err != nil {
+		t.Fatalf("Failed to set approval config: %v", err)
+	}
+	store, err := loadApprovalGate(db)
+	if err != nil {
+		t.Fatalf("Failed to load approval gate: %v", err)
+	}
+	large := newTestContract("TEST-001", activeStatus)
+	large.Amendments = nil
+	large.Terms.Value, large.Terms.Currency = 60000, "EUR"
+	if err := store.StoreContract(large); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected the chains of the store to be enforced, got %v", err)
+	}
+	if store, err := loadApprovalGate(NewMemoryStore()); err != nil || store == nil {
+		t.Errorf("Expected a store without approvals to be returned as is, got %v", err)
+	}
+}
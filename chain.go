@@ -0,0 +1,501 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chainLink holds the columns of a contract revision that its record hash covers.
+// Every revision is linked to the previous revision of the same contract and to
+// the previous revision of any contract of any tenant, so that changing, removing
+// or inserting a row breaks both chains from that row on.
+type chainLink struct {
+	Seq          int64
+	Tenant       string
+	ContractID   string
+	Version      int
+	ContentHash  string
+	StoredAt     time.Time
+	ContractPrev string
+	ChainPrev    string
+}
+
+// recordHash returns the hex encoded SHA-256 hash of the link
+func (l chainLink) recordHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%d\n%s\n%s\n%s\n%s", l.Seq, l.ContractID, l.Version,
+		l.ContentHash, l.StoredAt.UTC().Format(time.RFC3339Nano), l.ContractPrev, l.ChainPrev) + tenantSuffix(l.Tenant)))
+	return hex.EncodeToString(sum[:])
+}
+
+// deletedContentHash is the content hash of the revision that records the deletion
+// of a contract. Such a tombstone has no content.
+const deletedContentHash = "deleted"
+
+// nextChainLink returns the link of a new revision of a contract with the given
+// content hash, following the latest revision of the contract and the latest
+// revision of any contract, together with the content hash of the latest revision
+// of the contract, which is empty when it has none
+func nextChainLink(tx *sql.Tx, d dialect, tenant, contractID, contentHash string) (chainLink, string, error) {
+	var version int
+	var latestHash, contractPrev string
+	query := `
+	SELECT version, content_hash, record_hash
+	FROM contract_revisions
+	WHERE tenant = ? AND contract_id = ?
+	ORDER BY version DESC
+	LIMIT 1;`
+	err := tx.QueryRow(d.rebind(query), tenant, contractID).Scan(&version, &latestHash, &contractPrev)
+	if err != nil && err != sql.ErrNoRows {
+		return chainLink{}, "", fmt.Errorf("error reading contract revisions: %v", err)
+	}
+
+	// Link the revision to the latest revision of any contract. The unique index on
+	// seq makes a concurrent writer that read the same head fail instead of forking the chain.
+	var seq int64
+	var chainPrev string
+	err = tx.QueryRow(`SELECT seq, record_hash FROM contract_revisions ORDER BY seq DESC LIMIT 1;`).Scan(&seq, &chainPrev)
+	if err != nil && err != sql.ErrNoRows {
+		return chainLink{}, "", fmt.Errorf("error reading contract revisions: %v", err)
+	}
+	link := chainLink{
+		Seq:         seq + 1,
+		Tenant:      tenant,
+		ContractID:  contractID,
+		Version:     version + 1,
+		ContentHash: contentHash,
+		// PostgreSQL stores timestamps with microsecond precision
+		StoredAt:     time.Now().UTC().Truncate(time.Microsecond),
+		ContractPrev: contractPrev,
+		ChainPrev:    chainPrev,
+	}
+	return link, latestHash, nil
+}
+
+// insertRevision stores a revision with its link and the contract_json column data
+func insertRevision(tx *sql.Tx, d dialect, link chainLink, data string) error {
+	insert := `
+	INSERT INTO contract_revisions (tenant, contract_id, version, contract_json, content_hash, created_at, seq, contract_prev_hash, chain_prev_hash, record_hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := tx.Exec(d.rebind(insert), link.Tenant, link.ContractID, link.Version, data, link.ContentHash, link.StoredAt,
+		link.Seq, link.ContractPrev, link.ChainPrev, link.recordHash())
+	if err != nil {
+		return fmt.Errorf("error recording contract revision: %v", err)
+	}
+	return nil
+}
+
+// recordDeletion appends a tombstone for a deleted contract to the chain, so that
+// verification can tell it from a contract removed outside the store. Tombstones
+// hold no contract data, so they are not encrypted.
+func recordDeletion(tx *sql.Tx, d dialect, tenant, contractID string) error {
+	link, latestHash, err := nextChainLink(tx, d, tenant, contractID, deletedContentHash)
+	if err != nil {
+		return err
+	}
+	if latestHash == "" || latestHash == deletedContentHash {
+		return nil
+	}
+	return insertRevision(tx, d, link, "null")
+}
+
+// recordEarlierDeletions records tombstones for the contracts deleted before
+// deletions were chained: those whose latest revision has no contract row. Like
+// linkExistingRevisions, it trusts the database as it is when migrated.
+func recordEarlierDeletions(tx *sql.Tx, d dialect) error {
+	rows, err := tx.Query(`
+	SELECT DISTINCT tenant, contract_id
+	FROM contract_revisions r
+	WHERE NOT EXISTS (SELECT 1 FROM contracts c WHERE c.tenant = r.tenant AND c.id = r.contract_id)
+	ORDER BY tenant, contract_id;`)
+	if err != nil {
+		return fmt.Errorf("error querying deleted contracts: %v", err)
+	}
+	var deleted [][2]string
+	for rows.Next() {
+		var id [2]string
+		if err := rows.Scan(&id[0], &id[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning deleted contract: %v", err)
+		}
+		deleted = append(deleted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating deleted contracts: %v", err)
+	}
+
+	for _, id := range deleted {
+		if err := recordDeletion(tx, d, id[0], id[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkExistingRevisions starts the hash chain when migrating a database: it records
+// a first revision for every contract that has none, then links all revisions in
+// the order they were stored. Databases are only encrypted after this migration,
+// so the contracts are read without a key.
+func linkExistingRevisions(tx *sql.Tx, d dialect) error {
+	rows, err := tx.Query(`
+	SELECT ` + contractColumns + `
+	FROM contracts
+	WHERE id NOT IN (SELECT contract_id FROM contract_revisions)
+	ORDER BY id;`)
+	if err != nil {
+		return fmt.Errorf("error querying contracts without revisions: %v", err)
+	}
+	var unrevised []*Contract
+	for rows.Next() {
+		contract, err := scanContract(rows, nil, defaultTenant)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning contract: %v", err)
+		}
+		unrevised = append(unrevised, contract)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating contracts: %v", err)
+	}
+
+	insert := d.rebind(`
+	INSERT INTO contract_revisions (contract_id, version, contract_json, content_hash, created_at)
+	VALUES (?, 1, ?, ?, ?);`)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, contract := range unrevised {
+		data, err := json.Marshal(contract)
+		if err != nil {
+			return fmt.Errorf("error marshaling contract: %v", err)
+		}
+		hash, err := contract.ContentHash()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(insert, contract.ID, string(data), hash, now); err != nil {
+			return fmt.Errorf("error recording contract revision: %v", err)
+		}
+	}
+
+	rows, err = tx.Query(`
+	SELECT contract_id, version, content_hash, created_at
+	FROM contract_revisions
+	ORDER BY created_at, contract_id, version;`)
+	if err != nil {
+		return fmt.Errorf("error querying contract revisions: %v", err)
+	}
+	var links []chainLink
+	for rows.Next() {
+		link := chainLink{Tenant: defaultTenant}
+		if err := rows.Scan(&link.ContractID, &link.Version, &link.ContentHash, &link.StoredAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning contract revision: %v", err)
+		}
+		links = append(links, link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating contract revisions: %v", err)
+	}
+
+	update := d.rebind(`
+	UPDATE contract_revisions
+	SET seq = ?, contract_prev_hash = ?, chain_prev_hash = ?, record_hash = ?
+	WHERE contract_id = ? AND version = ?;`)
+	latest := make(map[string]string)
+	chainPrev := ""
+	for i, link := range links {
+		link.Seq = int64(i + 1)
+		link.ContractPrev = latest[link.ContractID]
+		link.ChainPrev = chainPrev
+		hash := link.recordHash()
+		if _, err := tx.Exec(update, link.Seq, link.ContractPrev, link.ChainPrev, hash, link.ContractID, link.Version); err != nil {
+			return fmt.Errorf("error linking contract revision: %v", err)
+		}
+		latest[link.ContractID] = hash
+		chainPrev = hash
+	}
+
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS contract_revisions_seq ON contract_revisions (seq);`); err != nil {
+		return fmt.Errorf("error creating index: %v", err)
+	}
+	return nil
+}
+
+// IntegrityProblem is a stored row whose content or links no longer match
+type IntegrityProblem struct {
+	Table      string `json:"table"`
+	Tenant     string `json:"tenant"`
+	ContractID string `json:"contractId" table:"contract"`
+	Version    int    `json:"version,omitempty"`
+	Seq        int64  `json:"seq,omitempty"`
+	Problem    string `json:"problem"`
+}
+
+// ChainReport is the result of verifying the hash chain of a database
+type ChainReport struct {
+	Revisions int `json:"revisions"`
+	Contracts int `json:"contracts"`
+	// HeadSeq and HeadHash identify the latest revision. Recording them elsewhere
+	// allows a later check that no revisions were removed from the end.
+	HeadSeq  int64              `json:"headSeq"`
+	HeadHash string             `json:"headHash"`
+	Problems []IntegrityProblem `json:"problems"`
+
+	// hashes holds the record hash of every revision by sequence number
+	hashes map[int64]string
+}
+
+// Head returns the chain head in the form verify-db -head accepts
+func (r *ChainReport) Head() string {
+	return fmt.Sprintf("%d:%s", r.HeadSeq, r.HeadHash)
+}
+
+// checkHead reports a problem unless the chain contains the head of an earlier verification
+func (r *ChainReport) checkHead(head string) error {
+	seqText, hash, ok := strings.Cut(head, ":")
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if !ok || err != nil || seq < 1 || hash == "" {
+		return fmt.Errorf("invalid chain head %q: expected <seq>:<hash> as printed by verify-db", head)
+	}
+	switch stored, found := r.hashes[seq]; {
+	case !found:
+		r.Problems = append(r.Problems, IntegrityProblem{Table: "contract_revisions", Seq: seq, Problem: "revision of the expected chain head is missing"})
+	case stored != hash:
+		r.Problems = append(r.Problems, IntegrityProblem{Table: "contract_revisions", Seq: seq, Problem: "revision does not match the expected chain head"})
+	}
+	return nil
+}
+
+// ChainVerifier is implemented by stores that link their revisions in a hash chain
+type ChainVerifier interface {
+	VerifyChain() (*ChainReport, error)
+}
+
+var _ ChainVerifier = (*DB)(nil)
+
+// VerifyChain walks the revisions of every tenant in the order they were stored and
+// reports every revision whose content no longer matches its hash or whose links
+// are broken, and every contract that does not match its latest revision
+func (db *DB) VerifyChain() (*ChainReport, error) {
+	rows, err := db.Query(`
+	SELECT seq, tenant, contract_id, version, contract_json, content_hash, created_at, contract_prev_hash, chain_prev_hash, record_hash
+	FROM contract_revisions
+	ORDER BY seq, contract_id, version;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contract revisions: %v", err)
+	}
+	defer rows.Close()
+
+	report := &ChainReport{hashes: make(map[int64]string)}
+	type contractState struct {
+		version     int
+		recordHash  string
+		contentHash string
+	}
+	// contracts holds the state of each contract by tenant and ID
+	contracts := make(map[[2]string]*contractState)
+	var chainPrev string
+	var expectedSeq int64 = 1
+
+	for rows.Next() {
+		var link chainLink
+		var data, recordHash string
+		err := rows.Scan(&link.Seq, &link.Tenant, &link.ContractID, &link.Version, &data, &link.ContentHash, &link.StoredAt,
+			&link.ContractPrev, &link.ChainPrev, &recordHash)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning contract revision: %v", err)
+		}
+		report.Revisions++
+		problem := func(format string, args ...any) {
+			report.Problems = append(report.Problems, IntegrityProblem{
+				Table:      "contract_revisions",
+				Tenant:     link.Tenant,
+				ContractID: link.ContractID,
+				Version:    link.Version,
+				Seq:        link.Seq,
+				Problem:    fmt.Sprintf(format, args...),
+			})
+		}
+
+		var contract Contract
+		if link.ContentHash == deletedContentHash {
+			if data != "null" {
+				problem("deletion record holds content")
+			}
+		} else if plaintext, err := openValue(db.key, data, revisionAAD(link.Tenant, link.ContractID, link.Version)); err != nil {
+			problem("content cannot be decrypted: %v", err)
+		} else if err := json.Unmarshal(plaintext, &contract); err != nil {
+			problem("content is not a valid contract: %v", err)
+		} else if hash, err := contract.ContentHash(); err != nil || hash != link.ContentHash {
+			problem("content does not match its content hash")
+		} else if contract.ID != link.ContractID {
+			problem("content belongs to contract %s", contract.ID)
+		}
+
+		if link.Seq != expectedSeq {
+			if link.Seq > expectedSeq {
+				problem("revisions %d to %d are missing from the chain", expectedSeq, link.Seq-1)
+			} else {
+				problem("sequence number is used more than once")
+			}
+		}
+		if link.ChainPrev != chainPrev {
+			problem("link to the previous revision in the chain is broken")
+		}
+
+		state := contracts[[2]string{link.Tenant, link.ContractID}]
+		if state == nil {
+			state = &contractState{}
+			contracts[[2]string{link.Tenant, link.ContractID}] = state
+		}
+		if link.Version != state.version+1 {
+			problem("follows version %d of the contract", state.version)
+		}
+		if link.ContractPrev != state.recordHash {
+			problem("link to the previous version of the contract is broken")
+		}
+		if recordHash != link.recordHash() {
+			problem("record hash does not match the revision")
+		}
+
+		// Continue from the stored hashes, so that a changed row is reported once
+		// rather than breaking every row after it
+		chainPrev = recordHash
+		expectedSeq = link.Seq + 1
+		*state = contractState{version: link.Version, recordHash: recordHash, contentHash: link.ContentHash}
+		report.hashes[link.Seq] = recordHash
+		report.HeadSeq, report.HeadHash = link.Seq, recordHash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contract revisions: %v", err)
+	}
+	rows.Close()
+
+	// Contracts are read one by one, so that one that cannot be read is reported
+	// rather than failing the verification
+	idRows, err := db.Query(`SELECT tenant, id FROM contracts ORDER BY tenant, id;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contracts: %v", err)
+	}
+	defer idRows.Close()
+	var ids [][2]string
+	for idRows.Next() {
+		var id [2]string
+		if err := idRows.Scan(&id[0], &id[1]); err != nil {
+			return nil, fmt.Errorf("error scanning contract: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := idRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contracts: %v", err)
+	}
+	idRows.Close()
+
+	report.Contracts = len(ids)
+	stored := make(map[[2]string]bool)
+	for _, id := range ids {
+		stored[id] = true
+		problem := func(text string) {
+			report.Problems = append(report.Problems, IntegrityProblem{Table: "contracts", Tenant: id[0], ContractID: id[1], Problem: text})
+		}
+		contract, err := db.tenantContract(id[0], id[1])
+		if err != nil {
+			problem(fmt.Sprintf("contract cannot be read: %v", err))
+			continue
+		}
+		state := contracts[id]
+		if state == nil {
+			problem("contract has no revisions in the chain")
+			continue
+		}
+		if state.contentHash == deletedContentHash {
+			problem(fmt.Sprintf("contract is stored although version %d records its deletion", state.version))
+			continue
+		}
+		if hash, err := contract.ContentHash(); err != nil || hash != state.contentHash {
+			problem(fmt.Sprintf("contract does not match its latest revision, version %d", state.version))
+		}
+	}
+
+	// A contract whose latest revision is not a deletion record must still be stored
+	var missing [][2]string
+	for id, state := range contracts {
+		if !stored[id] && state.contentHash != deletedContentHash {
+			missing = append(missing, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i][0] < missing[j][0] || (missing[i][0] == missing[j][0] && missing[i][1] < missing[j][1])
+	})
+	for _, id := range missing {
+		report.Problems = append(report.Problems, IntegrityProblem{Table: "contracts", Tenant: id[0], ContractID: id[1],
+			Problem: fmt.Sprintf("contract is missing, but the chain does not record its deletion after version %d", contracts[id].version)})
+	}
+	return report, nil
+}
+
+// runVerifyDB implements the verify-db command
+func runVerifyDB(args []string) error {
+	fs := newFlagSet("verify-db")
+	head := fs.String("head", "", "Also check that the chain still contains this head of an earlier run, given as <seq>:<hash>")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("verify-db takes no arguments")
+	}
+
+	store, err := openBareStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := requireOperator(store, "verify-db"); err != nil {
+		return err
+	}
+	verifier, ok := unwrapStore[ChainVerifier](store)
+	if !ok {
+		return fmt.Errorf("verify-db requires a SQLite or PostgreSQL store")
+	}
+
+	report, err := verifier.VerifyChain()
+	if err != nil {
+		return err
+	}
+	if *head != "" {
+		if err := report.checkHead(*head); err != nil {
+			return err
+		}
+	}
+	if report.Problems == nil {
+		report.Problems = []IntegrityProblem{}
+	}
+
+	err = printResults(report, func() {
+		if len(report.Problems) > 0 {
+			writeResults(os.Stdout, outputTable, report.Problems)
+			fmt.Println()
+		}
+		fmt.Printf("Verified %d revisions of %d contracts\n", report.Revisions, report.Contracts)
+		if report.HeadSeq > 0 {
+			fmt.Printf("Chain head: %s\n", report.Head())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("%d integrity problem(s) found", len(report.Problems))
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// seedChain stores three contracts, one of them in two versions
+func seedChain(t *testing.T, db *DB) {
+	t.Helper()
+	contracts := []*Contract{
+		{ID: "CHAIN-A", Title: "First", Status: "draft"},
+		{ID: "CHAIN-B", Title: "Second", Status: "active"},
+		{ID: "CHAIN-A", Title: "First", Status: "active"},
+		{ID: "CHAIN-C", Title: "Third", Status: "active"},
+	}
+	for _, contract := range contracts {
+		if err := db.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+	}
+}
+
+// verifyChain verifies the chain of the database and returns its problems as
+// "table contract version: problem" lines
+func verifyChain(t *testing.T, db *DB) (*ChainReport, string) {
+	t.Helper()
+	report, err := db.VerifyChain()
+	if err != nil {
+		t.Fatalf("Failed to verify chain: %v", err)
+	}
+	return report, problemLines(report)
+}
+
+// problemLines formats the problems of a report one per line
+func problemLines(report *ChainReport) string {
+	var lines []string
+	for _, p := range report.Problems {
+		where := []string{p.Table}
+		if p.ContractID != "" {
+			where = append(where, p.ContractID)
+		}
+		if p.Version != 0 {
+			where = append(where, strconv.Itoa(p.Version))
+		}
+		lines = append(lines, strings.Join(where, " ")+": "+p.Problem)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// exec runs a statement with ? placeholders against the database or fails the test
+func exec(t *testing.T, db *DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.Exec(db.dialect.rebind(query), args...); err != nil {
+		t.Fatalf("Failed to run %q: %v", query, err)
+	}
+}
+
+// testHashChain checks that verification detects rows changed outside the store.
+// open must return an empty database for every call.
+func testHashChain(t *testing.T, open func(t *testing.T) *DB) {
+	t.Run("Intact", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+
+		report, problems := verifyChain(t, db)
+		if problems != "" {
+			t.Errorf("Expected no problems, got:\n%s", problems)
+		}
+		if report.Revisions != 4 || report.Contracts != 3 || report.HeadSeq != 4 || len(report.HeadHash) != 64 {
+			t.Errorf("Unexpected report %+v", report)
+		}
+		if err := report.checkHead(report.Head()); err != nil || len(report.Problems) != 0 {
+			t.Errorf("Expected the current head to be found, got %v %+v", err, report.Problems)
+		}
+
+		// Storing the same content again does not extend the chain
+		if err := db.StoreContract(&Contract{ID: "CHAIN-C", Title: "Third", Status: "active"}); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		if again, _ := verifyChain(t, db); again.HeadSeq != 4 || again.HeadHash != report.HeadHash {
+			t.Errorf("Expected the head to stay at %s, got %s", report.Head(), again.Head())
+		}
+	})
+
+	t.Run("EmptyDatabase", func(t *testing.T) {
+		report, problems := verifyChain(t, open(t))
+		if problems != "" || report.Revisions != 0 || report.HeadSeq != 0 {
+			t.Errorf("Unexpected report %+v", report)
+		}
+	})
+
+	t.Run("ChangedRevisionContent", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		exec(t, db, `UPDATE contract_revisions SET contract_json = ? WHERE contract_id = ? AND version = ?;`,
+			`{"id":"CHAIN-A","title":"Forged","status":"draft"}`, "CHAIN-A", 1)
+
+		if _, problems := verifyChain(t, db); problems != "contract_revisions CHAIN-A 1: content does not match its content hash" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("ChangedRevisionAndHash", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		forged := &Contract{ID: "CHAIN-A", Title: "Forged", Status: "draft"}
+		data, _ := json.Marshal(forged)
+		hash, _ := forged.ContentHash()
+		exec(t, db, `UPDATE contract_revisions SET contract_json = ?, content_hash = ? WHERE contract_id = ? AND version = ?;`,
+			string(data), hash, "CHAIN-A", 1)
+
+		if _, problems := verifyChain(t, db); problems != "contract_revisions CHAIN-A 1: record hash does not match the revision" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("ChangedContract", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		exec(t, db, `UPDATE contracts SET title = ? WHERE id = ?;`, "Forged", "CHAIN-B")
+
+		if _, problems := verifyChain(t, db); problems != "contracts CHAIN-B: contract does not match its latest revision, version 1" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("InsertedContract", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		exec(t, db, `INSERT INTO contracts (id, title, status, parties_json, terms_json) VALUES (?, ?, ?, ?, ?);`,
+			"CHAIN-X", "Inserted", "active", "[]", "{}")
+
+		if _, problems := verifyChain(t, db); problems != "contracts CHAIN-X: contract has no revisions in the chain" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("DeletedContract", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		if err := db.DeleteContract("CHAIN-B"); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+		report, problems := verifyChain(t, db)
+		if problems != "" || report.Revisions != 5 || report.Contracts != 2 {
+			t.Errorf("Expected the deletion to be chained, got %+v:\n%s", report, problems)
+		}
+		if _, err := db.GetContractVersion("CHAIN-B", 2); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected the deletion record not to read as a contract, got %v", err)
+		}
+
+		// Storing the contract again continues its versions
+		if err := db.StoreContract(&Contract{ID: "CHAIN-B", Title: "Second", Status: "active"}); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		if revisions, err := db.ContractRevisions("CHAIN-B"); err != nil || len(revisions) != 3 || revisions[1].Hash != deletedContentHash {
+			t.Errorf("Expected the deletion between two versions, got %+v: %v", revisions, err)
+		}
+		if _, problems := verifyChain(t, db); problems != "" {
+			t.Errorf("Expected no problems, got:\n%s", problems)
+		}
+
+		// A row put back behind the store's back contradicts the deletion record
+		if err := db.DeleteContract("CHAIN-B"); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+		exec(t, db, `INSERT INTO contracts (id, title, status, parties_json, terms_json) VALUES (?, ?, ?, ?, ?);`,
+			"CHAIN-B", "Second", "active", "null", `{"startDate":"","endDate":"","value":0,"currency":""}`)
+		if _, problems := verifyChain(t, db); problems != "contracts CHAIN-B: contract is stored although version 4 records its deletion" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("DeletedContractRow", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		exec(t, db, `DELETE FROM contracts WHERE id = ?;`, "CHAIN-A")
+
+		if _, problems := verifyChain(t, db); problems != "contracts CHAIN-A: contract is missing, but the chain does not record its deletion after version 2" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("DeletedRevision", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		exec(t, db, `DELETE FROM contract_revisions WHERE contract_id = ? AND version = ?;`, "CHAIN-A", 1)
+
+		expected := strings.Join([]string{
+			"contract_revisions CHAIN-B 1: revisions 1 to 1 are missing from the chain",
+			"contract_revisions CHAIN-B 1: link to the previous revision in the chain is broken",
+			"contract_revisions CHAIN-A 2: follows version 0 of the contract",
+			"contract_revisions CHAIN-A 2: link to the previous version of the contract is broken",
+		}, "\n")
+		if _, problems := verifyChain(t, db); problems != expected {
+			t.Errorf("Unexpected problems:\n%s\nexpected:\n%s", problems, expected)
+		}
+	})
+
+	t.Run("RemovedHead", func(t *testing.T) {
+		db := open(t)
+		seedChain(t, db)
+		before, _ := verifyChain(t, db)
+
+		// Removing the latest revision along with its contract leaves a consistent
+		// chain, which only the recorded head reveals
+		exec(t, db, `DELETE FROM contract_revisions WHERE contract_id = ?;`, "CHAIN-C")
+		exec(t, db, `DELETE FROM contracts WHERE id = ?;`, "CHAIN-C")
+		report, problems := verifyChain(t, db)
+		if problems != "" {
+			t.Errorf("Expected no problems without a head, got:\n%s", problems)
+		}
+		if err := report.checkHead(before.Head()); err != nil {
+			t.Fatalf("Failed to check head: %v", err)
+		}
+		if problems := problemLines(report); problems != "contract_revisions: revision of the expected chain head is missing" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+
+		// A different revision with the same sequence number does not match either
+		if err := db.StoreContract(&Contract{ID: "CHAIN-D", Title: "Replacement", Status: "active"}); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		report, _ = verifyChain(t, db)
+		report.checkHead(before.Head())
+		if problems := problemLines(report); problems != "contract_revisions: revision does not match the expected chain head" {
+			t.Errorf("Unexpected problems:\n%s", problems)
+		}
+	})
+
+	t.Run("InvalidHead", func(t *testing.T) {
+		report, _ := verifyChain(t, open(t))
+		for _, head := range []string{"abc", "0:abc", "4:", "x:abc"} {
+			if err := report.checkHead(head); err == nil || !strings.Contains(err.Error(), "invalid chain head") {
+				t.Errorf("Expected an invalid head error for %q, got %v", head, err)
+			}
+		}
+	})
+}
+
+func TestHashChain(t *testing.T) {
+	testHashChain(t, func(t *testing.T) *DB {
+		db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestLinkExistingRevisions(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	seedChain(t, db)
+
+	// Put the database back into the state before the chain existed, with one
+	// contract stored before revisions were recorded
+	exec(t, db, `DROP INDEX contract_revisions_seq;`)
+	exec(t, db, `UPDATE contract_revisions SET seq = 0, contract_prev_hash = '', chain_prev_hash = '', record_hash = '';`)
+	exec(t, db, `DELETE FROM contract_revisions WHERE contract_id = ?;`, "CHAIN-C")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := linkExistingRevisions(tx, db.dialect); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to link revisions: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	report, problems := verifyChain(t, db)
+	if problems != "" {
+		t.Errorf("Expected no problems after linking, got:\n%s", problems)
+	}
+	if report.Revisions != 4 || report.HeadSeq != 4 {
+		t.Errorf("Expected 4 linked revisions, got %+v", report)
+	}
+
+	// New revisions continue the chain
+	if err := db.StoreContract(&Contract{ID: "CHAIN-C", Title: "Third", Status: "expired"}); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	report, problems = verifyChain(t, db)
+	if problems != "" || report.HeadSeq != 5 {
+		t.Errorf("Expected the chain to continue at 5, got %+v:\n%s", report, problems)
+	}
+	revisions, err := db.ContractRevisions("CHAIN-C")
+	if err != nil || len(revisions) != 2 {
+		t.Errorf("Expected the contract to have a first revision from linking, got %d: %v", len(revisions), err)
+	}
+}
+
+func TestRecordEarlierDeletions(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	seedChain(t, db)
+	// A contract deleted before deletions were chained
+	exec(t, db, `DELETE FROM contracts WHERE id = ?;`, "CHAIN-B")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := recordEarlierDeletions(tx, db.dialect); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to record deletions: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	report, problems := verifyChain(t, db)
+	if problems != "" || report.Revisions != 5 {
+		t.Errorf("Expected the deletion to be recorded, got %+v:\n%s", report, problems)
+	}
+}
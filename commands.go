@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand invoked as: goplayground [global flags] <name> [command flags] [args]
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+// commands lists the available subcommands in the order they are shown in the usage text
+var commands = []command{
+	{
+		name:        "list",
+		usage:       "list [-status s1,s2] [-id glob] [-party text] [-active-on date]",
+		description: "List the stored contracts that match the filter flags",
+		run:         runList,
+	},
+	{
+		name:        "store",
+		usage:       "store [contract-file...]",
+		description: "Validate contract files and store them",
+		run:         runStore,
+	},
+	{
+		name:        "delete",
+		usage:       "delete <id...>",
+		description: "Delete stored contracts",
+		run:         runDelete,
+	},
+	{
+		name:        "validate",
+		usage:       "validate [contract-file|dir...]",
+		description: "Validate contract files, failing if any of them is invalid",
+		run:         runValidate,
+	},
+	{
+		name:        "sync",
+		usage:       "sync [-dir config] [-direction file-to-db|db-to-file|two-way] [-dry-run]",
+		description: "Synchronize a directory of contract files with the contract store",
+		run:         runSync,
+	},
+	{
+		name:        "watch",
+		usage:       "watch [-render path] [-store] [file|dir]",
+		description: "Re-validate contract files whenever they change, optionally rendering and storing them",
+		run:         runWatch,
+	},
+	{
+		name:        "renew",
+		usage:       "renew <id> [-months 12] [-id new-id] [-status pending]",
+		description: "Create a renewal of a stored contract that starts when it ends",
+		run:         runRenew,
+	},
+	{
+		name:        "show",
+		usage:       "show <id> [-template name|file] [-as-of date]",
+		description: "Print a stored contract as markdown",
+		run:         runShow,
+	},
+	{
+		name:        "history",
+		usage:       "history <id>",
+		description: "List the stored versions of a contract",
+		run:         runHistory,
+	},
+	{
+		name:        "sign",
+		usage:       "sign <id> -key party.key -party name|email",
+		description: "Sign the current content of a stored contract for a party with an Ed25519 key",
+		run:         runSign,
+	},
+	{
+		name:        "verify",
+		usage:       "verify <id>",
+		description: "Report which parties have validly signed the current content of a stored contract",
+		run:         runVerify,
+	},
+	{
+		name:        "verify-db",
+		usage:       "verify-db [-head seq:hash]",
+		description: "Check the hash chain of stored revisions and report rows changed outside the tool",
+		run:         runVerifyDB,
+	},
+	{
+		name:        "rekey",
+		usage:       "rekey -new-key-file file | -decrypt",
+		description: "Encrypt the parties, terms and history of stored contracts with a new key, or decrypt them",
+		run:         runRekey,
+	},
+	{
+		name:        "users",
+		usage:       "users add <name> [-role viewer|editor|approver|admin] [-token] | list | role <name> <role> | token <name> | remove <name...>",
+		description: "Manage the users commands act as and the roles that decide what they may do",
+		run:         runUsers,
+	},
+	{
+		name:        "approvals",
+		usage:       "approvals chains [file] | request <id> | list [id] [-status pending|approved|rejected|superseded]",
+		description: "Set the approval chains of the store, request the approvals they require before a stored contract becomes active, or list requests",
+		run:         runApprovals,
+	},
+	{
+		name:        "approve",
+		usage:       "approve <request-id> [-comment text]",
+		description: "Approve a pending approval request for the current content of its contract",
+		run:         runApprove,
+	},
+	{
+		name:        "reject",
+		usage:       "reject <request-id> -comment text",
+		description: "Reject a pending approval request, giving the reason",
+		run:         runReject,
+	},
+	{
+		name:        "diff",
+		usage:       "diff [-format text|markdown|json-patch] <a> <b>",
+		description: "Compare two contracts given as files, IDs or ID@version field by field",
+		run:         runDiff,
+	},
+	{
+		name:        "expiring",
+		usage:       "expiring [-within 30d] [-as-of date] [filter flags]",
+		description: "List contract ends, notice deadlines and payments coming up, failing if any of them is overdue",
+		run:         runExpiring,
+	},
+	{
+		name:        "notify",
+		usage:       "notify [-days 30,7,1] [-as-of date] [-dry-run dir] [filter flags]",
+		description: "Email parties reminders of coming and overdue deadlines, using the -notify config",
+		run:         runNotify,
+	},
+	{
+		name:        "webhooks",
+		usage:       "webhooks add <url> [-events e1,e2] [-secret s] | list | remove <id...> | deliveries [-status s] | deliver | replay <delivery-id...>",
+		description: "Manage the endpoints that receive contract events, and send or replay their deliveries",
+		run:         runWebhooks,
+	},
+	{
+		name:        "calendar",
+		usage:       "calendar [-o file.ics] [-remind days] [-name name] [-locale tag] [contract-file|dir|id...] | -all [filter flags]",
+		description: "Export contract start and end dates, renewal notice deadlines and payment due dates as an iCalendar file",
+		run:         runCalendar,
+	},
+	{
+		name:        "render",
+		usage:       "render [-format markdown|html|pdf] [-template name|file] [-as-of date] [-o file|dir|pattern] [-force|-no-clobber] [-site dir] [-list-templates] [contract-file|dir|id...] | -all [filter flags]",
+		description: "Render contract files or stored contracts as markdown, HTML or PDF, or write an HTML site with -site",
+		run:         runRender,
+	},
+}
+
+// findCommand returns the subcommand with the given name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// usage prints the global flags followed by the available subcommands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [command flags]\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+
+	fmt.Fprintln(out, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %s\n    \t%s\n", cmd.usage, cmd.description)
+	}
+}
+
+// newFlagSet creates the flag set for a subcommand
+func newFlagSet(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(flag.CommandLine.Output())
+	return fs
+}
+
+// parseArgs parses command flags that may appear before or after the positional
+// arguments, as in "renew CONTRACT-001 -months 12", and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// openStore opens the contract store selected with -db
+func openStore() (ContractStore, error) {
+	store, err := openBareStore()
+	if err != nil {
+		return nil, err
+	}
+	return wrapStore(store)
+}
+
+// openBareStore opens the store selected with -db without the wrappers of openStore,
+// with the encryption key given by -key-file or the environment, working in the tenant
+// given by -tenant, the environment or the acting user. Changes are put into the outbox
+// of the tenant's webhooks. Once the store has users, it is limited to what the role
+// of the user given by -as or the environment allows.
+func openBareStore() (ContractStore, error) {
+	key, err := configuredEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenStore(*dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening contract store: %v", err)
+	}
+
+	if db, ok := store.(*DB); ok {
+		if err := db.UseEncryptionKey(key); err != nil {
+			store.Close()
+			return nil, err
+		}
+		name, token := configuredActor()
+		actor, err := resolveActor(db, name, token)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		tenant, err := selectTenant(actor, configuredTenant())
+		if err == nil {
+			err = db.UseTenant(tenant)
+		}
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		if store, err = loadOutbox(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if actor != nil {
+			return NewAccessStore(store, actor), nil
+		}
+	} else if key != nil {
+		store.Close()
+		return nil, fmt.Errorf("encryption at rest requires a SQLite or PostgreSQL store")
+	} else if *actingUser != "" {
+		store.Close()
+		return nil, fmt.Errorf("users require a SQLite or PostgreSQL store")
+	} else if *tenantName != "" {
+		store.Close()
+		return nil, fmt.Errorf("tenants require a SQLite or PostgreSQL store")
+	}
+	return store, nil
+}
+
+// wrapStore adds the behaviour selected with global flags and the store, such as
+// notifications and approvals, to an opened store. The store is closed when that fails.
+func wrapStore(store ContractStore) (ContractStore, error) {
+	gated, err := loadApprovalGate(store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	store = gated
+
+	rules, err := loadRulesFlag()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if rules != nil {
+		store = NewRuleStore(store, rules)
+	}
+
+	var handlers []EventHandler
+	if *notifyConfigPath != "" {
+		notifier, err := loadNotifier(*notifyConfigPath)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		handlers = append(handlers, notifier.HandleEvent)
+	}
+
+	if len(handlers) == 0 {
+		return store, nil
+	}
+	return NewEventStore(store, handlers...), nil
+}
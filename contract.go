@@ -1,20 +1,28 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/mail"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// dateLayout is the format of all dates in contract files
+const dateLayout = "2006-01-02"
+
 // Party represents a party involved in the contract
 type Party struct {
 	Name  string `json:"name"`
 	Role  string `json:"role"`
 	Email string `json:"email"`
+	// VATID is the party's VAT identification number, if it has one
+	VATID string `json:"vatId,omitempty"`
 }
 
 // Terms represents the contract terms
@@ -23,15 +31,77 @@ type Terms struct {
 	EndDate   string  `json:"endDate"`
 	Value     float64 `json:"value"`
 	Currency  string  `json:"currency"`
+	// NoticePeriodDays is how many days before the end date notice of renewal or
+	// termination must be given
+	NoticePeriodDays int       `json:"noticePeriodDays,omitempty"`
+	Payments         []Payment `json:"payments,omitempty"`
+
+	// valueRedacted is set on the copy RedactionPolicy.Apply returns when it hides the value
+	valueRedacted bool
+}
+
+// MarshalJSON encodes the terms, with a value hidden by a redaction policy as
+// [redacted] rather than as the zero it is set to
+func (t Terms) MarshalJSON() ([]byte, error) {
+	type terms Terms
+	if !t.valueRedacted {
+		return json.Marshal(terms(t))
+	}
+	return json.Marshal(struct {
+		terms
+		Value string `json:"value"`
+	}{terms(t), redactedText})
+}
+
+// Payment is an installment of the contract value, due on a date in the contract currency
+type Payment struct {
+	DueDate     string  `json:"dueDate"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description,omitempty"`
+	// PaidDate is the date the payment was received, empty while it is outstanding
+	PaidDate string `json:"paidDate,omitempty"`
+
+	// amountRedacted is set on the copy RedactionPolicy.Apply returns when it hides the amount
+	amountRedacted bool
+}
+
+// MarshalJSON encodes the payment, with an amount hidden by a redaction policy as
+// [redacted] rather than as the zero it is set to
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type payment Payment
+	if !p.amountRedacted {
+		return json.Marshal(payment(p))
+	}
+	return json.Marshal(struct {
+		payment
+		Amount string `json:"amount"`
+	}{payment(p), redactedText})
+}
+
+// NoticeDeadline returns the last day to give notice of renewal or termination as
+// YYYY-MM-DD, or "" when the terms have no notice period or end date
+func (t Terms) NoticeDeadline() string {
+	if t.NoticePeriodDays <= 0 || t.EndDate == "" {
+		return ""
+	}
+	end, err := time.Parse(dateLayout, t.EndDate)
+	if err != nil {
+		return ""
+	}
+	return end.AddDate(0, 0, -t.NoticePeriodDays).Format(dateLayout)
 }
 
 // Contract represents the main contract structure
 type Contract struct {
-	ID      string  `json:"id"`
-	Title   string  `json:"title"`
-	Parties []Party `json:"parties"`
-	Terms   Terms   `json:"terms"`
-	Status  string  `json:"status"`
+	ID            string      `json:"id"`
+	Title         string      `json:"title"`
+	Parties       []Party     `json:"parties"`
+	Terms         Terms       `json:"terms"`
+	Status        string      `json:"status"`
+	PredecessorID string      `json:"predecessorId,omitempty"`
+	Amendments    []Amendment `json:"amendments,omitempty"`
+	// Signatures are the parties' signatures of the contract, see CanonicalJSON
+	Signatures []Signature `json:"signatures,omitempty"`
 }
 
 // LoadContract reads the contract.json file from the specified path and returns a Contract object
@@ -104,11 +174,11 @@ func (c *Contract) Validate() error {
 
 	// Validate terms
 	if c.Terms.StartDate != "" && c.Terms.EndDate != "" {
-		startDate, err := time.Parse("2006-01-02", c.Terms.StartDate)
+		startDate, err := time.Parse(dateLayout, c.Terms.StartDate)
 		if err != nil {
 			return fmt.Errorf("invalid start date format: %v", err)
 		}
-		endDate, err := time.Parse("2006-01-02", c.Terms.EndDate)
+		endDate, err := time.Parse(dateLayout, c.Terms.EndDate)
 		if err != nil {
 			return fmt.Errorf("invalid end date format: %v", err)
 		}
@@ -126,6 +196,34 @@ func (c *Contract) Validate() error {
 		return fmt.Errorf("invalid currency code: %s", c.Terms.Currency)
 	}
 
+	if c.Terms.NoticePeriodDays < 0 {
+		return fmt.Errorf("notice period cannot be negative")
+	}
+	for i, payment := range c.Terms.Payments {
+		if _, err := time.Parse(dateLayout, payment.DueDate); err != nil {
+			return fmt.Errorf("payment %d: invalid due date format: %v", i+1, err)
+		}
+		if payment.Amount < 0 {
+			return fmt.Errorf("payment %d: amount cannot be negative", i+1)
+		}
+		if payment.PaidDate != "" {
+			if _, err := time.Parse(dateLayout, payment.PaidDate); err != nil {
+				return fmt.Errorf("payment %d: invalid paid date format: %v", i+1, err)
+			}
+		}
+	}
+
+	if c.PredecessorID == c.ID {
+		return fmt.Errorf("contract cannot be its own predecessor")
+	}
+
+	// Validate amendments and the terms they lead to
+	if len(c.Amendments) > 0 {
+		if err := c.validateAmendments(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -136,35 +234,49 @@ func isValidCurrency(currency string) bool {
 	return len(currency) == 3 && currency == strings.ToUpper(currency)
 }
 
-// ToMarkdown converts the contract to markdown format
-func (c *Contract) ToMarkdown() string {
-	var sb strings.Builder
-
-	sb.WriteString("# Contract Details\n\n")
-	sb.WriteString(fmt.Sprintf("## Contract %s\n", c.ID))
-	if c.Title != "" {
-		sb.WriteString(fmt.Sprintf("Title: %s\n", c.Title))
-	}
-	sb.WriteString(fmt.Sprintf("Status: %s\n\n", c.Status))
-
-	if len(c.Parties) > 0 {
-		sb.WriteString("### Parties\n")
-		for _, party := range c.Parties {
-			sb.WriteString(fmt.Sprintf("* %s (%s)\n", party.Name, party.Role))
-			if party.Email != "" {
-				sb.WriteString(fmt.Sprintf("  - Email: %s\n", party.Email))
-			}
-		}
-		sb.WriteString("\n")
+// ContentHash returns the hex encoded SHA-256 hash of the contract's JSON encoding.
+// Two contracts have the same hash exactly when all their fields are equal.
+func (c *Contract) ContentHash() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling contract: %v", err)
 	}
 
-	sb.WriteString("### Terms\n")
-	if c.Terms.StartDate != "" && c.Terms.EndDate != "" {
-		sb.WriteString(fmt.Sprintf("* Period: %s to %s\n", c.Terms.StartDate, c.Terms.EndDate))
-	}
-	if c.Terms.Value > 0 {
-		sb.WriteString(fmt.Sprintf("* Value: %.2f %s\n", c.Terms.Value, c.Terms.Currency))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ToMarkdown converts the contract to markdown format
+func (c *Contract) ToMarkdown() (string, error) {
+	return c.markdown("", nil)
+}
+
+// ToMarkdownAt converts the contract to markdown showing the terms in effect on the given date
+func (c *Contract) ToMarkdownAt(date time.Time) (string, error) {
+	return c.EffectiveAt(date).markdown(date.Format(dateLayout), nil)
+}
+
+// markdown renders the contract with the default template, noting the effective date when
+// asOf is set and marking the fields hidden by the redaction policy, which is already applied
+func (c *Contract) markdown(asOf string, redaction *RedactionPolicy) (string, error) {
+	renderer, err := defaultRenderer()
+	if err != nil {
+		return "", err
 	}
+	return renderer.RenderString(TemplateData{Contract: c, AsOf: asOf, Redaction: redaction})
+}
+
+var (
+	defaultRendererOnce sync.Once
+	defaultRendererTmpl *Renderer
+	defaultRendererErr  error
+)
 
-	return sb.String()
+// defaultRenderer returns the renderer of DefaultTemplate, which is parsed on first use.
+// Renderers clone their template for every render, so it is safe to share.
+func defaultRenderer() (*Renderer, error) {
+	defaultRendererOnce.Do(func() {
+		defaultRendererTmpl, defaultRendererErr = NewRenderer(DefaultTemplate)
+	})
+	return defaultRendererTmpl, defaultRendererErr
 }
@@ -9,6 +9,35 @@ import (
 	"time"
 )
 
+// newTestContract returns a one-year contract with two amendments, the fixture that
+// tests change as they need
+func newTestContract(id, status string) *Contract {
+	return &Contract{
+		ID:      id,
+		Title:   "Test Contract",
+		Status:  status,
+		Parties: []Party{{Name: "Test Client", Role: "Client", Email: "client@example.com"}},
+		Terms: Terms{
+			StartDate: "2024-01-01",
+			EndDate:   "2024-12-31",
+			Value:     1000.00,
+			Currency:  "USD",
+		},
+		Amendments: []Amendment{
+			{
+				EffectiveDate: "2024-09-01",
+				Description:   "Extension",
+				Changes:       AmendmentChanges{EndDate: stringPtr("2025-03-31")},
+			},
+			{
+				EffectiveDate: "2024-04-01",
+				Description:   "Price increase",
+				Changes:       AmendmentChanges{Value: floatPtr(1200.00)},
+			},
+		},
+	}
+}
+
 func TestLoadContract(t *testing.T) {
 	// Create a temporary directory for test files
 	tmpDir := t.TempDir()
@@ -207,6 +236,69 @@ func TestContractValidation(t *testing.T) {
 			t.Error("Expected error for invalid currency")
 		}
 	})
+
+	t.Run("PaymentsAndNoticePeriod", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			terms    func(t *Terms)
+			expected string
+		}{
+			{"Valid", func(t *Terms) {}, ""},
+			{"NegativeNoticePeriod", func(t *Terms) { t.NoticePeriodDays = -1 }, "notice period cannot be negative"},
+			{"InvalidDueDate", func(t *Terms) { t.Payments[1].DueDate = "2024-13-01" }, "payment 2: invalid due date format"},
+			{"MissingDueDate", func(t *Terms) { t.Payments[0].DueDate = "" }, "payment 1: invalid due date format"},
+			{"NegativeAmount", func(t *Terms) { t.Payments[0].Amount = -1 }, "payment 1: amount cannot be negative"},
+			{"InvalidPaidDate", func(t *Terms) { t.Payments[0].PaidDate = "soon" }, "payment 1: invalid paid date format"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				contract := Contract{
+					ID:      "TEST-001",
+					Title:   "Test Contract",
+					Status:  "active",
+					Parties: []Party{{Name: "Test Party", Role: "Client"}},
+					Terms: Terms{
+						StartDate:        "2024-01-01",
+						EndDate:          "2024-12-31",
+						Value:            1000.00,
+						Currency:         "USD",
+						NoticePeriodDays: 30,
+						Payments: []Payment{
+							{DueDate: "2024-01-15", Amount: 500, PaidDate: "2024-01-10"},
+							{DueDate: "2024-07-15", Amount: 500},
+						},
+					},
+				}
+				tt.terms(&contract.Terms)
+
+				err := contract.Validate()
+				if tt.expected == "" {
+					if err != nil {
+						t.Errorf("Expected valid contract, got %v", err)
+					}
+				} else if err == nil || !strings.Contains(err.Error(), tt.expected) {
+					t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+				}
+			})
+		}
+	})
+}
+
+func TestTermsNoticeDeadline(t *testing.T) {
+	tests := []struct {
+		terms    Terms
+		expected string
+	}{
+		{Terms{EndDate: "2024-12-31", NoticePeriodDays: 90}, "2024-10-02"},
+		{Terms{EndDate: "2024-03-01", NoticePeriodDays: 1}, "2024-02-29"},
+		{Terms{EndDate: "2024-12-31"}, ""},
+		{Terms{NoticePeriodDays: 30}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.terms.NoticeDeadline(); got != tt.expected {
+			t.Errorf("NoticeDeadline(%+v): expected %q, got %q", tt.terms, tt.expected, got)
+		}
+	}
 }
 
 func TestContractToMarkdown(t *testing.T) {
@@ -234,7 +326,10 @@ func TestContractToMarkdown(t *testing.T) {
 		},
 	}
 
-	markdown := contract.ToMarkdown()
+	markdown, err := contract.ToMarkdown()
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
 
 	// Test markdown content
 	expectedStrings := []string{
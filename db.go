@@ -13,6 +13,11 @@ import (
 // DB represents the database connection
 type DB struct {
 	*sql.DB
+	dialect dialect
+	// key encrypts sensitive columns when set, see UseEncryptionKey
+	key *EncryptionKey
+	// tenant owns the rows read and written, see UseTenant
+	tenant string
 }
 
 // InitDB initializes the SQLite database and creates the necessary tables
@@ -29,35 +34,42 @@ func InitDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("error opening database: %v", err)
 	}
 
+	return initSQL(db, dialectSQLite)
+}
+
+// initSQL checks the connection and brings the schema up to date
+func initSQL(sqlDB *sql.DB, d dialect) (*DB, error) {
 	// Test the connection
-	if err := db.Ping(); err != nil {
-		db.Close()
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	// Create the contracts table if it doesn't exist
-	createTable := `
-	CREATE TABLE IF NOT EXISTS contracts (
-		id TEXT PRIMARY KEY,
-		title TEXT NOT NULL,
-		status TEXT NOT NULL,
-		parties_json TEXT NOT NULL,
-		terms_json TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	_, err = db.Exec(createTable)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("error creating contracts table: %v", err)
+	db := &DB{DB: sqlDB, dialect: d, tenant: defaultTenant}
+	if err := db.migrate(); err != nil {
+		sqlDB.Close()
+		return nil, err
 	}
 
-	return &DB{db}, nil
+	return db, nil
+}
+
+// contractColumns lists the contract columns in the order scanContract reads them
+const contractColumns = `id, title, status, parties_json, terms_json, predecessor_id, amendments_json, signatures_json`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
 // StoreContract stores a contract in the database
 func (db *DB) StoreContract(contract *Contract) error {
-	// Convert parties and terms to JSON
+	return db.storeContract(contract, nil)
+}
+
+// storeContract stores a contract and adds the deliveries to the webhook outbox in one transaction
+func (db *DB) storeContract(contract *Contract, deliveries []*WebhookDelivery) error {
+	// Convert parties, terms, amendments and signatures to JSON
 	partiesJSON, err := json.Marshal(contract.Parties)
 	if err != nil {
 		return fmt.Errorf("error marshaling parties: %v", err)
@@ -68,58 +80,136 @@ func (db *DB) StoreContract(contract *Contract) error {
 		return fmt.Errorf("error marshaling terms: %v", err)
 	}
 
-	// Insert or replace the contract
+	amendmentsJSON, err := json.Marshal(contract.Amendments)
+	if err != nil {
+		return fmt.Errorf("error marshaling amendments: %v", err)
+	}
+
+	signaturesJSON, err := json.Marshal(contract.Signatures)
+	if err != nil {
+		return fmt.Errorf("error marshaling signatures: %v", err)
+	}
+
+	// Encrypt everything but the columns that are queried
+	sealed := make([]string, 4)
+	for i, column := range []struct {
+		name string
+		data []byte
+	}{
+		{"parties_json", partiesJSON},
+		{"terms_json", termsJSON},
+		{"amendments_json", amendmentsJSON},
+		{"signatures_json", signaturesJSON},
+	} {
+		if sealed[i], err = sealValue(db.key, column.data, columnAAD(db.tenant, column.name, contract.ID)); err != nil {
+			return fmt.Errorf("error encrypting %s: %v", column.name, err)
+		}
+	}
+
+	// Insert the contract or update the existing row
 	query := `
-	INSERT OR REPLACE INTO contracts (id, title, status, parties_json, terms_json)
-	VALUES (?, ?, ?, ?, ?);`
+	INSERT INTO contracts (tenant, ` + contractColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (tenant, id) DO UPDATE SET
+		title = excluded.title,
+		status = excluded.status,
+		parties_json = excluded.parties_json,
+		terms_json = excluded.terms_json,
+		predecessor_id = excluded.predecessor_id,
+		amendments_json = excluded.amendments_json,
+		signatures_json = excluded.signatures_json;`
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error storing contract: %v", err)
+	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(query, contract.ID, contract.Title, contract.Status, string(partiesJSON), string(termsJSON))
+	_, err = tx.Exec(db.dialect.rebind(query), db.tenant, contract.ID, contract.Title, contract.Status,
+		sealed[0], sealed[1], contract.PredecessorID, sealed[2], sealed[3])
 	if err != nil {
 		return fmt.Errorf("error storing contract: %v", err)
 	}
+	if err := db.recordRevision(tx, contract); err != nil {
+		return err
+	}
+	if err := db.enqueueDeliveries(tx, deliveries); err != nil {
+		return err
+	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error storing contract: %v", err)
+	}
 	return nil
 }
 
+// scanContract reads a contract of a tenant from a row selected with contractColumns,
+// decrypting its columns with key. Errors from Scan are returned unchanged so callers
+// can check for sql.ErrNoRows.
+func scanContract(row rowScanner, key *EncryptionKey, tenant string) (*Contract, error) {
+	var contract Contract
+	var partiesJSON, termsJSON, amendmentsJSON, signaturesJSON string
+
+	err := row.Scan(&contract.ID, &contract.Title, &contract.Status, &partiesJSON, &termsJSON,
+		&contract.PredecessorID, &amendmentsJSON, &signaturesJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, column := range []struct {
+		name  string
+		value string
+		dest  any
+	}{
+		{"parties_json", partiesJSON, &contract.Parties},
+		{"terms_json", termsJSON, &contract.Terms},
+		{"amendments_json", amendmentsJSON, &contract.Amendments},
+		{"signatures_json", signaturesJSON, &contract.Signatures},
+	} {
+		data, err := openValue(key, column.value, columnAAD(tenant, column.name, contract.ID))
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting %s: %v", column.name, err)
+		}
+		if err := json.Unmarshal(data, column.dest); err != nil {
+			return nil, fmt.Errorf("error unmarshaling %s: %v", column.name, err)
+		}
+	}
+
+	return &contract, nil
+}
+
 // GetContract retrieves a contract from the database by ID
 func (db *DB) GetContract(id string) (*Contract, error) {
+	return db.tenantContract(db.tenant, id)
+}
+
+// tenantContract retrieves a contract of any tenant by ID
+func (db *DB) tenantContract(tenant, id string) (*Contract, error) {
 	query := `
-	SELECT id, title, status, parties_json, terms_json
+	SELECT ` + contractColumns + `
 	FROM contracts
-	WHERE id = ?;`
+	WHERE tenant = ? AND id = ?;`
 
-	var contract Contract
-	var partiesJSON, termsJSON string
-
-	err := db.QueryRow(query, id).Scan(&contract.ID, &contract.Title, &contract.Status, &partiesJSON, &termsJSON)
+	contract, err := scanContract(db.QueryRow(db.dialect.rebind(query), tenant, id), db.key, tenant)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("contract not found: %s", id)
+			return nil, fmt.Errorf("%w: %s", ErrContractNotFound, id)
 		}
 		return nil, fmt.Errorf("error retrieving contract: %v", err)
 	}
 
-	// Parse parties JSON
-	if err := json.Unmarshal([]byte(partiesJSON), &contract.Parties); err != nil {
-		return nil, fmt.Errorf("error unmarshaling parties: %v", err)
-	}
-
-	// Parse terms JSON
-	if err := json.Unmarshal([]byte(termsJSON), &contract.Terms); err != nil {
-		return nil, fmt.Errorf("error unmarshaling terms: %v", err)
-	}
-
-	return &contract, nil
+	return contract, nil
 }
 
 // GetAllContracts retrieves all contracts from the database
 func (db *DB) GetAllContracts() ([]*Contract, error) {
 	query := `
-	SELECT id, title, status, parties_json, terms_json
+	SELECT ` + contractColumns + `
 	FROM contracts
+	WHERE tenant = ?
 	ORDER BY created_at DESC;`
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(db.dialect.rebind(query), db.tenant)
 	if err != nil {
 		return nil, fmt.Errorf("error querying contracts: %v", err)
 	}
@@ -127,25 +217,11 @@ func (db *DB) GetAllContracts() ([]*Contract, error) {
 
 	var contracts []*Contract
 	for rows.Next() {
-		var contract Contract
-		var partiesJSON, termsJSON string
-
-		err := rows.Scan(&contract.ID, &contract.Title, &contract.Status, &partiesJSON, &termsJSON)
+		contract, err := scanContract(rows, db.key, db.tenant)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning contract: %v", err)
 		}
-
-		// Parse parties JSON
-		if err := json.Unmarshal([]byte(partiesJSON), &contract.Parties); err != nil {
-			return nil, fmt.Errorf("error unmarshaling parties: %v", err)
-		}
-
-		// Parse terms JSON
-		if err := json.Unmarshal([]byte(termsJSON), &contract.Terms); err != nil {
-			return nil, fmt.Errorf("error unmarshaling terms: %v", err)
-		}
-
-		contracts = append(contracts, &contract)
+		contracts = append(contracts, contract)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -155,11 +231,22 @@ func (db *DB) GetAllContracts() ([]*Contract, error) {
 	return contracts, nil
 }
 
-// DeleteContract deletes a contract from the database by ID
+// DeleteContract deletes a contract from the database by ID and records its
+// deletion in the hash chain
 func (db *DB) DeleteContract(id string) error {
-	query := `DELETE FROM contracts WHERE id = ?;`
+	return db.deleteContract(id, nil)
+}
 
-	result, err := db.Exec(query, id)
+// deleteContract deletes a contract and adds the deliveries to the webhook outbox in one transaction
+func (db *DB) deleteContract(id string, deliveries []*WebhookDelivery) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error deleting contract: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM contracts WHERE tenant = ? AND id = ?;`
+	result, err := tx.Exec(db.dialect.rebind(query), db.tenant, id)
 	if err != nil {
 		return fmt.Errorf("error deleting contract: %v", err)
 	}
@@ -170,8 +257,105 @@ func (db *DB) DeleteContract(id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("contract not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrContractNotFound, id)
 	}
 
+	if err := recordDeletion(tx, db.dialect, db.tenant, id); err != nil {
+		return err
+	}
+	if err := db.enqueueDeliveries(tx, deliveries); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error deleting contract: %v", err)
+	}
 	return nil
 }
+
+// recordRevision adds a revision for the contract unless its latest revision has the same content
+func (db *DB) recordRevision(tx *sql.Tx, contract *Contract) error {
+	data, err := json.Marshal(contract)
+	if err != nil {
+		return fmt.Errorf("error marshaling contract: %v", err)
+	}
+	hash, err := contract.ContentHash()
+	if err != nil {
+		return err
+	}
+
+	link, latestHash, err := nextChainLink(tx, db.dialect, db.tenant, contract.ID, hash)
+	if err != nil {
+		return err
+	}
+	if latestHash == hash {
+		return nil
+	}
+
+	sealed, err := sealValue(db.key, data, revisionAAD(link.Tenant, link.ContractID, link.Version))
+	if err != nil {
+		return fmt.Errorf("error encrypting contract revision: %v", err)
+	}
+	return insertRevision(tx, db.dialect, link, sealed)
+}
+
+// ContractRevisions lists the stored versions of a contract, oldest first
+func (db *DB) ContractRevisions(id string) ([]ContractRevision, error) {
+	query := `
+	SELECT version, content_hash, created_at
+	FROM contract_revisions
+	WHERE tenant = ? AND contract_id = ?
+	ORDER BY version;`
+
+	rows, err := db.Query(db.dialect.rebind(query), db.tenant, id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contract revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []ContractRevision
+	for rows.Next() {
+		revision := ContractRevision{ID: id}
+		if err := rows.Scan(&revision.Version, &revision.Hash, &revision.StoredAt); err != nil {
+			return nil, fmt.Errorf("error scanning contract revision: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contract revisions: %v", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, id)
+	}
+	return revisions, nil
+}
+
+// GetContractVersion retrieves a stored version of a contract
+func (db *DB) GetContractVersion(id string, version int) (*Contract, error) {
+	query := `
+	SELECT contract_json, content_hash
+	FROM contract_revisions
+	WHERE tenant = ? AND contract_id = ? AND version = ?;`
+
+	var data, hash string
+	err := db.QueryRow(db.dialect.rebind(query), db.tenant, id, version).Scan(&data, &hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s@%d", ErrContractNotFound, id, version)
+		}
+		return nil, fmt.Errorf("error retrieving contract revision: %v", err)
+	}
+	if hash == deletedContentHash {
+		return nil, fmt.Errorf("%w: %s@%d records the deletion of the contract", ErrContractNotFound, id, version)
+	}
+
+	plaintext, err := openValue(db.key, data, revisionAAD(db.tenant, id, version))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting contract revision: %v", err)
+	}
+	var contract Contract
+	if err := json.Unmarshal(plaintext, &contract); err != nil {
+		return nil, fmt.Errorf("error unmarshaling contract revision: %v", err)
+	}
+	return &contract, nil
+}
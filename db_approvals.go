@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// approvalColumns lists the approval request columns in the order scanApprovalRequest reads them
+const approvalColumns = `id, contract_id, content_hash, chain, step, approvers, status, requested_by, decided_by, comment, created_at, decided_at`
+
+// scanApprovalRequest reads an approval request selected with approvalColumns
+func scanApprovalRequest(row rowScanner) (*ApprovalRequest, error) {
+	var request ApprovalRequest
+	var approvers string
+	var decidedAt sql.NullTime
+	err := row.Scan(&request.ID, &request.ContractID, &request.ContentHash, &request.Chain, &request.Step, &approvers,
+		&request.Status, &request.RequestedBy, &request.DecidedBy, &request.Comment, &request.CreatedAt, &decidedAt)
+	if err != nil {
+		return nil, err
+	}
+	if approvers != "" {
+		request.Approvers = strings.Split(approvers, ",")
+	}
+	if decidedAt.Valid {
+		request.DecidedAt = &decidedAt.Time
+	}
+	return &request, nil
+}
+
+// RequestApprovals supersedes the pending requests of a contract of the tenant and
+// adds new ones, setting their IDs and creation times
+func (db *DB) RequestApprovals(contractID string, requests []*ApprovalRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	supersede := `UPDATE approval_requests SET status = ? WHERE tenant = ? AND contract_id = ? AND status = ?;`
+	if _, err := tx.Exec(db.dialect.rebind(supersede), approvalSuperseded, db.tenant, contractID, approvalPending); err != nil {
+		return fmt.Errorf("error superseding approval requests: %v", err)
+	}
+
+	query := db.dialect.rebind(`
+	INSERT INTO approval_requests (tenant, contract_id, content_hash, chain, step, approvers, status, requested_by, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id;`)
+	now := time.Now().UTC()
+	for _, r := range requests {
+		r.ContractID = contractID
+		r.CreatedAt = now
+		err := tx.QueryRow(query, db.tenant, contractID, r.ContentHash, r.Chain, r.Step, strings.Join(r.Approvers, ","),
+			r.Status, r.RequestedBy, r.CreatedAt).Scan(&r.ID)
+		if err != nil {
+			return fmt.Errorf("error adding approval request: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ApprovalRequests returns the requests of the tenant for a contract, or for every
+// contract when contractID is empty, with the given status or any status, oldest first
+func (db *DB) ApprovalRequests(contractID, status string) ([]ApprovalRequest, error) {
+	query := `SELECT ` + approvalColumns + ` FROM approval_requests WHERE tenant = ?`
+	args := []any{db.tenant}
+	if contractID != "" {
+		query += ` AND contract_id = ?`
+		args = append(args, contractID)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	rows, err := db.Query(db.dialect.rebind(query+` ORDER BY id;`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying approval requests: %v", err)
+	}
+	defer rows.Close()
+
+	var requests []ApprovalRequest
+	for rows.Next() {
+		request, err := scanApprovalRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning approval request: %v", err)
+		}
+		requests = append(requests, *request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating approval requests: %v", err)
+	}
+	return requests, nil
+}
+
+// GetApprovalRequest returns an approval request of the tenant by ID
+func (db *DB) GetApprovalRequest(id int64) (*ApprovalRequest, error) {
+	row := db.QueryRow(db.dialect.rebind(`SELECT `+approvalColumns+` FROM approval_requests WHERE tenant = ? AND id = ?;`), db.tenant, id)
+	request, err := scanApprovalRequest(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrApprovalNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting approval request: %v", err)
+	}
+	return request, nil
+}
+
+// DecideApprovalRequest records the status, decider, comment and decision time of
+// a pending request of the tenant, and sets its decision time
+func (db *DB) DecideApprovalRequest(request *ApprovalRequest) error {
+	decidedAt := time.Now().UTC()
+	query := `
+	UPDATE approval_requests SET status = ?, decided_by = ?, comment = ?, decided_at = ?
+	WHERE tenant = ? AND id = ? AND status = ?;`
+	result, err := db.Exec(db.dialect.rebind(query), request.Status, request.DecidedBy, request.Comment, decidedAt, db.tenant, request.ID, approvalPending)
+	if err != nil {
+		return fmt.Errorf("error deciding approval request: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("approval request %d is no longer pending", request.ID)
+	}
+	request.DecidedAt = &decidedAt
+	return nil
+}
+
+// ApprovalConfig returns the approval chains set for the tenant, or nil when none were set
+func (db *DB) ApprovalConfig() (*ApprovalConfig, error) {
+	var data string
+	err := db.QueryRow(db.dialect.rebind(`SELECT config_json FROM approval_configs WHERE tenant = ?;`), db.tenant).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting approval config: %v", err)
+	}
+
+	var config ApprovalConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return nil, fmt.Errorf("error unmarshaling approval config: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid approval config in store: %v", err)
+	}
+	return &config, nil
+}
+
+// SetApprovalConfig replaces the approval chains of the tenant
+func (db *DB) SetApprovalConfig(config *ApprovalConfig) error {
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("invalid approval config: %v", err)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshaling approval config: %v", err)
+	}
+	query := `
+	INSERT INTO approval_configs (tenant, config_json, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT (tenant) DO UPDATE SET config_json = excluded.config_json, updated_at = excluded.updated_at;`
+	if _, err := db.Exec(db.dialect.rebind(query), db.tenant, string(data), time.Now().UTC()); err != nil {
+		return fmt.Errorf("error setting approval config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// InitPostgres connects to the PostgreSQL database described by dsn and creates the necessary tables.
+// The DSN is a postgres:// URL or a libpq key=value connection string.
+func InitPostgres(dsn string) (*DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	return initSQL(db, dialectPostgres)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// postgresTestDSNEnv names the environment variable holding the DSN of a local
+// PostgreSQL test instance. Every test works in a schema of its own, which it
+// creates and drops again, so the rest of the database is left alone.
+const postgresTestDSNEnv = "GOPLAYGROUND_TEST_POSTGRES_DSN"
+
+// The embedded PostgreSQL instance the tests start when no DSN is configured
+var (
+	embeddedPostgresOnce sync.Once
+	embeddedPostgres     *embeddedpostgres.EmbeddedPostgres
+	embeddedPostgresDSN  string
+	embeddedPostgresErr  error
+	embeddedPostgresDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if embeddedPostgres != nil {
+		if err := embeddedPostgres.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop embedded PostgreSQL: %v\n", err)
+		}
+		os.RemoveAll(embeddedPostgresDir)
+	}
+	os.Exit(code)
+}
+
+// startEmbeddedPostgres starts a PostgreSQL instance in a temporary directory on a
+// free port. The binaries are downloaded on first use and cached in ~/.embedded-postgres-go.
+func startEmbeddedPostgres() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	if embeddedPostgresDir, err = os.MkdirTemp("", "goplayground-postgres-"); err != nil {
+		return "", err
+	}
+	var log bytes.Buffer
+	config := embeddedpostgres.DefaultConfig().
+		Port(uint32(port)).
+		Database("goplayground_test").
+		RuntimePath(filepath.Join(embeddedPostgresDir, "runtime")).
+		DataPath(filepath.Join(embeddedPostgresDir, "data")).
+		Logger(&log)
+	postgres := embeddedpostgres.NewDatabase(config)
+	if err := postgres.Start(); err != nil {
+		os.RemoveAll(embeddedPostgresDir)
+		return "", fmt.Errorf("%v\n%s", err, log.String())
+	}
+	embeddedPostgres = postgres
+	return config.GetConnectionURL() + "?sslmode=disable", nil
+}
+
+// postgresTestDSN returns the DSN of the PostgreSQL test instance: the one in
+// $GOPLAYGROUND_TEST_POSTGRES_DSN, or else an embedded instance started on first
+// use. The tests are skipped with -short, and when the embedded instance cannot be
+// started, except on CI, where running without PostgreSQL is an error.
+func postgresTestDSN(t *testing.T) string {
+	t.Helper()
+
+	if dsn := os.Getenv(postgresTestDSNEnv); dsn != "" {
+		return dsn
+	}
+	if testing.Short() {
+		t.Skipf("skipping PostgreSQL tests in short mode; set %s or run without -short", postgresTestDSNEnv)
+	}
+	embeddedPostgresOnce.Do(func() {
+		embeddedPostgresDSN, embeddedPostgresErr = startEmbeddedPostgres()
+	})
+	if embeddedPostgresErr != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("%s is not set and embedded PostgreSQL failed to start: %v", postgresTestDSNEnv, embeddedPostgresErr)
+		}
+		t.Skipf("skipping PostgreSQL tests: %s is not set and embedded PostgreSQL failed to start: %v", postgresTestDSNEnv, embeddedPostgresErr)
+	}
+	return embeddedPostgresDSN
+}
+
+// openPostgresTestDB connects to the PostgreSQL test instance with a freshly migrated
+// schema of its own, dropped when the test ends
+func openPostgresTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	dsn := postgresTestDSN(t)
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "goplayground_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema + `;`); err != nil {
+		admin.Close()
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE;`); err != nil {
+			t.Errorf("Failed to drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	db, err := InitPostgres(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	// Cleanups run last in first out, so the database is closed before its schema is dropped
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// withSearchPath returns the DSN with the schema as the search path of every connection.
+// The DSN is either a URL or a list of key=value settings.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+func TestPostgresDB(t *testing.T) {
+	testDB(t, openPostgresTestDB(t))
+}
+
+func TestPostgresStore(t *testing.T) {
+	testContractStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresRevisions(t *testing.T) {
+	testRevisionStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	db := openPostgresTestDB(t)
+
+	// Running the migrations again must be a no-op
+	if err := db.migrate(); err != nil {
+		t.Fatalf("Failed to rerun migrations: %v", err)
+	}
+
+	var dataType string
+	err := db.QueryRow(`
+	SELECT data_type FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = 'contracts' AND column_name = 'parties_json';`).Scan(&dataType)
+	if err != nil {
+		t.Fatalf("Failed to inspect contracts table: %v", err)
+	}
+	if dataType != "jsonb" {
+		t.Errorf("Expected parties_json to be jsonb, got %s", dataType)
+	}
+}
+
+func TestPostgresWebhooks(t *testing.T) {
+	testWebhookStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresSignatures(t *testing.T) {
+	testSignedContractStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresHashChain(t *testing.T) {
+	testHashChain(t, openPostgresTestDB)
+}
+
+func TestPostgresEncryption(t *testing.T) {
+	testEncryptedStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresUsers(t *testing.T) {
+	testUserStore(t, openPostgresTestDB(t))
+}
+
+func TestPostgresTenantIsolation(t *testing.T) {
+	testTenantIsolation(t, openPostgresTestDB(t))
+}
+
+func TestPostgresApprovals(t *testing.T) {
+	testApprovalStore(t, openPostgresTestDB(t))
+}
@@ -18,6 +18,11 @@ func TestDB(t *testing.T) {
 	}
 	defer db.Close()
 
+	testDB(t, db)
+}
+
+// testDB runs the database tests against an empty, initialized database
+func testDB(t *testing.T, db *DB) {
 	// Test contract
 	testContract := &Contract{
 		ID:     "TEST-001",
@@ -175,3 +180,56 @@ func TestInitDB(t *testing.T) {
 		}
 	})
 }
+
+func TestMigrations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	if err := db.StoreContract(&Contract{ID: "TEST-001", Title: "Test Contract", Status: "active"}); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	db.Close()
+
+	// Reopening an existing database must not reapply migrations or lose data
+	db, err = InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations;`).Scan(&count); err != nil {
+		t.Fatalf("Failed to count migrations: %v", err)
+	}
+	if count != len(migrations) {
+		t.Errorf("Expected %d applied migrations, got %d", len(migrations), count)
+	}
+
+	if _, err := db.GetContract("TEST-001"); err != nil {
+		t.Errorf("Expected contract to survive reopening: %v", err)
+	}
+}
+
+func TestDialectRebind(t *testing.T) {
+	query := `SELECT id FROM contracts WHERE id = ? AND status = ?;`
+
+	if got := dialectSQLite.rebind(query); got != query {
+		t.Errorf("Expected SQLite query to be unchanged, got %s", got)
+	}
+
+	expected := `SELECT id FROM contracts WHERE id = $1 AND status = $2;`
+	if got := dialectPostgres.rebind(query); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	t.Run("QuotedSections", func(t *testing.T) {
+		query := `SELECT "who?" FROM contracts WHERE title = 'Why?' AND note = 'It''s ?' AND id = ?;`
+		expected := `SELECT "who?" FROM contracts WHERE title = 'Why?' AND note = 'It''s ?' AND id = $1;`
+		if got := dialectPostgres.rebind(query); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	})
+}
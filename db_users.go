@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// userColumns lists the user columns in the order scanUser reads them
+const userColumns = `name, tenant, role, token_hash, created_at`
+
+// scanUser reads a user selected with userColumns
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	if err := row.Scan(&user.Name, &user.Tenant, &user.Role, &user.TokenHash, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AddUser stores a new user and sets its creation time. Users without a tenant
+// are added to the tenant of the database.
+func (db *DB) AddUser(user *User) error {
+	user.CreatedAt = time.Now().UTC()
+	if user.Tenant == "" {
+		user.Tenant = db.tenant
+	}
+	query := `INSERT INTO users (name, tenant, role, token_hash, created_at) VALUES (?, ?, ?, ?, ?);`
+	if _, err := db.Exec(db.dialect.rebind(query), user.Name, user.Tenant, user.Role, user.TokenHash, user.CreatedAt); err != nil {
+		if _, getErr := db.GetUser(user.Name); getErr == nil {
+			return fmt.Errorf("user %s already exists", user.Name)
+		}
+		return fmt.Errorf("error adding user: %v", err)
+	}
+	return nil
+}
+
+// Users returns every user of the tenant ordered by name
+func (db *DB) Users() ([]User, error) {
+	rows, err := db.Query(db.dialect.rebind(`SELECT `+userColumns+` FROM users WHERE tenant = ? ORDER BY name;`), db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %v", err)
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %v", err)
+	}
+	return users, nil
+}
+
+// HasUsers reports whether any tenant has users, which turns on access control
+func (db *DB) HasUsers() (bool, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users;`).Scan(&count); err != nil {
+		return false, fmt.Errorf("error counting users: %v", err)
+	}
+	return count > 0, nil
+}
+
+// GetUser returns a user of any tenant by name
+func (db *DB) GetUser(name string) (*User, error) {
+	user, err := db.queryUser(`WHERE name = ?`, name)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, name)
+	}
+	return user, err
+}
+
+// UserForToken returns the user an API token was issued to, given the hash of the token
+func (db *DB) UserForToken(tokenHash string) (*User, error) {
+	if tokenHash == "" {
+		return nil, ErrUserNotFound
+	}
+	return db.queryUser(`WHERE token_hash = ?`, tokenHash)
+}
+
+// queryUser returns the user selected by a WHERE clause
+func (db *DB) queryUser(where string, arg any) (*User, error) {
+	row := db.QueryRow(db.dialect.rebind(`SELECT `+userColumns+` FROM users `+where+`;`), arg)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %v", err)
+	}
+	return user, nil
+}
+
+// UpdateUser records the role and token hash of a user of the tenant
+func (db *DB) UpdateUser(user *User) error {
+	result, err := db.Exec(db.dialect.rebind(`UPDATE users SET role = ?, token_hash = ? WHERE tenant = ? AND name = ?;`), user.Role, user.TokenHash, db.tenant, user.Name)
+	if err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, user.Name)
+	}
+	return nil
+}
+
+// RemoveUser removes a user of the tenant
+func (db *DB) RemoveUser(name string) error {
+	result, err := db.Exec(db.dialect.rebind(`DELETE FROM users WHERE tenant = ? AND name = ?;`), db.tenant, name)
+	if err != nil {
+		return fmt.Errorf("error removing user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, name)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AddWebhook stores a new webhook of the tenant and sets its ID and creation time.
+// The secret is sealed once the webhook has the ID it is bound to.
+func (db *DB) AddWebhook(webhook *Webhook) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().UTC()
+	query := `
+	INSERT INTO webhooks (tenant, url, secret, events, created_at)
+	VALUES (?, ?, '', ?, ?)
+	RETURNING id;`
+	var id int64
+	if err := tx.QueryRow(db.dialect.rebind(query), db.tenant, webhook.URL, strings.Join(webhook.Events, ","), createdAt).Scan(&id); err != nil {
+		return fmt.Errorf("error adding webhook: %v", err)
+	}
+	secret, err := sealValue(db.key, []byte(webhook.Secret), webhookAAD(db.tenant, id))
+	if err != nil {
+		return fmt.Errorf("error encrypting webhook secret: %v", err)
+	}
+	if _, err := tx.Exec(db.dialect.rebind(`UPDATE webhooks SET secret = ? WHERE id = ?;`), secret, id); err != nil {
+		return fmt.Errorf("error adding webhook: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing webhook: %v", err)
+	}
+	webhook.ID, webhook.CreatedAt = id, createdAt
+	return nil
+}
+
+// openWebhookSecret decrypts the secret of a webhook of the tenant
+func (db *DB) openWebhookSecret(id int64, secret string) (string, error) {
+	plaintext, err := openValue(db.key, secret, webhookAAD(db.tenant, id))
+	if errors.Is(err, errNotEncrypted) {
+		return "", fmt.Errorf("error decrypting secret of webhook %d: it was added before secrets were encrypted; run rekey with the current key to encrypt it", id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret of webhook %d: %v", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// Webhooks returns every webhook of the tenant ordered by ID
+func (db *DB) Webhooks() ([]Webhook, error) {
+	rows, err := db.Query(db.dialect.rebind(`SELECT id, url, secret, events, created_at FROM webhooks WHERE tenant = ? ORDER BY id;`), db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhooks: %v", err)
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		var secret string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &secret, &events, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %v", err)
+		}
+		if webhook.Secret, err = db.openWebhookSecret(webhook.ID, secret); err != nil {
+			return nil, err
+		}
+		if events != "" {
+			webhook.Events = strings.Split(events, ",")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %v", err)
+	}
+	return webhooks, nil
+}
+
+// RemoveWebhook removes a webhook together with its deliveries
+func (db *DB) RemoveWebhook(id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(db.dialect.rebind(`DELETE FROM webhooks WHERE tenant = ? AND id = ?;`), db.tenant, id)
+	if err != nil {
+		return fmt.Errorf("error removing webhook: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %d", ErrWebhookNotFound, id)
+	}
+	if _, err := tx.Exec(db.dialect.rebind(`DELETE FROM webhook_deliveries WHERE webhook_id = ?;`), id); err != nil {
+		return fmt.Errorf("error removing webhook deliveries: %v", err)
+	}
+	return tx.Commit()
+}
+
+// EnqueueDeliveries adds deliveries to the outbox and sets their IDs. The payload
+// is kept as text rather than JSONB, so that it is sent byte for byte as it was signed,
+// and is encrypted like the contract it holds when the database has a key.
+func (db *DB) EnqueueDeliveries(deliveries []*WebhookDelivery) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.enqueueDeliveries(tx, deliveries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// enqueueDeliveries adds deliveries to the outbox within a transaction and sets their IDs
+func (db *DB) enqueueDeliveries(tx *sql.Tx, deliveries []*WebhookDelivery) error {
+	query := db.dialect.rebind(`
+	INSERT INTO webhook_deliveries (tenant, webhook_id, event_type, contract_id, payload, status, attempts, next_attempt_at, last_error, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id;`)
+	for _, d := range deliveries {
+		payload, err := sealValue(db.key, d.Payload, deliveryAAD(db.tenant, d.WebhookID, d.ContractID))
+		if err != nil {
+			return fmt.Errorf("error encrypting webhook payload: %v", err)
+		}
+		err = tx.QueryRow(query, db.tenant, d.WebhookID, d.Event, d.ContractID, payload, d.Status, d.Attempts,
+			d.NextAttempt.UTC(), d.LastError, d.CreatedAt.UTC()).Scan(&d.ID)
+		if err != nil {
+			return fmt.Errorf("error adding webhook delivery: %v", err)
+		}
+	}
+	return nil
+}
+
+// webhookDeliveryQuery selects deliveries with the URL and secret of their webhook, in the order scanWebhookDelivery reads them
+const webhookDeliveryQuery = `
+	SELECT d.id, d.webhook_id, w.url, w.secret, d.event_type, d.contract_id, d.payload,
+		d.status, d.attempts, d.next_attempt_at, d.last_error, d.created_at
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.id = d.webhook_id`
+
+// scanWebhookDelivery reads a delivery of the tenant selected with webhookDeliveryQuery,
+// decrypting its payload. Errors from Scan are returned unchanged so callers can
+// check for sql.ErrNoRows.
+func (db *DB) scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var secret, payload string
+	err := row.Scan(&d.ID, &d.WebhookID, &d.URL, &secret, &d.Event, &d.ContractID, &payload,
+		&d.Status, &d.Attempts, &d.NextAttempt, &d.LastError, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if d.secret, err = db.openWebhookSecret(d.WebhookID, secret); err != nil {
+		return nil, err
+	}
+	if d.Payload, err = openValue(db.key, payload, deliveryAAD(db.tenant, d.WebhookID, d.ContractID)); err != nil {
+		return nil, fmt.Errorf("error decrypting payload of delivery %d: %v", d.ID, err)
+	}
+	return &d, nil
+}
+
+// WebhookDeliveries returns the tenant's deliveries with the given status, or all of them, oldest first
+func (db *DB) WebhookDeliveries(status string) ([]*WebhookDelivery, error) {
+	query := webhookDeliveryQuery + ` WHERE d.tenant = ? ORDER BY d.id;`
+	args := []any{db.tenant}
+	if status != "" {
+		query = webhookDeliveryQuery + ` WHERE d.tenant = ? AND d.status = ? ORDER BY d.id;`
+		args = append(args, status)
+	}
+
+	rows, err := db.Query(db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := db.scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDelivery returns a delivery of the tenant by ID
+func (db *DB) GetWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	row := db.QueryRow(db.dialect.rebind(webhookDeliveryQuery+` WHERE d.tenant = ? AND d.id = ?;`), db.tenant, id)
+	delivery, err := db.scanWebhookDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no delivery %d", ErrWebhookNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook delivery: %v", err)
+	}
+	return delivery, nil
+}
+
+// UpdateWebhookDelivery records the status, attempts, next attempt and error of a delivery
+func (db *DB) UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?
+	WHERE tenant = ? AND id = ?;`
+
+	result, err := db.Exec(db.dialect.rebind(query), delivery.Status, delivery.Attempts, delivery.NextAttempt.UTC(), delivery.LastError, db.tenant, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: no delivery %d", ErrWebhookNotFound, delivery.ID)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of contract deadlines
+const (
+	deadlineEnd     = "end"
+	deadlineNotice  = "notice"
+	deadlinePayment = "payment"
+)
+
+// closedStatuses are the statuses of contracts that have no deadlines left
+var closedStatuses = map[string]bool{
+	"cancelled":  true,
+	"expired":    true,
+	"terminated": true,
+}
+
+// Deadline is an upcoming or overdue date of a contract
+type Deadline struct {
+	ContractID string `json:"contractId" table:"contract"`
+	Title      string `json:"title"`
+	// Kind is end, notice or payment
+	Kind string `json:"kind"`
+	Date string `json:"date"`
+	// DaysLeft is the number of days until the date, negative once it has passed
+	DaysLeft int  `json:"daysLeft" table:"days"`
+	Overdue  bool `json:"overdue"`
+	// Description says what is due, e.g. the amount of a payment
+	Description string `json:"description"`
+}
+
+// ContractDeadlines returns the deadlines of a contract that fall within the given
+// number of days from today, together with the ones that are overdue: payments
+// that were due before today and have not been paid, and the end of contracts
+// whose end date has passed while their status still shows them as open.
+// Contracts that are cancelled, expired or terminated have no deadlines.
+func ContractDeadlines(c *Contract, today time.Time, within int) []Deadline {
+	if closedStatuses[strings.ToLower(c.Status)] {
+		return nil
+	}
+
+	latest := c.latestTerms()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	var deadlines []Deadline
+	add := func(kind, date, description string, canBeOverdue bool) {
+		day, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return
+		}
+		days := int(day.Sub(today).Hours() / 24)
+		overdue := days < 0
+		if (overdue && !canBeOverdue) || days > within {
+			return
+		}
+		deadlines = append(deadlines, Deadline{
+			ContractID:  c.ID,
+			Title:       latest.Title,
+			Kind:        kind,
+			Date:        date,
+			DaysLeft:    days,
+			Overdue:     overdue,
+			Description: description,
+		})
+	}
+
+	if latest.Terms.EndDate != "" {
+		add(deadlineEnd, latest.Terms.EndDate, "Contract ends", true)
+	}
+	// A missed notice deadline cannot be made up for, so it is only reported ahead
+	if deadline := latest.Terms.NoticeDeadline(); deadline != "" {
+		add(deadlineNotice, deadline, fmt.Sprintf("Notice due %d days before the end date", latest.Terms.NoticePeriodDays), false)
+	}
+	for _, payment := range latest.Terms.Payments {
+		if payment.PaidDate != "" {
+			continue
+		}
+		description := strings.TrimSpace(fmt.Sprintf("Payment of %.2f %s", payment.Amount, latest.Terms.Currency))
+		if payment.Description != "" {
+			description += ": " + payment.Description
+		}
+		add(deadlinePayment, payment.DueDate, description, true)
+	}
+	return deadlines
+}
+
+// UpcomingDeadlines returns the deadlines of the contracts within the given number
+// of days from today and the overdue ones, ordered by date and contract ID
+func UpcomingDeadlines(contracts []*Contract, today time.Time, within int) []Deadline {
+	var deadlines []Deadline
+	for _, contract := range contracts {
+		deadlines = append(deadlines, ContractDeadlines(contract, today, within)...)
+	}
+
+	sort.SliceStable(deadlines, func(i, j int) bool {
+		if deadlines[i].Date != deadlines[j].Date {
+			return deadlines[i].Date < deadlines[j].Date
+		}
+		return deadlines[i].ContractID < deadlines[j].ContractID
+	})
+	return deadlines
+}
+
+// FindDeadlines returns the upcoming and overdue deadlines of the stored contracts that match the filter
+func FindDeadlines(store ContractStore, filter ContractFilter, today time.Time, within int) ([]Deadline, error) {
+	contracts, err := FindContracts(store, filter)
+	if err != nil {
+		return nil, err
+	}
+	return UpcomingDeadlines(contracts, today, within), nil
+}
+
+// parseDays parses a period such as 60d, 8w or 60 (days) into a number of days
+func parseDays(value string) (int, error) {
+	number, multiplier := strings.TrimSpace(value), 1
+	if trimmed, ok := strings.CutSuffix(number, "w"); ok {
+		number, multiplier = trimmed, 7
+	} else {
+		number = strings.TrimSuffix(number, "d")
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid period %q: expected days such as 60d or weeks such as 8w", value)
+	}
+	return n * multiplier, nil
+}
+
+// runExpiring implements the expiring command
+func runExpiring(args []string) error {
+	fs := newFlagSet("expiring")
+	within := fs.String("within", "30d", "Report deadlines up to this far ahead, in days (60d) or weeks (8w)")
+	asOf := fs.String("as-of", "", "Check deadlines as of this date (YYYY-MM-DD) instead of today")
+	filter := filterFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("expiring takes no arguments, use the filter flags to select contracts")
+	}
+
+	days, err := parseDays(*within)
+	if err != nil {
+		return err
+	}
+	today := time.Now()
+	if *asOf != "" {
+		today, err = time.Parse(dateLayout, *asOf)
+		if err != nil {
+			return fmt.Errorf("invalid -as-of date %s: expected YYYY-MM-DD", *asOf)
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	deadlines, err := FindDeadlines(store, filter(), today, days)
+	if err != nil {
+		return fmt.Errorf("error checking deadlines: %v", err)
+	}
+	if deadlines == nil {
+		deadlines = []Deadline{}
+	}
+
+	err = printResults(deadlines, func() {
+		if len(deadlines) == 0 {
+			fmt.Printf("Nothing is due within %d days\n", days)
+			return
+		}
+		writeResults(os.Stdout, outputTable, deadlines)
+	})
+	if err != nil {
+		return err
+	}
+
+	// A non-zero exit status lets cron jobs and scripts act on overdue deadlines
+	overdue := 0
+	for _, deadline := range deadlines {
+		if deadline.Overdue {
+			overdue++
+		}
+	}
+	if overdue > 0 {
+		return fmt.Errorf("%d deadline(s) are overdue", overdue)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestContractDeadlines(t *testing.T) {
+	// The contract ends on 2025-03-31 after its extension, with notice due 60 days
+	// earlier on 2025-01-30 and an unpaid payment due on 2024-07-15
+	tests := []struct {
+		name     string
+		today    string
+		within   int
+		change   func(c *Contract)
+		expected []string
+	}{
+		{
+			name:     "NothingDue",
+			today:    "2024-03-01",
+			within:   30,
+			expected: nil,
+		},
+		{
+			name:     "UpcomingPayment",
+			today:    "2024-07-01",
+			within:   30,
+			expected: []string{"payment 2024-07-15 14 false Payment of 600.00 USD: Second installment"},
+		},
+		{
+			name:   "OverduePaymentAndUpcomingNotice",
+			today:  "2025-01-10",
+			within: 60,
+			expected: []string{
+				"payment 2024-07-15 -179 true Payment of 600.00 USD: Second installment",
+				"notice 2025-01-30 20 false Notice due 60 days before the end date",
+			},
+		},
+		{
+			name:   "MissedNoticeIsNotReported",
+			today:  "2025-03-01",
+			within: 60,
+			change: func(c *Contract) { c.Terms.Payments = nil },
+			expected: []string{
+				"end 2025-03-31 30 false Contract ends",
+			},
+		},
+		{
+			name:   "LapsedWhileActive",
+			today:  "2025-04-02",
+			within: 0,
+			change: func(c *Contract) { c.Terms.Payments = nil },
+			expected: []string{
+				"end 2025-03-31 -2 true Contract ends",
+			},
+		},
+		{
+			name:     "DueToday",
+			today:    "2024-07-15",
+			within:   0,
+			expected: []string{"payment 2024-07-15 0 false Payment of 600.00 USD: Second installment"},
+		},
+		{
+			name:     "ClosedContract",
+			today:    "2025-04-02",
+			within:   60,
+			change:   func(c *Contract) { c.Status = "Expired" },
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := newTestContract("TEST-001", "active")
+			contract.Terms.NoticePeriodDays = 60
+			contract.Terms.Payments = []Payment{
+				{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+				{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+			}
+			if tt.change != nil {
+				tt.change(contract)
+			}
+
+			var got []string
+			for _, d := range UpcomingDeadlines([]*Contract{contract}, mustParseDate(t, tt.today), tt.within) {
+				if d.ContractID != contract.ID || d.Title != "Test Contract" {
+					t.Errorf("Unexpected contract in deadline %+v", d)
+				}
+				got = append(got, fmt.Sprintf("%s %s %d %v %s", d.Kind, d.Date, d.DaysLeft, d.Overdue, d.Description))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Unexpected deadlines\n--- got\n%s\n--- expected\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+func TestFindDeadlines(t *testing.T) {
+	store := NewMemoryStore()
+	first := newTestContract("TEST-001", "active")
+	first.Terms.NoticePeriodDays = 60
+	first.Terms.Payments = []Payment{{DueDate: "2024-07-15", Amount: 600}}
+	second := newTestContract("TEST-002", "pending")
+	second.Terms.NoticePeriodDays = 60
+	second.Terms.Payments = []Payment{{DueDate: "2024-07-10", Amount: 100}}
+	store.StoreContract(first)
+	store.StoreContract(second)
+
+	deadlines, err := FindDeadlines(store, ContractFilter{}, mustParseDate(t, "2024-07-01"), 30)
+	if err != nil {
+		t.Fatalf("Failed to find deadlines: %v", err)
+	}
+	if len(deadlines) != 2 || deadlines[0].ContractID != "TEST-002" || deadlines[1].ContractID != "TEST-001" {
+		t.Errorf("Expected the deadlines of both contracts in date order, got %+v", deadlines)
+	}
+
+	deadlines, err = FindDeadlines(store, ContractFilter{Statuses: []string{"active"}}, mustParseDate(t, "2024-07-01"), 30)
+	if err != nil {
+		t.Fatalf("Failed to find deadlines: %v", err)
+	}
+	if len(deadlines) != 1 || deadlines[0].ContractID != "TEST-001" {
+		t.Errorf("Expected only the active contract's deadline, got %+v", deadlines)
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		valid    bool
+	}{
+		{"60d", 60, true},
+		{"8w", 56, true},
+		{"14", 14, true},
+		{"0d", 0, true},
+		{"-1d", 0, false},
+		{"2m", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseDays(tt.value)
+		if tt.valid && (err != nil || got != tt.expected) {
+			t.Errorf("parseDays(%q): expected %d, got %d (%v)", tt.value, tt.expected, got, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("parseDays(%q): expected an error", tt.value)
+		}
+	}
+}
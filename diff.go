@@ -0,0 +1,583 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff output formats
+const (
+	diffText      = "text"
+	diffMarkdown  = "markdown"
+	diffJSONPatch = "json-patch"
+)
+
+// Kinds of contract changes
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// ContractChange is a difference between two versions of a contract
+type ContractChange struct {
+	// Op is added, removed or changed
+	Op string `json:"op"`
+	// Field names the changed value, e.g. terms.value or parties[jane@example.com].role
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+
+	// pointer is the JSON pointer of the value in the old contract, or of the
+	// array the value is appended to when it was added
+	pointer string
+}
+
+// contractField is a single-valued contract field compared by DiffContracts
+type contractField struct {
+	name    string
+	pointer string
+	value   func(c *Contract) any
+	// omitEmpty fields are left out of the JSON encoding when they are empty, so
+	// setting or clearing them adds or removes the field
+	omitEmpty bool
+}
+
+// contractFields lists the single-valued fields in the order changes are reported
+var contractFields = []contractField{
+	{name: "id", pointer: "/id", value: func(c *Contract) any { return c.ID }},
+	{name: "title", pointer: "/title", value: func(c *Contract) any { return c.Title }},
+	{name: "status", pointer: "/status", value: func(c *Contract) any { return c.Status }},
+	{name: "predecessorId", pointer: "/predecessorId", value: func(c *Contract) any { return c.PredecessorID }, omitEmpty: true},
+	{name: "terms.startDate", pointer: "/terms/startDate", value: func(c *Contract) any { return c.Terms.StartDate }},
+	{name: "terms.endDate", pointer: "/terms/endDate", value: func(c *Contract) any { return c.Terms.EndDate }},
+	{name: "terms.value", pointer: "/terms/value", value: func(c *Contract) any { return c.Terms.Value }},
+	{name: "terms.currency", pointer: "/terms/currency", value: func(c *Contract) any { return c.Terms.Currency }},
+	{name: "terms.noticePeriodDays", pointer: "/terms/noticePeriodDays", value: func(c *Contract) any { return c.Terms.NoticePeriodDays }, omitEmpty: true},
+}
+
+// DiffContracts compares two contracts field by field. Parties are matched by email
+// and then by name, so reordering them is not a change; payments are matched by due
+// date and description, and amendments by effective date and description. Amounts
+// are compared exactly, without rounding.
+func DiffContracts(a, b *Contract) []ContractChange {
+	var changes []ContractChange
+	for _, field := range contractFields {
+		old, new := field.value(a), field.value(b)
+		if old == new {
+			continue
+		}
+		change := ContractChange{Op: changeChanged, Field: field.name, Old: old, New: new, pointer: field.pointer}
+		if field.omitEmpty && reflect.ValueOf(old).IsZero() {
+			change.Op, change.Old = changeAdded, nil
+		} else if field.omitEmpty && reflect.ValueOf(new).IsZero() {
+			change.Op, change.New = changeRemoved, nil
+		}
+		changes = append(changes, change)
+	}
+
+	changes = append(changes, diffPayments(a.Terms.Payments, b.Terms.Payments)...)
+	changes = append(changes, diffParties(a.Parties, b.Parties)...)
+	changes = append(changes, diffAmendments(a.Amendments, b.Amendments)...)
+	return changes
+}
+
+// partyKey identifies a party in change field names by its email, or its name when it has none
+func partyKey(p Party) string {
+	if p.Email != "" {
+		return p.Email
+	}
+	return p.Name
+}
+
+// matchParties pairs the index of each party in b with the index of the same party
+// in a, matching by email first and then by name, both ignoring case
+func matchParties(a, b []Party) map[int]int {
+	matches := make(map[int]int)
+	used := make(map[int]bool)
+	match := func(same func(x, y Party) bool) {
+		for j, party := range b {
+			if _, ok := matches[j]; ok {
+				continue
+			}
+			for i, candidate := range a {
+				if !used[i] && same(candidate, party) {
+					matches[j] = i
+					used[i] = true
+					break
+				}
+			}
+		}
+	}
+
+	match(func(x, y Party) bool { return x.Email != "" && strings.EqualFold(x.Email, y.Email) })
+	match(func(x, y Party) bool { return x.Name != "" && strings.EqualFold(x.Name, y.Name) })
+	return matches
+}
+
+// diffParties compares the parties of two contracts
+func diffParties(a, b []Party) []ContractChange {
+	matches := matchParties(a, b)
+	matched := make(map[int]bool)
+	for _, i := range matches {
+		matched[i] = true
+	}
+
+	var changes []ContractChange
+	for j, party := range b {
+		i, ok := matches[j]
+		if !ok {
+			continue
+		}
+		old := a[i]
+		key := partyKey(old)
+		fields := []struct{ name, old, new string }{
+			{"name", old.Name, party.Name},
+			{"role", old.Role, party.Role},
+			{"email", old.Email, party.Email},
+		}
+		for _, field := range fields {
+			if field.old != field.new {
+				changes = append(changes, ContractChange{
+					Op:      changeChanged,
+					Field:   fmt.Sprintf("parties[%s].%s", key, field.name),
+					Old:     field.old,
+					New:     field.new,
+					pointer: fmt.Sprintf("/parties/%d/%s", i, field.name),
+				})
+			}
+		}
+	}
+
+	for i, party := range a {
+		if !matched[i] {
+			changes = append(changes, ContractChange{
+				Op:      changeRemoved,
+				Field:   fmt.Sprintf("parties[%s]", partyKey(party)),
+				Old:     party,
+				pointer: fmt.Sprintf("/parties/%d", i),
+			})
+		}
+	}
+	for j, party := range b {
+		if _, ok := matches[j]; !ok {
+			changes = append(changes, ContractChange{
+				Op:      changeAdded,
+				Field:   fmt.Sprintf("parties[%s]", partyKey(party)),
+				New:     party,
+				pointer: "/parties/-",
+			})
+		}
+	}
+	return changes
+}
+
+// amendmentKey identifies an amendment in change field names
+func amendmentKey(a Amendment) string {
+	if a.Description == "" {
+		return a.EffectiveDate
+	}
+	return a.EffectiveDate + " " + a.Description
+}
+
+// diffAmendments compares the amendments of two contracts
+func diffAmendments(a, b []Amendment) []ContractChange {
+	indexes := make(map[string]int)
+	for i, amendment := range a {
+		if _, ok := indexes[amendmentKey(amendment)]; !ok {
+			indexes[amendmentKey(amendment)] = i
+		}
+	}
+
+	var changes, added []ContractChange
+	matched := make(map[int]bool)
+	for _, amendment := range b {
+		key := amendmentKey(amendment)
+		i, ok := indexes[key]
+		if !ok || matched[i] {
+			added = append(added, ContractChange{
+				Op:      changeAdded,
+				Field:   fmt.Sprintf("amendments[%s]", key),
+				New:     amendment,
+				pointer: "/amendments/-",
+			})
+			continue
+		}
+		matched[i] = true
+		if !reflect.DeepEqual(a[i].Changes, amendment.Changes) {
+			changes = append(changes, ContractChange{
+				Op:      changeChanged,
+				Field:   fmt.Sprintf("amendments[%s].changes", key),
+				Old:     a[i].Changes,
+				New:     amendment.Changes,
+				pointer: fmt.Sprintf("/amendments/%d/changes", i),
+			})
+		}
+	}
+
+	for i, amendment := range a {
+		if !matched[i] {
+			changes = append(changes, ContractChange{
+				Op:      changeRemoved,
+				Field:   fmt.Sprintf("amendments[%s]", amendmentKey(amendment)),
+				Old:     amendment,
+				pointer: fmt.Sprintf("/amendments/%d", i),
+			})
+		}
+	}
+	return append(changes, added...)
+}
+
+// paymentKey identifies a payment in change field names
+func paymentKey(p Payment) string {
+	if p.Description == "" {
+		return p.DueDate
+	}
+	return p.DueDate + " " + p.Description
+}
+
+// diffPayments compares the payment schedules of two contracts
+func diffPayments(a, b []Payment) []ContractChange {
+	indexes := make(map[string]int)
+	for i, payment := range a {
+		if _, ok := indexes[paymentKey(payment)]; !ok {
+			indexes[paymentKey(payment)] = i
+		}
+	}
+
+	var changes, added []ContractChange
+	matched := make(map[int]bool)
+	for _, payment := range b {
+		key := paymentKey(payment)
+		i, ok := indexes[key]
+		if !ok || matched[i] {
+			added = append(added, ContractChange{
+				Op:      changeAdded,
+				Field:   fmt.Sprintf("terms.payments[%s]", key),
+				New:     payment,
+				pointer: "/terms/payments/-",
+			})
+			continue
+		}
+		matched[i] = true
+
+		old := a[i]
+		if old.Amount != payment.Amount {
+			changes = append(changes, ContractChange{
+				Op:      changeChanged,
+				Field:   fmt.Sprintf("terms.payments[%s].amount", key),
+				Old:     old.Amount,
+				New:     payment.Amount,
+				pointer: fmt.Sprintf("/terms/payments/%d/amount", i),
+			})
+		}
+		if old.PaidDate != payment.PaidDate {
+			change := ContractChange{
+				Op:      changeChanged,
+				Field:   fmt.Sprintf("terms.payments[%s].paidDate", key),
+				Old:     old.PaidDate,
+				New:     payment.PaidDate,
+				pointer: fmt.Sprintf("/terms/payments/%d/paidDate", i),
+			}
+			if old.PaidDate == "" {
+				change.Op, change.Old = changeAdded, nil
+			} else if payment.PaidDate == "" {
+				change.Op, change.New = changeRemoved, nil
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for i, payment := range a {
+		if !matched[i] {
+			changes = append(changes, ContractChange{
+				Op:      changeRemoved,
+				Field:   fmt.Sprintf("terms.payments[%s]", paymentKey(payment)),
+				Old:     payment,
+				pointer: fmt.Sprintf("/terms/payments/%d", i),
+			})
+		}
+	}
+	return append(changes, added...)
+}
+
+// jsonPatchOp is an RFC 6902 JSON patch operation
+type jsonPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// JSONPatch converts changes between contracts a and b into an RFC 6902 patch that
+// turns the JSON encoding of a into a contract equal to b. Parties and amendments
+// added by the patch are appended, so their order may differ from b.
+func JSONPatch(a *Contract, changes []ContractChange) []jsonPatchOp {
+	var replaced, removed, added []jsonPatchOp
+	for _, change := range changes {
+		switch change.Op {
+		case changeChanged:
+			replaced = append(replaced, jsonPatchOp{Op: "replace", Path: change.pointer, Value: change.New})
+		case changeRemoved:
+			removed = append(removed, jsonPatchOp{Op: "remove", Path: change.pointer})
+		default:
+			added = append(added, jsonPatchOp{Op: "add", Path: change.pointer, Value: change.New})
+		}
+	}
+
+	// Remove array elements from the back so the indexes of the others stay valid
+	sort.SliceStable(removed, func(i, j int) bool {
+		arrayI, indexI, okI := cutArrayIndex(removed[i].Path)
+		arrayJ, indexJ, okJ := cutArrayIndex(removed[j].Path)
+		return okI && okJ && arrayI == arrayJ && indexI > indexJ
+	})
+
+	// An empty list of parties is encoded as null and empty payment schedules and
+	// amendments are left out, so nothing can be appended to them; the whole list
+	// is added instead
+	added = addWholeArray(added, "/parties", len(a.Parties))
+	added = addWholeArray(added, "/terms/payments", len(a.Terms.Payments))
+	added = addWholeArray(added, "/amendments", len(a.Amendments))
+
+	// Removing every payment or amendment removes the field, as b's encoding has none
+	removed = removeWholeArray(removed, added, "/terms/payments", len(a.Terms.Payments))
+	removed = removeWholeArray(removed, added, "/amendments", len(a.Amendments))
+
+	patch := append(replaced, removed...)
+	return append(patch, added...)
+}
+
+// addWholeArray replaces the operations appending to an array that was empty in
+// the old contract with one operation adding the whole array
+func addWholeArray(ops []jsonPatchOp, array string, length int) []jsonPatchOp {
+	if length > 0 || !appendsTo(ops, array) {
+		return ops
+	}
+
+	var kept []jsonPatchOp
+	var values []any
+	for _, op := range ops {
+		if op.Path == array+"/-" {
+			values = append(values, op.Value)
+		} else {
+			kept = append(kept, op)
+		}
+	}
+	return append(kept, jsonPatchOp{Op: "add", Path: array, Value: values})
+}
+
+// removeWholeArray replaces the operations removing every element of an array that
+// is left out of the JSON encoding when empty with one operation removing the array
+func removeWholeArray(removed, added []jsonPatchOp, array string, length int) []jsonPatchOp {
+	if length == 0 || countArrayOps(removed, array) != length || appendsTo(added, array) {
+		return removed
+	}
+
+	var kept []jsonPatchOp
+	for _, op := range removed {
+		if parent, _, ok := cutArrayIndex(op.Path); !ok || parent != array {
+			kept = append(kept, op)
+		}
+	}
+	return append(kept, jsonPatchOp{Op: "remove", Path: array})
+}
+
+// countArrayOps counts the operations on single elements of the array
+func countArrayOps(ops []jsonPatchOp, array string) int {
+	n := 0
+	for _, op := range ops {
+		if parent, _, ok := cutArrayIndex(op.Path); ok && parent == array {
+			n++
+		}
+	}
+	return n
+}
+
+// cutArrayIndex splits a pointer such as /parties/2 into the array and index
+func cutArrayIndex(pointer string) (string, int, bool) {
+	slash := strings.LastIndex(pointer, "/")
+	if slash <= 0 {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(pointer[slash+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return pointer[:slash], index, true
+}
+
+// appendsTo reports whether an operation appends to the array
+func appendsTo(ops []jsonPatchOp, array string) bool {
+	for _, op := range ops {
+		if op.Path == array+"/-" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatChangeValue formats a changed value for people
+func formatChangeValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case Party:
+		text := v.Name
+		if v.Email != "" {
+			text += " <" + v.Email + ">"
+		}
+		if v.Role != "" {
+			text += " (" + v.Role + ")"
+		}
+		return text
+	case Payment:
+		text := strconv.FormatFloat(v.Amount, 'f', -1, 64) + " due " + v.DueDate
+		if v.PaidDate != "" {
+			text += ", paid " + v.PaidDate
+		}
+		return text
+	case Amendment:
+		return strconv.Quote(v.Description) + " effective " + v.EffectiveDate
+	case AmendmentChanges:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeDiffText writes changes one per line, prefixed with +, - or ~
+func writeDiffText(w io.Writer, changes []ContractChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No differences")
+		return err
+	}
+
+	for _, change := range changes {
+		var err error
+		switch change.Op {
+		case changeAdded:
+			_, err = fmt.Fprintf(w, "+ %s: %s\n", change.Field, formatChangeValue(change.New))
+		case changeRemoved:
+			_, err = fmt.Fprintf(w, "- %s: %s\n", change.Field, formatChangeValue(change.Old))
+		default:
+			_, err = fmt.Fprintf(w, "~ %s: %s -> %s\n", change.Field, formatChangeValue(change.Old), formatChangeValue(change.New))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDiffMarkdown writes changes as a markdown table
+func writeDiffMarkdown(w io.Writer, changes []ContractChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No differences.")
+		return err
+	}
+
+	// Pipes would end the cell, even inside code spans
+	escape := func(text string) string {
+		return strings.ReplaceAll(text, "|", `\|`)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("| Field | Change | Before | After |\n")
+	sb.WriteString("|-------|--------|--------|-------|\n")
+	for _, change := range changes {
+		fmt.Fprintf(&sb, "| `%s` | %s | %s | %s |\n", escape(change.Field), change.Op,
+			escape(formatChangeValue(change.Old)), escape(formatChangeValue(change.New)))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// loadDiffContract loads a contract file, or the stored contract named by an ID or ID@version
+func loadDiffContract(ref string, store func() (ContractStore, error)) (*Contract, error) {
+	if pathExists(ref) {
+		return LoadContract(ref)
+	}
+
+	s, err := store()
+	if err != nil {
+		return nil, err
+	}
+	return getContractRef(s, ref)
+}
+
+// runDiff implements the diff command
+func runDiff(args []string) error {
+	fs := newFlagSet("diff")
+	format := fs.String("format", diffText, "Output format: text, markdown or json-patch")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("diff requires two contracts to compare")
+	}
+	if *format != diffText && *format != diffMarkdown && *format != diffJSONPatch {
+		return fmt.Errorf("unknown diff format %q (use text, markdown or json-patch)", *format)
+	}
+
+	// The store is only opened when a contract is not given as a file
+	var store ContractStore
+	openOnce := func() (ContractStore, error) {
+		if store == nil {
+			s, err := openStore()
+			if err != nil {
+				return nil, err
+			}
+			store = s
+		}
+		return store, nil
+	}
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+	}()
+
+	a, err := loadDiffContract(positional[0], openOnce)
+	if err != nil {
+		return err
+	}
+	b, err := loadDiffContract(positional[1], openOnce)
+	if err != nil {
+		return err
+	}
+	changes := DiffContracts(a, b)
+
+	switch {
+	case *format == diffJSONPatch:
+		patch := JSONPatch(a, changes)
+		if patch == nil {
+			patch = []jsonPatchOp{}
+		}
+		data, err := json.MarshalIndent(patch, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding JSON patch: %v", err)
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	case structuredOutput():
+		if changes == nil {
+			changes = []ContractChange{}
+		}
+		return printResults(changes, nil)
+	case *format == diffMarkdown:
+		return writeDiffMarkdown(os.Stdout, changes)
+	default:
+		return writeDiffText(os.Stdout, changes)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffContracts(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *Contract)
+		expected []string
+	}{
+		{
+			name:   "Identical",
+			change: func(c *Contract) {},
+		},
+		{
+			name: "ReorderedParties",
+			change: func(c *Contract) {
+				c.Parties[0], c.Parties[1] = c.Parties[1], c.Parties[0]
+			},
+		},
+		{
+			name: "Fields",
+			change: func(c *Contract) {
+				c.Title = "Premium Test Contract"
+				c.Terms.EndDate = "2025-12-31"
+				c.PredecessorID = "TEST-000"
+			},
+			expected: []string{
+				`changed title "Test Contract" -> "Premium Test Contract"`,
+				`added predecessorId <nil> -> "TEST-000"`,
+				`changed terms.endDate "2024-12-31" -> "2025-12-31"`,
+			},
+		},
+		{
+			name:     "MoneyComparedExactly",
+			change:   func(c *Contract) { c.Terms.Value = 1000.001 },
+			expected: []string{`changed terms.value 1000 -> 1000.001`},
+		},
+		{
+			name: "PartyMatchedByEmail",
+			change: func(c *Contract) {
+				c.Parties[0].Name = "Test Client Ltd"
+				c.Parties[0].Email = "CLIENT@example.com"
+			},
+			expected: []string{
+				`changed parties[client@example.com].name "Test Client" -> "Test Client Ltd"`,
+				`changed parties[client@example.com].email "client@example.com" -> "CLIENT@example.com"`,
+			},
+		},
+		{
+			name: "PartyMatchedByName",
+			change: func(c *Contract) {
+				c.Parties[1].Email = "jane@example.com"
+				c.Parties[1].Role = "contractor"
+			},
+			expected: []string{
+				`changed parties[Jane Smith].role "Provider" -> "contractor"`,
+				`changed parties[Jane Smith].email "" -> "jane@example.com"`,
+			},
+		},
+		{
+			name: "PartyReplaced",
+			change: func(c *Contract) {
+				c.Parties[1] = Party{Name: "Bob Jones", Role: "Provider", Email: "bob@example.com"}
+			},
+			expected: []string{
+				`removed parties[Jane Smith] Jane Smith (Provider) -> <nil>`,
+				`added parties[bob@example.com] <nil> -> Bob Jones <bob@example.com> (Provider)`,
+			},
+		},
+		{
+			name: "NoticePeriodAndPayments",
+			change: func(c *Contract) {
+				c.Terms.NoticePeriodDays = 30
+				c.Terms.Payments = []Payment{{DueDate: "2024-03-01", Amount: 500, PaidDate: "2024-02-28"}}
+			},
+			expected: []string{
+				`added terms.noticePeriodDays <nil> -> 30`,
+				`added terms.payments[2024-03-01] <nil> -> 500 due 2024-03-01, paid 2024-02-28`,
+			},
+		},
+		{
+			name: "Amendments",
+			change: func(c *Contract) {
+				c.Amendments[1].Changes.Value = floatPtr(1250)
+				c.Amendments = append(c.Amendments, Amendment{EffectiveDate: "2024-10-01", Description: "Renamed", Changes: AmendmentChanges{Title: stringPtr("Support")}})
+			},
+			expected: []string{
+				`changed amendments[2024-04-01 Price increase].changes {"value":1200} -> {"value":1250}`,
+				`added amendments[2024-10-01 Renamed] <nil> -> "Renamed" effective 2024-10-01`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestContract("TEST-001", "active"), newTestContract("TEST-001", "active")
+			for _, c := range []*Contract{a, b} {
+				c.Parties = append(c.Parties, Party{Name: "Jane Smith", Role: "Provider"})
+			}
+			tt.change(b)
+
+			var got []string
+			for _, change := range DiffContracts(a, b) {
+				old, new := formatChangeValue(change.Old), formatChangeValue(change.New)
+				if change.Old == nil {
+					old = "<nil>"
+				}
+				if change.New == nil {
+					new = "<nil>"
+				}
+				got = append(got, fmt.Sprintf("%s %s %s -> %s", change.Op, change.Field, old, new))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Unexpected changes\n--- got\n%s\n--- expected\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(a, b *Contract)
+	}{
+		{
+			name: "Fields",
+			change: func(a, b *Contract) {
+				b.Title = ""
+				b.Status = "terminated"
+				b.Terms.Value = 0
+				b.PredecessorID = "TEST-000"
+			},
+		},
+		{
+			name:   "ClearPredecessor",
+			change: func(a, b *Contract) { a.PredecessorID = "TEST-000" },
+		},
+		{
+			name: "Parties",
+			change: func(a, b *Contract) {
+				a.Parties = append(a.Parties, Party{Name: "Old Co", Role: "guarantor"}, Party{Name: "Older Co", Role: "guarantor"})
+				b.Parties = []Party{
+					{Name: "New Co", Role: "guarantor"},
+					{Name: "Jane Smith", Role: "contractor"},
+					{Name: "Test Client", Role: "Client", Email: "client@example.com"},
+				}
+			},
+		},
+		{
+			name: "Payments",
+			change: func(a, b *Contract) {
+				a.Terms.NoticePeriodDays = 30
+				a.Terms.Payments = []Payment{
+					{DueDate: "2024-03-01", Amount: 500},
+					{DueDate: "2024-06-01", Amount: 500, PaidDate: "2024-05-30"},
+					{DueDate: "2024-09-01", Amount: 500},
+				}
+				b.Terms.Payments = []Payment{
+					{DueDate: "2024-03-01", Amount: 500.5, PaidDate: "2024-03-01"},
+					{DueDate: "2024-06-01", Amount: 500},
+					{DueDate: "2024-12-01", Amount: 500},
+				}
+			},
+		},
+		{
+			name: "AddFirstPayments",
+			change: func(a, b *Contract) {
+				b.Terms.Payments = []Payment{{DueDate: "2024-03-01", Amount: 500}}
+			},
+		},
+		{
+			name: "RemoveAllPayments",
+			change: func(a, b *Contract) {
+				a.Terms.Payments = []Payment{{DueDate: "2024-03-01", Amount: 500}, {DueDate: "2024-04-01", Amount: 500}}
+			},
+		},
+		{
+			name: "AddFirstParties",
+			change: func(a, b *Contract) {
+				a.Parties = nil
+			},
+		},
+		{
+			name: "AddFirstAmendment",
+			change: func(a, b *Contract) {
+				a.Amendments = nil
+			},
+		},
+		{
+			name: "RemoveAllAmendments",
+			change: func(a, b *Contract) {
+				a.Amendments = append(a.Amendments, Amendment{EffectiveDate: "2024-10-01", Description: "Later"})
+				b.Amendments = nil
+			},
+		},
+		{
+			name: "ReplaceAllAmendments",
+			change: func(a, b *Contract) {
+				b.Amendments = []Amendment{{EffectiveDate: "2024-03-01", Description: "Earlier", Changes: AmendmentChanges{Status: stringPtr("pending")}}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestContract("TEST-001", "active"), newTestContract("TEST-001", "active")
+			for _, c := range []*Contract{a, b} {
+				c.Parties = append(c.Parties, Party{Name: "Jane Smith", Role: "Provider"})
+			}
+			tt.change(a, b)
+
+			patch := JSONPatch(a, DiffContracts(a, b))
+			patched := applyJSONPatch(t, a, patch)
+			if changes := DiffContracts(patched, b); len(changes) != 0 {
+				data, _ := json.Marshal(patch)
+				t.Errorf("Patch %s leaves differences: %+v", data, changes)
+			}
+		})
+	}
+}
+
+// applyJSONPatch applies the add, remove and replace operations of an RFC 6902
+// patch to the JSON encoding of a contract
+func applyJSONPatch(t *testing.T, c *Contract, patch []jsonPatchOp) *Contract {
+	t.Helper()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to encode contract: %v", err)
+	}
+	var doc any
+	json.Unmarshal(data, &doc)
+
+	for _, op := range patch {
+		// Round-trip the value so it has the same types as the decoded document
+		var value any
+		encoded, _ := json.Marshal(op.Value)
+		json.Unmarshal(encoded, &value)
+		doc = applyPatchOp(t, doc, strings.Split(op.Path, "/")[1:], op.Op, value)
+	}
+
+	data, _ = json.Marshal(doc)
+	var patched Contract
+	if err := json.Unmarshal(data, &patched); err != nil {
+		t.Fatalf("Failed to decode patched contract: %v", err)
+	}
+	return &patched
+}
+
+// applyPatchOp applies a patch operation at the path below node and returns the new node
+func applyPatchOp(t *testing.T, node any, path []string, op string, value any) any {
+	t.Helper()
+
+	key, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		if !last {
+			n[key] = applyPatchOp(t, n[key], path[1:], op, value)
+			return n
+		}
+		if _, exists := n[key]; !exists && op != "add" {
+			t.Fatalf("Cannot %s missing member %s", op, key)
+		}
+		if op == "remove" {
+			delete(n, key)
+		} else {
+			n[key] = value
+		}
+		return n
+	case []any:
+		if last && key == "-" && op == "add" {
+			return append(n, value)
+		}
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(n) {
+			t.Fatalf("Invalid array index %s for %d elements", key, len(n))
+		}
+		if !last {
+			n[index] = applyPatchOp(t, n[index], path[1:], op, value)
+			return n
+		}
+		switch op {
+		case "remove":
+			return append(n[:index], n[index+1:]...)
+		case "replace":
+			n[index] = value
+			return n
+		}
+	}
+	t.Fatalf("Cannot apply %s at %s", op, strings.Join(path, "/"))
+	return nil
+}
+
+func TestWriteDiff(t *testing.T) {
+	a, b := newTestContract("TEST-001", "active"), newTestContract("TEST-001", "active")
+	b.Terms.Value = 1500
+	b.Parties = append(b.Parties, Party{Name: "Pipe | Co", Role: "guarantor"})
+	changes := DiffContracts(a, b)
+
+	t.Run("Text", func(t *testing.T) {
+		var sb strings.Builder
+		if err := writeDiffText(&sb, changes); err != nil {
+			t.Fatalf("Failed to write diff: %v", err)
+		}
+		expected := "~ terms.value: 1000 -> 1500\n+ parties[Pipe | Co]: Pipe | Co (guarantor)\n"
+		if sb.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, sb.String())
+		}
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		var sb strings.Builder
+		if err := writeDiffMarkdown(&sb, changes); err != nil {
+			t.Fatalf("Failed to write diff: %v", err)
+		}
+		expected := "| Field | Change | Before | After |\n" +
+			"|-------|--------|--------|-------|\n" +
+			"| `terms.value` | changed | 1000 | 1500 |\n" +
+			"| `parties[Pipe \\| Co]` | added |  | Pipe \\| Co (guarantor) |\n"
+		if sb.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, sb.String())
+		}
+	})
+
+	t.Run("NoDifferences", func(t *testing.T) {
+		var sb strings.Builder
+		writeDiffText(&sb, nil)
+		if sb.String() != "No differences\n" {
+			t.Errorf("Expected no differences, got %q", sb.String())
+		}
+	})
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// encryptionKeyEnv names the environment variable that holds the base64 encoded
+// encryption key when -key-file is not given
+const encryptionKeyEnv = "GOPLAYGROUND_ENCRYPTION_KEY"
+
+// errNotEncrypted is returned for a plain value read with a key
+var errNotEncrypted = errors.New("value is not encrypted, although the database is")
+
+// sealedAlgorithm identifies values encrypted with AES-256-GCM under a data key
+// that is itself encrypted with the master key
+const sealedAlgorithm = "A256GCM"
+
+// EncryptionKey is a 256-bit master key. Every encrypted value has a random data
+// key of its own, which is stored with the value encrypted by the master key, so
+// changing the master key only re-encrypts the data keys.
+type EncryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewEncryptionKey returns the master key for 32 random bytes
+func NewEncryptionKey(raw []byte) (*EncryptionKey, error) {
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("invalid encryption key: expected 32 bytes, got %d", len(raw))
+	}
+	aead, err := newGCM(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("goplayground key id\n"), raw...))
+	return &EncryptionKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// ParseEncryptionKey decodes a base64 encoded key, as written by: openssl rand -base64 32
+func ParseEncryptionKey(text string) (*EncryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: expected base64: %v", err)
+	}
+	return NewEncryptionKey(raw)
+}
+
+// LoadEncryptionKey reads a base64 encoded key from a file
+func LoadEncryptionKey(path string) (*EncryptionKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption key: %v", err)
+	}
+	key, err := ParseEncryptionKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// ID returns a fingerprint that identifies the key without revealing it
+func (k *EncryptionKey) ID() string {
+	return k.id
+}
+
+// newGCM returns AES-GCM for a 256-bit key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return aead, nil
+}
+
+// sealedValue is the JSON stored in place of an encrypted column value. It is
+// itself JSON so that it fits the JSONB columns of PostgreSQL.
+type sealedValue struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// DataKey is the data key encrypted with the master key, nonce first
+	DataKey string `json:"dek"`
+	// Data is the value encrypted with the data key, nonce first
+	Data string `json:"ct"`
+}
+
+// parseSealed returns the sealed value stored in a column, or false when the
+// column holds a plain JSON value
+func parseSealed(value string) (sealedValue, bool) {
+	var sealed sealedValue
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") || json.Unmarshal([]byte(value), &sealed) != nil {
+		return sealedValue{}, false
+	}
+	return sealed, sealed.Algorithm == sealedAlgorithm && sealed.Data != ""
+}
+
+// encrypt seals plaintext with AES-GCM and returns the nonce followed by the ciphertext
+func encrypt(aead cipher.AEAD, plaintext []byte, aad string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(aad)), nil
+}
+
+// decrypt opens the output of encrypt
+func decrypt(aead cipher.AEAD, sealed []byte, aad string) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+}
+
+// wrapDataKey encrypts a data key with the master key
+func (k *EncryptionKey) wrapDataKey(dataKey []byte) (string, error) {
+	wrapped, err := encrypt(k.aead, dataKey, k.id)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// unwrapDataKey decrypts the data key of a sealed value with the master key
+func (k *EncryptionKey) unwrapDataKey(sealed sealedValue) ([]byte, error) {
+	if sealed.KeyID != k.id {
+		return nil, fmt.Errorf("value is encrypted with key %s, not %s", sealed.KeyID, k.id)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(sealed.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %v", err)
+	}
+	dataKey, err := decrypt(k.aead, wrapped, k.id)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// sealValue encrypts a column value under a new data key. The additional data
+// binds the value to its row, so that it cannot be moved to another contract.
+// Without a key the value is returned unchanged.
+func sealValue(key *EncryptionKey, plaintext []byte, aad string) (string, error) {
+	if key == nil {
+		return string(plaintext), nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("error generating data key: %v", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := encrypt(aead, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := key.wrapDataKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := json.Marshal(sealedValue{Algorithm: sealedAlgorithm, KeyID: key.id, DataKey: wrapped, Data: base64.StdEncoding.EncodeToString(data)})
+	if err != nil {
+		return "", fmt.Errorf("error encoding encrypted value: %v", err)
+	}
+	return string(sealed), nil
+}
+
+// openValue returns the plaintext of a column value written by sealValue. Without
+// a key, plain values are returned unchanged; with one they are an error, since
+// every value of an encrypted database is sealed and a plain one was put there
+// behind its back.
+func openValue(key *EncryptionKey, value string, aad string) ([]byte, error) {
+	sealed, ok := parseSealed(value)
+	if !ok {
+		if key != nil {
+			return nil, errNotEncrypted
+		}
+		return []byte(value), nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("value is encrypted with key %s; set -key-file or %s", sealed.KeyID, encryptionKeyEnv)
+	}
+	dataKey, err := key.unwrapDataKey(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %v", err)
+	}
+	plaintext, err := decrypt(aead, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting value: %v", err)
+	}
+	return plaintext, nil
+}
+
+// rekeyValue re-encrypts a column value for another key. Sealed values keep their
+// data and data key, which is re-encrypted with the new key; plain values are
+// sealed, and without a new key values are decrypted. Plain values in an encrypted
+// database are only accepted when decrypting it.
+func rekeyValue(from, to *EncryptionKey, value string, aad string) (string, error) {
+	sealed, ok := parseSealed(value)
+	if !ok {
+		if from != nil && to != nil {
+			return "", errNotEncrypted
+		}
+		return sealValue(to, []byte(value), aad)
+	}
+	if from == nil {
+		return "", fmt.Errorf("value is encrypted with key %s; set -key-file or %s", sealed.KeyID, encryptionKeyEnv)
+	}
+	if to == nil {
+		plaintext, err := openValue(from, value, aad)
+		return string(plaintext), err
+	}
+
+	dataKey, err := from.unwrapDataKey(sealed)
+	if err != nil {
+		return "", err
+	}
+	// Check the data before trusting it to the new key
+	if _, err := openValue(from, value, aad); err != nil {
+		return "", err
+	}
+	sealed.KeyID = to.id
+	if sealed.DataKey, err = to.wrapDataKey(dataKey); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return "", fmt.Errorf("error encoding encrypted value: %v", err)
+	}
+	return string(data), nil
+}
+
+// columnAAD returns the additional data that binds an encrypted contracts column to its row
+func columnAAD(tenant, column, id string) string {
+	return "contracts." + column + "\n" + id + tenantSuffix(tenant)
+}
+
+// revisionAAD returns the additional data that binds an encrypted revision to its row
+func revisionAAD(tenant, id string, version int) string {
+	return fmt.Sprintf("contract_revisions.contract_json\n%s\n%d", id, version) + tenantSuffix(tenant)
+}
+
+// deliveryAAD returns the additional data that binds an encrypted webhook payload
+// to the webhook and contract of its delivery
+func deliveryAAD(tenant string, webhookID int64, contractID string) string {
+	return fmt.Sprintf("webhook_deliveries.payload\n%d\n%s", webhookID, contractID) + tenantSuffix(tenant)
+}
+
+// webhookAAD returns the additional data that binds an encrypted webhook secret to its webhook
+func webhookAAD(tenant string, id int64) string {
+	return fmt.Sprintf("webhooks.secret\n%d", id) + tenantSuffix(tenant)
+}
+
+// configuredEncryptionKey returns the key given with -key-file or in the
+// environment, or nil when there is none
+func configuredEncryptionKey() (*EncryptionKey, error) {
+	if *encryptionKeyFile != "" {
+		return LoadEncryptionKey(*encryptionKeyFile)
+	}
+	if text := os.Getenv(encryptionKeyEnv); text != "" {
+		key, err := ParseEncryptionKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", encryptionKeyEnv, err)
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// storedKeyID returns the ID of the key the database is encrypted with, or an
+// empty string when it is not encrypted
+func storedKeyID(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (string, error) {
+	var id string
+	err := q.QueryRow(`SELECT key_id FROM encryption_keys;`).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error reading encryption key: %v", err)
+	}
+	return id, nil
+}
+
+// UseEncryptionKey sets the key that encrypts parties, terms, amendments,
+// signatures, revisions and webhook payloads from now on and decrypts them when they are read.
+// It fails unless the key is the one the database is encrypted with, so that
+// an encrypted database is never written to in plain text, nor with another key.
+func (db *DB) UseEncryptionKey(key *EncryptionKey) error {
+	stored, err := storedKeyID(db)
+	if err != nil {
+		return err
+	}
+	switch {
+	case key == nil && stored != "":
+		return fmt.Errorf("database is encrypted with key %s; set -key-file or %s", stored, encryptionKeyEnv)
+	case key != nil && stored == "":
+		return fmt.Errorf("database is not encrypted; encrypt it with: rekey -new-key-file <file>")
+	case key != nil && key.id != stored:
+		return fmt.Errorf("database is encrypted with key %s, not %s", stored, key.id)
+	}
+	db.key = key
+	return nil
+}
+
+// RekeyResult reports what rekey re-encrypted
+type RekeyResult struct {
+	Contracts int `json:"contracts"`
+	Revisions int `json:"revisions"`
+	// Webhooks counts the webhooks whose signing secrets were re-encrypted
+	Webhooks int `json:"webhooks"`
+	// Deliveries counts the webhook deliveries whose payloads were re-encrypted
+	Deliveries int `json:"deliveries"`
+	// KeyID identifies the new key, empty when the database was decrypted
+	KeyID string `json:"keyId" table:"key"`
+}
+
+// Rekey re-encrypts the contracts, revisions, webhook secrets and payloads of every tenant for a new key in one transaction
+// and makes it the key of the database. A nil key decrypts the database.
+func (db *DB) Rekey(to *EncryptionKey) (*RekeyResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting rekey: %v", err)
+	}
+	defer tx.Rollback()
+
+	result := &RekeyResult{}
+	if to != nil {
+		result.KeyID = to.id
+	}
+
+	columns := []string{"parties_json", "terms_json", "amendments_json", "signatures_json"}
+	rows, err := tx.Query(`SELECT tenant, id, ` + strings.Join(columns, ", ") + ` FROM contracts ORDER BY tenant, id;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contracts: %v", err)
+	}
+	type contractRow struct {
+		tenant string
+		id     string
+		values []string
+	}
+	var contracts []contractRow
+	for rows.Next() {
+		row := contractRow{values: make([]string, len(columns))}
+		dest := []any{&row.tenant, &row.id}
+		for i := range row.values {
+			dest = append(dest, &row.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning contract: %v", err)
+		}
+		contracts = append(contracts, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contracts: %v", err)
+	}
+
+	update := db.dialect.rebind(`UPDATE contracts SET ` + strings.Join(columns, " = ?, ") + ` = ? WHERE tenant = ? AND id = ?;`)
+	for _, row := range contracts {
+		var args []any
+		for i, column := range columns {
+			value, err := rekeyValue(db.key, to, row.values[i], columnAAD(row.tenant, column, row.id))
+			if err != nil {
+				return nil, fmt.Errorf("error re-encrypting %s of contract %s: %v", column, row.id, err)
+			}
+			args = append(args, value)
+		}
+		if _, err := tx.Exec(update, append(args, row.tenant, row.id)...); err != nil {
+			return nil, fmt.Errorf("error updating contract %s: %v", row.id, err)
+		}
+		result.Contracts++
+	}
+
+	// Deletion records hold no content
+	rows, err = tx.Query(db.dialect.rebind(`SELECT tenant, contract_id, version, contract_json FROM contract_revisions WHERE content_hash <> ? ORDER BY tenant, contract_id, version;`), deletedContentHash)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contract revisions: %v", err)
+	}
+	type revisionRow struct {
+		tenant  string
+		id      string
+		version int
+		value   string
+	}
+	var revisions []revisionRow
+	for rows.Next() {
+		var row revisionRow
+		if err := rows.Scan(&row.tenant, &row.id, &row.version, &row.value); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning contract revision: %v", err)
+		}
+		revisions = append(revisions, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contract revisions: %v", err)
+	}
+
+	update = db.dialect.rebind(`UPDATE contract_revisions SET contract_json = ? WHERE tenant = ? AND contract_id = ? AND version = ?;`)
+	for _, row := range revisions {
+		value, err := rekeyValue(db.key, to, row.value, revisionAAD(row.tenant, row.id, row.version))
+		if err != nil {
+			return nil, fmt.Errorf("error re-encrypting version %d of contract %s: %v", row.version, row.id, err)
+		}
+		if _, err := tx.Exec(update, value, row.tenant, row.id, row.version); err != nil {
+			return nil, fmt.Errorf("error updating version %d of contract %s: %v", row.version, row.id, err)
+		}
+		result.Revisions++
+	}
+
+	rows, err = tx.Query(`SELECT tenant, id, secret FROM webhooks ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhooks: %v", err)
+	}
+	type webhookRow struct {
+		tenant string
+		id     int64
+		secret string
+	}
+	var webhooks []webhookRow
+	for rows.Next() {
+		var row webhookRow
+		if err := rows.Scan(&row.tenant, &row.id, &row.secret); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning webhook: %v", err)
+		}
+		webhooks = append(webhooks, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %v", err)
+	}
+
+	update = db.dialect.rebind(`UPDATE webhooks SET secret = ? WHERE id = ?;`)
+	for _, row := range webhooks {
+		aad := webhookAAD(row.tenant, row.id)
+		value, err := rekeyValue(db.key, to, row.secret, aad)
+		if errors.Is(err, errNotEncrypted) {
+			// Secrets were stored in plain text before they were encrypted too
+			value, err = sealValue(to, []byte(row.secret), aad)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error re-encrypting the secret of webhook %d: %v", row.id, err)
+		}
+		if _, err := tx.Exec(update, value, row.id); err != nil {
+			return nil, fmt.Errorf("error updating webhook %d: %v", row.id, err)
+		}
+		result.Webhooks++
+	}
+
+	rows, err = tx.Query(`SELECT tenant, id, webhook_id, contract_id, payload FROM webhook_deliveries ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %v", err)
+	}
+	type deliveryRow struct {
+		tenant     string
+		id         int64
+		webhookID  int64
+		contractID string
+		payload    string
+	}
+	var deliveries []deliveryRow
+	for rows.Next() {
+		var row deliveryRow
+		if err := rows.Scan(&row.tenant, &row.id, &row.webhookID, &row.contractID, &row.payload); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %v", err)
+	}
+
+	update = db.dialect.rebind(`UPDATE webhook_deliveries SET payload = ? WHERE id = ?;`)
+	for _, row := range deliveries {
+		value, err := rekeyValue(db.key, to, row.payload, deliveryAAD(row.tenant, row.webhookID, row.contractID))
+		if err != nil {
+			return nil, fmt.Errorf("error re-encrypting the payload of webhook delivery %d: %v", row.id, err)
+		}
+		if _, err := tx.Exec(update, value, row.id); err != nil {
+			return nil, fmt.Errorf("error updating webhook delivery %d: %v", row.id, err)
+		}
+		result.Deliveries++
+	}
+
+	if _, err := tx.Exec(`DELETE FROM encryption_keys;`); err != nil {
+		return nil, fmt.Errorf("error updating encryption key: %v", err)
+	}
+	if to != nil {
+		insert := db.dialect.rebind(`INSERT INTO encryption_keys (key_id, created_at) VALUES (?, ?);`)
+		if _, err := tx.Exec(insert, to.id, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("error updating encryption key: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing rekey: %v", err)
+	}
+	db.key = to
+	return result, nil
+}
+
+// runRekey implements the rekey command
+func runRekey(args []string) error {
+	fs := newFlagSet("rekey")
+	newKeyFile := fs.String("new-key-file", "", "File holding the new base64 encoded key, as written by: openssl rand -base64 32")
+	decryptAll := fs.Bool("decrypt", false, "Store every contract in plain text again")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("rekey takes no arguments")
+	}
+	if (*newKeyFile == "") == !*decryptAll {
+		return fmt.Errorf("rekey requires either -new-key-file or -decrypt")
+	}
+
+	var newKey *EncryptionKey
+	if *newKeyFile != "" {
+		if newKey, err = LoadEncryptionKey(*newKeyFile); err != nil {
+			return err
+		}
+	}
+
+	// The store opens with the current key, if any
+	store, err := openBareStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := requireOperator(store, "rekey"); err != nil {
+		return err
+	}
+	db, ok := unwrapStore[*DB](store)
+	if !ok {
+		return fmt.Errorf("rekey requires a SQLite or PostgreSQL store")
+	}
+
+	result, err := db.Rekey(newKey)
+	if err != nil {
+		return err
+	}
+	return printResults(result, func() {
+		if result.KeyID == "" {
+			fmt.Printf("Decrypted %d contracts, %d revisions, %d webhooks and %d webhook deliveries\n", result.Contracts, result.Revisions, result.Webhooks, result.Deliveries)
+			return
+		}
+		fmt.Printf("Encrypted %d contracts, %d revisions, %d webhooks and %d webhook deliveries with key %s\n", result.Contracts, result.Revisions, result.Webhooks, result.Deliveries, result.KeyID)
+	})
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestEncryptionKey generates an encryption key or fails the test
+func newTestEncryptionKey(t *testing.T) *EncryptionKey {
+	t.Helper()
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	key, err := NewEncryptionKey(raw)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return key
+}
+
+func TestEncryptionKey(t *testing.T) {
+	raw := make([]byte, 32)
+	for i := range raw {
+		raw[i] = byte(i)
+	}
+	text := base64.StdEncoding.EncodeToString(raw)
+
+	key, err := ParseEncryptionKey(text + "\n")
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	again, _ := ParseEncryptionKey(text)
+	if len(key.ID()) != 16 || key.ID() != again.ID() {
+		t.Errorf("Expected a stable 16 digit key ID, got %q and %q", key.ID(), again.ID())
+	}
+	if other := newTestEncryptionKey(t); other.ID() == key.ID() {
+		t.Errorf("Expected different keys to have different IDs")
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, text := range []string{"not base64!", base64.StdEncoding.EncodeToString(raw[:16])} {
+			if _, err := ParseEncryptionKey(text); err == nil || !strings.Contains(err.Error(), "invalid encryption key") {
+				t.Errorf("Expected an invalid key error for %q, got %v", text, err)
+			}
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "contracts.key")
+		os.WriteFile(path, []byte(text+"\n"), 0600)
+		loaded, err := LoadEncryptionKey(path)
+		if err != nil || loaded.ID() != key.ID() {
+			t.Errorf("Expected the key to load, got %v", err)
+		}
+		if _, err := LoadEncryptionKey(filepath.Join(t.TempDir(), "missing.key")); err == nil {
+			t.Errorf("Expected an error for a missing key file")
+		}
+	})
+}
+
+func TestSealValue(t *testing.T) {
+	key := newTestEncryptionKey(t)
+	plaintext := []byte(`[{"name":"Ann","email":"ann@example.com"}]`)
+
+	sealed, err := sealValue(key, plaintext, columnAAD(defaultTenant, "parties_json", "A"))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if strings.Contains(sealed, "ann@example.com") {
+		t.Errorf("Expected the sealed value to hide the plaintext: %s", sealed)
+	}
+	if opened, err := openValue(key, sealed, columnAAD(defaultTenant, "parties_json", "A")); err != nil || string(opened) != string(plaintext) {
+		t.Errorf("Expected the value to open, got %q: %v", opened, err)
+	}
+	if again, _ := sealValue(key, plaintext, columnAAD(defaultTenant, "parties_json", "A")); again == sealed {
+		t.Errorf("Expected every seal to use a new data key and nonce")
+	}
+
+	t.Run("PlainValues", func(t *testing.T) {
+		if opened, err := openValue(nil, `{"value":100}`, "x"); err != nil || string(opened) != `{"value":100}` {
+			t.Errorf("Expected plain values to pass through without a key, got %q: %v", opened, err)
+		}
+		if _, err := openValue(key, `{"value":100}`, "x"); !errors.Is(err, errNotEncrypted) {
+			t.Errorf("Expected a plain value to be refused with a key, got %v", err)
+		}
+		if _, err := rekeyValue(key, newTestEncryptionKey(t), `{"value":100}`, "x"); !errors.Is(err, errNotEncrypted) {
+			t.Errorf("Expected a plain value not to be rekeyed, got %v", err)
+		}
+		if decrypted, err := rekeyValue(key, nil, `{"value":100}`, "x"); err != nil || decrypted != `{"value":100}` {
+			t.Errorf("Expected decrypting to keep a plain value, got %q: %v", decrypted, err)
+		}
+		if unsealed, _ := sealValue(nil, plaintext, "x"); unsealed != string(plaintext) {
+			t.Errorf("Expected no encryption without a key, got %s", unsealed)
+		}
+	})
+
+	t.Run("MovedToAnotherRow", func(t *testing.T) {
+		if _, err := openValue(key, sealed, columnAAD(defaultTenant, "parties_json", "B")); err == nil {
+			t.Errorf("Expected a value moved to another contract not to open")
+		}
+		if _, err := openValue(key, sealed, columnAAD(defaultTenant, "terms_json", "A")); err == nil {
+			t.Errorf("Expected a value moved to another column not to open")
+		}
+		if _, err := openValue(key, sealed, columnAAD("acme", "parties_json", "A")); err == nil {
+			t.Errorf("Expected a value moved to another tenant not to open")
+		}
+	})
+
+	t.Run("WrongOrMissingKey", func(t *testing.T) {
+		if _, err := openValue(newTestEncryptionKey(t), sealed, columnAAD(defaultTenant, "parties_json", "A")); err == nil || !strings.Contains(err.Error(), "encrypted with key "+key.ID()) {
+			t.Errorf("Expected a wrong key error, got %v", err)
+		}
+		if _, err := openValue(nil, sealed, columnAAD(defaultTenant, "parties_json", "A")); err == nil || !strings.Contains(err.Error(), encryptionKeyEnv) {
+			t.Errorf("Expected a missing key error, got %v", err)
+		}
+	})
+
+	t.Run("Rekey", func(t *testing.T) {
+		newKey := newTestEncryptionKey(t)
+		aad := columnAAD(defaultTenant, "parties_json", "A")
+		rekeyed, err := rekeyValue(key, newKey, sealed, aad)
+		if err != nil {
+			t.Fatalf("Failed to rekey: %v", err)
+		}
+		if sealedData, _ := parseSealed(sealed); !strings.Contains(rekeyed, sealedData.Data) {
+			t.Errorf("Expected the data to be kept and only its data key to be re-encrypted")
+		}
+		if opened, err := openValue(newKey, rekeyed, aad); err != nil || string(opened) != string(plaintext) {
+			t.Errorf("Expected the value to open with the new key, got %q: %v", opened, err)
+		}
+		if _, err := openValue(key, rekeyed, aad); err == nil {
+			t.Errorf("Expected the old key not to open the value")
+		}
+
+		decrypted, err := rekeyValue(newKey, nil, rekeyed, aad)
+		if err != nil || decrypted != string(plaintext) {
+			t.Errorf("Expected rekeying without a key to decrypt, got %q: %v", decrypted, err)
+		}
+		encrypted, err := rekeyValue(nil, key, string(plaintext), aad)
+		if opened, _ := openValue(key, encrypted, aad); err != nil || string(opened) != string(plaintext) {
+			t.Errorf("Expected rekeying a plain value to encrypt it: %v", err)
+		}
+
+		tampered := strings.Replace(sealed, `"ct":"`, `"ct":"AAAA`, 1)
+		if _, err := rekeyValue(key, newKey, tampered, aad); err == nil {
+			t.Errorf("Expected a corrupt value not to be rekeyed")
+		}
+	})
+}
+
+// testEncryptedStore checks that an encrypted database stores no sensitive fields in
+// plain text and reads them back transparently across key changes
+func testEncryptedStore(t *testing.T, db *DB) {
+	contract := &Contract{
+		ID:      "SECRET-001",
+		Title:   "Confidential Services",
+		Status:  "active",
+		Parties: []Party{{Name: "Ann Example", Role: "client", Email: "ann@example.com"}},
+		Terms:   Terms{StartDate: "2024-01-01", EndDate: "2024-12-31", Value: 123456.78, Currency: "EUR"},
+	}
+	plainColumns := func(t *testing.T) string {
+		t.Helper()
+		var parts []string
+		rows, err := db.Query(`SELECT parties_json, terms_json, amendments_json, signatures_json FROM contracts;`)
+		if err != nil {
+			t.Fatalf("Failed to query contracts: %v", err)
+		}
+		for rows.Next() {
+			var a, b, c, d string
+			rows.Scan(&a, &b, &c, &d)
+			parts = append(parts, a, b, c, d)
+		}
+		rows.Close()
+		for _, query := range []string{`SELECT contract_json FROM contract_revisions;`, `SELECT secret FROM webhooks;`, `SELECT payload FROM webhook_deliveries;`} {
+			rows, err = db.Query(query)
+			if err != nil {
+				t.Fatalf("Failed to query %s: %v", query, err)
+			}
+			for rows.Next() {
+				var data string
+				rows.Scan(&data)
+				parts = append(parts, data)
+			}
+			rows.Close()
+		}
+		return strings.Join(parts, "\n")
+	}
+	checkReadable := func(t *testing.T) {
+		t.Helper()
+		stored, err := db.GetContract(contract.ID)
+		if err != nil || stored.Parties[0].Email != "ann@example.com" || stored.Terms.Value != 123456.78 {
+			t.Fatalf("Expected the contract to read back, got %+v: %v", stored, err)
+		}
+		all, err := db.GetAllContracts()
+		if err != nil || len(all) != 1 || all[0].Parties[0].Name != "Ann Example" {
+			t.Errorf("Expected all contracts to read back: %v", err)
+		}
+		version, err := db.GetContractVersion(contract.ID, 1)
+		if err != nil || version.Terms.Value != 100 {
+			t.Errorf("Expected the first version to read back, got %+v: %v", version, err)
+		}
+		if _, problems := verifyChain(t, db); problems != "" {
+			t.Errorf("Expected the chain to verify, got:\n%s", problems)
+		}
+		webhooks, err := db.Webhooks()
+		if err != nil || len(webhooks) != 1 || webhooks[0].Secret != "whsec-confidential" {
+			t.Errorf("Expected the webhook secret to read back, got %+v: %v", webhooks, err)
+		}
+		deliveries, err := db.WebhookDeliveries("")
+		if err != nil || len(deliveries) != 1 || !strings.Contains(string(deliveries[0].Payload), "ann@example.com") {
+			t.Errorf("Expected the webhook payload to read back, got %v", err)
+		} else if deliveries[0].secret != "whsec-confidential" {
+			t.Errorf("Expected the delivery to be signed with the webhook secret, got %q", deliveries[0].secret)
+		}
+	}
+
+	// A plain database is encrypted with rekey
+	first := *contract
+	first.Terms.Value = 100
+	if err := db.StoreContract(&first); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	key := newTestEncryptionKey(t)
+	result, err := db.Rekey(key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt database: %v", err)
+	}
+	if *result != (RekeyResult{Contracts: 1, Revisions: 1, KeyID: key.ID()}) {
+		t.Errorf("Unexpected rekey result %+v", result)
+	}
+
+	if err := db.StoreContract(contract); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	webhook := &Webhook{URL: "https://example.com/hook", Secret: "whsec-confidential"}
+	if err := db.AddWebhook(webhook); err != nil {
+		t.Fatalf("Failed to add webhook: %v", err)
+	}
+	payload, _ := json.Marshal(Event{Type: EventContractCreated, ContractID: contract.ID, Contract: contract})
+	delivery := &WebhookDelivery{WebhookID: webhook.ID, Event: EventContractCreated, ContractID: contract.ID, Status: deliveryPending, Payload: payload}
+	if err := db.EnqueueDeliveries([]*WebhookDelivery{delivery}); err != nil {
+		t.Fatalf("Failed to enqueue delivery: %v", err)
+	}
+	// Quoted, so that base64 ciphertext cannot contain it by chance
+	for _, secret := range []string{"ann@example.com", "Ann Example", "123456.78", `"EUR"`, "whsec-confidential"} {
+		if plain := plainColumns(t); strings.Contains(plain, secret) {
+			t.Errorf("Expected %q not to be stored in plain text:\n%s", secret, plain)
+		}
+	}
+	checkReadable(t)
+
+	t.Run("IDAndStatusStayQueryable", func(t *testing.T) {
+		var id string
+		query := db.dialect.rebind(`SELECT id FROM contracts WHERE status = ?;`)
+		if err := db.QueryRow(query, "active").Scan(&id); err != nil || id != contract.ID {
+			t.Errorf("Expected to find the contract by status, got %q: %v", id, err)
+		}
+	})
+
+	t.Run("UseEncryptionKey", func(t *testing.T) {
+		if err := db.UseEncryptionKey(nil); err == nil || !strings.Contains(err.Error(), "database is encrypted with key "+key.ID()) {
+			t.Errorf("Expected a missing key error, got %v", err)
+		}
+		if err := db.UseEncryptionKey(newTestEncryptionKey(t)); err == nil || !strings.Contains(err.Error(), "not ") {
+			t.Errorf("Expected a wrong key error, got %v", err)
+		}
+		if err := db.UseEncryptionKey(key); err != nil {
+			t.Errorf("Expected the database key to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("RotateKey", func(t *testing.T) {
+		newKey := newTestEncryptionKey(t)
+		result, err := db.Rekey(newKey)
+		if err != nil {
+			t.Fatalf("Failed to rekey: %v", err)
+		}
+		if result.Contracts != 1 || result.Revisions != 2 || result.Webhooks != 1 || result.Deliveries != 1 || result.KeyID != newKey.ID() {
+			t.Errorf("Unexpected rekey result %+v", result)
+		}
+		checkReadable(t)
+		if err := db.UseEncryptionKey(key); err == nil {
+			t.Errorf("Expected the old key to be rejected after rotation")
+		}
+		if err := db.UseEncryptionKey(newKey); err != nil {
+			t.Errorf("Expected the new key to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("PlainSecret", func(t *testing.T) {
+		// Secrets of webhooks added before they were encrypted are sealed by rekey
+		update := db.dialect.rebind(`UPDATE webhooks SET secret = ? WHERE id = ?;`)
+		if _, err := db.Exec(update, "whsec-confidential", webhook.ID); err != nil {
+			t.Fatalf("Failed to store plain secret: %v", err)
+		}
+		if _, err := db.Webhooks(); err == nil || !strings.Contains(err.Error(), "run rekey") {
+			t.Errorf("Expected a plain secret to be refused, got %v", err)
+		}
+		if _, err := db.Rekey(newTestEncryptionKey(t)); err != nil {
+			t.Fatalf("Failed to rekey: %v", err)
+		}
+		if plain := plainColumns(t); strings.Contains(plain, "whsec-confidential") {
+			t.Errorf("Expected the secret to be encrypted by rekey:\n%s", plain)
+		}
+		checkReadable(t)
+	})
+
+	t.Run("Decrypt", func(t *testing.T) {
+		if _, err := db.Rekey(nil); err != nil {
+			t.Fatalf("Failed to decrypt: %v", err)
+		}
+		if plain := plainColumns(t); !strings.Contains(plain, "ann@example.com") {
+			t.Errorf("Expected the columns to be plain text again:\n%s", plain)
+		}
+		checkReadable(t)
+		if err := db.UseEncryptionKey(newTestEncryptionKey(t)); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+			t.Errorf("Expected a key for a plain database to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestEncryptedStore(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	testEncryptedStore(t, db)
+}
+
+func TestEncryptedColumnMovedToAnotherContract(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Rekey(newTestEncryptionKey(t)); err != nil {
+		t.Fatalf("Failed to encrypt database: %v", err)
+	}
+	for _, id := range []string{"A", "B"} {
+		contract := &Contract{ID: id, Title: id, Status: "active", Parties: []Party{{Name: "Party " + id}}}
+		if err := db.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+	}
+
+	exec(t, db, `UPDATE contracts SET parties_json = (SELECT parties_json FROM contracts WHERE id = ?) WHERE id = ?;`, "A", "B")
+	if _, err := db.GetContract("B"); err == nil || !strings.Contains(err.Error(), "error decrypting parties_json") {
+		t.Errorf("Expected parties copied from another contract not to decrypt, got %v", err)
+	}
+	if _, problems := verifyChain(t, db); !strings.Contains(problems, "contracts B: contract cannot be read") {
+		t.Errorf("Expected verify-db to report the contract, got:\n%s", problems)
+	}
+
+	exec(t, db, `UPDATE contracts SET parties_json = ? WHERE id = ?;`, `[{"name":"Mallory"}]`, "A")
+	if _, err := db.GetContract("A"); err == nil || !strings.Contains(err.Error(), "value is not encrypted") {
+		t.Errorf("Expected plain parties in an encrypted database to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Contract lifecycle event types
+const (
+	// EventContractCreated is published when a contract with a new ID is stored
+	EventContractCreated = "contract.created"
+	// EventContractUpdated is published when a stored contract is stored with changes
+	EventContractUpdated = "contract.updated"
+	// EventStatusChanged is published, after EventContractUpdated, when the update changes the status
+	EventStatusChanged = "contract.status_changed"
+	// EventContractDeleted is published when a contract is deleted
+	EventContractDeleted = "contract.deleted"
+	// EventContractExpiring is published for a deadline coming up or overdue, see ContractDeadlines
+	EventContractExpiring = "contract.expiring"
+)
+
+// EventTypes lists every event type in the order they are documented
+var EventTypes = []string{
+	EventContractCreated,
+	EventContractUpdated,
+	EventStatusChanged,
+	EventContractDeleted,
+	EventContractExpiring,
+}
+
+// Event describes something that happened to a contract
+type Event struct {
+	Type       string    `json:"type"`
+	ContractID string    `json:"contractId"`
+	Time       time.Time `json:"time"`
+	// Contract is the contract after the change; it is nil for deletions
+	Contract *Contract `json:"contract,omitempty"`
+	// Previous is the contract before the change; it is nil for new contracts
+	Previous *Contract `json:"previous,omitempty"`
+	// Deadline is the deadline an expiring event is about
+	Deadline *Deadline `json:"deadline,omitempty"`
+}
+
+// isEventType reports whether name is a known event type
+func isEventType(name string) bool {
+	for _, known := range EventTypes {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// EventHandler is called with every event an EventStore publishes
+type EventHandler func(Event) error
+
+// EventStore is a ContractStore that publishes an event to its handlers for every
+// change made through it. Storing a contract without changing it publishes nothing.
+type EventStore struct {
+	ContractStore
+	handlers []EventHandler
+	now      func() time.Time
+}
+
+// NewEventStore wraps a store so that changes made through it are published to the handlers
+func NewEventStore(store ContractStore, handlers ...EventHandler) *EventStore {
+	return &EventStore{ContractStore: store, handlers: handlers, now: time.Now}
+}
+
+// Unwrap returns the wrapped store
+func (s *EventStore) Unwrap() ContractStore {
+	return s.ContractStore
+}
+
+// StoreContract stores the contract and publishes whether it was created or updated.
+// An error from a handler is returned after the contract has been stored.
+func (s *EventStore) StoreContract(contract *Contract) error {
+	previous, err := s.ContractStore.GetContract(contract.ID)
+	if err != nil && !errors.Is(err, ErrContractNotFound) {
+		return err
+	}
+	events, err := storeEvents(previous, contract)
+	if err != nil {
+		return err
+	}
+	if err := s.ContractStore.StoreContract(contract); err != nil {
+		return err
+	}
+	return s.Publish(events...)
+}
+
+// storeEvents returns the events of storing contract over previous, which is nil
+// for a new contract. Storing a contract without changing it has no events.
+func storeEvents(previous, contract *Contract) ([]Event, error) {
+	stored, err := copyContract(contract)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return []Event{{Type: EventContractCreated, ContractID: contract.ID, Contract: stored}}, nil
+	}
+
+	oldHash, err := previous.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	newHash, err := stored.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	if oldHash == newHash {
+		return nil, nil
+	}
+
+	events := []Event{{Type: EventContractUpdated, ContractID: contract.ID, Contract: stored, Previous: previous}}
+	if previous.Status != stored.Status {
+		events = append(events, Event{Type: EventStatusChanged, ContractID: contract.ID, Contract: stored, Previous: previous})
+	}
+	return events, nil
+}
+
+// DeleteContract deletes the contract and publishes its deletion
+func (s *EventStore) DeleteContract(id string) error {
+	previous, err := s.ContractStore.GetContract(id)
+	if err != nil {
+		return err
+	}
+	if err := s.ContractStore.DeleteContract(id); err != nil {
+		return err
+	}
+	return s.Publish(Event{Type: EventContractDeleted, ContractID: id, Previous: previous})
+}
+
+// Publish passes the events to every handler in order. Events without a time get
+// the current time. All handlers see every event even when some of them fail.
+func (s *EventStore) Publish(events ...Event) error {
+	var errs []error
+	for _, event := range events {
+		if event.Time.IsZero() {
+			event.Time = s.now().UTC()
+		}
+		for _, handle := range s.handlers {
+			if err := handle(event); err != nil {
+				errs = append(errs, fmt.Errorf("error handling %s event for contract %s: %v", event.Type, event.ContractID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordEvents returns a handler that appends every event it sees to events
+func recordEvents(events *[]Event) EventHandler {
+	return func(e Event) error {
+		*events = append(*events, e)
+		return nil
+	}
+}
+
+func TestEventStore(t *testing.T) {
+	var events []Event
+	store := NewEventStore(NewMemoryStore(), recordEvents(&events))
+	store.now = func() time.Time { return calendarStamp }
+
+	eventTypes := func() string {
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		events = nil
+		return strings.Join(types, ",")
+	}
+
+	contract := newTestContract("TEST-001", "active")
+	if err := store.StoreContract(contract); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	if len(events) != 1 || events[0].Previous != nil || events[0].Contract.ID != "TEST-001" || !events[0].Time.Equal(calendarStamp) {
+		t.Errorf("Unexpected created event %+v", events)
+	}
+	if got := eventTypes(); got != EventContractCreated {
+		t.Errorf("Expected %s, got %s", EventContractCreated, got)
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := store.StoreContract(newTestContract("TEST-001", "active")); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		if got := eventTypes(); got != "" {
+			t.Errorf("Expected no events for an unchanged contract, got %s", got)
+		}
+	})
+
+	t.Run("Updated", func(t *testing.T) {
+		contract.Title = "Renamed Contract"
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		if len(events) != 1 || events[0].Previous.Title != "Test Contract" || events[0].Contract.Title != "Renamed Contract" {
+			t.Errorf("Unexpected updated event %+v", events)
+		}
+		if got := eventTypes(); got != EventContractUpdated {
+			t.Errorf("Expected %s, got %s", EventContractUpdated, got)
+		}
+	})
+
+	t.Run("StatusChanged", func(t *testing.T) {
+		contract.Status = "terminated"
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		expected := EventContractUpdated + "," + EventStatusChanged
+		if got := eventTypes(); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("EventContractIsACopy", func(t *testing.T) {
+		contract.Title = "Another Title"
+		store.StoreContract(contract)
+		contract.Title = "Changed After Storing"
+		if events[0].Contract.Title != "Another Title" {
+			t.Errorf("Expected the event to keep the stored contract, got %q", events[0].Contract.Title)
+		}
+		eventTypes()
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		if err := store.DeleteContract("TEST-001"); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+		if len(events) != 1 || events[0].Contract != nil || events[0].Previous.ID != "TEST-001" {
+			t.Errorf("Unexpected deleted event %+v", events)
+		}
+		if got := eventTypes(); got != EventContractDeleted {
+			t.Errorf("Expected %s, got %s", EventContractDeleted, got)
+		}
+
+		if err := store.DeleteContract("TEST-001"); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected ErrContractNotFound, got %v", err)
+		}
+		if got := eventTypes(); got != "" {
+			t.Errorf("Expected no events for a failed delete, got %s", got)
+		}
+	})
+
+	t.Run("HandlerErrors", func(t *testing.T) {
+		var seen []Event
+		failing := func(Event) error { return errors.New("mail server down") }
+		store := NewEventStore(NewMemoryStore(), failing, recordEvents(&seen))
+
+		err := store.StoreContract(newTestContract("TEST-001", "active"))
+		if err == nil || !strings.Contains(err.Error(), "mail server down") {
+			t.Errorf("Expected the handler error, got %v", err)
+		}
+		if len(seen) != 1 {
+			t.Errorf("Expected the other handler to see the event, got %d events", len(seen))
+		}
+		if _, err := store.GetContract("TEST-001"); err != nil {
+			t.Errorf("Expected the contract to be stored despite the handler error: %v", err)
+		}
+	})
+
+	t.Run("Unwrap", func(t *testing.T) {
+		if _, ok := asRevisionStore(store); !ok {
+			t.Errorf("Expected the wrapped memory store to keep revisions")
+		}
+	})
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// exprType is the type of a value in a rule expression
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeNumber
+	typeString
+	typeList
+	typeObject
+)
+
+// String returns the name of the type used in error messages
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "boolean"
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	case typeList:
+		return "list"
+	default:
+		return "object"
+	}
+}
+
+// zero returns the value of a field of the type that a contract leaves out
+func (t exprType) zero() any {
+	switch t {
+	case typeBool:
+		return false
+	case typeNumber:
+		return 0.0
+	case typeString:
+		return ""
+	case typeList:
+		return []any{}
+	default:
+		return map[string]any{}
+	}
+}
+
+// exprTypeOf returns the expression type of a Go field type
+func exprTypeOf(typ reflect.Type) exprType {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return typeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return typeNumber
+	case reflect.String:
+		return typeString
+	case reflect.Slice, reflect.Array:
+		return typeList
+	default:
+		return typeObject
+	}
+}
+
+// jsonField returns the type of the field of a struct type with the given JSON
+// name, looking into embedded structs like encoding/json does
+func jsonField(typ reflect.Type, name string) (reflect.Type, bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && tag == "" {
+			if found, ok := jsonField(field.Type, name); ok {
+				return found, true
+			}
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		if tag == name {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// exprNode is a compiled part of a rule expression. It is evaluated against frames
+// of JSON-decoded values: the contract first, then the list element of each
+// enclosing any, all or count.
+type exprNode interface {
+	eval(frames []any) (any, error)
+}
+
+// litNode is a number, string or boolean literal
+type litNode struct {
+	value any
+}
+
+func (n litNode) eval([]any) (any, error) {
+	return n.value, nil
+}
+
+// fieldNode reads a field such as terms.value from a frame
+type fieldNode struct {
+	path []string
+	// depth counts the frames between the innermost one and the one the field is read from
+	depth int
+	typ   reflect.Type
+}
+
+func (n fieldNode) eval(frames []any) (any, error) {
+	value := frames[len(frames)-1-n.depth]
+	for _, name := range n.path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return exprTypeOf(n.typ).zero(), nil
+		}
+		if value, ok = object[name]; !ok || value == nil {
+			return exprTypeOf(n.typ).zero(), nil
+		}
+	}
+	return value, nil
+}
+
+// unaryNode is a negation, ! or -
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n unaryNode) eval(frames []any) (any, error) {
+	x, err := n.x.eval(frames)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !x.(bool), nil
+	}
+	return -x.(float64), nil
+}
+
+// binaryNode is a comparison, arithmetic or logical operation
+type binaryNode struct {
+	op   string
+	x, y exprNode
+}
+
+func (n binaryNode) eval(frames []any) (any, error) {
+	x, err := n.x.eval(frames)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only evaluate their right side when it decides the result
+	switch n.op {
+	case "&&":
+		if !x.(bool) {
+			return false, nil
+		}
+		return n.y.eval(frames)
+	case "||":
+		if x.(bool) {
+			return true, nil
+		}
+		return n.y.eval(frames)
+	}
+	y, err := n.y.eval(frames)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	}
+	if xs, ok := x.(string); ok {
+		ys := y.(string)
+		switch n.op {
+		case "<":
+			return xs < ys, nil
+		case "<=":
+			return xs <= ys, nil
+		case ">":
+			return xs > ys, nil
+		case ">=":
+			return xs >= ys, nil
+		default: // +
+			return xs + ys, nil
+		}
+	}
+	xf, yf := x.(float64), y.(float64)
+	switch n.op {
+	case "<":
+		return xf < yf, nil
+	case "<=":
+		return xf <= yf, nil
+	case ">":
+		return xf > yf, nil
+	case ">=":
+		return xf >= yf, nil
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	default: // /
+		if yf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return xf / yf, nil
+	}
+}
+
+// callNode calls one of exprFunctions
+type callNode struct {
+	name    string
+	args    []exprNode
+	pattern *regexp.Regexp
+}
+
+func (n callNode) eval(frames []any) (any, error) {
+	if n.name == "any" || n.name == "all" || n.name == "count" {
+		return n.evalQuantifier(frames)
+	}
+
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(frames)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	switch n.name {
+	case "len":
+		if s, ok := args[0].(string); ok {
+			return float64(len([]rune(s))), nil
+		}
+		return float64(len(args[0].([]any))), nil
+	case "lower":
+		return strings.ToLower(args[0].(string)), nil
+	case "contains":
+		return strings.Contains(args[0].(string), args[1].(string)), nil
+	case "matches":
+		return n.pattern.MatchString(args[0].(string)), nil
+	case "days":
+		from, err := parseExprDate(args[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseExprDate(args[1].(string))
+		if err != nil {
+			return nil, err
+		}
+		return to.Sub(from).Hours() / 24, nil
+	default: // addMonths, addYears
+		date, err := parseExprDate(args[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		months := int(args[1].(float64))
+		if n.name == "addYears" {
+			months *= 12
+		}
+		return date.AddDate(0, months, 0).Format(dateLayout), nil
+	}
+}
+
+// evalQuantifier evaluates any, all or count, which evaluate their second argument
+// for each element of the list in their first
+func (n callNode) evalQuantifier(frames []any) (any, error) {
+	list, err := n.args[0].eval(frames)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, element := range list.([]any) {
+		matched, err := n.args[1].eval(append(frames[:len(frames):len(frames)], element))
+		if err != nil {
+			return nil, err
+		}
+		if matched.(bool) {
+			count++
+		}
+	}
+	switch n.name {
+	case "any":
+		return count > 0, nil
+	case "all":
+		return count == len(list.([]any)), nil
+	default:
+		return float64(count), nil
+	}
+}
+
+// parseExprDate parses a YYYY-MM-DD date given to a date function
+func parseExprDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing date")
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
+
+// exprFunction describes the arguments and result of a function of the expression language
+type exprFunction struct {
+	args   []exprType
+	result exprType
+}
+
+// exprFunctions lists the functions rule expressions can call. The first argument
+// of len is a string or a list; any, all and count take a list and a condition.
+var exprFunctions = map[string]exprFunction{
+	"len":       {[]exprType{typeList}, typeNumber},
+	"any":       {[]exprType{typeList, typeBool}, typeBool},
+	"all":       {[]exprType{typeList, typeBool}, typeBool},
+	"count":     {[]exprType{typeList, typeBool}, typeNumber},
+	"lower":     {[]exprType{typeString}, typeString},
+	"contains":  {[]exprType{typeString, typeString}, typeBool},
+	"matches":   {[]exprType{typeString, typeString}, typeBool},
+	"days":      {[]exprType{typeString, typeString}, typeNumber},
+	"addMonths": {[]exprType{typeString, typeNumber}, typeString},
+	"addYears":  {[]exprType{typeString, typeNumber}, typeString},
+}
+
+// exprToken is a token of a rule expression
+type exprToken struct {
+	// kind is 'n' for numbers, 's' for strings, 'i' for identifiers, 'o' for
+	// operators and punctuation, and 0 at the end of the expression
+	kind  byte
+	text  string
+	value any
+	pos   int
+}
+
+// exprOperators lists the operators, longest first so that <= is not read as <
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "(", ")", ","}
+
+// lexExpr splits a rule expression into tokens
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			text := src[start:i]
+			value, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: invalid number %s", start+1, text)
+			}
+			tokens = append(tokens, exprToken{kind: 'n', text: text, value: value, pos: start})
+
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			for i++; i < len(src) && rune(src[i]) != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+			}
+			if i == len(src) {
+				return nil, fmt.Errorf("column %d: unterminated string", start+1)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: 's', text: src[start:i], value: sb.String(), pos: start})
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: 'i', text: src[start:i], pos: start})
+
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("column %d: unexpected %q", i+1, c)
+			}
+			tokens = append(tokens, exprToken{kind: 'o', text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{pos: len(src)}), nil
+}
+
+// exprScope is what field names resolve against: the contract, or the element type
+// of a list inside any, all or count, whose fields hide those of the enclosing scopes
+type exprScope struct {
+	typ    reflect.Type
+	parent *exprScope
+}
+
+// exprParser compiles tokens into exprNodes, checking field names and types
+type exprParser struct {
+	tokens []exprToken
+	next   int
+	scope  *exprScope
+}
+
+// binaryLevels lists the binary operators from the loosest binding to the tightest
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+// compileExpr compiles a rule expression over values of the given type and returns
+// it with the type of its result
+func compileExpr(src string, root reflect.Type) (exprNode, exprType, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &exprParser{tokens: tokens, scope: &exprScope{typ: root}}
+	node, typ, err := p.parseBinary(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token := p.peek(); token.kind != 0 {
+		return nil, 0, fmt.Errorf("column %d: unexpected %s", token.pos+1, token.text)
+	}
+	return node, typ, nil
+}
+
+// peek returns the next token without consuming it
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+// take consumes and returns the next token
+func (p *exprParser) take() exprToken {
+	token := p.tokens[p.next]
+	if token.kind != 0 {
+		p.next++
+	}
+	return token
+}
+
+// expect consumes the next token, which must be the given punctuation
+func (p *exprParser) expect(text string) error {
+	token := p.take()
+	if token.kind != 'o' || token.text != text {
+		return fmt.Errorf("column %d: expected %s", token.pos+1, text)
+	}
+	return nil
+}
+
+// parseBinary parses the operators of a level of binaryLevels and the tighter ones
+func (p *exprParser) parseBinary(level int) (exprNode, exprType, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	x, xt, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		token := p.peek()
+		if token.kind != 'o' || !containsString(binaryLevels[level], token.text) {
+			return x, xt, nil
+		}
+		p.take()
+		y, yt, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ, err := binaryType(token.text, xt, yt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("column %d: %v", token.pos+1, err)
+		}
+		x, xt = binaryNode{op: token.text, x: x, y: y}, typ
+	}
+}
+
+// binaryType returns the result type of a binary operator applied to operands of
+// the given types, or an error when the operator does not apply to them
+func binaryType(op string, x, y exprType) (exprType, error) {
+	if x != y {
+		return 0, fmt.Errorf("%s needs operands of the same type, not %s and %s", op, x, y)
+	}
+	switch op {
+	case "&&", "||":
+		if x == typeBool {
+			return typeBool, nil
+		}
+	case "==", "!=":
+		if x != typeList && x != typeObject {
+			return typeBool, nil
+		}
+	case "<", "<=", ">", ">=":
+		if x == typeNumber || x == typeString {
+			return typeBool, nil
+		}
+	case "+":
+		if x == typeNumber || x == typeString {
+			return x, nil
+		}
+	default:
+		if x == typeNumber {
+			return typeNumber, nil
+		}
+	}
+	return 0, fmt.Errorf("%s does not apply to %s values", op, x)
+}
+
+// parseUnary parses ! and - and the operand they apply to
+func (p *exprParser) parseUnary() (exprNode, exprType, error) {
+	token := p.peek()
+	if token.kind == 'o' && (token.text == "!" || token.text == "-") {
+		p.take()
+		x, xt, err := p.parseUnary()
+		if err != nil {
+			return nil, 0, err
+		}
+		want := typeBool
+		if token.text == "-" {
+			want = typeNumber
+		}
+		if xt != want {
+			return nil, 0, fmt.Errorf("column %d: %s does not apply to %s values", token.pos+1, token.text, xt)
+		}
+		return unaryNode{op: token.text, x: x}, xt, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a literal, field, function call or parenthesized expression
+func (p *exprParser) parsePrimary() (exprNode, exprType, error) {
+	token := p.take()
+	switch token.kind {
+	case 'n':
+		return litNode{value: token.value}, typeNumber, nil
+	case 's':
+		return litNode{value: token.value}, typeString, nil
+	case 'i':
+		switch {
+		case token.text == "true" || token.text == "false":
+			return litNode{value: token.text == "true"}, typeBool, nil
+		case p.peek().kind == 'o' && p.peek().text == "(":
+			return p.parseCall(token)
+		default:
+			return p.resolveField(token)
+		}
+	case 'o':
+		if token.text == "(" {
+			node, typ, err := p.parseBinary(0)
+			if err != nil {
+				return nil, 0, err
+			}
+			return node, typ, p.expect(")")
+		}
+	}
+	if token.kind == 0 {
+		return nil, 0, fmt.Errorf("column %d: unexpected end of expression", token.pos+1)
+	}
+	return nil, 0, fmt.Errorf("column %d: unexpected %s", token.pos+1, token.text)
+}
+
+// resolveField resolves a dotted field name against the innermost scope that has its
+// first part
+func (p *exprParser) resolveField(token exprToken) (exprNode, exprType, error) {
+	path := strings.Split(token.text, ".")
+	depth := 0
+	for scope := p.scope; scope != nil; scope, depth = scope.parent, depth+1 {
+		typ, ok := jsonField(scope.typ, path[0])
+		if !ok {
+			continue
+		}
+		for i, name := range path[1:] {
+			if typ, ok = jsonField(typ, name); !ok {
+				return nil, 0, fmt.Errorf("column %d: unknown field %s", token.pos+1, strings.Join(path[:i+2], "."))
+			}
+		}
+		return fieldNode{path: path, depth: depth, typ: typ}, exprTypeOf(typ), nil
+	}
+	return nil, 0, fmt.Errorf("column %d: unknown field %s", token.pos+1, path[0])
+}
+
+// parseCall parses the arguments of a call to one of exprFunctions
+func (p *exprParser) parseCall(name exprToken) (exprNode, exprType, error) {
+	function, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, 0, fmt.Errorf("column %d: unknown function %s", name.pos+1, name.text)
+	}
+	p.take() // (
+
+	call := callNode{name: name.text}
+	for i := range function.args {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, 0, err
+			}
+		}
+		start := p.peek()
+		arg, typ, err := p.parseBinary(0)
+		if err != nil {
+			return nil, 0, err
+		}
+		want := function.args[i]
+		if name.text == "len" && typ == typeString {
+			want = typeString
+		}
+		if typ != want {
+			return nil, 0, fmt.Errorf("column %d: argument %d of %s must be a %s, not a %s", start.pos+1, i+1, name.text, want, typ)
+		}
+		call.args = append(call.args, arg)
+
+		// The condition of any, all and count sees the fields of the list elements
+		if i == 0 && want == typeList && len(function.args) == 2 {
+			field, ok := arg.(fieldNode)
+			if !ok || exprTypeOf(field.typ.Elem()) != typeObject {
+				return nil, 0, fmt.Errorf("column %d: the first argument of %s must be a list field such as parties", start.pos+1, name.text)
+			}
+			p.scope = &exprScope{typ: field.typ.Elem(), parent: p.scope}
+			defer func() { p.scope = p.scope.parent }()
+		}
+		if name.text == "matches" && i == 1 {
+			literal, ok := arg.(litNode)
+			if !ok {
+				return nil, 0, fmt.Errorf("column %d: the pattern of matches must be a string literal", start.pos+1)
+			}
+			if call.pattern, err = regexp.Compile(literal.value.(string)); err != nil {
+				return nil, 0, fmt.Errorf("column %d: invalid pattern: %v", start.pos+1, err)
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, 0, err
+	}
+	return call, function.result, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
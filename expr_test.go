@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// evalRuleExpr compiles an expression over a contract as rules see it and evaluates it
+func evalRuleExpr(src string, contract *Contract) (any, error) {
+	node, _, err := compileExpr(src, reflect.TypeOf(ruleRoot{}))
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(ruleRoot{Contract: *contract, Latest: *contract.latestTerms()})
+	var root any
+	json.Unmarshal(data, &root)
+	return node.eval([]any{root})
+}
+
+func TestEvalExpr(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = append(contract.Parties, Party{Name: "Legal Dept", Role: "Legal", VATID: "DE123456789"})
+
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{"terms.value", 1000.0},
+		{"latest.terms.value", 1200.0},
+		{"terms.value * 2 + 1 > 2_000", true},
+		{"-terms.value < 0", true},
+		{"(1 + 2) * 3", 9.0},
+		{"10 / 4", 2.5},
+		{"terms.currency == 'USD' && status != \"draft\"", true},
+		{"!(terms.value > 500) || id == 'TEST-001'", true},
+		{"title + '!'", "Test Contract!"},
+		{"terms.startDate < '2024-06-01'", true},
+		{"predecessorId == ''", true},
+		{"terms.noticePeriodDays", 0.0},
+		{"len(parties)", 2.0},
+		{"len(title)", 13.0},
+		{"len(signatures)", 0.0},
+		{"any(parties, lower(role) == 'legal')", true},
+		{"all(parties, vatId != '')", false},
+		{"count(parties, contains(email, '@'))", 1.0},
+		{"any(parties, name == title)", false},
+		{"any(amendments, changes.value > terms.value)", true},
+		{"matches(terms.currency, '^[A-Z]{3}$')", true},
+		{"days(terms.startDate, terms.endDate)", 365.0},
+		{"addYears(terms.startDate, 3)", "2027-01-01"},
+		{"addMonths(latest.terms.endDate, 1)", "2025-05-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			value, err := evalRuleExpr(tt.expr, contract)
+			if err != nil {
+				t.Fatalf("Failed to evaluate: %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"terms.amount > 1", "column 1: unknown field terms.amount"},
+		{"vatId == ''", "column 1: unknown field vatId"},
+		{"terms.value > '100'", "column 13: > needs operands of the same type, not number and string"},
+		{"title - 'x'", "column 7: - does not apply to string values"},
+		{"parties == parties", "== does not apply to list values"},
+		{"!title", "column 1: ! does not apply to string values"},
+		{"terms.value >", "column 14: unexpected end of expression"},
+		{"(terms.value > 1", "column 17: expected )"},
+		{"terms.value > 1 1", "column 17: unexpected 1"},
+		{"title == 'open", "column 10: unterminated string"},
+		{"title = 'x'", "column 7: unexpected '='"},
+		{"size(parties)", "column 1: unknown function size"},
+		{"len(terms.value)", "argument 1 of len must be a list, not a number"},
+		{"any(parties, name)", "argument 2 of any must be a boolean, not a string"},
+		{"any(title, true)", "argument 1 of any must be a list, not a string"},
+		{"matches(parties.name, '^Test')", "column 9: unknown field parties.name"},
+		{"matches(title, title)", "the pattern of matches must be a string literal"},
+		{"matches(title, '(')", "invalid pattern"},
+		{"addYears(terms.startDate)", "expected ,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := compileExpr(tt.expr, reflect.TypeOf(ruleRoot{}))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContractFilter selects stored contracts. Empty fields match every contract.
+type ContractFilter struct {
+	// Statuses lists the accepted statuses, compared case-insensitively
+	Statuses []string
+	// IDPattern is a glob such as CONTRACT-* matched against the contract ID
+	IDPattern string
+	// Party matches contracts with a party whose name or email contains it, ignoring case
+	Party string
+	// ActiveOn matches contracts whose term includes this YYYY-MM-DD date
+	ActiveOn string
+}
+
+// IsEmpty reports whether the filter matches every contract
+func (f ContractFilter) IsEmpty() bool {
+	return len(f.Statuses) == 0 && f.IDPattern == "" && f.Party == "" && f.ActiveOn == ""
+}
+
+// Validate checks the filter for malformed patterns and dates
+func (f ContractFilter) Validate() error {
+	if f.IDPattern != "" {
+		if _, err := path.Match(f.IDPattern, ""); err != nil {
+			return fmt.Errorf("invalid ID pattern %q: %v", f.IDPattern, err)
+		}
+	}
+	if f.ActiveOn != "" {
+		if _, err := time.Parse(dateLayout, f.ActiveOn); err != nil {
+			return fmt.Errorf("invalid date %s: expected YYYY-MM-DD", f.ActiveOn)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the contract passes every condition of the filter
+func (f ContractFilter) Matches(c *Contract) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			found = found || strings.EqualFold(status, c.Status)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.IDPattern != "" {
+		if matched, _ := path.Match(f.IDPattern, c.ID); !matched {
+			return false
+		}
+	}
+
+	if f.Party != "" {
+		needle := strings.ToLower(f.Party)
+		found := false
+		for _, party := range c.Parties {
+			found = found || strings.Contains(strings.ToLower(party.Name), needle) ||
+				strings.Contains(strings.ToLower(party.Email), needle)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	// Dates use the YYYY-MM-DD layout, so they compare chronologically as strings
+	if f.ActiveOn != "" {
+		if c.Terms.StartDate > f.ActiveOn || (c.Terms.EndDate != "" && c.Terms.EndDate < f.ActiveOn) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindContracts returns the stored contracts that match the filter, ordered by ID
+func FindContracts(store ContractStore, filter ContractFilter) ([]*Contract, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	all, err := store.GetAllContracts()
+	if err != nil {
+		return nil, err
+	}
+
+	var contracts []*Contract
+	for _, contract := range all {
+		if filter.Matches(contract) {
+			contracts = append(contracts, contract)
+		}
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ID < contracts[j].ID })
+	return contracts, nil
+}
+
+// filterFlags registers the contract filter flags on a command's flag set. The
+// returned function builds the filter once the flags have been parsed.
+func filterFlags(fs *flag.FlagSet) func() ContractFilter {
+	statuses := fs.String("status", "", "Only contracts with one of these comma-separated statuses")
+	idPattern := fs.String("id", "", "Only contracts whose ID matches this glob, e.g. CONTRACT-*")
+	party := fs.String("party", "", "Only contracts with a party whose name or email contains this text")
+	activeOn := fs.String("active-on", "", "Only contracts whose term includes this date (YYYY-MM-DD)")
+
+	return func() ContractFilter {
+		filter := ContractFilter{IDPattern: *idPattern, Party: *party, ActiveOn: *activeOn}
+		for _, status := range strings.Split(*statuses, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+		return filter
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFindContracts(t *testing.T) {
+	store := NewMemoryStore()
+	contracts := []*Contract{
+		newTestContract("CONTRACT-001", "active"),
+		newTestContract("CONTRACT-002", "pending"),
+		newTestContract("LEASE-001", "Active"),
+		newTestContract("LEASE-002", "expired"),
+	}
+	contracts[1].Parties = []Party{{Name: "Jane Smith", Role: "seller", Email: "jane@example.com"}}
+	contracts[3].Terms.StartDate = "2022-01-01"
+	contracts[3].Terms.EndDate = "2022-12-31"
+	for _, contract := range contracts {
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   ContractFilter
+		expected []string
+	}{
+		{"All", ContractFilter{}, []string{"CONTRACT-001", "CONTRACT-002", "LEASE-001", "LEASE-002"}},
+		{"Status", ContractFilter{Statuses: []string{"active"}}, []string{"CONTRACT-001", "LEASE-001"}},
+		{"Statuses", ContractFilter{Statuses: []string{"pending", "expired"}}, []string{"CONTRACT-002", "LEASE-002"}},
+		{"IDPattern", ContractFilter{IDPattern: "LEASE-*"}, []string{"LEASE-001", "LEASE-002"}},
+		{"PartyName", ContractFilter{Party: "jane"}, []string{"CONTRACT-002"}},
+		{"PartyEmail", ContractFilter{Party: "CLIENT@example"}, []string{"CONTRACT-001", "LEASE-001", "LEASE-002"}},
+		{"ActiveOn", ContractFilter{ActiveOn: "2022-06-01"}, []string{"LEASE-002"}},
+		{"ActiveOnLastDay", ContractFilter{ActiveOn: "2024-12-31", IDPattern: "CONTRACT-*"}, []string{"CONTRACT-001", "CONTRACT-002"}},
+		{"Combined", ContractFilter{Statuses: []string{"active"}, IDPattern: "CONTRACT-*"}, []string{"CONTRACT-001"}},
+		{"NoMatch", ContractFilter{Statuses: []string{"terminated"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contracts, err := FindContracts(store, tt.filter)
+			if err != nil {
+				t.Fatalf("Failed to find contracts: %v", err)
+			}
+			var ids []string
+			for _, contract := range contracts {
+				ids = append(ids, contract.ID)
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, ids)
+					break
+				}
+			}
+		})
+	}
+
+	t.Run("InvalidFilter", func(t *testing.T) {
+		if _, err := FindContracts(store, ContractFilter{IDPattern: "["}); err == nil {
+			t.Error("Expected error for malformed ID pattern")
+		}
+		if _, err := FindContracts(store, ContractFilter{ActiveOn: "June"}); err == nil {
+			t.Error("Expected error for malformed date")
+		}
+	})
+}
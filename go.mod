@@ -2,7 +2,13 @@ module goplayground
 
 go 1.21
 
-require github.com/glebarez/sqlite v1.10.0
+require (
+	github.com/fergusstrange/embedded-postgres v1.34.0
+	github.com/glebarez/sqlite v1.10.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/sys v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -12,7 +18,7 @@ require (
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	golang.org/x/sys v0.7.0 // indirect
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	gorm.io/gorm v1.25.5 // indirect
 	modernc.org/libc v1.22.5 // indirect
 	modernc.org/mathutil v1.5.0 // indirect
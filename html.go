@@ -0,0 +1,176 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// htmlTemplates holds the HTML page templates and their shared stylesheet
+//
+//go:embed templates/html/*.tmpl
+var htmlTemplates embed.FS
+
+// ScheduleEntry is a dated event in the life of a contract
+type ScheduleEntry struct {
+	Date        string
+	Description string
+}
+
+// Schedule returns the start, amendments, payments, renewal notice deadline and end
+// of the contract in date order
+func (d TemplateData) Schedule() []ScheduleEntry {
+	var entries []ScheduleEntry
+	if d.Terms.StartDate != "" {
+		entries = append(entries, ScheduleEntry{Date: d.Terms.StartDate, Description: d.Locale.T("Contract starts")})
+	}
+	for _, amendment := range d.sortedAmendments() {
+		description := d.Locale.T("Amendment") + ": " + amendment.Description
+		if summary := amendment.Changes.LocalSummary(d.Locale); summary != "" {
+			description += " (" + summary + ")"
+		}
+		entries = append(entries, ScheduleEntry{Date: amendment.EffectiveDate, Description: description})
+	}
+	for _, payment := range d.Terms.Payments {
+		description := d.Locale.Tf("Payment of %s due", d.Locale.Money(payment.Amount, d.Terms.Currency))
+		if d.Redacted(redactPaymentAmounts) {
+			description = d.Locale.T("Payment due")
+		}
+		if payment.PaidDate != "" {
+			description += " (" + d.Locale.Tf("paid on %s", d.Locale.Date(payment.PaidDate)) + ")"
+		}
+		entries = append(entries, ScheduleEntry{Date: payment.DueDate, Description: description})
+	}
+	if deadline := d.Terms.NoticeDeadline(); deadline != "" {
+		entries = append(entries, ScheduleEntry{Date: deadline, Description: d.Locale.T("Renewal notice deadline")})
+	}
+	if d.Terms.EndDate != "" {
+		entries = append(entries, ScheduleEntry{Date: d.Terms.EndDate, Description: d.Locale.T("Contract ends")})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+	return entries
+}
+
+// htmlIndexData is the value the index page template is executed with
+type htmlIndexData struct {
+	Title     string
+	Contracts []*Contract
+	Locale    *Locale
+}
+
+// HTMLRenderer renders contracts as standalone HTML pages with an inline stylesheet
+type HTMLRenderer struct {
+	tmpl *template.Template
+}
+
+// NewHTMLRenderer parses the built-in HTML templates
+func NewHTMLRenderer() (*HTMLRenderer, error) {
+	tmpl, err := template.New("html").Funcs(htmlFuncs(nil)).ParseFS(htmlTemplates, "templates/html/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML templates: %v", err)
+	}
+	return &HTMLRenderer{tmpl: tmpl}, nil
+}
+
+// htmlFuncs returns the template helpers of the HTML pages for the locale
+func htmlFuncs(locale *Locale) template.FuncMap {
+	funcs := template.FuncMap(templateFuncs(locale))
+	funcs["statusClass"] = statusClass
+	funcs["htmlFile"] = func(id string) string {
+		name, err := contractFileName(id, ".html")
+		if err != nil {
+			return "#"
+		}
+		return name
+	}
+	return funcs
+}
+
+// execute runs one of the page templates with the helpers bound to the locale
+func (r *HTMLRenderer) execute(w io.Writer, name string, locale *Locale, data any) error {
+	tmpl, err := r.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return tmpl.Funcs(htmlFuncs(locale)).ExecuteTemplate(w, name, data)
+}
+
+// RenderContract writes the HTML page of a single contract to w
+func (r *HTMLRenderer) RenderContract(w io.Writer, data TemplateData) error {
+	if err := r.execute(w, "contract", data.Locale, data); err != nil {
+		return fmt.Errorf("error rendering contract %s as HTML: %v", data.ID, err)
+	}
+	return nil
+}
+
+// RenderIndex writes an HTML page linking to the pages of the given contracts
+func (r *HTMLRenderer) RenderIndex(w io.Writer, title string, contracts []*Contract, locale *Locale) error {
+	data := htmlIndexData{Title: title, Contracts: contracts, Locale: locale}
+	if err := r.execute(w, "index", locale, data); err != nil {
+		return fmt.Errorf("error rendering HTML index: %v", err)
+	}
+	return nil
+}
+
+// WriteSite writes index.html and one <id>.html page per contract to dir, with the
+// fields of the redaction policy hidden when one is given
+func (r *HTMLRenderer) WriteSite(dir string, contracts []*Contract, locale *Locale, redaction *RedactionPolicy) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating site directory: %v", err)
+	}
+
+	sorted := make([]*Contract, 0, len(contracts))
+	for _, contract := range contracts {
+		sorted = append(sorted, redaction.Apply(contract))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	for _, contract := range sorted {
+		name, err := contractFileName(contract.ID, ".html")
+		if err != nil {
+			return err
+		}
+
+		var sb strings.Builder
+		if err := r.RenderContract(&sb, TemplateData{Contract: contract, Locale: locale, Redaction: redaction}); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, name), []byte(sb.String())); err != nil {
+			return fmt.Errorf("error writing %s: %v", name, err)
+		}
+	}
+
+	var sb strings.Builder
+	if err := r.RenderIndex(&sb, locale.T("Contracts"), sorted, locale); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "index.html"), []byte(sb.String())); err != nil {
+		return fmt.Errorf("error writing index.html: %v", err)
+	}
+	return nil
+}
+
+// statusClass returns the CSS class of the status badge, e.g. status-active
+func statusClass(status string) string {
+	return "status-" + slugify(status)
+}
+
+// slugify lowercases text and joins its runs of letters and digits with hyphens,
+// e.g. "On Hold" becomes "on-hold"
+func slugify(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "-") {
+			sb.WriteRune('-')
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLRenderContract(t *testing.T) {
+	renderer, err := NewHTMLRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create HTML renderer: %v", err)
+	}
+
+	contract := newTestContract("TEST-001", "active")
+	contract.Title = `Supply <script>alert("x")</script> & Service`
+	contract.PredecessorID = "TEST-000"
+
+	var sb strings.Builder
+	if err := renderer.RenderContract(&sb, TemplateData{Contract: contract}); err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	page := sb.String()
+
+	expectedStrings := []string{
+		"<!DOCTYPE html>",
+		"<style>",
+		"Supply &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; Service",
+		`<span class="badge status-active">active</span>`,
+		`<a href="TEST-000.html">TEST-000</a>`,
+		`<a href="mailto:client@example.com">client@example.com</a>`,
+		"<dd>1000.00 USD</dd>",
+		"<td>2024-04-01</td><td>Amendment: Price increase (value 1200.00)</td>",
+	}
+	for _, expected := range expectedStrings {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected page to contain %q", expected)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("Expected title to be escaped")
+	}
+}
+
+func TestTemplateDataSchedule(t *testing.T) {
+	schedule := TemplateData{Contract: newTestContract("TEST-001", "active")}.Schedule()
+
+	expected := []string{"2024-01-01", "2024-04-01", "2024-09-01", "2024-12-31"}
+	if len(schedule) != len(expected) {
+		t.Fatalf("Expected %d schedule entries, got %+v", len(expected), schedule)
+	}
+	for i, date := range expected {
+		if schedule[i].Date != date {
+			t.Errorf("Expected entry %d on %s, got %s", i, date, schedule[i].Date)
+		}
+	}
+}
+
+func TestTemplateDataSchedulePayments(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Terms.NoticePeriodDays = 30
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-06-30", Amount: 600, PaidDate: "2024-06-28"},
+		{DueDate: "2024-12-15", Amount: 600},
+	}
+
+	var got []string
+	for _, entry := range (TemplateData{Contract: contract}).Schedule() {
+		got = append(got, entry.Date+" "+entry.Description)
+	}
+	expected := []string{
+		"2024-01-01 Contract starts",
+		"2024-04-01 Amendment: Price increase (value 1200.00)",
+		"2024-06-30 Payment of 600.00 USD due (paid on 2024-06-28)",
+		"2024-09-01 Amendment: Extension (end date 2025-03-31)",
+		"2024-12-01 Renewal notice deadline",
+		"2024-12-15 Payment of 600.00 USD due",
+		"2024-12-31 Contract ends",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected schedule\n--- got\n%s\n--- expected\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestHTMLWriteSite(t *testing.T) {
+	renderer, err := NewHTMLRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create HTML renderer: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "site")
+	contracts := []*Contract{newTestContract("C-2", "pending"), newTestContract("C-1", "active")}
+	if err := renderer.WriteSite(dir, contracts, nil, nil); err != nil {
+		t.Fatalf("Failed to write site: %v", err)
+	}
+
+	for _, name := range []string{"index.html", "C-1.html", "C-2.html"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	first := strings.Index(string(index), `href="C-1.html"`)
+	second := strings.Index(string(index), `href="C-2.html"`)
+	if first < 0 || second < 0 || first > second {
+		t.Errorf("Expected index to link to C-1 before C-2:\n%s", index)
+	}
+	if !strings.Contains(string(index), "2 contracts") {
+		t.Error("Expected index to show the number of contracts")
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[string]string{
+		"active":        "status-active",
+		"Pending":       "status-pending",
+		"On Hold":       "status-on-hold",
+		`x" onclick="y`: "status-x-onclick-y",
+		"":              "status-",
+	}
+	for status, expected := range tests {
+		if got := statusClass(status); got != expected {
+			t.Errorf("statusClass(%q): expected %s, got %s", status, expected, got)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsProductID identifies the program in exported calendars
+const icsProductID = "-//goplayground//Contract Calendar//EN"
+
+// icsUIDDomain is the domain part of event UIDs, which keeps them apart from the
+// UIDs of events created by other programs
+const icsUIDDomain = "contracts.goplayground"
+
+// icsLineLimit is the maximum length of a calendar line in octets, without the line break
+const icsLineLimit = 75
+
+// CalendarEvent is an all-day event in the life of a contract
+type CalendarEvent struct {
+	// UID only depends on the contract ID, the kind of event and, for payments, the
+	// due date, so importing a new export updates the events of an earlier one
+	UID         string
+	Date        string
+	Summary     string
+	Description string
+	// Remind is set for events that deserve an alarm: the end of the contract, the
+	// renewal notice deadline and outstanding payments
+	Remind bool
+}
+
+// CalendarOptions controls how contracts are exported as a calendar
+type CalendarOptions struct {
+	// Name is shown by calendar applications as the name of the calendar
+	Name string
+	// Locale translates event summaries and formats amounts and dates
+	Locale *Locale
+	// Stamp is the time the calendar is created, recorded in every event
+	Stamp time.Time
+	// ReminderDays adds an alarm this many days before events that deserve one;
+	// zero adds none
+	ReminderDays int
+	// Redaction hides contract fields in the events when set
+	Redaction *RedactionPolicy
+}
+
+// ContractEvents returns the start, end, renewal notice deadline and payment due
+// dates of a contract as calendar events, using the terms after all amendments
+func ContractEvents(c *Contract, l *Locale) []CalendarEvent {
+	return contractEvents(c, l, nil)
+}
+
+// contractEvents returns the events of a contract that the redaction policy, if
+// any, was applied to, leaving out the payment amounts it hides
+func contractEvents(c *Contract, l *Locale, redaction *RedactionPolicy) []CalendarEvent {
+	latest := c.latestTerms()
+	terms := latest.Terms
+	uid := func(kind string) string {
+		return c.ID + "-" + kind + "@" + icsUIDDomain
+	}
+	description := l.Tf("Contract %s", c.ID) + " (" + l.T(latest.Status) + ")"
+
+	var events []CalendarEvent
+	if terms.StartDate != "" {
+		events = append(events, CalendarEvent{
+			UID:         uid("start"),
+			Date:        terms.StartDate,
+			Summary:     l.Tf("%s starts", latest.Title),
+			Description: description,
+		})
+	}
+	if deadline := terms.NoticeDeadline(); deadline != "" {
+		events = append(events, CalendarEvent{
+			UID:     uid("notice"),
+			Date:    deadline,
+			Summary: l.Tf("Renewal notice deadline for %s", latest.Title),
+			Description: description + "\n" + l.Tf("Notice must be given %d days before the contract ends on %s.",
+				terms.NoticePeriodDays, l.Date(terms.EndDate)),
+			Remind: true,
+		})
+	}
+	if terms.EndDate != "" {
+		events = append(events, CalendarEvent{
+			UID:         uid("end"),
+			Date:        terms.EndDate,
+			Summary:     l.Tf("%s ends", latest.Title),
+			Description: description,
+			Remind:      true,
+		})
+	}
+
+	// Payments due on the same day are told apart by their position among them
+	sameDay := make(map[string]int)
+	for _, payment := range terms.Payments {
+		sameDay[payment.DueDate]++
+		kind := "payment-" + payment.DueDate
+		if n := sameDay[payment.DueDate]; n > 1 {
+			kind += "-" + strconv.Itoa(n)
+		}
+
+		paymentDescription := description
+		if payment.Description != "" {
+			paymentDescription += "\n" + payment.Description
+		}
+		if payment.PaidDate != "" {
+			paymentDescription += "\n" + l.Tf("paid on %s", l.Date(payment.PaidDate))
+		}
+		summary := l.Tf("Payment of %s due for %s", l.Money(payment.Amount, terms.Currency), latest.Title)
+		if redaction.Redacts(redactPaymentAmounts) {
+			summary = l.Tf("Payment due for %s", latest.Title)
+		}
+		events = append(events, CalendarEvent{
+			UID:         uid(kind),
+			Date:        payment.DueDate,
+			Summary:     summary,
+			Description: paymentDescription,
+			Remind:      payment.PaidDate == "",
+		})
+	}
+	return events
+}
+
+// WriteCalendar writes the events of the contracts as an RFC 5545 calendar
+func WriteCalendar(w io.Writer, contracts []*Contract, opts CalendarOptions) error {
+	var sb strings.Builder
+	line := func(name, value string) {
+		sb.WriteString(foldICSLine(name + ":" + value))
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", icsProductID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if opts.Name != "" {
+		line("X-WR-CALNAME", escapeICSText(opts.Name))
+	}
+
+	stamp := opts.Stamp.UTC().Format("20060102T150405Z")
+	for _, contract := range contracts {
+		for _, event := range contractEvents(opts.Redaction.Apply(contract), opts.Locale, opts.Redaction) {
+			start, err := time.Parse(dateLayout, event.Date)
+			if err != nil {
+				return fmt.Errorf("contract %s: invalid date %s: %v", contract.ID, event.Date, err)
+			}
+
+			line("BEGIN", "VEVENT")
+			line("UID", escapeICSText(event.UID))
+			line("DTSTAMP", stamp)
+			line("DTSTART;VALUE=DATE", start.Format("20060102"))
+			// The end of an all-day event is exclusive
+			line("DTEND;VALUE=DATE", start.AddDate(0, 0, 1).Format("20060102"))
+			line("SUMMARY", escapeICSText(event.Summary))
+			line("DESCRIPTION", escapeICSText(event.Description))
+			line("TRANSP", "TRANSPARENT")
+			if event.Remind && opts.ReminderDays > 0 {
+				line("BEGIN", "VALARM")
+				line("ACTION", "DISPLAY")
+				line("DESCRIPTION", escapeICSText(event.Summary))
+				line("TRIGGER", fmt.Sprintf("-P%dD", opts.ReminderDays))
+				line("END", "VALARM")
+			}
+			line("END", "VEVENT")
+		}
+	}
+	line("END", "VCALENDAR")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// escapeICSText escapes a TEXT property value
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldICSLine terminates a content line with CRLF, folding it into continuation
+// lines that start with a space so that no line exceeds 75 octets. Lines are only
+// folded between characters, never inside a UTF-8 sequence.
+func foldICSLine(line string) string {
+	var sb strings.Builder
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > icsLineLimit {
+			sb.WriteString("\r\n ")
+			width = 1
+		}
+		sb.WriteRune(r)
+		width += size
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+// calendarResult is the result record of a calendar written to a file
+type calendarResult struct {
+	Path      string `json:"path"`
+	Contracts int    `json:"contracts"`
+	Events    int    `json:"events"`
+}
+
+// runCalendar implements the calendar command
+func runCalendar(args []string) error {
+	fs := newFlagSet("calendar")
+	output := fs.String("o", "", "Write the calendar to this .ics file instead of standard output")
+	name := fs.String("name", "", "Name of the calendar shown by calendar applications (default: Contracts, translated with -locale)")
+	remind := fs.Int("remind", 7, "Add an alarm this many days before contract ends, notice deadlines and outstanding payments (0 for none)")
+	localeTag := fs.String("locale", "", "Write event summaries, dates and amounts for a locale such as de-DE or en-US")
+	redact := fs.String("redact", "", "Hide fields using this policy from the -redaction-config file, e.g. external")
+	all := fs.Bool("all", false, "Export every stored contract that matches the filter flags")
+	filter := filterFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *remind < 0 {
+		return fmt.Errorf("-remind cannot be negative")
+	}
+
+	locale, err := loadLocaleFlag(*localeTag)
+	if err != nil {
+		return err
+	}
+	redaction, err := loadRedactionFlag(*redact)
+	if err != nil {
+		return err
+	}
+	contracts, err := selectContracts(positional, *all, filter())
+	if err != nil {
+		return err
+	}
+
+	opts := CalendarOptions{Name: *name, Locale: locale, Stamp: time.Now(), ReminderDays: *remind, Redaction: redaction}
+	if opts.Name == "" {
+		opts.Name = locale.T("Contracts")
+	}
+	if *output == "" || *output == "-" {
+		return WriteCalendar(os.Stdout, contracts, opts)
+	}
+
+	var sb strings.Builder
+	if err := WriteCalendar(&sb, contracts, opts); err != nil {
+		return err
+	}
+	// Re-exporting replaces the calendar, so it is always overwritten
+	if err := writeFileAtomic(*output, []byte(sb.String())); err != nil {
+		return fmt.Errorf("error writing calendar: %v", err)
+	}
+
+	result := calendarResult{Path: *output, Contracts: len(contracts)}
+	for _, contract := range contracts {
+		result.Events += len(ContractEvents(contract, locale))
+	}
+	return printResults(result, func() {
+		fmt.Printf("Wrote %d event(s) for %d contract(s) to %s\n", result.Events, result.Contracts, result.Path)
+	})
+}
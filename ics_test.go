@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var calendarStamp = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWriteCalendar(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Terms.NoticePeriodDays = 60
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+		{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+	}
+	other := &Contract{
+		ID:     "TEST-002",
+		Title:  "Maintenance, Support; and a title long enough to be folded onto a second line",
+		Status: "pending",
+		Terms:  Terms{StartDate: "2025-01-01"},
+	}
+
+	var sb strings.Builder
+	opts := CalendarOptions{Name: "Contracts", Stamp: calendarStamp, ReminderDays: 7}
+	if err := WriteCalendar(&sb, []*Contract{contract, other}, opts); err != nil {
+		t.Fatalf("Failed to write calendar: %v", err)
+	}
+	checkGolden(t, "calendar.ics", sb.String())
+
+	for i, line := range strings.Split(strings.TrimSuffix(sb.String(), "\r\n"), "\r\n") {
+		if len(line) > icsLineLimit {
+			t.Errorf("Line %d is %d octets long: %q", i+1, len(line), line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("Line %d contains a bare line feed: %q", i+1, line)
+		}
+	}
+
+	t.Run("NoReminders", func(t *testing.T) {
+		var sb strings.Builder
+		opts := CalendarOptions{Stamp: calendarStamp}
+		if err := WriteCalendar(&sb, []*Contract{contract}, opts); err != nil {
+			t.Fatalf("Failed to write calendar: %v", err)
+		}
+		if strings.Contains(sb.String(), "VALARM") || strings.Contains(sb.String(), "X-WR-CALNAME") {
+			t.Errorf("Expected no alarms and no calendar name, got\n%s", sb.String())
+		}
+	})
+
+	t.Run("Localized", func(t *testing.T) {
+		var sb strings.Builder
+		opts := CalendarOptions{Locale: mustLoadLocale(t, "de"), Stamp: calendarStamp}
+		if err := WriteCalendar(&sb, []*Contract{contract}, opts); err != nil {
+			t.Fatalf("Failed to write calendar: %v", err)
+		}
+		for _, expected := range []string{
+			"SUMMARY:Letzter Kündigungstag für Test Contract",
+			`SUMMARY:Zahlung von 600\,00 $ fällig für Test Contract`,
+			"SUMMARY:Ende: Test Contract",
+		} {
+			if !strings.Contains(sb.String(), expected) {
+				t.Errorf("Expected calendar to contain %q", expected)
+			}
+		}
+	})
+}
+
+func TestContractEvents(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Terms.NoticePeriodDays = 60
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+		{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+	}
+	events := ContractEvents(contract, nil)
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Date+" "+event.UID)
+	}
+	// The end date and notice deadline follow the amendment that extends the contract
+	expected := []string{
+		"2024-01-01 TEST-001-start@contracts.goplayground",
+		"2025-01-30 TEST-001-notice@contracts.goplayground",
+		"2025-03-31 TEST-001-end@contracts.goplayground",
+		"2024-01-15 TEST-001-payment-2024-01-15@contracts.goplayground",
+		"2024-07-15 TEST-001-payment-2024-07-15@contracts.goplayground",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected events\n--- got\n%s\n--- expected\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	t.Run("StableUIDs", func(t *testing.T) {
+		changed, err := copyContract(contract)
+		if err != nil {
+			t.Fatalf("Failed to copy contract: %v", err)
+		}
+		changed.Title = "Renamed Contract"
+		changed.Terms.EndDate = "2024-11-30"
+		changed.Amendments = nil
+		changed.Terms.Payments[1].Amount = 700
+
+		for i, event := range ContractEvents(changed, nil) {
+			if event.UID != events[i].UID {
+				t.Errorf("Expected UID %s to stay the same, got %s", events[i].UID, event.UID)
+			}
+		}
+	})
+
+	t.Run("PaymentsOnTheSameDay", func(t *testing.T) {
+		contract := &Contract{ID: "C-1", Terms: Terms{Payments: []Payment{
+			{DueDate: "2024-03-01", Amount: 1},
+			{DueDate: "2024-03-01", Amount: 2},
+		}}}
+		events := ContractEvents(contract, nil)
+		if len(events) != 2 || events[0].UID == events[1].UID {
+			t.Fatalf("Expected two events with different UIDs, got %+v", events)
+		}
+		if events[1].UID != "C-1-payment-2024-03-01-2@contracts.goplayground" {
+			t.Errorf("Unexpected UID %s", events[1].UID)
+		}
+	})
+
+	t.Run("Reminders", func(t *testing.T) {
+		for _, event := range events {
+			paid := strings.HasSuffix(event.UID, "-payment-2024-01-15@contracts.goplayground")
+			start := strings.Contains(event.UID, "-start@")
+			if event.Remind == (paid || start) {
+				t.Errorf("Unexpected reminder setting %v for %s", event.Remind, event.UID)
+			}
+		}
+	})
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("a", 200),
+		"SUMMARY:" + strings.Repeat("ü", 60),
+	}
+	for _, line := range tests {
+		folded := foldICSLine(line)
+		if !strings.HasSuffix(folded, "\r\n") {
+			t.Errorf("Expected folded line to end with CRLF: %q", folded)
+		}
+		for _, part := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+			if len(part) > icsLineLimit || !utf8.ValidString(part) {
+				t.Errorf("Invalid folded line %q", part)
+			}
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+			t.Errorf("Expected unfolding to restore %q, got %q", line, unfolded)
+		}
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	got := escapeICSText("a\\b; c, d\ne")
+	expected := `a\\b\; c\, d\ne`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// localeCatalogs holds the message catalogs and formats of the shipped locales
+//
+//go:embed locales/*.json
+var localeCatalogs embed.FS
+
+// currencySymbols maps ISO 4217 codes to the symbols shown in localized amounts.
+// Other currencies are shown with their code.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"USD": "$",
+}
+
+// Locale translates labels and formats dates and amounts for a language.
+// A nil *Locale keeps the English labels, ISO dates and "1000.00 USD" amounts
+// that contracts are rendered with when no locale is selected.
+type Locale struct {
+	// Tag is the locale the catalog was loaded for, e.g. de-DE
+	Tag string `json:"-"`
+	// Name is the name of the language in that language
+	Name string `json:"name"`
+	// DateFormat is the Go time layout of dates
+	DateFormat string `json:"dateFormat"`
+	// DecimalSeparator and GroupSeparator are used in numbers and amounts
+	DecimalSeparator string `json:"decimalSeparator"`
+	GroupSeparator   string `json:"groupSeparator"`
+	// SymbolBeforeAmount places the currency symbol before the amount ($1,000.00)
+	// instead of after it (1.000,00 €)
+	SymbolBeforeAmount bool `json:"symbolBeforeAmount"`
+	// Messages maps English messages to their translation
+	Messages map[string]string `json:"messages"`
+}
+
+// LoadLocale loads the locale for a tag such as de, de-DE or en_US. The catalog of
+// the language is loaded first and a catalog for the exact region, when one is
+// shipped, overrides its entries.
+func LoadLocale(tag string) (*Locale, error) {
+	normalized := strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	language, region, _ := strings.Cut(normalized, "-")
+	language = strings.ToLower(language)
+	if language == "" {
+		return nil, fmt.Errorf("locale is empty")
+	}
+
+	data, err := localeCatalogs.ReadFile("locales/" + language + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported locale %q (available: %s)", tag, strings.Join(AvailableLocales(), ", "))
+	}
+	locale := &Locale{}
+	if err := json.Unmarshal(data, locale); err != nil {
+		return nil, fmt.Errorf("error parsing locale %s: %v", language, err)
+	}
+
+	locale.Tag = language
+	if region != "" {
+		locale.Tag = language + "-" + strings.ToUpper(region)
+		if data, err := localeCatalogs.ReadFile("locales/" + locale.Tag + ".json"); err == nil {
+			if err := json.Unmarshal(data, locale); err != nil {
+				return nil, fmt.Errorf("error parsing locale %s: %v", locale.Tag, err)
+			}
+		}
+	}
+	return locale, nil
+}
+
+// AvailableLocales returns the tags of the shipped catalogs
+func AvailableLocales() []string {
+	entries, err := localeCatalogs.ReadDir("locales")
+	if err != nil {
+		return nil
+	}
+
+	var tags []string
+	for _, entry := range entries {
+		if tag, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Language returns the language part of the locale tag, e.g. de for de-DE
+func (l *Locale) Language() string {
+	if l == nil {
+		return "en"
+	}
+	language, _, _ := strings.Cut(l.Tag, "-")
+	return language
+}
+
+// T returns the translation of an English message, or the message itself when the
+// catalog has none. Messages that only differ in the case of their first letter,
+// such as the status "Active", share the translation of the lowercase message.
+func (l *Locale) T(message string) string {
+	if l == nil || message == "" {
+		return message
+	}
+	if translated, ok := l.Messages[message]; ok {
+		return translated
+	}
+
+	first, size := utf8.DecodeRuneInString(message)
+	lower := string(unicode.ToLower(first)) + message[size:]
+	if translated, ok := l.Messages[lower]; ok && unicode.IsUpper(first) {
+		first, size := utf8.DecodeRuneInString(translated)
+		return string(unicode.ToUpper(first)) + translated[size:]
+	}
+	return message
+}
+
+// Tf translates a format string and formats it with the arguments
+func (l *Locale) Tf(format string, args ...any) string {
+	return fmt.Sprintf(l.T(format), args...)
+}
+
+// Date formats a YYYY-MM-DD contract date in the locale's date format.
+// Values that are not valid dates are returned unchanged.
+func (l *Locale) Date(value string) string {
+	if l == nil || l.DateFormat == "" {
+		return value
+	}
+	parsed, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return value
+	}
+	return parsed.Format(l.DateFormat)
+}
+
+// Number formats a number with the given number of decimals and grouped thousands
+func (l *Locale) Number(value float64, decimals int) string {
+	if l == nil {
+		return strconv.FormatFloat(value, 'f', decimals, 64)
+	}
+
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(formatted, ".")
+
+	var sb strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		sb.WriteByte('-')
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			sb.WriteString(l.GroupSeparator)
+		}
+		sb.WriteRune(digit)
+	}
+	if fraction != "" {
+		sb.WriteString(l.DecimalSeparator)
+		sb.WriteString(fraction)
+	}
+	return sb.String()
+}
+
+// Money formats an amount with two decimals and the currency symbol placed the way
+// the locale places it. Without a locale the result is e.g. "1000.00 USD".
+func (l *Locale) Money(value float64, currency string) string {
+	if l == nil {
+		return strings.TrimSpace(fmt.Sprintf("%.2f %s", value, currency))
+	}
+
+	amount := l.Number(math.Abs(value), 2)
+	sign := ""
+	if value < 0 && amount != l.Number(0, 2) {
+		sign = "-"
+	}
+	if currency == "" {
+		return sign + amount
+	}
+
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if !l.SymbolBeforeAmount {
+		return sign + amount + " " + symbol
+	}
+	// Codes such as CHF are separated from the amount, symbols such as $ are not
+	if !ok {
+		return sign + symbol + " " + amount
+	}
+	return sign + symbol + amount
+}
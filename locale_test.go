@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// mustLoadLocale loads a shipped locale or fails the test
+func mustLoadLocale(t *testing.T, tag string) *Locale {
+	t.Helper()
+	locale, err := LoadLocale(tag)
+	if err != nil {
+		t.Fatalf("Failed to load locale %s: %v", tag, err)
+	}
+	return locale
+}
+
+func TestLoadLocale(t *testing.T) {
+	for _, tag := range []string{"de", "de-DE", "de_de", "DE-at"} {
+		locale := mustLoadLocale(t, tag)
+		if locale.Language() != "de" || locale.DateFormat != "02.01.2006" {
+			t.Errorf("%s: expected the German catalog, got %s with %s", tag, locale.Tag, locale.DateFormat)
+		}
+	}
+	if tag := mustLoadLocale(t, "en_us").Tag; tag != "en-US" {
+		t.Errorf("Expected tag en-US, got %s", tag)
+	}
+
+	for _, tag := range []string{"", "fr-FR", "../de"} {
+		if _, err := LoadLocale(tag); err == nil {
+			t.Errorf("Expected error for locale %q", tag)
+		}
+	}
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	en := mustLoadLocale(t, "en-US")
+	de := mustLoadLocale(t, "de-DE")
+	var none *Locale
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"NoneMoney", none.Money(1000, "USD"), "1000.00 USD"},
+		{"NoneDate", none.Date("2024-03-01"), "2024-03-01"},
+		{"NoneLabel", none.T("Terms"), "Terms"},
+		{"EnMoney", en.Money(1234567.891, "USD"), "$1,234,567.89"},
+		{"EnMoneyCode", en.Money(500, "CHF"), "CHF 500.00"},
+		{"EnMoneyNegative", en.Money(-42.5, "EUR"), "-€42.50"},
+		{"EnMoneyNoCurrency", en.Money(999, ""), "999.00"},
+		{"EnDate", en.Date("2024-03-01"), "03/01/2024"},
+		{"EnInvalidDate", en.Date("soon"), "soon"},
+		{"DeMoney", de.Money(1234567.891, "EUR"), "1.234.567,89 €"},
+		{"DeMoneyDollar", de.Money(100, "USD"), "100,00 $"},
+		{"DeMoneyNegativeZero", de.Money(-0.001, "EUR"), "0,00 €"},
+		{"DeNumber", de.Number(1000, 0), "1.000"},
+		{"DeDate", de.Date("2024-03-01"), "01.03.2024"},
+		{"DeLabel", de.T("Terms"), "Konditionen"},
+		{"DeStatus", de.T("active"), "aktiv"},
+		{"DeCapitalizedStatus", de.T("Active"), "Aktiv"},
+		{"DeUnknown", de.T("on hold"), "on hold"},
+		{"DeFormat", de.Tf("Page %d of %d", 1, 3), "Seite 1 von 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+func TestLocalizedMarkdown(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.PredecessorID = "TEST-000"
+
+	renderer, err := NewRenderer(DefaultTemplate)
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	rendered, err := renderer.RenderString(TemplateData{Contract: contract, Locale: mustLoadLocale(t, "de-DE")})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	checkGolden(t, "amended.de.md", rendered)
+
+	// The renderer keeps no state from the localized render
+	english, err := renderer.RenderString(TemplateData{Contract: contract})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	markdown, err := contract.ToMarkdown()
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	if english != markdown {
+		t.Errorf("Expected an English render after a German one, got\n%s", english)
+	}
+}
+
+func TestLocalizedHTML(t *testing.T) {
+	renderer, err := NewHTMLRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create HTML renderer: %v", err)
+	}
+
+	var sb strings.Builder
+	data := TemplateData{Contract: newTestContract("TEST-001", "active"), Locale: mustLoadLocale(t, "de")}
+	if err := renderer.RenderContract(&sb, data); err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	for _, expected := range []string{
+		`<html lang="de">`,
+		`<span class="badge status-active">aktiv</span>`,
+		"<dd>1.000,00 $</dd>",
+		"<td>01.04.2024</td><td>Nachtrag: Price increase (Wert 1.200,00)</td>",
+	} {
+		if !strings.Contains(sb.String(), expected) {
+			t.Errorf("Expected page to contain %q", expected)
+		}
+	}
+}
+
+// TestLocaleCatalogsComplete checks that every label used in the templates and the
+// PDF layout has a German translation
+func TestLocaleCatalogsComplete(t *testing.T) {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`\btf? "([^"]+)"`),
+		regexp.MustCompile(`\.Tf?\("([^"]+)"`),
+	}
+	sources, _ := filepath.Glob(filepath.Join("templates", "*.tmpl"))
+	html, _ := filepath.Glob(filepath.Join("templates", "html", "*.tmpl"))
+	sources = append(append(sources, html...), "pdf.go", "html.go", "amendment.go", "ics.go")
+
+	de := mustLoadLocale(t, "de")
+	for _, source := range sources {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", source, err)
+		}
+		for _, pattern := range patterns {
+			for _, match := range pattern.FindAllStringSubmatch(string(data), -1) {
+				if _, ok := de.Messages[match[1]]; !ok {
+					t.Errorf("%s: no German translation for %q", source, match[1])
+				}
+			}
+		}
+	}
+}
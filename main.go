@@ -1,28 +1,68 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 )
 
 // defaultContractFile is set at build time using -ldflags
 var defaultContractFile string
 
 var (
-	showContract   = flag.Bool("contract", false, "Show contract information")
-	outputMarkdown = flag.Bool("output-md", false, "Output contract information to output.md")
-	contractFile   = flag.String("contract-file", "config/contract.json", "Path to the contract.json file")
-	storeContract  = flag.Bool("store", false, "Store contract in database")
-	listContracts  = flag.Bool("list", false, "List all contracts in database")
-	deleteContract = flag.String("delete", "", "Delete contract with the specified ID from database")
-	dbPath         = flag.String("db", "data/contracts.db", "Path to the SQLite database file")
+	showContract        = flag.Bool("contract", false, "Show contract information")
+	outputMarkdown      = flag.Bool("output-md", false, "Output contract information to output.md, or to -output-md-path")
+	markdownPath        = flag.String("output-md-path", "output.md", "Where -output-md writes: a file, a directory or a pattern like rendered/{id}-{status}.md")
+	contractFile        = flag.String("contract-file", "config/contract.json", "Path to the contract.json file")
+	storeContract       = flag.Bool("store", false, "Store contract in database")
+	listContracts       = flag.Bool("list", false, "List all contracts in database")
+	deleteContract      = flag.String("delete", "", "Delete contract with the specified ID from database")
+	asOfDate            = flag.String("as-of", "", "Show the terms in effect on this date (YYYY-MM-DD), including amendments")
+	outputFormat        = flag.String("output", outputTable, "Format of command results: table, json, jsonl, yaml or csv")
+	notifyConfigPath    = flag.String("notify", "", "Email contract parties about changes to stored contracts using this notification config file (JSON)")
+	dbPath              = flag.String("db", "data/contracts.db", "Contract store: a SQLite file path or a URL like sqlite:<path>, postgres://..., dir:<path> or memory:")
+	redactPolicy        = flag.String("redact", "", "With -contract or -output-md, hide fields using this policy from the -redaction-config file")
+	redactionConfigPath = flag.String("redaction-config", "redaction.json", "File defining the named redaction policies used by -redact (JSON)")
+	actingUser          = flag.String("as", "", "Name of the user to act as once the store has users, not authenticated (default from $"+userEnv+", or the user of $"+apiTokenEnv+")")
+	tenantName          = flag.String("tenant", "", "Tenant whose contracts commands work with (default from $"+tenantEnv+", or the tenant of the -as user)")
+	rulesConfigPath     = flag.String("rules", "", "Check contracts against the business rules in this file (JSON) in validate and whenever a contract is stored")
+	trustedKeysPath     = flag.String("trusted-keys", "trusted-keys.json", "File pinning the public key of each signing party, used by sign and verify (JSON)")
+	encryptionKeyFile   = flag.String("key-file", "", "File holding the base64 encoded key of an encrypted database (default from $"+encryptionKeyEnv+")")
 )
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
+	if err := validateOutputFormat(*outputFormat); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := checkRedactFlag(*redactPolicy, flag.Arg(0), *showContract || *outputMarkdown); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Run a subcommand if one is given
+	if flag.NArg() > 0 {
+		cmd, ok := findCommand(flag.Arg(0))
+		if !ok {
+			fmt.Printf("Unknown command: %s\n", flag.Arg(0))
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Check if any flags are provided
 	if flag.NFlag() == 0 {
 		fmt.Println("No flags provided. Available options:")
@@ -30,13 +70,17 @@ func main() {
 		return
 	}
 
-	// Initialize database if any database-related flags are used
-	var db *DB
+	// Open the contract store if any database-related flags are used
+	var db ContractStore
 	if *storeContract || *listContracts || *deleteContract != "" {
 		var err error
-		db, err = InitDB(*dbPath)
+		db, err = openBareStore()
 		if err != nil {
-			fmt.Printf("Error initializing database: %v\n", err)
+			printError(err)
+			return
+		}
+		if db, err = wrapStore(db); err != nil {
+			printError(err)
 			return
 		}
 		defer db.Close()
@@ -44,48 +88,28 @@ func main() {
 
 	// Handle delete operation
 	if *deleteContract != "" {
-		err := db.DeleteContract(*deleteContract)
-		if err != nil {
-			fmt.Printf("Error deleting contract: %v\n", err)
-			return
+		if err := deleteStoredContracts(db, []string{*deleteContract}); err != nil {
+			printError(err)
 		}
-		fmt.Printf("Contract %s deleted successfully from database\n", *deleteContract)
 		return
 	}
 
 	// Handle list operation
 	if *listContracts {
-		contracts, err := db.GetAllContracts()
-		if err != nil {
-			fmt.Printf("Error listing contracts: %v\n", err)
-			return
-		}
-
-		fmt.Println("Contracts in database:")
-		fmt.Printf("%-15s %-20s %-10s\n", "ID", "Title", "Status")
-		fmt.Println(strings.Repeat("-", 45))
-		for _, contract := range contracts {
-			fmt.Printf("%-15s %-20s %-10s\n", contract.ID, contract.Title, contract.Status)
+		if err := printContractList(db, ContractFilter{}); err != nil {
+			printError(err)
 		}
 		return
 	}
 
 	// For store operation, we need a contract file
 	if *storeContract {
-		// Load the contract from the specified file
-		contract, err := LoadContract(*contractFile)
-		if err != nil {
-			fmt.Printf("Error loading contract from %s: %v\n", *contractFile, err)
-			fmt.Println("Please ensure the contract file exists and is valid JSON")
-			return
-		}
-
-		err = db.StoreContract(contract)
-		if err != nil {
-			fmt.Printf("Error storing contract: %v\n", err)
-			return
+		if err := storeContractFiles(db, []string{*contractFile}); err != nil {
+			printError(err)
+			if isLoadError(err) && !structuredOutput() {
+				fmt.Println("Please ensure the contract file exists and is valid JSON")
+			}
 		}
-		fmt.Printf("Contract %s stored successfully in database\n", contract.ID)
 		return
 	}
 
@@ -99,23 +123,74 @@ func main() {
 			return
 		}
 
-		markdown := contract.ToMarkdown()
+		var policy *RedactionPolicy
+		if *asOfDate != "" {
+			date, err := time.Parse(dateLayout, *asOfDate)
+			if err != nil {
+				fmt.Printf("Invalid -as-of date %s: expected YYYY-MM-DD\n", *asOfDate)
+				return
+			}
+			contract = contract.EffectiveAt(date)
+		}
+		if *redactPolicy != "" {
+			if policy, err = loadRedactionFlag(*redactPolicy); err != nil {
+				printError(err)
+				return
+			}
+			contract = policy.Apply(contract)
+		}
+		markdown, err := contract.markdown(*asOfDate, policy)
+		if err != nil {
+			printError(err)
+			return
+		}
 
-		// If output to file is requested
+		// If output to file is requested, replacing an earlier output as before
 		if *outputMarkdown {
-			err := os.WriteFile("output.md", []byte(markdown), 0644)
+			dest := OutputDestination{Path: *markdownPath, Force: true}
+			if err := dest.Validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			path, _, err := dest.Write(contract, formatMarkdown, []byte(markdown))
 			if err != nil {
-				fmt.Printf("Error writing to output.md: %v\n", err)
+				fmt.Printf("Error writing contract information: %v\n", err)
+				return
+			}
+			if path == "" {
 				return
 			}
-			fmt.Println("Contract information has been written to output.md")
+			printResults(renderResult{ID: contract.ID, Path: path}, func() {
+				fmt.Printf("Contract information has been written to %s\n", path)
+			})
 			return
 		}
 
 		// If just displaying to console
 		if *showContract {
-			fmt.Println(markdown)
+			printResults(contract, func() {
+				fmt.Println(markdown)
+			})
 			return
 		}
 	}
 }
+
+// printError reports a failed command. Errors go to standard error with structured
+// -output formats, so they never mix with the results a script reads.
+func printError(err error) {
+	if structuredOutput() {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Error: %v\n", err)
+}
+
+// printWarning prints a warning like printError prints an error
+func printWarning(message string) {
+	if structuredOutput() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+		return
+	}
+	fmt.Printf("Warning: %s\n", message)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// contractSummary is the result record of a contract in listings
+type contractSummary struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	Status    string  `json:"status"`
+	StartDate string  `json:"startDate" table:"start"`
+	EndDate   string  `json:"endDate" table:"end"`
+	Value     float64 `json:"value"`
+	Currency  string  `json:"currency"`
+}
+
+// summarizeContract returns the listing record of a contract
+func summarizeContract(c *Contract) contractSummary {
+	return contractSummary{
+		ID:        c.ID,
+		Title:     c.Title,
+		Status:    c.Status,
+		StartDate: c.Terms.StartDate,
+		EndDate:   c.Terms.EndDate,
+		Value:     c.Terms.Value,
+		Currency:  c.Terms.Currency,
+	}
+}
+
+// storeResult is the result record of a stored contract
+type storeResult struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+// deleteResult is the result record of a deleted contract
+type deleteResult struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+// printContractList prints the stored contracts that match the filter
+func printContractList(store ContractStore, filter ContractFilter) error {
+	contracts, err := FindContracts(store, filter)
+	if err != nil {
+		return fmt.Errorf("error listing contracts: %v", err)
+	}
+
+	summaries := make([]contractSummary, 0, len(contracts))
+	for _, contract := range contracts {
+		summaries = append(summaries, summarizeContract(contract))
+	}
+	return printResults(summaries, nil)
+}
+
+// loadError is the error of a contract file that could not be read or parsed, as
+// opposed to a contract the store refused
+type loadError struct {
+	err error
+}
+
+func (e *loadError) Error() string {
+	return e.err.Error()
+}
+
+// isLoadError reports whether err is the error of a contract file that could not be loaded
+func isLoadError(err error) bool {
+	var target *loadError
+	return errors.As(err, &target)
+}
+
+// storeContractFiles loads every given contract file and stores it, stopping at the
+// first error. The contracts stored before it are still reported.
+func storeContractFiles(store ContractStore, paths []string) error {
+	results := make([]storeResult, 0, len(paths))
+	var failure error
+	for _, path := range paths {
+		contract, err := LoadContract(path)
+		if err != nil {
+			failure = &loadError{fmt.Errorf("error loading contract from %s: %v", path, err)}
+			break
+		}
+		if err := store.StoreContract(contract); err != nil {
+			failure = fmt.Errorf("error storing contract %s: %v", contract.ID, err)
+			break
+		}
+		results = append(results, storeResult{ID: contract.ID, Path: path})
+	}
+
+	if failure == nil || len(results) > 0 {
+		err := printResults(results, func() {
+			for _, result := range results {
+				fmt.Printf("Contract %s stored successfully in database\n", result.ID)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return failure
+}
+
+// deleteStoredContracts deletes the contracts with the given IDs, stopping at the
+// first error. The contracts deleted before it are still reported.
+func deleteStoredContracts(store ContractStore, ids []string) error {
+	results := make([]deleteResult, 0, len(ids))
+	var failure error
+	for _, id := range ids {
+		if err := store.DeleteContract(id); err != nil {
+			failure = fmt.Errorf("error deleting contract %s: %v", id, err)
+			break
+		}
+		results = append(results, deleteResult{ID: id, Deleted: true})
+	}
+
+	if failure == nil || len(results) > 0 {
+		err := printResults(results, func() {
+			for _, result := range results {
+				fmt.Printf("Contract %s deleted successfully from database\n", result.ID)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return failure
+}
+
+// runList implements the list command
+func runList(args []string) error {
+	fs := newFlagSet("list")
+	filter := filterFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("list takes no arguments, use the filter flags to select contracts")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return printContractList(store, filter())
+}
+
+// runStore implements the store command
+func runStore(args []string) error {
+	fs := newFlagSet("store")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		positional = []string{*contractFile}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return storeContractFiles(store, positional)
+}
+
+// runDelete implements the delete command
+func runDelete(args []string) error {
+	fs := newFlagSet("delete")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("delete requires at least one contract ID")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return deleteStoredContracts(store, positional)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreContractFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeContract := func(t *testing.T, contract *Contract) string {
+		t.Helper()
+		data, err := json.Marshal(contract)
+		if err != nil {
+			t.Fatalf("Failed to encode contract: %v", err)
+		}
+		path := filepath.Join(dir, contract.ID+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("Failed to write contract: %v", err)
+		}
+		return path
+	}
+	first := writeContract(t, newTestContract("TEST-001", "pending"))
+
+	t.Run("LoadError", func(t *testing.T) {
+		store := NewMemoryStore()
+		err := storeContractFiles(store, []string{first, filepath.Join(dir, "missing.json")})
+		if err == nil || !isLoadError(err) {
+			t.Errorf("Expected a load error, got %v", err)
+		}
+		if _, err := store.GetContract("TEST-001"); err != nil {
+			t.Errorf("Expected the contract before the error to be stored, got %v", err)
+		}
+	})
+
+	t.Run("StoreError", func(t *testing.T) {
+		store := NewAccessStore(NewMemoryStore(), &User{Name: "vic", Role: roleViewer})
+		err := storeContractFiles(store, []string{first})
+		if err == nil || isLoadError(err) {
+			t.Errorf("Expected a store error that is no load error, got %v", err)
+		}
+	})
+}
+
+func TestDeleteStoredContracts(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.StoreContract(newTestContract("TEST-001", "pending")); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+
+	err := deleteStoredContracts(store, []string{"TEST-001", "TEST-002"})
+	if err == nil || isLoadError(err) {
+		t.Errorf("Expected an error for the missing contract, got %v", err)
+	}
+	if _, err := store.GetContract("TEST-001"); err == nil {
+		t.Errorf("Expected the contract before the error to be deleted")
+	}
+}
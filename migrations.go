@@ -0,0 +1,410 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect identifies the SQL flavour spoken by the database behind a DB
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// String returns the name of the dialect
+func (d dialect) String() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// rebind converts the ? placeholders used in queries to the placeholder style of the
+// dialect. A ? in a string literal or a quoted identifier is left as it is.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// A doubled quote inside a quoted section ends it and starts it again
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// migration is a versioned schema change with one statement per dialect, or a
+// data change without statements
+type migration struct {
+	version     int
+	description string
+	sqlite      string
+	postgres    string
+	// then, if set, runs in the same transaction after the statement, for data
+	// changes that need Go code
+	then func(tx *sql.Tx, d dialect) error
+}
+
+// statement returns the migration SQL for the given dialect
+func (m migration) statement(d dialect) string {
+	if d == dialectPostgres {
+		return m.postgres
+	}
+	return m.sqlite
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Never edit a released migration; append a new one instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create contracts table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS contracts (
+		id TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL,
+		parties_json TEXT NOT NULL,
+		terms_json TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS contracts (
+		id TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL,
+		parties_json JSONB NOT NULL,
+		terms_json JSONB NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);`,
+	},
+	{
+		version:     2,
+		description: "add contract lineage and amendments",
+		sqlite: `
+	ALTER TABLE contracts ADD COLUMN predecessor_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contracts ADD COLUMN amendments_json TEXT NOT NULL DEFAULT 'null';`,
+		postgres: `
+	ALTER TABLE contracts ADD COLUMN predecessor_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contracts ADD COLUMN amendments_json JSONB NOT NULL DEFAULT 'null';`,
+	},
+	{
+		version:     3,
+		description: "create contract revisions table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS contract_revisions (
+		contract_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		contract_json TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (contract_id, version)
+	);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS contract_revisions (
+		contract_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		contract_json JSONB NOT NULL,
+		content_hash TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (contract_id, version)
+	);`,
+	},
+	{
+		version:     4,
+		description: "create webhooks and webhook deliveries tables",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		contract_id TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_status ON webhook_deliveries (status);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id BIGINT NOT NULL,
+		event_type TEXT NOT NULL,
+		contract_id TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMPTZ NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_status ON webhook_deliveries (status);`,
+	},
+	{
+		version:     5,
+		description: "add contract signatures",
+		sqlite: `
+	ALTER TABLE contracts ADD COLUMN signatures_json TEXT NOT NULL DEFAULT 'null';`,
+		postgres: `
+	ALTER TABLE contracts ADD COLUMN signatures_json JSONB NOT NULL DEFAULT 'null';`,
+	},
+	{
+		version:     6,
+		description: "link contract revisions in a hash chain",
+		sqlite: `
+	ALTER TABLE contract_revisions ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE contract_revisions ADD COLUMN contract_prev_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contract_revisions ADD COLUMN chain_prev_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contract_revisions ADD COLUMN record_hash TEXT NOT NULL DEFAULT '';`,
+		postgres: `
+	ALTER TABLE contract_revisions ADD COLUMN seq BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE contract_revisions ADD COLUMN contract_prev_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contract_revisions ADD COLUMN chain_prev_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE contract_revisions ADD COLUMN record_hash TEXT NOT NULL DEFAULT '';`,
+		then: linkExistingRevisions,
+	},
+	{
+		version:     7,
+		description: "create encryption keys table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS encryption_keys (
+		key_id TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL
+	);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS encryption_keys (
+		key_id TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL
+	);`,
+	},
+	{
+		version:     8,
+		description: "create users table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS users (
+		name TEXT PRIMARY KEY,
+		role TEXT NOT NULL,
+		token_hash TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS users (
+		name TEXT PRIMARY KEY,
+		role TEXT NOT NULL,
+		token_hash TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL
+	);`,
+	},
+	{
+		version:     9,
+		description: "partition contracts, webhooks and users by tenant",
+		// SQLite cannot change a primary key, so the contract tables are rebuilt
+		sqlite: `
+	CREATE TABLE contracts_partitioned (
+		tenant TEXT NOT NULL DEFAULT 'default',
+		id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL,
+		parties_json TEXT NOT NULL,
+		terms_json TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		predecessor_id TEXT NOT NULL DEFAULT '',
+		amendments_json TEXT NOT NULL DEFAULT 'null',
+		signatures_json TEXT NOT NULL DEFAULT 'null',
+		PRIMARY KEY (tenant, id)
+	);
+	INSERT INTO contracts_partitioned (id, title, status, parties_json, terms_json, created_at, predecessor_id, amendments_json, signatures_json)
+	SELECT id, title, status, parties_json, terms_json, created_at, predecessor_id, amendments_json, signatures_json FROM contracts;
+	DROP TABLE contracts;
+	ALTER TABLE contracts_partitioned RENAME TO contracts;
+	CREATE TABLE contract_revisions_partitioned (
+		tenant TEXT NOT NULL DEFAULT 'default',
+		contract_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		contract_json TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		seq INTEGER NOT NULL DEFAULT 0,
+		contract_prev_hash TEXT NOT NULL DEFAULT '',
+		chain_prev_hash TEXT NOT NULL DEFAULT '',
+		record_hash TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (tenant, contract_id, version)
+	);
+	INSERT INTO contract_revisions_partitioned (contract_id, version, contract_json, content_hash, created_at, seq, contract_prev_hash, chain_prev_hash, record_hash)
+	SELECT contract_id, version, contract_json, content_hash, created_at, seq, contract_prev_hash, chain_prev_hash, record_hash FROM contract_revisions;
+	DROP TABLE contract_revisions;
+	ALTER TABLE contract_revisions_partitioned RENAME TO contract_revisions;
+	CREATE UNIQUE INDEX IF NOT EXISTS contract_revisions_seq ON contract_revisions (seq);
+	ALTER TABLE webhooks ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE webhook_deliveries ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE users ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';`,
+		postgres: `
+	ALTER TABLE contracts ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE contracts DROP CONSTRAINT contracts_pkey;
+	ALTER TABLE contracts ADD PRIMARY KEY (tenant, id);
+	ALTER TABLE contract_revisions ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE contract_revisions DROP CONSTRAINT contract_revisions_pkey;
+	ALTER TABLE contract_revisions ADD PRIMARY KEY (tenant, contract_id, version);
+	ALTER TABLE webhooks ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE webhook_deliveries ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE users ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';`,
+	},
+	{
+		version:     10,
+		description: "create approval requests table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS approval_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant TEXT NOT NULL DEFAULT 'default',
+		contract_id TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		step TEXT NOT NULL,
+		approvers TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		requested_by TEXT NOT NULL DEFAULT '',
+		decided_by TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		decided_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS approval_requests_contract ON approval_requests (tenant, contract_id);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS approval_requests (
+		id BIGSERIAL PRIMARY KEY,
+		tenant TEXT NOT NULL DEFAULT 'default',
+		contract_id TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		step TEXT NOT NULL,
+		approvers TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		requested_by TEXT NOT NULL DEFAULT '',
+		decided_by TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL,
+		decided_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS approval_requests_contract ON approval_requests (tenant, contract_id);`,
+	},
+	{
+		version:     11,
+		description: "create approval configs table",
+		sqlite: `
+	CREATE TABLE IF NOT EXISTS approval_configs (
+		tenant TEXT PRIMARY KEY,
+		config_json TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`,
+		postgres: `
+	CREATE TABLE IF NOT EXISTS approval_configs (
+		tenant TEXT PRIMARY KEY,
+		config_json JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);`,
+	},
+	{
+		version:     12,
+		description: "record earlier contract deletions in the hash chain",
+		then:        recordEarlierDeletions,
+	},
+}
+
+// migrate applies every migration that has not been recorded in schema_migrations yet
+func (db *DB) migrate() error {
+	createTable := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(createTable); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query(`SELECT version FROM schema_migrations;`)
+	if err != nil {
+		return fmt.Errorf("error reading applied migrations: %v", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning migration version: %v", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading applied migrations: %v", err)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting migration %d: %v", m.version, err)
+		}
+		if statement := m.statement(db.dialect); statement == "" {
+			// The migration only changes data
+		} else if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d (%s): %v", m.version, m.description, err)
+		}
+		if m.then != nil {
+			if err := m.then(tx, db.dialect); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error applying migration %d (%s): %v", m.version, m.description, err)
+			}
+		}
+		record := db.dialect.rebind(`INSERT INTO schema_migrations (version, description) VALUES (?, ?);`)
+		if _, err := tx.Exec(record, m.version, m.description); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording migration %d: %v", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %v", m.version, err)
+		}
+	}
+
+	return nil
+}
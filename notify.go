@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// emailTemplates holds the built-in email templates, one per event type
+//
+//go:embed templates/email/*.tmpl
+var emailTemplates embed.FS
+
+// smtpPasswordEnv names the environment variable holding the SMTP password, which
+// takes precedence over the password in the notification config
+const smtpPasswordEnv = "GOPLAYGROUND_SMTP_PASSWORD"
+
+// SMTP connection security
+const (
+	smtpSTARTTLS = "starttls"
+	smtpTLS      = "tls"
+	smtpNone     = "none"
+)
+
+// smtpTimeout limits how long connecting to the SMTP server may take
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig describes the SMTP server notifications are sent through
+type SMTPConfig struct {
+	Host string `json:"host"`
+	// Port defaults to 587 for starttls, 465 for tls and 25 for none
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// From is the sender, e.g. "Contracts <contracts@example.com>"
+	From string `json:"from"`
+	// Security is starttls (the default), tls or none. With starttls, sending
+	// fails if the server does not offer STARTTLS.
+	Security string `json:"security,omitempty"`
+
+	// tlsConfig replaces the default TLS configuration, so tests can trust their own certificate
+	tlsConfig *tls.Config
+}
+
+// NotifyRule sends the emails for an event type to the parties with the given roles
+type NotifyRule struct {
+	Event string `json:"event"`
+	// Roles are compared case-insensitively; * selects every party
+	Roles []string `json:"roles"`
+}
+
+// NotifyConfig configures email notifications to contract parties
+type NotifyConfig struct {
+	SMTP SMTPConfig `json:"smtp"`
+	// DryRunDir, when set, receives every message as an .eml file instead of sending it
+	DryRunDir string `json:"dryRunDir,omitempty"`
+	// Templates is a directory of templates named <event type>.tmpl that replace
+	// the built-in ones and add templates for other events
+	Templates string       `json:"templates,omitempty"`
+	Rules     []NotifyRule `json:"rules"`
+}
+
+// LoadNotifyConfig reads and validates a notification config file
+func LoadNotifyConfig(path string) (*NotifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading notification config: %v", err)
+	}
+
+	var config NotifyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing notification config %s: %v", path, err)
+	}
+	if password := os.Getenv(smtpPasswordEnv); password != "" {
+		config.SMTP.Password = password
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid notification config %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// Validate checks the config for missing settings and unknown events
+func (c *NotifyConfig) Validate() error {
+	if c.SMTP.From == "" {
+		return fmt.Errorf("smtp.from is required")
+	}
+	if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+		return fmt.Errorf("invalid smtp.from address: %v", err)
+	}
+	if c.DryRunDir == "" && c.SMTP.Host == "" {
+		return fmt.Errorf("smtp.host is required unless dryRunDir is set")
+	}
+	switch c.SMTP.Security {
+	case "", smtpSTARTTLS, smtpTLS, smtpNone:
+	default:
+		return fmt.Errorf("unknown smtp.security %q (use %s, %s or %s)", c.SMTP.Security, smtpSTARTTLS, smtpTLS, smtpNone)
+	}
+
+	for i, rule := range c.Rules {
+		if !isEventType(rule.Event) {
+			return fmt.Errorf("rule %d: unknown event %q (use %s)", i+1, rule.Event, strings.Join(EventTypes, ", "))
+		}
+		if len(rule.Roles) == 0 {
+			return fmt.Errorf("rule %d: at least one role is required", i+1)
+		}
+	}
+	return nil
+}
+
+// EmailData is the value email templates are executed with
+type EmailData struct {
+	Event Event
+	// Contract is the contract the event is about; for deletions it is the deleted contract
+	Contract *Contract
+	// Previous is the contract before an update
+	Previous *Contract
+	// Deadline is the deadline of an expiring event
+	Deadline *Deadline
+	// Recipient is the party the email is sent to
+	Recipient Party
+}
+
+// EmailMessage is a plain-text email to a single recipient
+type EmailMessage struct {
+	From      mail.Address
+	To        mail.Address
+	Subject   string
+	Body      string
+	Date      time.Time
+	MessageID string
+}
+
+// Bytes encodes the message in RFC 5322 format with a quoted-printable UTF-8 body
+func (m *EmailMessage) Bytes() []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", m.From.String())
+	header("To", m.To.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", m.Date.Format(time.RFC1123Z))
+	header("Message-ID", m.MessageID)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(m.Body))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// Notification is the result record of an email sent or written for an event
+type Notification struct {
+	ContractID string `json:"contractId" table:"contract"`
+	Event      string `json:"event"`
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	// Path is the .eml file the message was written to in a dry run
+	Path string `json:"path,omitempty"`
+}
+
+// Notifier emails contract parties about events according to the rules of its config
+type Notifier struct {
+	config    NotifyConfig
+	from      mail.Address
+	templates map[string]*template.Template
+	now       func() time.Time
+}
+
+// NewNotifier creates a notifier, loading the templates of every event the rules use
+func NewNotifier(config NotifyConfig) (*Notifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	from, _ := mail.ParseAddress(config.SMTP.From)
+
+	n := &Notifier{config: config, from: *from, templates: make(map[string]*template.Template), now: time.Now}
+	for _, rule := range config.Rules {
+		if _, ok := n.templates[rule.Event]; ok {
+			continue
+		}
+		tmpl, err := loadEmailTemplate(rule.Event, config.Templates)
+		if err != nil {
+			return nil, err
+		}
+		n.templates[rule.Event] = tmpl
+	}
+	return n, nil
+}
+
+// loadEmailTemplate loads the template for an event from dir, if it has one, or the built-in template
+func loadEmailTemplate(event, dir string) (*template.Template, error) {
+	name := event + ".tmpl"
+	data, err := fs.ReadFile(emailTemplates, "templates/email/"+name)
+	if dir != "" {
+		custom, customErr := os.ReadFile(filepath.Join(dir, name))
+		if customErr == nil {
+			data, err = custom, nil
+		} else if !errors.Is(customErr, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error reading email template: %v", customErr)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no email template for %s: add %s to the templates directory", event, name)
+	}
+
+	funcs := templateFuncs(nil)
+	funcs["neg"] = func(n int) int { return -n }
+	tmpl, err := template.New(name).Funcs(funcs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing email template %s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// HandleEvent sends the notifications for an event; it is an EventHandler
+func (n *Notifier) HandleEvent(event Event) error {
+	_, err := n.Notify(event)
+	return err
+}
+
+// Notify emails every party the rules select for the event, or writes the
+// messages to the dry-run directory, and returns what was sent
+func (n *Notifier) Notify(event Event) ([]Notification, error) {
+	contract := event.Contract
+	if contract == nil {
+		contract = event.Previous
+	}
+	if contract == nil {
+		return nil, nil
+	}
+
+	var notifications []Notification
+	for _, recipient := range n.recipients(event.Type, contract) {
+		message, err := n.compose(event, contract, recipient)
+		if err != nil {
+			return notifications, err
+		}
+		path, err := n.deliver(message, contract.ID, event.Type)
+		if err != nil {
+			return notifications, fmt.Errorf("error sending email to %s: %v", recipient.Email, err)
+		}
+		notifications = append(notifications, Notification{
+			ContractID: contract.ID,
+			Event:      event.Type,
+			To:         recipient.Email,
+			Subject:    message.Subject,
+			Path:       path,
+		})
+	}
+	return notifications, nil
+}
+
+// recipients returns the parties with an email address whose role a rule for the
+// event selects, each address once
+func (n *Notifier) recipients(eventType string, contract *Contract) []Party {
+	var parties []Party
+	seen := make(map[string]bool)
+	for _, rule := range n.config.Rules {
+		if rule.Event != eventType {
+			continue
+		}
+		for _, party := range contract.Parties {
+			address := strings.ToLower(party.Email)
+			if address == "" || seen[address] || !matchesRole(rule.Roles, party.Role) {
+				continue
+			}
+			seen[address] = true
+			parties = append(parties, party)
+		}
+	}
+	return parties
+}
+
+// matchesRole reports whether a role is one of the roles, or the roles include *
+func matchesRole(roles []string, role string) bool {
+	for _, candidate := range roles {
+		if candidate == "*" || strings.EqualFold(candidate, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// compose renders the template of the event for a recipient. The first line of
+// the output is the Subject header, followed by a blank line and the body.
+func (n *Notifier) compose(event Event, contract *Contract, recipient Party) (*EmailMessage, error) {
+	tmpl, ok := n.templates[event.Type]
+	if !ok {
+		return nil, fmt.Errorf("no email template for %s", event.Type)
+	}
+
+	data := EmailData{Event: event, Contract: contract, Previous: event.Previous, Deadline: event.Deadline, Recipient: recipient}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering email template %s: %v", tmpl.Name(), err)
+	}
+
+	head, body, _ := strings.Cut(buf.String(), "\n")
+	subject, ok := strings.CutPrefix(head, "Subject:")
+	if !ok {
+		return nil, fmt.Errorf("email template %s must start with a Subject: line", tmpl.Name())
+	}
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	_, domain, _ := strings.Cut(n.from.Address, "@")
+	return &EmailMessage{
+		From:      n.from,
+		To:        mail.Address{Name: recipient.Name, Address: recipient.Email},
+		Subject:   strings.TrimSpace(subject),
+		Body:      strings.TrimLeft(body, "\n"),
+		Date:      n.now(),
+		MessageID: "<" + hex.EncodeToString(id) + "@" + domain + ">",
+	}, nil
+}
+
+// deliver sends a message, or writes it to the dry-run directory and returns the file's path
+func (n *Notifier) deliver(message *EmailMessage, contractID, eventType string) (string, error) {
+	if n.config.DryRunDir == "" {
+		return "", n.config.SMTP.Send(message)
+	}
+
+	if err := os.MkdirAll(n.config.DryRunDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating dry-run directory: %v", err)
+	}
+	base := fmt.Sprintf("%s-%s-%s-%s", message.Date.UTC().Format("20060102T150405Z"), slugify(contractID),
+		strings.ReplaceAll(eventType, ".", "-"), slugify(message.To.Address))
+	for i := 1; ; i++ {
+		name := base + ".eml"
+		if i > 1 {
+			name = base + "-" + strconv.Itoa(i) + ".eml"
+		}
+		path := filepath.Join(n.config.DryRunDir, name)
+		err := writeFileExclusive(path, message.Bytes())
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return path, err
+	}
+}
+
+// port returns the configured port or the default port of the connection security
+func (c SMTPConfig) port() int {
+	switch {
+	case c.Port != 0:
+		return c.Port
+	case c.Security == smtpTLS:
+		return 465
+	case c.Security == smtpNone:
+		return 25
+	default:
+		return 587
+	}
+}
+
+// Send delivers a message through the SMTP server, authenticating when a username is set
+func (c SMTPConfig) Send(message *EmailMessage) error {
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.port()))
+	tlsConfig := c.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: c.Host}
+	}
+
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if c.Security == smtpTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	defer client.Close()
+
+	if c.Security == "" || c.Security == smtpSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS", c.Host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("error starting TLS: %v", err)
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %v", err)
+		}
+	}
+
+	if err := client.Mail(message.From.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.To.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// loadNotifier loads the notification config selected with -notify
+func loadNotifier(path string) (*Notifier, error) {
+	config, err := LoadNotifyConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewNotifier(*config)
+}
+
+// parseDayList parses a comma-separated list of day counts such as 30,7,1
+func parseDayList(value string) ([]int, error) {
+	var days []int
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		n, err := parseDays(field)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, n)
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("at least one day count is required")
+	}
+	return days, nil
+}
+
+// runNotify implements the notify command
+func runNotify(args []string) error {
+	fs := newFlagSet("notify")
+	daysFlag := fs.String("days", "30,7,1", "Remind parties this many days before a deadline, as a comma-separated list")
+	asOf := fs.String("as-of", "", "Check deadlines as of this date (YYYY-MM-DD) instead of today")
+	dryRun := fs.String("dry-run", "", "Write the messages as .eml files to this directory instead of sending them")
+	filter := filterFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("notify takes no arguments, use the filter flags to select contracts")
+	}
+	if *notifyConfigPath == "" {
+		return fmt.Errorf("notify requires a notification config, see -notify")
+	}
+
+	days, err := parseDayList(*daysFlag)
+	if err != nil {
+		return err
+	}
+	today := time.Now()
+	if *asOf != "" {
+		today, err = time.Parse(dateLayout, *asOf)
+		if err != nil {
+			return fmt.Errorf("invalid -as-of date %s: expected YYYY-MM-DD", *asOf)
+		}
+	}
+
+	config, err := LoadNotifyConfig(*notifyConfigPath)
+	if err != nil {
+		return err
+	}
+	if *dryRun != "" {
+		config.DryRunDir = *dryRun
+	}
+	notifier, err := NewNotifier(*config)
+	if err != nil {
+		return err
+	}
+
+	// notify only reads contracts, so the store is opened without the -notify wrapper
+	store, err := openBareStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	contracts, err := FindContracts(store, filter())
+	if err != nil {
+		return err
+	}
+	notifications, err := notifyDeadlines(notifier, contracts, today, days)
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	if printErr := printResults(notifications, func() {
+		for _, sent := range notifications {
+			if sent.Path != "" {
+				fmt.Printf("Wrote reminder for contract %s to %s: %s\n", sent.ContractID, sent.To, sent.Path)
+			} else {
+				fmt.Printf("Sent reminder for contract %s to %s\n", sent.ContractID, sent.To)
+			}
+		}
+		if len(notifications) == 0 {
+			fmt.Println("No reminders are due")
+		}
+	}); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// notifyDeadlines sends an expiring event for every deadline exactly one of the given
+// numbers of days ahead and for every overdue deadline, so that a daily run reminds
+// parties a few times before a deadline and every day after it has passed
+func notifyDeadlines(notifier *Notifier, contracts []*Contract, today time.Time, days []int) ([]Notification, error) {
+	remind := make(map[int]bool)
+	within := 0
+	for _, n := range days {
+		remind[n] = true
+		within = max(within, n)
+	}
+
+	var notifications []Notification
+	for _, contract := range contracts {
+		for _, deadline := range ContractDeadlines(contract, today, within) {
+			if !deadline.Overdue && !remind[deadline.DaysLeft] {
+				continue
+			}
+			deadline := deadline
+			sent, err := notifier.Notify(Event{
+				Type:       EventContractExpiring,
+				ContractID: contract.ID,
+				Time:       notifier.now().UTC(),
+				Contract:   contract,
+				Deadline:   &deadline,
+			})
+			notifications = append(notifications, sent...)
+			if err != nil {
+				return notifications, err
+			}
+		}
+	}
+	return notifications, nil
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPMessage is a message received by fakeSMTPServer
+type fakeSMTPMessage struct {
+	From string
+	To   []string
+	Data string
+	// TLS reports whether the message was sent over an encrypted connection
+	TLS bool
+	// User is the authenticated user, if any
+	User string
+}
+
+// fakeSMTPServer is a minimal SMTP server on the loopback interface that accepts
+// STARTTLS, implicit TLS and AUTH PLAIN, and records the messages it receives
+type fakeSMTPServer struct {
+	Host, Port string
+	// Client is the TLS configuration that trusts the server's certificate
+	Client *tls.Config
+
+	listener    net.Listener
+	server      *tls.Config
+	implicitTLS bool
+	offerTLS    bool
+	username    string
+	password    string
+
+	mu       sync.Mutex
+	messages []fakeSMTPMessage
+}
+
+// startFakeSMTPServer starts a server with the given connection security, which
+// requires authentication when a username is given
+func startFakeSMTPServer(t *testing.T, security, username, password string) *fakeSMTPServer {
+	t.Helper()
+	server, client := newTestTLSConfigs(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if security == smtpTLS {
+		listener = tls.NewListener(listener, server)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	s := &fakeSMTPServer{
+		Host:        host,
+		Port:        port,
+		Client:      client,
+		listener:    listener,
+		server:      server,
+		implicitTLS: security == smtpTLS,
+		offerTLS:    security == smtpSTARTTLS,
+		username:    username,
+		password:    password,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Config returns an SMTP config for the server
+func (s *fakeSMTPServer) Config(security string) SMTPConfig {
+	port, _ := strconv.Atoi(s.Port)
+	return SMTPConfig{
+		Host:      s.Host,
+		Port:      port,
+		From:      "Contracts <contracts@example.com>",
+		Security:  security,
+		tlsConfig: s.Client,
+	}
+}
+
+// Messages returns the messages received so far
+func (s *fakeSMTPServer) Messages() []fakeSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	secure := s.implicitTLS
+	var message fakeSMTPMessage
+	var user string
+
+	text.PrintfLine("220 fake.example.com ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			extensions := []string{"fake.example.com"}
+			if s.offerTLS && !secure {
+				extensions = append(extensions, "STARTTLS")
+			}
+			if s.username != "" {
+				extensions = append(extensions, "AUTH PLAIN")
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.server)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, secure = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			mechanism, response, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(response)
+			if mechanism != "PLAIN" || string(decoded) != "\x00"+s.username+"\x00"+s.password {
+				text.PrintfLine("535 Authentication credentials invalid")
+				continue
+			}
+			user = s.username
+			text.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			if s.username != "" && user == "" {
+				text.PrintfLine("530 Authentication required")
+				continue
+			}
+			message = fakeSMTPMessage{From: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), TLS: secure, User: user}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			message.To = append(message.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// newTestTLSConfigs creates a server configuration with a self-signed certificate
+// for 127.0.0.1 and a client configuration that trusts it
+func newTestTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+// readEmail parses a message and returns its headers and decoded body
+func readEmail(t *testing.T, data string) (mail.Header, string) {
+	t.Helper()
+	message, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v\n%s", err, data)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	if err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	return message.Header, string(body)
+}
+
+func TestNotifierSMTP(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = []Party{
+		{Name: "Test Client", Role: "Client", Email: "client@example.com"},
+		{Name: "Jürgen Müller", Role: "Provider", Email: "provider@example.com"},
+		{Name: "Witness", Role: "Witness"},
+	}
+	event := Event{Type: EventContractCreated, ContractID: "TEST-001", Contract: contract}
+	rules := []NotifyRule{{Event: EventContractCreated, Roles: []string{"client"}}}
+
+	t.Run("STARTTLS", func(t *testing.T) {
+		server := startFakeSMTPServer(t, smtpSTARTTLS, "mailer", "secret")
+		config := NotifyConfig{SMTP: server.Config(""), Rules: rules}
+		config.SMTP.Username, config.SMTP.Password = "mailer", "secret"
+		notifier, err := NewNotifier(config)
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+
+		sent, err := notifier.Notify(event)
+		if err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if len(sent) != 1 || sent[0].To != "client@example.com" || sent[0].Path != "" {
+			t.Errorf("Unexpected notifications %+v", sent)
+		}
+
+		messages := server.Messages()
+		if len(messages) != 1 {
+			t.Fatalf("Expected 1 message, got %d", len(messages))
+		}
+		got := messages[0]
+		if !got.TLS || got.User != "mailer" || got.From != "contracts@example.com" || strings.Join(got.To, ",") != "client@example.com" {
+			t.Errorf("Unexpected envelope %+v", got)
+		}
+		header, body := readEmail(t, got.Data)
+		if subject := header.Get("Subject"); subject != "New contract TEST-001: Test Contract" {
+			t.Errorf("Unexpected subject %q", subject)
+		}
+		if !strings.Contains(body, "Dear Test Client,") || !strings.Contains(body, "- Jürgen Müller (Provider)") {
+			t.Errorf("Unexpected body:\n%s", body)
+		}
+	})
+
+	t.Run("ImplicitTLS", func(t *testing.T) {
+		server := startFakeSMTPServer(t, smtpTLS, "", "")
+		notifier, err := NewNotifier(NotifyConfig{SMTP: server.Config(smtpTLS), Rules: rules})
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+		if _, err := notifier.Notify(event); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if messages := server.Messages(); len(messages) != 1 || !messages[0].TLS {
+			t.Errorf("Expected 1 encrypted message, got %+v", messages)
+		}
+	})
+
+	t.Run("Unencrypted", func(t *testing.T) {
+		server := startFakeSMTPServer(t, smtpNone, "", "")
+		notifier, err := NewNotifier(NotifyConfig{SMTP: server.Config(smtpNone), Rules: rules})
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+		if _, err := notifier.Notify(event); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if messages := server.Messages(); len(messages) != 1 || messages[0].TLS {
+			t.Errorf("Expected 1 unencrypted message, got %+v", messages)
+		}
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		server := startFakeSMTPServer(t, smtpSTARTTLS, "mailer", "secret")
+		config := NotifyConfig{SMTP: server.Config(smtpSTARTTLS), Rules: rules}
+		config.SMTP.Username, config.SMTP.Password = "mailer", "wrong"
+		notifier, err := NewNotifier(config)
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+		if _, err := notifier.Notify(event); err == nil || !strings.Contains(err.Error(), "error authenticating") {
+			t.Errorf("Expected an authentication error, got %v", err)
+		}
+		if messages := server.Messages(); len(messages) != 0 {
+			t.Errorf("Expected no messages, got %d", len(messages))
+		}
+	})
+
+	t.Run("STARTTLSRequired", func(t *testing.T) {
+		server := startFakeSMTPServer(t, smtpNone, "", "")
+		notifier, err := NewNotifier(NotifyConfig{SMTP: server.Config(smtpSTARTTLS), Rules: rules})
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+		if _, err := notifier.Notify(event); err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+			t.Errorf("Expected a STARTTLS error, got %v", err)
+		}
+	})
+}
+
+func TestNotifierDryRun(t *testing.T) {
+	dir := t.TempDir()
+	config := NotifyConfig{
+		SMTP:      SMTPConfig{From: "Contracts <contracts@example.com>"},
+		DryRunDir: dir,
+		Rules: []NotifyRule{
+			{Event: EventStatusChanged, Roles: []string{"*"}},
+		},
+	}
+	notifier, err := NewNotifier(config)
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	notifier.now = func() time.Time { return calendarStamp }
+
+	previous := newTestContract("TEST-001", "active")
+	previous.Parties = []Party{
+		{Name: "Test Client", Role: "Client", Email: "client@example.com"},
+		{Name: "Jürgen Müller", Role: "Provider", Email: "provider@example.com"},
+		{Name: "Witness", Role: "Witness"},
+	}
+	contract, err := copyContract(previous)
+	if err != nil {
+		t.Fatalf("Failed to copy contract: %v", err)
+	}
+	contract.Title = "Vertrag für Müller"
+	contract.Status = "terminated"
+	event := Event{Type: EventStatusChanged, ContractID: "TEST-001", Contract: contract, Previous: previous}
+
+	sent, err := notifier.Notify(event)
+	if err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("Expected messages to the 2 parties with an email address, got %+v", sent)
+	}
+	expectedPath := filepath.Join(dir, "20240501T120000Z-test-001-contract-status_changed-client-example-com.eml")
+	if sent[0].Path != expectedPath {
+		t.Errorf("Expected %s, got %s", expectedPath, sent[0].Path)
+	}
+
+	data, err := os.ReadFile(sent[1].Path)
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if strings.Contains(strings.ReplaceAll(string(data), "\r\n", ""), "\n") {
+		t.Errorf("Expected CRLF line endings")
+	}
+	header, body := readEmail(t, string(data))
+	to, err := header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Name != "Jürgen Müller" || to[0].Address != "provider@example.com" {
+		t.Errorf("Unexpected To header %q", header.Get("To"))
+	}
+	if header.Get("Date") != "Wed, 01 May 2024 12:00:00 +0000" || !strings.HasSuffix(header.Get("Message-Id"), "@example.com>") {
+		t.Errorf("Unexpected headers %v", header)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "Contract TEST-001 is now terminated" {
+		t.Errorf("Unexpected subject %q (%v)", subject, err)
+	}
+	if !strings.Contains(body, `"Vertrag für Müller" has changed from active to terminated.`) {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+
+	t.Run("FileNameCollision", func(t *testing.T) {
+		sent, err := notifier.Notify(event)
+		if err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if !strings.HasSuffix(sent[0].Path, "client-example-com-2.eml") {
+			t.Errorf("Expected a numbered file name, got %s", sent[0].Path)
+		}
+	})
+}
+
+func TestNotifierRecipients(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = []Party{
+		{Name: "Test Client", Role: "Client", Email: "client@example.com"},
+		{Name: "Jürgen Müller", Role: "Provider", Email: "provider@example.com"},
+		{Name: "Witness", Role: "Witness"},
+		{Name: "Client Again", Role: "Billing", Email: "CLIENT@example.com"},
+	}
+
+	tests := []struct {
+		name     string
+		rules    []NotifyRule
+		expected string
+	}{
+		{"Everyone", []NotifyRule{{Event: EventContractCreated, Roles: []string{"*"}}}, "client@example.com,provider@example.com"},
+		{"RoleIgnoresCase", []NotifyRule{{Event: EventContractCreated, Roles: []string{"PROVIDER"}}}, "provider@example.com"},
+		{"SkipsPartiesWithoutEmail", []NotifyRule{{Event: EventContractCreated, Roles: []string{"Witness"}}}, ""},
+		{"DeduplicatesAddresses", []NotifyRule{
+			{Event: EventContractCreated, Roles: []string{"Billing"}},
+			{Event: EventContractCreated, Roles: []string{"Client"}},
+		}, "CLIENT@example.com"},
+		{"OtherEvent", []NotifyRule{{Event: EventStatusChanged, Roles: []string{"*"}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, err := NewNotifier(NotifyConfig{SMTP: SMTPConfig{From: "contracts@example.com"}, DryRunDir: t.TempDir(), Rules: tt.rules})
+			if err != nil {
+				t.Fatalf("Failed to create notifier: %v", err)
+			}
+			var got []string
+			for _, party := range notifier.recipients(EventContractCreated, contract) {
+				got = append(got, party.Email)
+			}
+			if strings.Join(got, ",") != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, strings.Join(got, ","))
+			}
+		})
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	base := func() NotifyConfig {
+		return NotifyConfig{SMTP: SMTPConfig{Host: "mail.example.com", From: "contracts@example.com"}}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(c *NotifyConfig)
+		errText string
+	}{
+		{"Valid", func(c *NotifyConfig) {
+			c.Rules = []NotifyRule{{Event: EventContractExpiring, Roles: []string{"Client"}}}
+		}, ""},
+		{"MissingFrom", func(c *NotifyConfig) { c.SMTP.From = "" }, "smtp.from is required"},
+		{"MissingHost", func(c *NotifyConfig) { c.SMTP.Host = "" }, "smtp.host is required"},
+		{"UnknownSecurity", func(c *NotifyConfig) { c.SMTP.Security = "ssl" }, "unknown smtp.security"},
+		{"UnknownEvent", func(c *NotifyConfig) {
+			c.Rules = []NotifyRule{{Event: "contract.signed", Roles: []string{"*"}}}
+		}, `rule 1: unknown event "contract.signed"`},
+		{"NoRoles", func(c *NotifyConfig) {
+			c.Rules = []NotifyRule{{Event: EventContractCreated}}
+		}, "rule 1: at least one role is required"},
+		{"NoTemplate", func(c *NotifyConfig) {
+			c.Rules = []NotifyRule{{Event: EventContractDeleted, Roles: []string{"*"}}}
+		}, "no email template for contract.deleted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base()
+			tt.change(&config)
+			_, err := NewNotifier(config)
+			if tt.errText == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+
+	t.Run("CustomTemplates", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "contract.deleted.tmpl"), []byte("Subject: Deleted {{.Contract.ID}}\n\nGone.\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "contract.created.tmpl"), []byte("No subject line\n"), 0644)
+
+		config := base()
+		config.Templates = dir
+		config.DryRunDir = t.TempDir()
+		config.Rules = []NotifyRule{{Event: EventContractDeleted, Roles: []string{"*"}}, {Event: EventContractCreated, Roles: []string{"*"}}}
+		notifier, err := NewNotifier(config)
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+
+		sent, err := notifier.Notify(Event{Type: EventContractDeleted, ContractID: "TEST-001", Previous: newTestContract("TEST-001", "active")})
+		if err != nil || len(sent) != 1 || sent[0].Subject != "Deleted TEST-001" {
+			t.Errorf("Unexpected notifications %+v (%v)", sent, err)
+		}
+		_, err = notifier.Notify(Event{Type: EventContractCreated, ContractID: "TEST-001", Contract: newTestContract("TEST-001", "active")})
+		if err == nil || !strings.Contains(err.Error(), "must start with a Subject: line") {
+			t.Errorf("Expected a missing subject error, got %v", err)
+		}
+	})
+}
+
+func TestLoadNotifyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.json")
+	config := `{"smtp": {"host": "mail.example.com", "from": "contracts@example.com", "username": "mailer", "password": "from-file"},
+		"rules": [{"event": "contract.created", "roles": ["*"]}]}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	loaded, err := LoadNotifyConfig(path)
+	if err != nil || loaded.SMTP.Password != "from-file" || loaded.SMTP.port() != 587 {
+		t.Errorf("Unexpected config %+v (%v)", loaded, err)
+	}
+
+	t.Setenv(smtpPasswordEnv, "from-env")
+	loaded, err = LoadNotifyConfig(path)
+	if err != nil || loaded.SMTP.Password != "from-env" {
+		t.Errorf("Expected the password from %s, got %+v (%v)", smtpPasswordEnv, loaded, err)
+	}
+}
+
+func TestNotifyDeadlines(t *testing.T) {
+	config := NotifyConfig{
+		SMTP:      SMTPConfig{From: "contracts@example.com"},
+		DryRunDir: t.TempDir(),
+		Rules:     []NotifyRule{{Event: EventContractExpiring, Roles: []string{"Client"}}},
+	}
+	notifier, err := NewNotifier(config)
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = []Party{
+		{Name: "Test Client", Role: "Client", Email: "client@example.com"},
+		{Name: "Jürgen Müller", Role: "Provider", Email: "provider@example.com"},
+		{Name: "Witness", Role: "Witness"},
+	}
+	contract.Terms.NoticePeriodDays = 60
+	contract.Terms.Payments = []Payment{{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"}}
+	contracts := []*Contract{contract}
+
+	t.Run("OnReminderDay", func(t *testing.T) {
+		sent, err := notifyDeadlines(notifier, contracts, mustParseDate(t, "2024-07-08"), []int{30, 7, 1})
+		if err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if len(sent) != 1 || sent[0].Subject != "Reminder: Payment of 600.00 USD: Second installment for contract TEST-001" {
+			t.Fatalf("Unexpected notifications %+v", sent)
+		}
+
+		data, _ := os.ReadFile(sent[0].Path)
+		_, body := readEmail(t, string(data))
+		if !strings.Contains(body, "is due on 2024-07-15, in 7 day(s).") {
+			t.Errorf("Unexpected body:\n%s", body)
+		}
+	})
+
+	t.Run("BetweenReminderDays", func(t *testing.T) {
+		sent, err := notifyDeadlines(notifier, contracts, mustParseDate(t, "2024-07-09"), []int{30, 7, 1})
+		if err != nil || len(sent) != 0 {
+			t.Errorf("Expected no notifications, got %+v (%v)", sent, err)
+		}
+	})
+
+	t.Run("Overdue", func(t *testing.T) {
+		sent, err := notifyDeadlines(notifier, contracts, mustParseDate(t, "2025-01-10"), []int{30, 7, 1})
+		if err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		if len(sent) != 1 || !strings.HasPrefix(sent[0].Subject, "Overdue: Payment of 600.00 USD") {
+			t.Fatalf("Unexpected notifications %+v", sent)
+		}
+
+		data, _ := os.ReadFile(sent[0].Path)
+		_, body := readEmail(t, string(data))
+		if !strings.Contains(body, "was due on 2024-07-15, 179 day(s) ago, and has not been received.") {
+			t.Errorf("Unexpected body:\n%s", body)
+		}
+	})
+
+	t.Run("Notice", func(t *testing.T) {
+		sent, err := notifyDeadlines(notifier, contracts, mustParseDate(t, "2025-01-23"), []int{7})
+		if err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+		var notice *Notification
+		for i := range sent {
+			if strings.Contains(sent[i].Subject, "Notice due") {
+				notice = &sent[i]
+			}
+		}
+		if notice == nil {
+			t.Fatalf("Expected a notice reminder, got %+v", sent)
+		}
+		data, _ := os.ReadFile(notice.Path)
+		_, body := readEmail(t, string(data))
+		if !strings.Contains(body, "is due by 2025-01-30, in 7 day(s).") {
+			t.Errorf("Unexpected body:\n%s", body)
+		}
+	})
+}
+
+func TestEmailMessageBytes(t *testing.T) {
+	message := &EmailMessage{
+		From:      mail.Address{Address: "contracts@example.com"},
+		To:        mail.Address{Name: "Test Client", Address: "client@example.com"},
+		Subject:   "Zahlung fällig",
+		Body:      "A line long enough to be wrapped by the quoted-printable encoding because it exceeds seventy-six characters.\n",
+		Date:      calendarStamp,
+		MessageID: "<id@example.com>",
+	}
+	data := message.Bytes()
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		if len(scanner.Text()) > 78 {
+			t.Errorf("Line longer than 78 characters: %q", scanner.Text())
+		}
+	}
+	header, body := readEmail(t, string(data))
+	if header.Get("Subject") != "=?utf-8?q?Zahlung_f=C3=A4llig?=" {
+		t.Errorf("Unexpected encoded subject %q", header.Get("Subject"))
+	}
+	if body != strings.ReplaceAll(message.Body, "\n", "\r\n") {
+		t.Errorf("Expected the body with CRLF line endings, got %q", body)
+	}
+}
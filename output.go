@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultOutputPattern names the files written to an output directory
+const defaultOutputPattern = "{id}.{ext}"
+
+// outputPlaceholderPattern matches placeholders such as {id} in output paths
+var outputPlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// formatExtensions maps render formats to the file extension used for {ext}
+var formatExtensions = map[string]string{
+	formatMarkdown: "md",
+	formatHTML:     "html",
+	formatPDF:      "pdf",
+}
+
+// ErrOutputExists is returned when writing would replace an existing file without -force
+var ErrOutputExists = errors.New("output file already exists")
+
+// OutputDestination describes where rendered contracts are written
+type OutputDestination struct {
+	// Path is one of
+	//   - "" or "-" for standard output
+	//   - a directory (existing, or ending in a path separator), which receives {id}.{ext}
+	//   - a path pattern with placeholders such as rendered/{id}-{status}.md
+	//   - a plain file path
+	// The placeholders are {id}, {status}, {title} and {ext}.
+	Path string
+	// Force replaces existing files
+	Force bool
+	// NoClobber skips contracts whose output file already exists
+	NoClobber bool
+	// Stdout receives the output when Path is standard output (default: os.Stdout)
+	Stdout io.Writer
+}
+
+// Validate checks the destination options before anything is written
+func (d OutputDestination) Validate() error {
+	if d.Force && d.NoClobber {
+		return fmt.Errorf("-force and -no-clobber cannot be used together")
+	}
+	for _, match := range outputPlaceholderPattern.FindAllStringSubmatch(d.pattern(), -1) {
+		switch match[1] {
+		case "id", "status", "title", "ext":
+		default:
+			return fmt.Errorf("unknown placeholder %s in output path (use {id}, {status}, {title} or {ext})", match[0])
+		}
+	}
+	return nil
+}
+
+// IsStdout reports whether output goes to standard output
+func (d OutputDestination) IsStdout() bool {
+	return d.Path == "" || d.Path == "-"
+}
+
+// PerContract reports whether the file name depends on the contract, so that
+// several contracts can be written to the destination
+func (d OutputDestination) PerContract() bool {
+	for _, match := range outputPlaceholderPattern.FindAllStringSubmatch(d.pattern(), -1) {
+		if match[1] != "ext" {
+			return true
+		}
+	}
+	return false
+}
+
+// pattern returns the output path with a file name pattern appended for directories
+func (d OutputDestination) pattern() string {
+	if d.IsStdout() {
+		return ""
+	}
+	if strings.HasSuffix(d.Path, "/") || strings.HasSuffix(d.Path, string(filepath.Separator)) {
+		return filepath.Join(d.Path, defaultOutputPattern)
+	}
+	if info, err := os.Stat(d.Path); err == nil && info.IsDir() {
+		return filepath.Join(d.Path, defaultOutputPattern)
+	}
+	return d.Path
+}
+
+// PathFor returns the file a contract rendered in the given format is written to
+func (d OutputDestination) PathFor(contract *Contract, format string) (string, error) {
+	if d.IsStdout() {
+		return "", fmt.Errorf("output goes to standard output, not to a file")
+	}
+
+	var expandErr error
+	path := outputPlaceholderPattern.ReplaceAllStringFunc(d.pattern(), func(placeholder string) string {
+		var value string
+		switch placeholder {
+		case "{id}":
+			// The ID is used as is, but must be usable as a file name
+			if _, err := contractFileName(contract.ID, ""); err != nil {
+				expandErr = err
+			}
+			value = contract.ID
+		case "{status}":
+			value = slugify(contract.Status)
+		case "{title}":
+			value = slugify(contract.Title)
+		case "{ext}":
+			value = formatExtensions[format]
+		default:
+			expandErr = fmt.Errorf("unknown placeholder %s in output path", placeholder)
+		}
+		if value == "" && expandErr == nil {
+			expandErr = fmt.Errorf("placeholder %s is empty for contract %s", placeholder, contract.ID)
+		}
+		return value
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return path, nil
+}
+
+// Write writes the rendered contract to the destination and returns the path it was
+// written to, or "" for standard output. Files are replaced atomically, so readers
+// never see a partly written file. Existing files are only replaced with Force; with
+// NoClobber they are left alone and skipped is true.
+func (d OutputDestination) Write(contract *Contract, format string, data []byte) (path string, skipped bool, err error) {
+	if d.IsStdout() {
+		out := d.Stdout
+		if out == nil {
+			out = os.Stdout
+		}
+		_, err := out.Write(data)
+		return "", false, err
+	}
+
+	path, err = d.PathFor(contract, format)
+	if err != nil {
+		return "", false, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", false, fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+
+	if d.Force {
+		err = writeFileAtomic(path, data)
+	} else {
+		err = writeFileExclusive(path, data)
+	}
+	switch {
+	case errors.Is(err, fs.ErrExist) && d.NoClobber:
+		return path, true, nil
+	case errors.Is(err, fs.ErrExist):
+		return "", false, fmt.Errorf("%w: %s (use -force to replace it or -no-clobber to skip it)", ErrOutputExists, path)
+	case err != nil:
+		return "", false, fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return path, false, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputDestinationPathFor(t *testing.T) {
+	dir := t.TempDir()
+	contract := &Contract{ID: "C-1", Title: "Supply Agreement", Status: "On Hold"}
+
+	tests := []struct {
+		name     string
+		path     string
+		format   string
+		expected string
+	}{
+		{"File", filepath.Join(dir, "out.md"), formatMarkdown, filepath.Join(dir, "out.md")},
+		{"ExistingDirectory", dir, formatHTML, filepath.Join(dir, "C-1.html")},
+		{"NewDirectory", filepath.Join(dir, "new") + "/", formatPDF, filepath.Join(dir, "new", "C-1.pdf")},
+		{"Pattern", filepath.Join(dir, "{id}-{status}.{ext}"), formatMarkdown, filepath.Join(dir, "C-1-on-hold.md")},
+		{"Title", filepath.Join(dir, "{title}", "{id}.md"), formatMarkdown, filepath.Join(dir, "supply-agreement", "C-1.md")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := OutputDestination{Path: tt.path}.PathFor(contract, tt.format)
+			if err != nil {
+				t.Fatalf("Failed to expand %s: %v", tt.path, err)
+			}
+			if path != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, path)
+			}
+		})
+	}
+
+	t.Run("UnsafeID", func(t *testing.T) {
+		unsafe := &Contract{ID: "../escape", Status: "active"}
+		if _, err := (OutputDestination{Path: filepath.Join(dir, "{id}.md")}).PathFor(unsafe, formatMarkdown); err == nil {
+			t.Error("Expected error for an ID that is not a valid file name")
+		}
+	})
+
+	t.Run("EmptyPlaceholder", func(t *testing.T) {
+		untitled := &Contract{ID: "C-2", Status: "active"}
+		if _, err := (OutputDestination{Path: filepath.Join(dir, "{title}.md")}).PathFor(untitled, formatMarkdown); err == nil {
+			t.Error("Expected error for a placeholder without a value")
+		}
+	})
+}
+
+func TestOutputDestinationValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		dest  OutputDestination
+		valid bool
+	}{
+		{"Stdout", OutputDestination{}, true},
+		{"Pattern", OutputDestination{Path: "out/{id}-{status}.{ext}"}, true},
+		{"UnknownPlaceholder", OutputDestination{Path: "out/{name}.md"}, false},
+		{"ForceAndNoClobber", OutputDestination{Path: "out.md", Force: true, NoClobber: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dest.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Expected destination to be valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected destination to be invalid")
+			}
+		})
+	}
+}
+
+func TestOutputDestinationPerContract(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		"":                              false,
+		"out.md":                        false,
+		"out.{ext}":                     false,
+		"out/{id}.md":                   true,
+		"out/{status}.md":               true,
+		dir:                             true,
+		filepath.Join(dir, "new") + "/": true,
+	}
+	for path, expected := range tests {
+		if got := (OutputDestination{Path: path}).PerContract(); got != expected {
+			t.Errorf("PerContract(%q): expected %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestOutputDestinationWrite(t *testing.T) {
+	contract := &Contract{ID: "C-1", Status: "active"}
+
+	t.Run("Stdout", func(t *testing.T) {
+		var sb strings.Builder
+		path, skipped, err := OutputDestination{Path: "-", Stdout: &sb}.Write(contract, formatMarkdown, []byte("hello"))
+		if err != nil || path != "" || skipped {
+			t.Fatalf("Unexpected result: %q, %v, %v", path, skipped, err)
+		}
+		if sb.String() != "hello" {
+			t.Errorf("Expected output on stdout, got %q", sb.String())
+		}
+	})
+
+	t.Run("CreatesDirectories", func(t *testing.T) {
+		pattern := filepath.Join(t.TempDir(), "a", "b", "{id}.{ext}")
+		path, _, err := OutputDestination{Path: pattern}.Write(contract, formatHTML, []byte("<p>"))
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != "<p>" {
+			t.Errorf("Expected written file, got %q, %v", data, err)
+		}
+	})
+
+	t.Run("ExistingFile", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.md")
+		if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		_, _, err := OutputDestination{Path: path}.Write(contract, formatMarkdown, []byte("new"))
+		if !errors.Is(err, ErrOutputExists) {
+			t.Errorf("Expected ErrOutputExists, got %v", err)
+		}
+		assertFileContent(t, path, "original")
+
+		_, skipped, err := OutputDestination{Path: path, NoClobber: true}.Write(contract, formatMarkdown, []byte("new"))
+		if err != nil || !skipped {
+			t.Errorf("Expected the file to be skipped, got %v, %v", skipped, err)
+		}
+		assertFileContent(t, path, "original")
+
+		_, skipped, err = OutputDestination{Path: path, Force: true}.Write(contract, formatMarkdown, []byte("new"))
+		if err != nil || skipped {
+			t.Errorf("Expected the file to be replaced, got %v, %v", skipped, err)
+		}
+		assertFileContent(t, path, "new")
+
+		// No temporary files are left behind
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("Expected only out.md in the directory, got %d entries", len(entries))
+		}
+	})
+}
+
+// assertFileContent fails the test unless the file at path contains expected
+func assertFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(data) != expected {
+		t.Errorf("Expected %s to contain %q, got %q", path, expected, data)
+	}
+}
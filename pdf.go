@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF page geometry in points (A4 portrait)
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 56.0
+	pdfFooterY    = 32.0
+)
+
+// pdfFont selects one of the two standard fonts every PDF viewer provides
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+)
+
+// resourceName returns the name the font is registered under in the page resources
+func (f pdfFont) resourceName() string {
+	if f == fontBold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Glyph widths of the printable ASCII characters (32 to 126) in thousandths of the
+// font size, taken from the Adobe font metrics of Helvetica and Helvetica-Bold
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// winAnsi converts text to the WinAnsiEncoding used by the standard fonts.
+// Latin-1 characters map to themselves, the euro sign to 0x80 and anything
+// else that cannot be shown becomes a question mark.
+func winAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '€':
+			encoded = append(encoded, 0x80)
+		case r == '–':
+			encoded = append(encoded, 0x96)
+		case r == '—':
+			encoded = append(encoded, 0x97)
+		case r == '\u00a0':
+			// A no-break space measures and prints like a space
+			encoded = append(encoded, ' ')
+		case r >= 32 && r <= 126, r >= 0xa1 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// textWidth returns the width of text in points when set in the font at the given size
+func textWidth(text string, font pdfFont, size float64) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, b := range winAnsi(text) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			// Close enough for the accented letters and symbols outside ASCII
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrapText splits text into lines that fit within width points
+func wrapText(text string, font pdfFont, size, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && textWidth(candidate, font, size) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfString encodes text as a PDF literal string
+func pdfString(text string) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, b := range winAnsi(text) {
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b < 32 || b > 126:
+			fmt.Fprintf(&sb, "\\%03o", b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// pdfDocument lays out text and lines on A4 pages and writes them as a PDF file.
+// Positions use PDF coordinates: points from the bottom left corner of the page.
+type pdfDocument struct {
+	title string
+	pages []*bytes.Buffer
+	y     float64
+	// footer returns the left and right footer text of a page, numbered from 1
+	footer func(page, pages int) (string, string)
+}
+
+// newPDFDocument creates an empty document with the given title in its metadata
+func newPDFDocument(title string) *pdfDocument {
+	return &pdfDocument{title: title}
+}
+
+// page returns the content stream of the current page
+func (d *pdfDocument) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// newPage starts a new page and moves the cursor to its top margin
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// ensureSpace starts a new page unless height points fit above the bottom margin
+func (d *pdfDocument) ensureSpace(height float64) {
+	if len(d.pages) == 0 || d.y-height < pdfMargin+pdfFooterY {
+		d.newPage()
+	}
+}
+
+// text draws a single line of text with its baseline at y
+func (d *pdfDocument) text(x, y float64, font pdfFont, size float64, text string) {
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font.resourceName(), size, x, y, pdfString(text))
+}
+
+// textCenter draws text centered on the page
+func (d *pdfDocument) textCenter(y float64, font pdfFont, size float64, text string) {
+	d.text((pdfPageWidth-textWidth(text, font, size))/2, y, font, size, text)
+}
+
+// line draws a thin line between two points
+func (d *pdfDocument) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// heading writes a section heading at the cursor
+func (d *pdfDocument) heading(text string) {
+	d.ensureSpace(40)
+	d.y -= 18
+	d.text(pdfMargin, d.y, fontBold, 14, text)
+	d.y -= 6
+	d.line(pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+	d.y -= 16
+}
+
+// paragraph writes wrapped text at the cursor, indented by indent points
+func (d *pdfDocument) paragraph(indent float64, font pdfFont, size float64, text string) {
+	for _, line := range wrapText(text, font, size, pdfPageWidth-2*pdfMargin-indent) {
+		d.ensureSpace(size * 1.4)
+		d.text(pdfMargin+indent, d.y, font, size, line)
+		d.y -= size * 1.4
+	}
+}
+
+// labelValue writes a "label: value" row at the cursor
+func (d *pdfDocument) labelValue(label, value string) {
+	d.ensureSpace(16)
+	d.text(pdfMargin, d.y, fontBold, 10, label)
+	d.text(pdfMargin+110, d.y, fontRegular, 10, value)
+	d.y -= 16
+}
+
+// table writes rows of cells at the given column offsets, with the first row as
+// header. Cells that are too wide for their column wrap onto further lines.
+func (d *pdfDocument) table(columns []float64, rows [][]string) {
+	for i, row := range rows {
+		font := fontRegular
+		if i == 0 {
+			font = fontBold
+		}
+
+		cells := make([][]string, len(row))
+		height := 1
+		for j, cell := range row {
+			right := pdfPageWidth - 2*pdfMargin
+			if j+1 < len(columns) {
+				right = columns[j+1]
+			}
+			cells[j] = wrapText(cell, font, 10, right-columns[j]-8)
+			height = max(height, len(cells[j]))
+		}
+
+		// Keep the header together with the first row
+		space := float64(height)*14 + 4
+		if i == 0 {
+			space += 18
+		}
+		d.ensureSpace(space)
+
+		for j, lines := range cells {
+			for k, line := range lines {
+				d.text(pdfMargin+columns[j], d.y-float64(k)*14, font, 10, line)
+			}
+		}
+		d.y -= float64(height-1)*14 + 6
+		d.line(pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+		d.y -= 12
+	}
+}
+
+// WriteTo writes the document as a PDF file to w
+func (d *pdfDocument) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+
+	// Footers are drawn last so they can show the total page count
+	if d.footer != nil {
+		for i, page := range d.pages {
+			left, right := d.footer(i+1, len(d.pages))
+			fmt.Fprintf(page, "BT /F1 8.0 Tf %.2f %.2f Td %s Tj ET\n", pdfMargin, pdfFooterY, pdfString(left))
+			x := pdfPageWidth - pdfMargin - textWidth(right, fontRegular, 8)
+			fmt.Fprintf(page, "BT /F1 8.0 Tf %.2f %.2f Td %s Tj ET\n", x, pdfFooterY, pdfString(right))
+		}
+	}
+
+	// Objects 1 to 5 are fixed, followed by a page and a content object per page
+	var objects []string
+	pageRefs := make([]string, len(d.pages))
+	for i := range d.pages {
+		pageRefs[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageRefs, " "), len(d.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title %s /Producer (goplayground) >>", pdfString(d.title)),
+	)
+	for i, page := range d.pages {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(page.Bytes())
+		zw.Close()
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 7+2*i),
+			fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// RenderPDF writes the contract as a PDF document to w: a title page followed by the
+// parties, terms, schedule and a signature block for every party. Each page has a
+// footer with the contract ID, its content hash and the page number. The hash of a
+// redacted contract is its SourceHash, the hash of the contract it was redacted from.
+func RenderPDF(w io.Writer, data TemplateData) error {
+	hash := data.SourceHash
+	if hash == "" {
+		if data.Redaction != nil {
+			return fmt.Errorf("redacted contract %s has no source hash", data.ID)
+		}
+		var err error
+		if hash, err = data.ContentHash(); err != nil {
+			return err
+		}
+	}
+
+	l := data.Locale
+	doc := newPDFDocument(data.Title)
+	doc.footer = func(page, pages int) (string, string) {
+		return l.Tf("Contract %s", data.ID) + " · SHA-256 " + hash, l.Tf("Page %d of %d", page, pages)
+	}
+
+	// Title page
+	doc.newPage()
+	y := pdfPageHeight * 0.62
+	for _, line := range wrapText(data.Title, fontBold, 26, pdfPageWidth-2*pdfMargin) {
+		doc.textCenter(y, fontBold, 26, line)
+		y -= 34
+	}
+	y -= 10
+	doc.textCenter(y, fontRegular, 14, l.Tf("Contract %s", data.ID))
+	y -= 22
+	doc.textCenter(y, fontRegular, 12, l.T("Status")+": "+l.T(data.Status))
+	if data.Terms.StartDate != "" || data.Terms.EndDate != "" {
+		y -= 18
+		doc.textCenter(y, fontRegular, 12, l.Tf("%s to %s", l.Date(data.Terms.StartDate), l.Date(data.Terms.EndDate)))
+	}
+	if data.AsOf != "" {
+		y -= 18
+		doc.textCenter(y, fontRegular, 12, l.T("Terms in effect on")+" "+l.Date(data.AsOf))
+	}
+	if data.PredecessorID != "" {
+		y -= 18
+		doc.textCenter(y, fontRegular, 12, l.T("Renews contract")+" "+data.PredecessorID)
+	}
+
+	doc.newPage()
+	doc.heading(l.T("Parties"))
+	rows := [][]string{{l.T("Name"), l.T("Role"), l.T("Email")}}
+	for _, party := range data.Parties {
+		rows = append(rows, []string{party.Name, l.T(party.Role), party.Email})
+	}
+	doc.table([]float64{0, 180, 300}, rows)
+
+	doc.heading(l.T("Terms"))
+	doc.labelValue(l.T("Start date"), l.Date(data.Terms.StartDate))
+	doc.labelValue(l.T("End date"), l.Date(data.Terms.EndDate))
+	if data.Redacted(redactValue) {
+		doc.labelValue(l.T("Value"), l.T(redactedText))
+	} else {
+		doc.labelValue(l.T("Value"), l.Money(data.Terms.Value, data.Terms.Currency))
+	}
+	doc.labelValue(l.T("Status"), l.T(data.Status))
+
+	if schedule := data.Schedule(); len(schedule) > 0 {
+		doc.heading(l.T("Schedule"))
+		rows := [][]string{{l.T("Date"), l.T("Event")}}
+		for _, entry := range schedule {
+			rows = append(rows, []string{l.Date(entry.Date), entry.Description})
+		}
+		doc.table([]float64{0, 90}, rows)
+	}
+
+	doc.heading(l.T("Signatures"))
+	for _, party := range data.Parties {
+		doc.ensureSpace(90)
+		doc.y -= 40
+		doc.line(pdfMargin, doc.y, pdfMargin+220, doc.y)
+		doc.line(pdfMargin+280, doc.y, pdfPageWidth-pdfMargin, doc.y)
+		doc.y -= 12
+		doc.text(pdfMargin, doc.y, fontBold, 10, party.Name)
+		doc.text(pdfMargin+280, doc.y, fontRegular, 10, l.T("Date"))
+		doc.y -= 14
+		doc.text(pdfMargin, doc.y, fontRegular, 9, l.T(party.Role))
+		doc.y -= 10
+	}
+
+	if _, err := doc.WriteTo(w); err != nil {
+		return fmt.Errorf("error writing PDF: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+var (
+	pdfObjectPattern = regexp.MustCompile(`(?m)^(\d+) 0 obj$`)
+	pdfStreamPattern = regexp.MustCompile(`/Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	pdfTextPattern   = regexp.MustCompile(`\(((?:\\.|[^\\)])*)\) Tj`)
+)
+
+// pdfText extracts the text shown on every page of a PDF written by pdfDocument,
+// one string per line in drawing order with a marker line before each page
+func pdfText(t *testing.T, data []byte) string {
+	t.Helper()
+
+	var sb strings.Builder
+	page := 0
+	for _, match := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		stream := data[match[1] : match[1]+length]
+		if !bytes.HasPrefix(data[match[1]+length:], []byte("\nendstream")) {
+			t.Fatalf("Stream at offset %d does not end after its /Length", match[1])
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatalf("Failed to decompress stream: %v", err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Failed to decompress stream: %v", err)
+		}
+
+		page++
+		fmt.Fprintf(&sb, "--- page %d ---\n", page)
+		for _, text := range pdfTextPattern.FindAllSubmatch(content, -1) {
+			sb.WriteString(unescapePDFString(text[1]))
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// unescapePDFString decodes the body of a PDF literal string in WinAnsiEncoding
+func unescapePDFString(escaped []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		b := escaped[i]
+		if b == '\\' && i+1 < len(escaped) {
+			i++
+			b = escaped[i]
+			if b >= '0' && b <= '7' && i+2 < len(escaped) {
+				n, _ := strconv.ParseUint(string(escaped[i:i+3]), 8, 8)
+				b = byte(n)
+				i += 2
+			}
+		}
+		switch b {
+		case 0x80:
+			sb.WriteRune('€')
+		case 0x96:
+			sb.WriteRune('–')
+		case 0x97:
+			sb.WriteRune('—')
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+// checkGolden compares got with testdata/<name>, rewriting the file with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatalf("Failed to create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update %s: %v", path, err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s (run go test -update to create it): %v", path, err)
+	}
+	if got != string(expected) {
+		t.Errorf("Output does not match %s\n--- got\n%s\n--- expected\n%s", path, got, expected)
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	sample, err := LoadContract(filepath.Join("config", "contract.json"))
+	if err != nil {
+		t.Fatalf("Failed to load contract: %v", err)
+	}
+
+	amended := newTestContract("TEST-001", "active")
+	amended.PredecessorID = "TEST-000"
+	amended.Parties[0].Name = "Müller & Söhne (Köln)"
+
+	tests := []struct {
+		name   string
+		data   TemplateData
+		golden string
+	}{
+		{"Sample", TemplateData{Contract: sample}, "sample.pdf.txt"},
+		{"Amended", TemplateData{Contract: amended}, "amended.pdf.txt"},
+		{"AsOf", TemplateData{Contract: amended.EffectiveAt(mustParseDate(t, "2024-05-01")), AsOf: "2024-05-01"}, "amended-as-of.pdf.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := RenderPDF(&buf, tt.data); err != nil {
+				t.Fatalf("Failed to render PDF: %v", err)
+			}
+			checkGolden(t, tt.golden, pdfText(t, buf.Bytes()))
+		})
+	}
+}
+
+func TestPDFStructure(t *testing.T) {
+	contract := newTestContract("TEST-001", "active")
+	// Enough parties to push the signatures onto further pages
+	for i := 0; i < 30; i++ {
+		contract.Parties = append(contract.Parties, Party{Name: fmt.Sprintf("Witness %d", i+1), Role: "witness"})
+	}
+
+	var buf bytes.Buffer
+	if err := RenderPDF(&buf, TemplateData{Contract: contract}); err != nil {
+		t.Fatalf("Failed to render PDF: %v", err)
+	}
+	data := buf.Bytes()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("Expected PDF header and end-of-file marker")
+	}
+
+	t.Run("CrossReferenceTable", func(t *testing.T) {
+		startxref := bytes.LastIndex(data, []byte("startxref\n"))
+		xref, _ := strconv.Atoi(strings.Fields(string(data[startxref+len("startxref\n"):]))[0])
+		if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+			t.Fatalf("startxref %d does not point to the xref table", xref)
+		}
+
+		objects := pdfObjectPattern.FindAllSubmatchIndex(data, -1)
+		lines := strings.Split(string(data[xref:]), "\n")
+		if lines[1] != fmt.Sprintf("0 %d", len(objects)+1) {
+			t.Errorf("Expected xref section for %d objects, got %q", len(objects)+1, lines[1])
+		}
+		for i, object := range objects {
+			entry := lines[3+i]
+			offset, _ := strconv.Atoi(entry[:10])
+			if offset != object[0] {
+				t.Errorf("Object %d: xref entry %q, expected offset %d", i+1, entry, object[0])
+			}
+		}
+	})
+
+	t.Run("PageNumbers", func(t *testing.T) {
+		text := pdfText(t, data)
+		pages := strings.Count(text, "--- page ")
+		if pages < 3 {
+			t.Fatalf("Expected the signatures to continue on a third page, got %d pages", pages)
+		}
+		if !strings.Contains(string(data), fmt.Sprintf("/Count %d", pages)) {
+			t.Errorf("Expected page tree with %d pages", pages)
+		}
+		hash, _ := contract.ContentHash()
+		for page := 1; page <= pages; page++ {
+			if !strings.Contains(text, fmt.Sprintf("Page %d of %d\n", page, pages)) {
+				t.Errorf("Expected footer page number %d of %d", page, pages)
+			}
+		}
+		if strings.Count(text, "SHA-256 "+hash) != pages {
+			t.Errorf("Expected content hash in the footer of every page")
+		}
+	})
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("the quick brown fox jumps over the lazy dog", fontRegular, 10, 60)
+	for _, line := range lines {
+		if width := textWidth(line, fontRegular, 10); width > 60 && strings.Contains(line, " ") {
+			t.Errorf("Line %q is %.1f points wide, expected at most 60", line, width)
+		}
+	}
+	if joined := strings.Join(lines, " "); joined != "the quick brown fox jumps over the lazy dog" {
+		t.Errorf("Expected wrapped lines to keep every word, got %q", joined)
+	}
+
+	if lines := wrapText("", fontRegular, 10, 60); len(lines) != 1 || lines[0] != "" {
+		t.Errorf("Expected a single empty line for empty text, got %q", lines)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := map[string]string{
+		"plain":     "(plain)",
+		"(a) \\ b":  `(\(a\) \\ b)`,
+		"Köln 5 €":  `(K\366ln 5 \200)`,
+		"日本":        "(??)",
+		"tab\there": "(tab?here)",
+	}
+	for input, expected := range tests {
+		if got := pdfString(input); got != expected {
+			t.Errorf("pdfString(%q) = %s, expected %s", input, got, expected)
+		}
+	}
+}
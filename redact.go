@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fields a redaction rule can apply to
+const (
+	redactTitle            = "title"
+	redactPartyName        = "parties.name"
+	redactPartyEmail       = "parties.email"
+	redactValue            = "terms.value"
+	redactPaymentAmounts   = "terms.payments.amount"
+	redactAmendmentDetails = "amendments.description"
+)
+
+// Redaction actions
+const (
+	redactionActionMask   = "mask"
+	redactionActionRemove = "remove"
+)
+
+// partyFieldPrefix starts the fields that rules can limit to parties with certain roles
+const partyFieldPrefix = "parties."
+
+// redactedText replaces hidden text
+const redactedText = "[redacted]"
+
+// redactionFields lists the fields rules can name, in the order they are documented
+var redactionFields = []string{redactTitle, redactPartyName, redactPartyEmail, redactValue, redactPaymentAmounts, redactAmendmentDetails}
+
+// RedactionRule hides a field of a contract
+type RedactionRule struct {
+	// Field is one of redactionFields, e.g. parties.email
+	Field string `json:"field"`
+	// Roles limits a parties.* rule to the parties with these roles; * or no roles
+	// means every party
+	Roles []string `json:"roles,omitempty"`
+	// Action is mask (the default), which keeps a hint such as the domain of an
+	// email address or the initials of a name, or remove, which keeps nothing.
+	// Amounts are always removed.
+	Action string `json:"action,omitempty"`
+}
+
+// validate checks that the rule names a known field and action
+func (r RedactionRule) validate() error {
+	known := false
+	for _, field := range redactionFields {
+		known = known || r.Field == field
+	}
+	if !known {
+		return fmt.Errorf("unknown field %q (use %s)", r.Field, strings.Join(redactionFields, ", "))
+	}
+	if len(r.Roles) > 0 && !strings.HasPrefix(r.Field, partyFieldPrefix) {
+		return fmt.Errorf("field %s: roles only apply to parties.name and parties.email", r.Field)
+	}
+	if r.Action != "" && r.Action != redactionActionMask && r.Action != redactionActionRemove {
+		return fmt.Errorf("field %s: unknown action %q (use %s or %s)", r.Field, r.Action, redactionActionMask, redactionActionRemove)
+	}
+	return nil
+}
+
+// appliesTo reports whether a parties.* rule covers a party with the given role
+func (r RedactionRule) appliesTo(role string) bool {
+	return len(r.Roles) == 0 || matchesRole(r.Roles, role)
+}
+
+// RedactionConfig holds the named redaction policies of the config file
+type RedactionConfig struct {
+	Policies map[string][]RedactionRule `json:"policies"`
+}
+
+// LoadRedactionConfig reads and validates a redaction config file
+func LoadRedactionConfig(path string) (*RedactionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading redaction config: %v", err)
+	}
+
+	var config RedactionConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing redaction config %s: %v", path, err)
+	}
+	for name, rules := range config.Policies {
+		for i, rule := range rules {
+			if err := rule.validate(); err != nil {
+				return nil, fmt.Errorf("invalid redaction config %s: policy %s, rule %d: %v", path, name, i+1, err)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// Policy returns the policy with the given name
+func (c *RedactionConfig) Policy(name string) (*RedactionPolicy, error) {
+	rules, ok := c.Policies[name]
+	if !ok {
+		var names []string
+		for known := range c.Policies {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown redaction policy %q (configured: %s)", name, strings.Join(names, ", "))
+	}
+	return &RedactionPolicy{Name: name, Rules: rules}, nil
+}
+
+// RedactionPolicy is a named set of rules that hide contract fields when
+// contracts are rendered or exported for someone who may not see them
+type RedactionPolicy struct {
+	Name  string
+	Rules []RedactionRule
+}
+
+// Redacts reports whether the policy hides the field for any party. It is false
+// for a nil policy.
+func (p *RedactionPolicy) Redacts(field string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if rule.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// rule returns the first rule for the field that applies to a party role, or
+// for fields of the contract, any rule for the field
+func (p *RedactionPolicy) rule(field, role string) (RedactionRule, bool) {
+	for _, rule := range p.Rules {
+		if rule.Field == field && (!strings.HasPrefix(field, partyFieldPrefix) || rule.appliesTo(role)) {
+			return rule, true
+		}
+	}
+	return RedactionRule{}, false
+}
+
+// Apply returns a copy of the contract with the fields of the policy hidden.
+// Amounts are set to zero, so that no renderer or export can show them; the
+// built-in templates show them as redacted using Redacts, and JSON, YAML and CSV
+// output as [redacted]. Signatures no longer verify on the copy. A nil policy
+// returns the contract itself.
+func (p *RedactionPolicy) Apply(c *Contract) *Contract {
+	if p == nil {
+		return c
+	}
+	redacted, err := copyContract(c)
+	if err != nil {
+		// Contracts always marshal; hide everything rather than leak it
+		return &Contract{ID: c.ID, Status: c.Status}
+	}
+
+	if _, ok := p.rule(redactTitle, ""); ok {
+		redacted.Title = redactText(redacted.Title)
+	}
+	if _, ok := p.rule(redactValue, ""); ok {
+		redacted.Terms.Value = 0
+		redacted.Terms.valueRedacted = true
+	}
+	if _, ok := p.rule(redactPaymentAmounts, ""); ok {
+		for i := range redacted.Terms.Payments {
+			redacted.Terms.Payments[i].Amount = 0
+			redacted.Terms.Payments[i].amountRedacted = true
+		}
+	}
+
+	// Signatures name the party that signed, so they are redacted like the party
+	roles := make(map[string]string)
+	for _, party := range redacted.Parties {
+		roles[party.Name] = party.Role
+	}
+	for i := range redacted.Signatures {
+		if rule, ok := p.rule(redactPartyName, roles[redacted.Signatures[i].Party]); ok {
+			redacted.Signatures[i].Party = redactName(redacted.Signatures[i].Party, rule.Action)
+		}
+	}
+	p.redactParties(redacted.Parties)
+
+	for i := range redacted.Amendments {
+		amendment := &redacted.Amendments[i]
+		if _, ok := p.rule(redactAmendmentDetails, ""); ok {
+			amendment.Description = redactText(amendment.Description)
+		}
+		if _, ok := p.rule(redactTitle, ""); ok && amendment.Changes.Title != nil {
+			title := redactText(*amendment.Changes.Title)
+			amendment.Changes.Title = &title
+		}
+		if _, ok := p.rule(redactValue, ""); ok {
+			amendment.Changes.Value = nil
+		}
+		p.redactParties(amendment.Changes.Parties)
+	}
+	return redacted
+}
+
+// redactParties hides the names and email addresses of the parties the rules cover
+func (p *RedactionPolicy) redactParties(parties []Party) {
+	for i := range parties {
+		party := &parties[i]
+		if rule, ok := p.rule(redactPartyEmail, party.Role); ok {
+			party.Email = redactEmail(party.Email, rule.Action)
+		}
+		if rule, ok := p.rule(redactPartyName, party.Role); ok {
+			party.Name = redactName(party.Name, rule.Action)
+		}
+	}
+}
+
+// redactText hides free text completely
+func redactText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return redactedText
+}
+
+// redactName masks a name to its initials, e.g. Jane Doe becomes J. D.
+func redactName(name, action string) string {
+	if name == "" || action == redactionActionRemove {
+		return redactText(name)
+	}
+	var initials []string
+	for _, word := range strings.Fields(name) {
+		first, _ := utf8.DecodeRuneInString(word)
+		if unicode.IsLetter(first) || unicode.IsDigit(first) {
+			initials = append(initials, string(unicode.ToUpper(first))+".")
+		}
+	}
+	if len(initials) == 0 {
+		return redactedText
+	}
+	return strings.Join(initials, " ")
+}
+
+// redactEmail masks an email address to its first letter and domain, e.g.
+// jane@example.com becomes j***@example.com. Removing it leaves it empty.
+func redactEmail(email, action string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if email == "" || action == redactionActionRemove || !ok || local == "" {
+		return ""
+	}
+	first, _ := utf8.DecodeRuneInString(local)
+	return string(first) + "***@" + domain
+}
+
+// loadRedactionFlag loads the policy selected with a -redact flag from the
+// -redaction-config file, or returns nil when none is selected
+func loadRedactionFlag(name string) (*RedactionPolicy, error) {
+	if name == "" {
+		return nil, nil
+	}
+	config, err := LoadRedactionConfig(*redactionConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return config.Policy(name)
+}
+
+// checkRedactFlag rejects the global -redact flag where it would be ignored: with a
+// subcommand, which takes a -redact flag of its own or shows nothing it could hide
+// it from, such as list and diff, and without -contract or -output-md
+func checkRedactFlag(policy, command string, rendering bool) error {
+	if policy == "" {
+		return nil
+	}
+	if command != "" {
+		return fmt.Errorf("-redact before the %s command has no effect; show, render and calendar take -redact after the command, and other commands cannot redact", command)
+	}
+	if !rendering {
+		return fmt.Errorf("-redact only applies to -contract and -output-md")
+	}
+	return nil
+}
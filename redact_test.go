@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// externalPolicy hides the client and the amounts
+var externalPolicy = &RedactionPolicy{Name: "external", Rules: []RedactionRule{
+	{Field: redactPartyEmail, Roles: []string{"client"}},
+	{Field: redactPartyName, Roles: []string{"client"}},
+	{Field: redactValue},
+	{Field: redactPaymentAmounts},
+}}
+
+func TestRedactionPolicyApply(t *testing.T) {
+	// An internal and an external party, payments, amendments and a signature
+	contract := newTestContract("TEST-001", "active")
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+		{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+	}
+	contract.Parties = []Party{
+		{Name: "Jane Doe", Role: "Client", Email: "jane@client.example"},
+		{Name: "Acme Services", Role: "Provider", Email: "sales@acme.example"},
+	}
+	contract.Amendments = append(contract.Amendments, Amendment{
+		EffectiveDate: "2024-10-01",
+		Description:   "New client contact",
+		Changes:       AmendmentChanges{Parties: []Party{{Name: "John Roe", Role: "Client", Email: "john@client.example"}}},
+	})
+	contract.Signatures = []Signature{{Party: "Jane Doe", PublicKey: "a2V5", Value: "c2ln"}}
+	redacted := externalPolicy.Apply(contract)
+
+	expected := []Party{
+		{Name: "J. D.", Role: "Client", Email: "j***@client.example"},
+		{Name: "Acme Services", Role: "Provider", Email: "sales@acme.example"},
+	}
+	for i, party := range redacted.Parties {
+		if party != expected[i] {
+			t.Errorf("Party %d: expected %+v, got %+v", i, expected[i], party)
+		}
+	}
+	if redacted.Terms.Value != 0 || redacted.Terms.Payments[0].Amount != 0 || redacted.Terms.Payments[1].Amount != 0 {
+		t.Errorf("Expected the amounts to be removed, got %+v", redacted.Terms)
+	}
+	if redacted.Signatures[0].Party != "J. D." {
+		t.Errorf("Expected the signature to be redacted like its party, got %q", redacted.Signatures[0].Party)
+	}
+	if got := redacted.Amendments[2].Changes.Parties[0]; got.Name != "J. R." || got.Email != "j***@client.example" {
+		t.Errorf("Expected parties changed by amendments to be redacted, got %+v", got)
+	}
+	if redacted.Amendments[1].Changes.Value != nil {
+		t.Errorf("Expected value changes of amendments to be removed")
+	}
+	if latest := redacted.latestTerms(); latest.Terms.Value != 0 {
+		t.Errorf("Expected the value to stay hidden after applying the amendments, got %v", latest.Terms.Value)
+	}
+	if redacted.Title != contract.Title || redacted.Amendments[0].Description != "Extension" {
+		t.Errorf("Expected fields without a rule to be kept")
+	}
+
+	t.Run("OriginalUnchanged", func(t *testing.T) {
+		if contract.Parties[0].Email != "jane@client.example" || contract.Terms.Value != 1000 || contract.Amendments[1].Changes.Value == nil {
+			t.Errorf("Expected the original contract to be unchanged, got %+v", contract)
+		}
+	})
+
+	t.Run("StructuredOutput", func(t *testing.T) {
+		for _, format := range []string{outputJSON, outputYAML, outputCSV} {
+			var buf bytes.Buffer
+			if err := writeResults(&buf, format, redacted); err != nil {
+				t.Fatalf("Failed to write %s: %v", format, err)
+			}
+			out := buf.String()
+			if strings.Count(out, redactedText) != 3 || strings.Contains(out, "1000") {
+				t.Errorf("Expected the value and both payment amounts to show as redacted in %s, got\n%s", format, out)
+			}
+		}
+		var buf bytes.Buffer
+		writeResults(&buf, outputJSON, contract)
+		if strings.Contains(buf.String(), redactedText) {
+			t.Errorf("Expected the original contract to show its amounts, got\n%s", buf.String())
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		policy := &RedactionPolicy{Rules: []RedactionRule{
+			{Field: redactPartyName, Action: redactionActionRemove},
+			{Field: redactPartyEmail, Roles: []string{"*"}, Action: redactionActionRemove},
+			{Field: redactTitle},
+			{Field: redactAmendmentDetails},
+		}}
+		redacted := policy.Apply(contract)
+		for _, party := range redacted.Parties {
+			if party.Name != redactedText || party.Email != "" {
+				t.Errorf("Expected the party to be removed, got %+v", party)
+			}
+		}
+		if redacted.Title != redactedText || redacted.Amendments[0].Description != redactedText {
+			t.Errorf("Expected the title and amendment descriptions to be removed, got %q and %q", redacted.Title, redacted.Amendments[0].Description)
+		}
+		if redacted.Terms.Value != 1000 {
+			t.Errorf("Expected the value to be kept, got %v", redacted.Terms.Value)
+		}
+	})
+
+	t.Run("NilPolicy", func(t *testing.T) {
+		var policy *RedactionPolicy
+		if policy.Apply(contract) != contract || policy.Redacts(redactValue) {
+			t.Errorf("Expected a nil policy to change nothing")
+		}
+	})
+}
+
+func TestRedactMasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"Name", redactName("jane van der Doe", redactionActionMask), "J. V. D. D."},
+		{"NameWithoutLetters", redactName("- -", redactionActionMask), redactedText},
+		{"EmptyName", redactName("", redactionActionMask), ""},
+		{"Email", redactEmail("élodie@example.fr", redactionActionMask), "é***@example.fr"},
+		{"InvalidEmail", redactEmail("not an email", redactionActionMask), ""},
+		{"RemovedEmail", redactEmail("jane@example.com", redactionActionRemove), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+func TestLoadRedactionConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "redaction.json")
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+
+	config, err := LoadRedactionConfig(write(`{"policies": {"external": [{"field": "parties.email", "roles": ["client"]}, {"field": "terms.value"}]}}`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	policy, err := config.Policy("external")
+	if err != nil || policy.Name != "external" || len(policy.Rules) != 2 || !policy.Redacts(redactValue) {
+		t.Errorf("Unexpected policy %+v: %v", policy, err)
+	}
+	if _, err := config.Policy("internal"); err == nil || !strings.Contains(err.Error(), `unknown redaction policy "internal" (configured: external)`) {
+		t.Errorf("Expected an unknown policy error, got %v", err)
+	}
+
+	t.Run("Shipped", func(t *testing.T) {
+		config, err := LoadRedactionConfig("redaction.json")
+		if err != nil {
+			t.Fatalf("Failed to load the shipped config: %v", err)
+		}
+		if _, err := config.Policy("external"); err != nil {
+			t.Errorf("Expected the shipped config to define external: %v", err)
+		}
+	})
+
+	invalid := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"UnknownField", `{"policies": {"p": [{"field": "parties.phone"}]}}`, `policy p, rule 1: unknown field "parties.phone"`},
+		{"RolesOnContractField", `{"policies": {"p": [{"field": "terms.value", "roles": ["client"]}]}}`, "roles only apply to parties"},
+		{"UnknownAction", `{"policies": {"p": [{"field": "title", "action": "blur"}]}}`, `unknown action "blur"`},
+		{"InvalidJSON", `{"policies": [`, "error parsing redaction config"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadRedactionConfig(write(tt.content)); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestRedactedRendering(t *testing.T) {
+	// An internal and an external party, payments, amendments and a signature
+	contract := newTestContract("TEST-001", "active")
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+		{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+	}
+	contract.Parties = []Party{
+		{Name: "Jane Doe", Role: "Client", Email: "jane@client.example"},
+		{Name: "Acme Services", Role: "Provider", Email: "sales@acme.example"},
+	}
+	contract.Amendments = append(contract.Amendments, Amendment{
+		EffectiveDate: "2024-10-01",
+		Description:   "New client contact",
+		Changes:       AmendmentChanges{Parties: []Party{{Name: "John Roe", Role: "Client", Email: "john@client.example"}}},
+	})
+	contract.Signatures = []Signature{{Party: "Jane Doe", PublicKey: "a2V5", Value: "c2ln"}}
+
+	prepare, err := templateDataFor("", nil, externalPolicy)
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	data := prepare(contract)
+	secrets := []string{"Jane Doe", "jane@client.example", "1,000.00", "600.00", "1,200.00"}
+
+	t.Run("Markdown", func(t *testing.T) {
+		markdown, err := renderContract(data, formatMarkdown, DefaultTemplate)
+		if err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		for _, expected := range []string{"* J. D. (Client)\n  - Email: j***@client.example", "* Value: [redacted]", "Acme Services"} {
+			if !strings.Contains(string(markdown), expected) {
+				t.Errorf("Expected markdown to contain %q:\n%s", expected, markdown)
+			}
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(markdown), secret) {
+				t.Errorf("Expected markdown not to contain %q:\n%s", secret, markdown)
+			}
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		page, err := renderContract(data, formatHTML, "")
+		if err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		if !strings.Contains(string(page), `<dd class="redacted">[redacted]</dd>`) || !strings.Contains(string(page), "Payment due") {
+			t.Errorf("Expected the value and payments to be shown as redacted:\n%s", page)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(page), secret) {
+				t.Errorf("Expected the page not to contain %q", secret)
+			}
+		}
+	})
+
+	t.Run("PDF", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := RenderPDF(&buf, data); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		text := pdfText(t, buf.Bytes())
+		if !strings.Contains(text, "Value\n[redacted]") {
+			t.Errorf("Expected the PDF to show the value as redacted:\n%s", text)
+		}
+		hash, _ := contract.ContentHash()
+		if !strings.Contains(text, "SHA-256 "+hash) {
+			t.Errorf("Expected the footer to show the hash of the contract before redaction %s:\n%s", hash, text)
+		}
+
+		withoutHash := data
+		withoutHash.SourceHash = ""
+		if err := RenderPDF(&buf, withoutHash); err == nil {
+			t.Errorf("Expected an error for a redacted contract without its source hash")
+		}
+		for _, secret := range secrets {
+			if strings.Contains(text, secret) {
+				t.Errorf("Expected the PDF not to contain %q", secret)
+			}
+		}
+	})
+
+	t.Run("Calendar", func(t *testing.T) {
+		var sb strings.Builder
+		opts := CalendarOptions{Stamp: time.Now(), Redaction: externalPolicy}
+		if err := WriteCalendar(&sb, []*Contract{contract}, opts); err != nil {
+			t.Fatalf("Failed to write calendar: %v", err)
+		}
+		if !strings.Contains(sb.String(), "SUMMARY:Payment due for Test Contract") || strings.Contains(sb.String(), "600.00") {
+			t.Errorf("Expected payment amounts to be left out:\n%s", sb.String())
+		}
+	})
+
+	t.Run("LegacyMarkdown", func(t *testing.T) {
+		markdown, err := externalPolicy.Apply(contract).markdown("", externalPolicy)
+		if err != nil {
+			t.Fatalf("Failed to render contract: %v", err)
+		}
+		if !strings.Contains(markdown, "* Value: [redacted]") {
+			t.Errorf("Expected the value to be shown as redacted:\n%s", markdown)
+		}
+	})
+}
+
+func TestRedactedFileNames(t *testing.T) {
+	policy := &RedactionPolicy{Name: "internal", Rules: []RedactionRule{{Field: redactTitle}}}
+	prepare, err := templateDataFor("", nil, policy)
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	dir := t.TempDir()
+	dest := OutputDestination{Path: filepath.Join(dir, "{title}.md")}
+	if err := renderToDestination([]*Contract{newTestContract("TEST-001", "active")}, dest, formatMarkdown, DefaultTemplate, prepare); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one rendered file, got %v: %v", entries, err)
+	}
+	if strings.Contains(entries[0].Name(), "test-contract") {
+		t.Errorf("Expected the file name not to show the redacted title, got %s", entries[0].Name())
+	}
+}
+
+func TestCheckRedactFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		command   string
+		rendering bool
+		err       string
+	}{
+		{"NoPolicy", "", "list", false, ""},
+		{"Contract", "external", "", true, ""},
+		{"List", "external", "list", false, "-redact before the list command has no effect"},
+		{"Diff", "external", "diff", false, "-redact before the diff command has no effect"},
+		{"WithoutRendering", "external", "", false, "-redact only applies to -contract and -output-md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRedactFlag(tt.policy, tt.command, tt.rendering)
+			if tt.err == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the built-in template used by ToMarkdown
+const DefaultTemplate = "default"
+
+// builtinTemplates holds the templates compiled into the binary
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// TemplateData is the value contract templates are executed with.
+// Contract fields are available directly, e.g. {{.ID}} or {{.Terms.Value}}.
+type TemplateData struct {
+	*Contract
+	// AsOf is the date the terms are shown for, or empty for the terms as written
+	AsOf string
+	// Locale selects the language of labels and the format of dates and amounts.
+	// It is nil for English labels with ISO dates.
+	Locale *Locale
+	// Redaction is the policy that was applied to the contract, or nil
+	Redaction *RedactionPolicy
+	// SourceHash is the content hash of the contract before the redaction was
+	// applied, so that a redacted document still identifies the contract it shows
+	SourceHash string
+}
+
+// Redacted reports whether the redaction policy hides a field such as terms.value,
+// so that templates can show it as redacted rather than leave it out
+func (d TemplateData) Redacted(field string) bool {
+	return d.Redaction.Redacts(field)
+}
+
+// Party returns the first party with the given role (compared case-insensitively), or nil
+func (d TemplateData) Party(role string) *Party {
+	for i := range d.Parties {
+		if strings.EqualFold(d.Parties[i].Role, role) {
+			return &d.Parties[i]
+		}
+	}
+	return nil
+}
+
+// PartiesWithRole returns every party with the given role (compared case-insensitively)
+func (d TemplateData) PartiesWithRole(role string) []Party {
+	var parties []Party
+	for _, party := range d.Parties {
+		if strings.EqualFold(party.Role, role) {
+			parties = append(parties, party)
+		}
+	}
+	return parties
+}
+
+// Renderer renders contracts with a text/template
+type Renderer struct {
+	tmpl *template.Template
+}
+
+// templateFuncs returns the helper functions available in contract templates,
+// formatting labels, dates and amounts for the locale (nil for the defaults)
+func templateFuncs(locale *Locale) template.FuncMap {
+	return template.FuncMap{
+		// money formats an amount with two decimals and the currency, e.g. 1000.00 USD
+		"money": locale.Money,
+		// number formats a number with the given decimals and the locale's separators
+		"number": locale.Number,
+		// date reformats a YYYY-MM-DD contract date using a Go time layout
+		"date": func(value, layout string) string {
+			parsed, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return value
+			}
+			return parsed.Format(layout)
+		},
+		// localDate formats a YYYY-MM-DD contract date in the locale's date format
+		"localDate": locale.Date,
+		// t translates an English label, tf a format string such as "%d contracts"
+		"t":  locale.T,
+		"tf": locale.Tf,
+		// changes summarizes the fields changed by an amendment
+		"changes": func(changes AmendmentChanges) string {
+			return changes.LocalSummary(locale)
+		},
+		// lang is the language code of the locale, e.g. en
+		"lang":  locale.Language,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+// NewRenderer creates a renderer for a built-in template name or a template file path
+func NewRenderer(name string) (*Renderer, error) {
+	builtin := "templates/" + name + ".md.tmpl"
+	if data, err := builtinTemplates.ReadFile(builtin); err == nil {
+		tmpl, err := template.New(name).Funcs(templateFuncs(nil)).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing built-in template %s: %v", name, err)
+		}
+		return &Renderer{tmpl: tmpl}, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q: not a built-in template (%s) and %v",
+			name, strings.Join(BuiltinTemplates(), ", "), err)
+	}
+	tmpl, err := template.New(path.Base(name)).Funcs(templateFuncs(nil)).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %v", name, err)
+	}
+	return &Renderer{tmpl: tmpl}, nil
+}
+
+// BuiltinTemplates returns the names of the built-in templates
+func BuiltinTemplates() []string {
+	entries, err := builtinTemplates.ReadDir("templates")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".md.tmpl"); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes the template for the contract and writes the result to w
+func (r *Renderer) Render(w io.Writer, data TemplateData) error {
+	// The helpers depend on the locale, so each render binds them to a copy of the template
+	tmpl, err := r.tmpl.Clone()
+	if err != nil {
+		return fmt.Errorf("error rendering contract: %v", err)
+	}
+	if err := tmpl.Funcs(templateFuncs(data.Locale)).Execute(w, data); err != nil {
+		return fmt.Errorf("error rendering contract: %v", err)
+	}
+	return nil
+}
+
+// RenderString executes the template for the contract and returns the result
+func (r *Renderer) RenderString(data TemplateData) (string, error) {
+	var sb strings.Builder
+	if err := r.Render(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// Render formats supported by the render command
+const (
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+	formatPDF      = "pdf"
+)
+
+// loadContractFiles loads contracts from files and from every contract file in directories
+func loadContractFiles(paths []string) ([]*Contract, error) {
+	var contracts []*Contract
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error accessing %s: %v", path, err)
+		}
+
+		if !info.IsDir() {
+			contract, err := LoadContract(path)
+			if err != nil {
+				return nil, fmt.Errorf("error loading contract from %s: %v", path, err)
+			}
+			contracts = append(contracts, contract)
+			continue
+		}
+
+		files, err := scanContractDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			contracts = append(contracts, file.contract)
+		}
+	}
+
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ID < contracts[j].ID })
+	return contracts, nil
+}
+
+// pathExists reports whether a command line argument names an existing file or directory
+func pathExists(arg string) bool {
+	_, err := os.Stat(arg)
+	return err == nil
+}
+
+// resolveContracts loads the contracts named on the command line. Arguments that are
+// existing files or directories are loaded from disk; any other argument is the ID of a
+// contract in the store, which may be nil when every argument is a path.
+func resolveContracts(args []string, store ContractStore) ([]*Contract, error) {
+	var contracts []*Contract
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		var loaded []*Contract
+		if pathExists(arg) {
+			files, err := loadContractFiles([]string{arg})
+			if err != nil {
+				return nil, err
+			}
+			loaded = files
+		} else {
+			if store == nil {
+				return nil, fmt.Errorf("%s is not a contract file and no store is open", arg)
+			}
+			contract, err := store.GetContract(arg)
+			if errors.Is(err, ErrContractNotFound) {
+				return nil, fmt.Errorf("%s is neither a contract file nor a stored contract", arg)
+			} else if err != nil {
+				return nil, err
+			}
+			loaded = []*Contract{contract}
+		}
+
+		for _, contract := range loaded {
+			if seen[contract.ID] {
+				return nil, fmt.Errorf("contract %s is given more than once", contract.ID)
+			}
+			seen[contract.ID] = true
+			contracts = append(contracts, contract)
+		}
+	}
+
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ID < contracts[j].ID })
+	return contracts, nil
+}
+
+// selectContracts loads the contracts named on the command line or, with all, the
+// stored contracts that match the filter. Without either, the -contract-file is loaded.
+func selectContracts(positional []string, all bool, filter ContractFilter) ([]*Contract, error) {
+	if all && len(positional) > 0 {
+		return nil, fmt.Errorf("-all cannot be combined with contract files or IDs")
+	}
+	if !all && !filter.IsEmpty() {
+		return nil, fmt.Errorf("the filter flags select stored contracts and require -all")
+	}
+	if len(positional) == 0 && !all {
+		positional = []string{*contractFile}
+	}
+
+	// The store is only needed for -all and for arguments that are not files
+	var store ContractStore
+	needsStore := all
+	for _, arg := range positional {
+		needsStore = needsStore || !pathExists(arg)
+	}
+	if needsStore {
+		var err error
+		store, err = openStore()
+		if err != nil {
+			return nil, err
+		}
+		defer store.Close()
+	}
+
+	if all {
+		return FindContracts(store, filter)
+	}
+	return resolveContracts(positional, store)
+}
+
+// renderContract renders a contract in the given format
+func renderContract(data TemplateData, format, templateName string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case formatMarkdown:
+		renderer, err := NewRenderer(templateName)
+		if err != nil {
+			return nil, err
+		}
+		if err := renderer.Render(&buf, data); err != nil {
+			return nil, err
+		}
+	case formatHTML:
+		renderer, err := NewHTMLRenderer()
+		if err != nil {
+			return nil, err
+		}
+		if err := renderer.RenderContract(&buf, data); err != nil {
+			return nil, err
+		}
+	case formatPDF:
+		if err := RenderPDF(&buf, data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q (use %s, %s or %s)", format, formatMarkdown, formatHTML, formatPDF)
+	}
+	return buf.Bytes(), nil
+}
+
+// runRender implements the render command
+func runRender(args []string) error {
+	fs := newFlagSet("render")
+	format := fs.String("format", formatMarkdown, "Output format: markdown, html or pdf")
+	templateName := fs.String("template", DefaultTemplate, "Built-in template name or path to a template file (markdown only)")
+	asOf := fs.String("as-of", "", "Render the terms in effect on this date (YYYY-MM-DD)")
+	localeTag := fs.String("locale", "", "Render labels, dates and amounts for a locale such as de-DE or en-US (default: English with ISO dates)")
+	output := fs.String("o", "", "Write to this file, directory or pattern like out/{id}-{status}.{ext} instead of standard output (required for pdf)")
+	force := fs.Bool("force", false, "Replace existing output files")
+	noClobber := fs.Bool("no-clobber", false, "Skip contracts whose output file already exists")
+	site := fs.String("site", "", "Write an HTML page per contract plus index.html to this directory")
+	all := fs.Bool("all", false, "Render every stored contract that matches the filter flags")
+	filter := filterFlags(fs)
+	listTemplates := fs.Bool("list-templates", false, "List the built-in templates")
+	redact := fs.String("redact", "", "Hide fields using this policy from the -redaction-config file, e.g. external")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *listTemplates {
+		for _, name := range BuiltinTemplates() {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	locale, err := loadLocaleFlag(*localeTag)
+	if err != nil {
+		return err
+	}
+	redaction, err := loadRedactionFlag(*redact)
+	if err != nil {
+		return err
+	}
+
+	contracts, err := selectContracts(positional, *all, filter())
+	if err != nil {
+		return err
+	}
+	if *all && len(contracts) == 0 {
+		fmt.Println("No stored contracts match the filter")
+		return nil
+	}
+
+	if *site != "" {
+		renderer, err := NewHTMLRenderer()
+		if err != nil {
+			return err
+		}
+		if err := renderer.WriteSite(*site, contracts, locale, redaction); err != nil {
+			return err
+		}
+		results := make([]renderResult, 0, len(contracts))
+		for _, contract := range contracts {
+			name, _ := contractFileName(contract.ID, ".html")
+			results = append(results, renderResult{ID: contract.ID, Path: filepath.Join(*site, name)})
+		}
+		return printResults(results, func() {
+			fmt.Printf("Wrote %d contract page(s) and index.html to %s\n", len(contracts), *site)
+		})
+	}
+
+	dest := OutputDestination{Path: *output, Force: *force, NoClobber: *noClobber}
+	if err := dest.Validate(); err != nil {
+		return err
+	}
+	if *format == formatPDF && dest.IsStdout() {
+		return fmt.Errorf("pdf output requires -o <file>")
+	}
+
+	prepare, err := templateDataFor(*asOf, locale, redaction)
+	if err != nil {
+		return err
+	}
+	return renderToDestination(contracts, dest, *format, *templateName, prepare)
+}
+
+// templateDataFor returns a function that prepares contracts for rendering with the
+// terms in effect on the -as-of date, if one is given, the selected locale and the
+// fields of the redaction policy hidden
+func templateDataFor(asOf string, locale *Locale, redaction *RedactionPolicy) (func(*Contract) TemplateData, error) {
+	redact := func(data TemplateData) TemplateData {
+		if redaction != nil {
+			data.SourceHash, _ = data.ContentHash()
+			data.Contract = redaction.Apply(data.Contract)
+			data.Redaction = redaction
+		}
+		return data
+	}
+	if asOf == "" {
+		return func(contract *Contract) TemplateData {
+			return redact(TemplateData{Contract: contract, Locale: locale})
+		}, nil
+	}
+
+	date, err := time.Parse(dateLayout, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -as-of date %s: expected YYYY-MM-DD", asOf)
+	}
+	return func(contract *Contract) TemplateData {
+		return redact(TemplateData{Contract: contract.EffectiveAt(date), AsOf: asOf, Locale: locale})
+	}, nil
+}
+
+// loadLocaleFlag loads the locale selected with a -locale flag, or returns nil when none is
+func loadLocaleFlag(tag string) (*Locale, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	return LoadLocale(tag)
+}
+
+// renderToDestination renders every contract and writes it to the destination,
+// reporting the files written unless the output goes to standard output. File
+// names are made from the prepared contracts, so they show no redacted fields.
+func renderToDestination(contracts []*Contract, dest OutputDestination, format, templateName string, prepare func(*Contract) TemplateData) error {
+	prepared := make([]TemplateData, len(contracts))
+	for i, contract := range contracts {
+		prepared[i] = prepare(contract)
+	}
+
+	if len(contracts) > 1 {
+		if !dest.PerContract() {
+			return fmt.Errorf("rendering %d contracts requires -o with a directory or a pattern like {id}.{ext}", len(contracts))
+		}
+		// Fail before writing anything if two contracts would end up in the same file
+		seen := make(map[string]string)
+		for _, data := range prepared {
+			path, err := dest.PathFor(data.Contract, format)
+			if err != nil {
+				return err
+			}
+			if other, ok := seen[path]; ok {
+				return fmt.Errorf("contracts %s and %s would both be written to %s", other, data.Contract.ID, path)
+			}
+			seen[path] = data.Contract.ID
+		}
+	}
+
+	results := make([]renderResult, 0, len(contracts))
+	for _, data := range prepared {
+		rendered, err := renderContract(data, format, templateName)
+		if err != nil {
+			return err
+		}
+
+		path, skipped, err := dest.Write(data.Contract, format, rendered)
+		if err != nil {
+			return err
+		}
+		results = append(results, renderResult{ID: data.Contract.ID, Path: path, Skipped: skipped})
+	}
+
+	// The rendered contracts themselves went to standard output
+	if dest.IsStdout() {
+		return nil
+	}
+	return printResults(results, func() {
+		for _, result := range results {
+			if result.Skipped {
+				fmt.Printf("Skipped contract %s: %s already exists\n", result.ID, result.Path)
+			} else {
+				fmt.Printf("Contract %s rendered to %s\n", result.ID, result.Path)
+			}
+		}
+	})
+}
+
+// renderResult is the result record of a contract rendered to a file
+type renderResult struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Skipped bool   `json:"skipped"`
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	names := BuiltinTemplates()
+	for _, expected := range []string{"default", "information"} {
+		found := false
+		for _, name := range names {
+			found = found || name == expected
+		}
+		if !found {
+			t.Errorf("Expected built-in template %s, got %v", expected, names)
+		}
+	}
+}
+
+func TestInformationTemplate(t *testing.T) {
+	// output.md in the repository root is the reference output of the information template
+	contract, err := LoadContract(filepath.Join("config", "contract.json"))
+	if err != nil {
+		t.Fatalf("Failed to load contract: %v", err)
+	}
+	expected, err := os.ReadFile("output.md")
+	if err != nil {
+		t.Fatalf("Failed to read output.md: %v", err)
+	}
+
+	renderer, err := NewRenderer("information")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	rendered, err := renderer.RenderString(TemplateData{Contract: contract})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+
+	if rendered != string(expected) {
+		t.Errorf("Expected rendered output to match output.md\n--- got\n%s\n--- expected\n%s", rendered, expected)
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "summary.tmpl")
+	template := `{{.ID}}|{{money .Terms.Value .Terms.Currency}}|{{date .Terms.StartDate "02.01.2006"}}|` +
+		`{{with .Party "client"}}{{.Name}}{{end}}|{{len (.PartiesWithRole "Provider")}}|{{upper .Status}}`
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	renderer, err := NewRenderer(templatePath)
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	contract := &Contract{
+		ID:     "TEST-001",
+		Status: "active",
+		Parties: []Party{
+			{Name: "Test Client", Role: "Client"},
+			{Name: "Test Provider", Role: "Provider"},
+		},
+		Terms: Terms{StartDate: "2024-03-01", Value: 1234.5, Currency: "EUR"},
+	}
+	rendered, err := renderer.RenderString(TemplateData{Contract: contract})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+
+	expected := "TEST-001|1234.50 EUR|01.03.2024|Test Client|1|ACTIVE"
+	if rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
+
+func TestNewRendererErrors(t *testing.T) {
+	t.Run("UnknownTemplate", func(t *testing.T) {
+		_, err := NewRenderer("no-such-template")
+		if err == nil || !strings.Contains(err.Error(), "default") {
+			t.Errorf("Expected error listing the built-in templates, got %v", err)
+		}
+	})
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		templatePath := filepath.Join(t.TempDir(), "broken.tmpl")
+		os.WriteFile(templatePath, []byte("{{.ID"), 0644)
+		if _, err := NewRenderer(templatePath); err == nil {
+			t.Error("Expected parse error for broken template")
+		}
+	})
+}
+
+func TestResolveContracts(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.StoreContract(newTestContract("STORED-001", "active")); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	dir := t.TempDir()
+	writeSyncFile(t, dir, "a.json", newTestContract("FILE-001", "active"))
+	writeSyncFile(t, dir, "b.json", newTestContract("FILE-002", "active"))
+
+	t.Run("FilesAndIDs", func(t *testing.T) {
+		contracts, err := resolveContracts([]string{"STORED-001", dir}, store)
+		if err != nil {
+			t.Fatalf("Failed to resolve contracts: %v", err)
+		}
+		if len(contracts) != 3 || contracts[0].ID != "FILE-001" || contracts[2].ID != "STORED-001" {
+			t.Errorf("Expected FILE-001, FILE-002 and STORED-001, got %d contracts", len(contracts))
+		}
+	})
+
+	t.Run("UnknownID", func(t *testing.T) {
+		_, err := resolveContracts([]string{"MISSING"}, store)
+		if err == nil || !strings.Contains(err.Error(), "neither a contract file nor a stored contract") {
+			t.Errorf("Expected error for unknown ID, got %v", err)
+		}
+	})
+
+	t.Run("NoStore", func(t *testing.T) {
+		if _, err := resolveContracts([]string{"STORED-001"}, nil); err == nil {
+			t.Error("Expected error for an ID without a store")
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		if _, err := resolveContracts([]string{filepath.Join(dir, "a.json"), dir}, store); err == nil {
+			t.Error("Expected error for a contract given twice")
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Result formats selected with the global -output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+)
+
+// outputFormats lists the result formats in the order they are documented
+var outputFormats = []string{outputTable, outputJSON, outputJSONL, outputYAML, outputCSV}
+
+// validateOutputFormat checks a -output value
+func validateOutputFormat(format string) error {
+	for _, known := range outputFormats {
+		if format == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (use %s)", format, strings.Join(outputFormats, ", "))
+}
+
+// structuredOutput reports whether results are printed for scripts rather than people
+func structuredOutput() bool {
+	return *outputFormat != outputTable
+}
+
+// printResults writes command results to standard output in the -output format.
+// With the table format, human is called instead when it is not nil, so commands
+// keep their plain-text messages; without it the records are printed as a table.
+func printResults(records any, human func()) error {
+	if *outputFormat == outputTable && human != nil {
+		human()
+		return nil
+	}
+	return writeResults(os.Stdout, *outputFormat, records)
+}
+
+// writeResults writes records in the given format. records is a struct or a slice
+// of structs; their fields are named by their json tags. Table and CSV columns are
+// headed by the table tag of a field, or its json name, and leave out fields tagged
+// table:"-". Times are shown in RFC 3339 format there, and other values that are
+// not strings, numbers or booleans as JSON.
+func writeResults(w io.Writer, format string, records any) error {
+	switch format {
+	case outputJSON:
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding results: %v", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case outputJSONL:
+		for _, record := range resultRecords(records) {
+			data, err := json.Marshal(record.Interface())
+			if err != nil {
+				return fmt.Errorf("error encoding results: %v", err)
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputYAML:
+		return writeYAML(w, records)
+	case outputCSV:
+		columns, rows := resultTable(records)
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case outputTable:
+		columns, rows := resultTable(records)
+		return writeTable(w, columns, rows)
+	default:
+		return validateOutputFormat(format)
+	}
+}
+
+// resultRecords returns the records of a struct or a slice of structs
+func resultRecords(records any) []reflect.Value {
+	value := reflect.ValueOf(records)
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return []reflect.Value{value}
+	}
+
+	result := make([]reflect.Value, value.Len())
+	for i := range result {
+		result[i] = value.Index(i)
+	}
+	return result
+}
+
+// resultColumn is a struct field shown as a table or CSV column
+type resultColumn struct {
+	index  int
+	header string
+}
+
+// resultColumns returns the columns of a record struct type
+func resultColumns(typ reflect.Type) []resultColumn {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	var columns []resultColumn
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		header := field.Tag.Get("table")
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if header == "-" || name == "-" {
+			continue
+		}
+		if header == "" {
+			header = name
+		}
+		if header == "" {
+			header = field.Name
+		}
+		columns = append(columns, resultColumn{index: i, header: header})
+	}
+	return columns
+}
+
+// resultTable flattens records into a header and rows of cells
+func resultTable(records any) ([]string, [][]string) {
+	typ := reflect.TypeOf(records)
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	columns := resultColumns(typ)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.header
+	}
+
+	var rows [][]string
+	for _, record := range resultRecords(records) {
+		for record.Kind() == reflect.Pointer {
+			record = record.Elem()
+		}
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = resultCell(record.Field(column.index))
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+// resultCell formats a field value as a table or CSV cell
+func resultCell(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer && !value.IsNil() {
+		return resultCell(value.Elem())
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		if value.IsNil() {
+			return ""
+		}
+	}
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+	return string(data)
+}
+
+// writeTable writes an aligned table whose column widths fit the widest cell
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	widths := make([]int, len(header))
+	for i, title := range header {
+		widths[i] = utf8.RuneCountInString(title)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var buf bytes.Buffer
+	writeRow := func(cells []string) {
+		var line strings.Builder
+		for i, cell := range cells {
+			line.WriteString(cell)
+			line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+		}
+		// No padding after the last column
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteByte('\n')
+	}
+
+	upper := make([]string, len(header))
+	rules := make([]string, len(header))
+	for i, title := range header {
+		upper[i] = strings.ToUpper(title)
+		rules[i] = strings.Repeat("-", widths[i])
+	}
+	writeRow(upper)
+	writeRow(rules)
+	for _, row := range rows {
+		// Line breaks inside a cell would break the alignment
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.ReplaceAll(cell, "\n", " ")
+		}
+		writeRow(cells)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeYAML writes records as YAML with the field names and field order of their JSON encoding
+func writeYAML(w io.Writer, records any) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("error encoding results: %v", err)
+	}
+
+	// JSON is valid YAML, so parsing it keeps the keys in order
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("error encoding results: %v", err)
+	}
+	resetYAMLStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("error encoding results: %v", err)
+	}
+	return enc.Close()
+}
+
+// resetYAMLStyle switches a document parsed from JSON to block style and plain
+// scalars; the encoder still quotes strings that would otherwise change type
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
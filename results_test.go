@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRecord is a result record with the kinds of fields commands use
+type testRecord struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Value    float64  `json:"value" table:"amount"`
+	Valid    bool     `json:"valid"`
+	Tags     []string `json:"tags,omitempty"`
+	Internal string   `json:"internal" table:"-"`
+}
+
+var testRecords = []testRecord{
+	{ID: "C-1", Title: "Short", Value: 1000, Valid: true, Internal: "x"},
+	{ID: "C-10", Title: "A much longer title, with a comma", Value: 1234.5, Tags: []string{"a", "b"}},
+	{ID: "C-2", Title: "Müller \"GmbH\"", Value: 0.25, Valid: true},
+}
+
+func TestWriteResults(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{outputTable, `ID    TITLE                              AMOUNT  VALID  TAGS
+----  ---------------------------------  ------  -----  ---------
+C-1   Short                              1000    true
+C-10  A much longer title, with a comma  1234.5  false  ["a","b"]
+C-2   Müller "GmbH"                      0.25    true
+`},
+		{outputCSV, `id,title,amount,valid,tags
+C-1,Short,1000,true,
+C-10,"A much longer title, with a comma",1234.5,false,"[""a"",""b""]"
+C-2,"Müller ""GmbH""",0.25,true,
+`},
+		{outputJSONL, `{"id":"C-1","title":"Short","value":1000,"valid":true,"internal":"x"}
+{"id":"C-10","title":"A much longer title, with a comma","value":1234.5,"valid":false,"tags":["a","b"],"internal":""}
+{"id":"C-2","title":"Müller \"GmbH\"","value":0.25,"valid":true,"internal":""}
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var sb strings.Builder
+			if err := writeResults(&sb, tt.format, testRecords); err != nil {
+				t.Fatalf("Failed to write results: %v", err)
+			}
+			if sb.String() != tt.expected {
+				t.Errorf("Unexpected output\n--- got\n%s\n--- expected\n%s", sb.String(), tt.expected)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var sb strings.Builder
+		if err := writeResults(&sb, outputJSON, testRecords[:1]); err != nil {
+			t.Fatalf("Failed to write results: %v", err)
+		}
+		expected := "[\n  {\n    \"id\": \"C-1\",\n    \"title\": \"Short\",\n    \"value\": 1000,\n    \"valid\": true,\n    \"internal\": \"x\"\n  }\n]\n"
+		if sb.String() != expected {
+			t.Errorf("Unexpected output\n--- got\n%s\n--- expected\n%s", sb.String(), expected)
+		}
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		contract := &Contract{
+			ID:      "C-1",
+			Title:   "true",
+			Parties: []Party{{Name: "Ann", Role: "client", Email: "ann@example.com"}},
+			Terms:   Terms{StartDate: "2024-01-01", Value: 10, Currency: "EUR"},
+			Status:  "active",
+		}
+		var sb strings.Builder
+		if err := writeResults(&sb, outputYAML, contract); err != nil {
+			t.Fatalf("Failed to write results: %v", err)
+		}
+		// Keys keep the JSON field order and strings that look like other types stay strings
+		expected := `id: C-1
+title: "true"
+parties:
+  - name: Ann
+    role: client
+    email: ann@example.com
+terms:
+  startDate: "2024-01-01"
+  endDate: ""
+  value: 10
+  currency: EUR
+status: active
+`
+		if sb.String() != expected {
+			t.Errorf("Unexpected output\n--- got\n%s\n--- expected\n%s", sb.String(), expected)
+		}
+	})
+
+	t.Run("SingleRecordTable", func(t *testing.T) {
+		var sb strings.Builder
+		if err := writeResults(&sb, outputTable, deleteResult{ID: "C-1", Deleted: true}); err != nil {
+			t.Fatalf("Failed to write results: %v", err)
+		}
+		expected := "ID   DELETED\n---  -------\nC-1  true\n"
+		if sb.String() != expected {
+			t.Errorf("Unexpected output\n--- got\n%s\n--- expected\n%s", sb.String(), expected)
+		}
+	})
+
+	t.Run("TimeCells", func(t *testing.T) {
+		revision := ContractRevision{ID: "C-1", Version: 2, Hash: "abc", StoredAt: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}
+		var sb strings.Builder
+		if err := writeResults(&sb, outputCSV, revision); err != nil {
+			t.Fatalf("Failed to write results: %v", err)
+		}
+		expected := "id,version,hash,stored\nC-1,2,abc,2024-05-01T09:30:00Z\n"
+		if sb.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, sb.String())
+		}
+
+		// Optional times are pointers, empty while unset
+		decided := revision.StoredAt
+		requests := []ApprovalRequest{{ID: 1, Status: approvalApproved, DecidedAt: &decided}, {ID: 2, Status: approvalPending}}
+		header, rows := resultTable(requests)
+		if column := header[len(header)-1]; column != "decided" || rows[0][len(header)-1] != "2024-05-01T09:30:00Z" || rows[1][len(header)-1] != "" {
+			t.Errorf("Unexpected decision time cells %q in %v", rows, header)
+		}
+	})
+
+	t.Run("EmptyTable", func(t *testing.T) {
+		var sb strings.Builder
+		if err := writeResults(&sb, outputTable, []deleteResult{}); err != nil {
+			t.Fatalf("Failed to write results: %v", err)
+		}
+		if sb.String() != "ID  DELETED\n--  -------\n" {
+			t.Errorf("Expected only the header, got %q", sb.String())
+		}
+	})
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range outputFormats {
+		if err := validateOutputFormat(format); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", format, err)
+		}
+	}
+	if err := validateOutputFormat("xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContractRevision describes a stored version of a contract
+type ContractRevision struct {
+	ID       string    `json:"id"`
+	Version  int       `json:"version"`
+	Hash     string    `json:"hash"`
+	StoredAt time.Time `json:"storedAt" table:"stored"`
+}
+
+// RevisionStore is implemented by stores that keep every version of the contracts
+// stored in them. Versions are numbered from 1, and storing a contract without
+// changing it does not add a version.
+type RevisionStore interface {
+	ContractRevisions(id string) ([]ContractRevision, error)
+	GetContractVersion(id string, version int) (*Contract, error)
+}
+
+var (
+	_ RevisionStore = (*DB)(nil)
+	_ RevisionStore = (*MemoryStore)(nil)
+)
+
+// parseContractRef splits a reference such as CONTRACT-001@3 into the contract ID
+// and version. The version is 0 when the reference names the current contract.
+func parseContractRef(ref string) (string, int, error) {
+	id, suffix, found := strings.Cut(ref, "@")
+	if !found {
+		return ref, 0, nil
+	}
+	version, err := strconv.Atoi(suffix)
+	if err != nil || version < 1 || id == "" {
+		return "", 0, fmt.Errorf("invalid contract reference %q: expected ID or ID@version", ref)
+	}
+	return id, version, nil
+}
+
+// getContractRef retrieves the contract named by an ID or ID@version reference
+func getContractRef(store ContractStore, ref string) (*Contract, error) {
+	id, version, err := parseContractRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return store.GetContract(id)
+	}
+
+	revisions, ok := asRevisionStore(store)
+	if !ok {
+		return nil, fmt.Errorf("cannot load %s: the contract store does not keep contract versions", ref)
+	}
+	return revisions.GetContractVersion(id, version)
+}
+
+// runHistory implements the history command
+func runHistory(args []string) error {
+	fs := newFlagSet("history")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("history requires exactly one contract ID")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	revisionStore, ok := asRevisionStore(store)
+	if !ok {
+		return fmt.Errorf("the contract store does not keep contract versions")
+	}
+	revisions, err := revisionStore.ContractRevisions(positional[0])
+	if errors.Is(err, ErrContractNotFound) {
+		return fmt.Errorf("no versions of contract %s are stored", positional[0])
+	} else if err != nil {
+		return err
+	}
+	return printResults(revisions, nil)
+}
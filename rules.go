@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ErrRuleViolation is returned when a contract that fails a business rule with error severity is stored
+var ErrRuleViolation = errors.New("business rule violated")
+
+// Rule severities
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// ruleIDPattern matches valid rule IDs
+var ruleIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ruleRoot is what rule expressions see: the fields of the contract and, under
+// latest, the contract with every amendment applied
+type ruleRoot struct {
+	Contract
+	Latest Contract `json:"latest"`
+}
+
+// BusinessRule is a check of contract fields defined in a rule config, evaluated
+// after the checks of Contract.Validate
+type BusinessRule struct {
+	ID string `json:"id"`
+	// Severity is error (the default), which makes a contract invalid, warning or info
+	Severity string `json:"severity,omitempty"`
+	// When, if set, limits the rule to contracts for which this expression is true
+	When string `json:"when,omitempty"`
+	// Check is the expression that must be true
+	Check string `json:"check"`
+	// Message explains a contract that fails the check
+	Message string `json:"message,omitempty"`
+
+	when, check exprNode
+}
+
+// compile validates the rule and compiles its expressions
+func (r *BusinessRule) compile() error {
+	if !ruleIDPattern.MatchString(r.ID) {
+		return fmt.Errorf("invalid rule ID %q: use letters, digits, ., - and _", r.ID)
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = severityError
+	case severityError, severityWarning, severityInfo:
+	default:
+		return fmt.Errorf("rule %s: unknown severity %q (use %s, %s or %s)", r.ID, r.Severity, severityError, severityWarning, severityInfo)
+	}
+	if r.Check == "" {
+		return fmt.Errorf("rule %s: check is required", r.ID)
+	}
+	if r.Message == "" {
+		r.Message = r.Check + " does not hold"
+	}
+
+	var err error
+	if r.When != "" {
+		if r.when, err = compileCondition(r.When); err != nil {
+			return fmt.Errorf("rule %s: when: %v", r.ID, err)
+		}
+	}
+	if r.check, err = compileCondition(r.Check); err != nil {
+		return fmt.Errorf("rule %s: check: %v", r.ID, err)
+	}
+	return nil
+}
+
+// compileCondition compiles an expression over contract fields that must be true or false
+func compileCondition(src string) (exprNode, error) {
+	node, typ, err := compileExpr(src, reflect.TypeOf(ruleRoot{}))
+	if err != nil {
+		return nil, err
+	}
+	if typ != typeBool {
+		return nil, fmt.Errorf("expected a condition, got a %s expression", typ)
+	}
+	return node, nil
+}
+
+// RuleViolation is a rule a contract fails
+type RuleViolation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// RuleConfig holds the business rules of the config file
+type RuleConfig struct {
+	Rules []*BusinessRule `json:"rules"`
+}
+
+// LoadRuleConfig reads a rule config file and compiles its rules
+func LoadRuleConfig(path string) (*RuleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rule config: %v", err)
+	}
+
+	var config RuleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing rule config %s: %v", path, err)
+	}
+	ids := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule config %s: %v", path, err)
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("invalid rule config %s: rule %s appears more than once", path, rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+	return &config, nil
+}
+
+// Evaluate returns the rules the contract fails, in the order of the config. A
+// rule that cannot be evaluated, for example because of a malformed date, fails
+// with an error. It returns nothing for a nil config.
+func (c *RuleConfig) Evaluate(contract *Contract) ([]RuleViolation, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	// Rules see the contract as JSON, so fields are named as in contract files
+	data, err := json.Marshal(ruleRoot{Contract: *contract, Latest: *contract.latestTerms()})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling contract: %v", err)
+	}
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error unmarshaling contract: %v", err)
+	}
+	frames := []any{root}
+
+	var violations []RuleViolation
+	for _, rule := range c.Rules {
+		passed, err := rule.evaluate(frames)
+		if err != nil {
+			violations = append(violations, RuleViolation{Rule: rule.ID, Severity: severityError, Message: fmt.Sprintf("cannot be evaluated: %v", err)})
+		} else if !passed {
+			violations = append(violations, RuleViolation{Rule: rule.ID, Severity: rule.Severity, Message: rule.Message})
+		}
+	}
+	return violations, nil
+}
+
+// evaluate reports whether a contract passes the rule, which it does when the
+// rule's when condition is false
+func (r *BusinessRule) evaluate(frames []any) (bool, error) {
+	if r.when != nil {
+		applies, err := r.when.eval(frames)
+		if err != nil {
+			return false, err
+		}
+		if !applies.(bool) {
+			return true, nil
+		}
+	}
+	passed, err := r.check.eval(frames)
+	if err != nil {
+		return false, err
+	}
+	return passed.(bool), nil
+}
+
+// ruleError returns an error listing the violations with error severity, or nil
+// when there are none
+func ruleError(violations []RuleViolation) error {
+	var failed []string
+	for _, v := range violations {
+		if v.Severity == severityError {
+			failed = append(failed, fmt.Sprintf("rule %s: %s", v.Rule, v.Message))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(failed, "; "))
+}
+
+// loadRulesFlag loads the -rules config, or returns nil when none is given
+func loadRulesFlag() (*RuleConfig, error) {
+	if *rulesConfigPath == "" {
+		return nil, nil
+	}
+	return LoadRuleConfig(*rulesConfigPath)
+}
+
+// RuleStore is a ContractStore that refuses contracts failing a business rule with
+// error severity and reports the rules with warning severity they fail
+type RuleStore struct {
+	ContractStore
+	rules *RuleConfig
+	warn  func(message string)
+}
+
+// NewRuleStore wraps a store so that contracts stored through it are checked against the rules
+func NewRuleStore(store ContractStore, rules *RuleConfig) *RuleStore {
+	return &RuleStore{ContractStore: store, rules: rules, warn: printWarning}
+}
+
+// Unwrap returns the wrapped store
+func (s *RuleStore) Unwrap() ContractStore {
+	return s.ContractStore
+}
+
+// StoreContract stores the contract unless it fails a rule with error severity.
+// Failed warnings are reported once the contract is stored.
+func (s *RuleStore) StoreContract(contract *Contract) error {
+	violations, err := s.rules.Evaluate(contract)
+	if err != nil {
+		return err
+	}
+	if err := ruleError(violations); err != nil {
+		return fmt.Errorf("%w: %s fails %v", ErrRuleViolation, contract.ID, err)
+	}
+	if err := s.ContractStore.StoreContract(contract); err != nil {
+		return err
+	}
+	for _, v := range violations {
+		if v.Severity == severityWarning {
+			s.warn(fmt.Sprintf("%s fails rule %s: %s", contract.ID, v.Rule, v.Message))
+		}
+	}
+	return nil
+}
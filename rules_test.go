@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRuleConfig writes a rule config file and returns its path
+func writeRuleConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write rule config: %v", err)
+	}
+	return path
+}
+
+func TestLoadRuleConfig(t *testing.T) {
+	t.Run("Repository", func(t *testing.T) {
+		config, err := LoadRuleConfig("rules.json")
+		if err != nil {
+			t.Fatalf("Failed to load rule config: %v", err)
+		}
+		if len(config.Rules) == 0 {
+			t.Errorf("Expected rules")
+		}
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		config, err := LoadRuleConfig(writeRuleConfig(t, `{"rules":[{"id":"has-end","check":"terms.endDate != ''"}]}`))
+		if err != nil {
+			t.Fatalf("Failed to load rule config: %v", err)
+		}
+		if rule := config.Rules[0]; rule.Severity != severityError || rule.Message != "terms.endDate != '' does not hold" {
+			t.Errorf("Expected the default severity and message, got %+v", rule)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"NoID", `{"rules":[{"check":"true"}]}`, `invalid rule ID ""`},
+		{"RepeatedID", `{"rules":[{"id":"a","check":"true"},{"id":"a","check":"true"}]}`, "rule a appears more than once"},
+		{"Severity", `{"rules":[{"id":"a","severity":"fatal","check":"true"}]}`, `rule a: unknown severity "fatal"`},
+		{"NoCheck", `{"rules":[{"id":"a"}]}`, "rule a: check is required"},
+		{"NotACondition", `{"rules":[{"id":"a","check":"terms.value"}]}`, "rule a: check: expected a condition, got a number expression"},
+		{"When", `{"rules":[{"id":"a","when":"terms.amount > 1","check":"true"}]}`, "rule a: when: column 1: unknown field terms.amount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadRuleConfig(writeRuleConfig(t, tt.config)); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	config, err := LoadRuleConfig("rules.json")
+	if err != nil {
+		t.Fatalf("Failed to load rule config: %v", err)
+	}
+
+	large := newTestContract("TEST-001", "active")
+	large.Amendments[1].Changes.Value = floatPtr(150000)
+	euro := newTestContract("TEST-001", "active")
+	euro.Terms.Currency = "EUR"
+	long := newTestContract("TEST-001", "active")
+	long.Amendments[0].Changes.EndDate = stringPtr("2027-06-30")
+	legal := newTestContract("TEST-001", "active")
+	legal.Terms.Value = 200000
+	legal.Parties = append(legal.Parties, Party{Name: "Counsel", Role: "legal"})
+	broken := newTestContract("TEST-001", "active")
+	broken.Terms.StartDate = "01/01/2024"
+
+	tests := []struct {
+		name     string
+		contract *Contract
+		expected []string
+	}{
+		{"Passes", newTestContract("TEST-001", "active"), nil},
+		{"ValueAfterAmendment", large, []string{"error legal-party-over-100k"}},
+		{"LegalParty", legal, nil},
+		{"Warning", euro, []string{"warning eur-vat-id"}},
+		{"TermWithExtension", long, []string{"error max-term-3-years"}},
+		{"Unevaluable", broken, []string{"error max-term-3-years"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := config.Evaluate(tt.contract)
+			if err != nil {
+				t.Fatalf("Failed to evaluate rules: %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Severity+" "+v.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected violations %v, got %+v", tt.expected, violations)
+			}
+		})
+	}
+
+	t.Run("Messages", func(t *testing.T) {
+		violations, _ := config.Evaluate(broken)
+		if len(violations) != 1 || violations[0].Message != `cannot be evaluated: invalid date "01/01/2024"` {
+			t.Errorf("Expected the evaluation error as message, got %+v", violations)
+		}
+		err := ruleError([]RuleViolation{
+			{Rule: "a", Severity: severityError, Message: "first"},
+			{Rule: "b", Severity: severityWarning, Message: "second"},
+			{Rule: "c", Severity: severityError, Message: "third"},
+		})
+		if err == nil || err.Error() != "rule a: first; rule c: third" {
+			t.Errorf("Expected the errors to be listed, got %v", err)
+		}
+		if err := ruleError([]RuleViolation{{Rule: "b", Severity: severityInfo}}); err != nil {
+			t.Errorf("Expected no error without error violations, got %v", err)
+		}
+	})
+
+	t.Run("NilConfig", func(t *testing.T) {
+		var none *RuleConfig
+		if violations, err := none.Evaluate(large); violations != nil || err != nil {
+			t.Errorf("Expected no violations without rules, got %+v: %v", violations, err)
+		}
+	})
+}
+
+func TestRuleStore(t *testing.T) {
+	config, err := LoadRuleConfig("rules.json")
+	if err != nil {
+		t.Fatalf("Failed to load rule config: %v", err)
+	}
+	memory := NewMemoryStore()
+	store := NewRuleStore(memory, config)
+	var warnings []string
+	store.warn = func(message string) { warnings = append(warnings, message) }
+
+	large := newTestContract("TEST-001", "active")
+	large.Amendments[1].Changes.Value = floatPtr(150000)
+	err = store.StoreContract(large)
+	if !errors.Is(err, ErrRuleViolation) || !strings.Contains(err.Error(), "TEST-001 fails rule legal-party-over-100k") {
+		t.Errorf("Expected a rule violation, got %v", err)
+	}
+	if _, err := memory.GetContract(large.ID); !errors.Is(err, ErrContractNotFound) {
+		t.Errorf("Expected the contract not to be stored, got %v", err)
+	}
+
+	euro := newTestContract("TEST-001", "active")
+	euro.Terms.Currency = "EUR"
+	if err := store.StoreContract(euro); err != nil {
+		t.Fatalf("Expected a warning not to keep the contract from being stored: %v", err)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "TEST-001 fails rule eur-vat-id") {
+		t.Errorf("Expected the warning to be reported, got %q", warnings)
+	}
+}
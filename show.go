@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runShow implements the show command
+func runShow(args []string) error {
+	fs := newFlagSet("show")
+	templateName := fs.String("template", DefaultTemplate, "Built-in template name or path to a template file")
+	asOf := fs.String("as-of", "", "Show the terms in effect on this date (YYYY-MM-DD)")
+	localeTag := fs.String("locale", "", "Show labels, dates and amounts for a locale such as de-DE or en-US")
+	redact := fs.String("redact", "", "Hide fields using this policy from the -redaction-config file, e.g. external")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("show requires exactly one contract ID")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	contract, err := store.GetContract(positional[0])
+	if err != nil {
+		return err
+	}
+
+	locale, err := loadLocaleFlag(*localeTag)
+	if err != nil {
+		return err
+	}
+	redaction, err := loadRedactionFlag(*redact)
+	if err != nil {
+		return err
+	}
+	prepare, err := templateDataFor(*asOf, locale, redaction)
+	if err != nil {
+		return err
+	}
+	data := prepare(contract)
+
+	if structuredOutput() {
+		return printResults(data.Contract, nil)
+	}
+
+	renderer, err := NewRenderer(*templateName)
+	if err != nil {
+		return err
+	}
+	return renderer.Render(os.Stdout, data)
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signature statuses reported by VerifySignatures
+const (
+	signatureValid    = "valid"
+	signatureInvalid  = "invalid"
+	signatureUnsigned = "unsigned"
+)
+
+// Signature is a party's Ed25519 signature of the canonical JSON of a contract
+type Signature struct {
+	// Party is the name of the signing party
+	Party string `json:"party"`
+	// PublicKey is the base64 encoded Ed25519 public key the signature verifies with
+	PublicKey string `json:"publicKey"`
+	// Value is the base64 encoded signature
+	Value string `json:"signature"`
+	// SignedAt records when the party signed; it is not covered by the signature
+	SignedAt time.Time `json:"signedAt"`
+}
+
+// Fingerprint returns the first 16 hex digits of the SHA-256 hash of the public key,
+// for comparing the key with the one a party is known to use
+func (s Signature) Fingerprint() string {
+	key, err := base64.StdEncoding.DecodeString(s.PublicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CanonicalJSON returns the encoding of a contract that parties sign: its JSON
+// without the signatures and the status, with object keys sorted, no insignificant
+// whitespace and no HTML escaping. Members whose value is null or an empty array are
+// left out, so that a missing list and an empty one give the same encoding. Like
+// approvals, signatures survive status changes, so a signed draft can be activated.
+func CanonicalJSON(c *Contract) ([]byte, error) {
+	unsigned := *c
+	unsigned.Signatures = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling contract: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value map[string]any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("error decoding contract: %v", err)
+	}
+	delete(value, "status")
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// Maps are encoded with sorted keys
+	if err := encoder.Encode(pruneEmpty(value)); err != nil {
+		return nil, fmt.Errorf("error encoding contract: %v", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// pruneEmpty removes object members that are null or empty arrays from a decoded JSON value
+func pruneEmpty(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if list, ok := member.([]any); member == nil || (ok && len(list) == 0) {
+				delete(v, key)
+				continue
+			}
+			v[key] = pruneEmpty(member)
+		}
+	case []any:
+		for i := range v {
+			v[i] = pruneEmpty(v[i])
+		}
+	}
+	return value
+}
+
+// findParty returns the party with the given name or email address, ignoring case
+func findParty(c *Contract, nameOrEmail string) (Party, bool) {
+	for _, party := range c.Parties {
+		if strings.EqualFold(party.Name, nameOrEmail) || (party.Email != "" && strings.EqualFold(party.Email, nameOrEmail)) {
+			return party, true
+		}
+	}
+	return Party{}, false
+}
+
+// SignContract signs the canonical JSON of the contract for a party, given by name
+// or email address, replacing the party's earlier signature
+func SignContract(c *Contract, nameOrEmail string, key ed25519.PrivateKey, now time.Time) error {
+	party, ok := findParty(c, nameOrEmail)
+	if !ok {
+		return fmt.Errorf("contract %s has no party %q", c.ID, nameOrEmail)
+	}
+	data, err := CanonicalJSON(c)
+	if err != nil {
+		return err
+	}
+
+	signature := Signature{
+		Party:     party.Name,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+		SignedAt:  now.UTC().Truncate(time.Second),
+	}
+	for i, existing := range c.Signatures {
+		if existing.Party == party.Name {
+			c.Signatures[i] = signature
+			return nil
+		}
+	}
+	c.Signatures = append(c.Signatures, signature)
+	return nil
+}
+
+// TrustedKeys pins the Ed25519 public key of each party that signs contracts.
+// A signature only counts when it verifies with the key pinned for its party, so
+// that whoever can change a stored contract cannot sign it again with a key of
+// their own.
+type TrustedKeys struct {
+	// Parties maps a party's name or email address to its base64 encoded public key
+	Parties map[string]string `json:"parties"`
+}
+
+// LoadTrustedKeys reads and validates a trusted key file
+func LoadTrustedKeys(path string) (*TrustedKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading trusted keys: %v", err)
+	}
+
+	var keys TrustedKeys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing trusted keys %s: %v", path, err)
+	}
+	for party, encoded := range keys.Parties {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid trusted keys %s: the key of %s is not a base64 encoded Ed25519 public key", path, party)
+		}
+	}
+	return &keys, nil
+}
+
+// keyFor returns the base64 encoded key pinned for a party, looked up by email
+// address and then by name, ignoring case. It is empty for a nil TrustedKeys.
+func (k *TrustedKeys) keyFor(party Party) string {
+	if k == nil {
+		return ""
+	}
+	for _, nameOrEmail := range []string{party.Email, party.Name} {
+		if nameOrEmail == "" {
+			continue
+		}
+		for pinned, key := range k.Parties {
+			if strings.EqualFold(pinned, nameOrEmail) {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// checkKey returns an error unless the public key is the one pinned for the party
+func (k *TrustedKeys) checkKey(party Party, publicKey string) error {
+	pinned := k.keyFor(party)
+	if pinned == "" {
+		return fmt.Errorf("no trusted key for %s", party.Name)
+	}
+	if pinned != publicKey {
+		return fmt.Errorf("key %s is not the trusted key of %s", Signature{PublicKey: publicKey}.Fingerprint(), party.Name)
+	}
+	return nil
+}
+
+// SignatureStatus reports whether a party has validly signed the current content of a contract
+type SignatureStatus struct {
+	Party string `json:"party"`
+	// Status is valid, invalid or unsigned
+	Status      string `json:"status"`
+	Fingerprint string `json:"fingerprint,omitempty" table:"key"`
+	// SignedAt is when the party signed in RFC 3339 format, empty when it has not
+	SignedAt string `json:"signedAt,omitempty" table:"signed"`
+	// Problem explains why a signature is invalid
+	Problem string `json:"problem,omitempty"`
+}
+
+// VerifySignatures checks every signature against the current content of the
+// contract and the key trusted for its party, and returns a status for each party,
+// in the order of the parties, followed by the signatures of names that are no
+// longer a party. A signature made with any other key than the trusted one is
+// invalid, as is every signature when trusted is nil.
+func VerifySignatures(c *Contract, trusted *TrustedKeys) ([]SignatureStatus, error) {
+	data, err := CanonicalJSON(c)
+	if err != nil {
+		return nil, err
+	}
+
+	check := func(party Party, s Signature) SignatureStatus {
+		status := SignatureStatus{Party: s.Party, Status: signatureInvalid, Fingerprint: s.Fingerprint(), SignedAt: s.SignedAt.Format(time.RFC3339)}
+		if err := trusted.checkKey(party, s.PublicKey); err != nil {
+			status.Problem = err.Error()
+			return status
+		}
+		key, keyErr := base64.StdEncoding.DecodeString(s.PublicKey)
+		value, valueErr := base64.StdEncoding.DecodeString(s.Value)
+		if keyErr != nil || valueErr != nil || len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, data, value) {
+			status.Problem = "the contract changed after signing, or the signature is corrupt"
+			return status
+		}
+		status.Status = signatureValid
+		return status
+	}
+
+	var statuses []SignatureStatus
+	signed := make(map[string]bool)
+	for _, party := range c.Parties {
+		status := SignatureStatus{Party: party.Name, Status: signatureUnsigned}
+		for _, s := range c.Signatures {
+			if s.Party == party.Name {
+				status = check(party, s)
+				signed[s.Party] = true
+				break
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	for _, s := range c.Signatures {
+		if !signed[s.Party] {
+			// A signature of someone who is not a party does not count
+			status := SignatureStatus{Party: s.Party, Status: signatureInvalid, Fingerprint: s.Fingerprint(),
+				SignedAt: s.SignedAt.Format(time.RFC3339), Problem: "not a party of the contract"}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// loadSigningKey reads an Ed25519 private key from a PEM file in PKCS #8 format,
+// as written by: openssl genpkey -algorithm ed25519
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid key %s: expected a PEM encoded PRIVATE KEY", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %s: %v", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid key %s: expected an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// runSign implements the sign command
+func runSign(args []string) error {
+	fs := newFlagSet("sign")
+	keyPath := fs.String("key", "", "Ed25519 private key of the signing party (PEM, PKCS #8)")
+	party := fs.String("party", "", "Name or email address of the signing party")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("sign requires exactly one contract ID")
+	}
+	if *keyPath == "" || *party == "" {
+		return fmt.Errorf("sign requires -key and -party")
+	}
+
+	key, err := loadSigningKey(*keyPath)
+	if err != nil {
+		return err
+	}
+	trusted, err := LoadTrustedKeys(*trustedKeysPath)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	contract, err := store.GetContract(positional[0])
+	if err != nil {
+		return err
+	}
+	// Refuse a signature that verify would report as invalid
+	if signer, ok := findParty(contract, *party); ok {
+		publicKey := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		if err := trusted.checkKey(signer, publicKey); err != nil {
+			return fmt.Errorf("%v: pin the party's public key %s in %s first", err, publicKey, *trustedKeysPath)
+		}
+	}
+	if err := SignContract(contract, *party, key, time.Now()); err != nil {
+		return err
+	}
+	if err := store.StoreContract(contract); err != nil {
+		return err
+	}
+
+	statuses, err := VerifySignatures(contract, trusted)
+	if err != nil {
+		return err
+	}
+	signer, _ := findParty(contract, *party)
+	for _, status := range statuses {
+		if status.Party == signer.Name {
+			return printResults(status, func() {
+				fmt.Printf("Contract %s signed by %s with key %s\n", contract.ID, status.Party, status.Fingerprint)
+			})
+		}
+	}
+	return nil
+}
+
+// runVerify implements the verify command
+func runVerify(args []string) error {
+	fs := newFlagSet("verify")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("verify requires exactly one contract ID")
+	}
+
+	trusted, err := LoadTrustedKeys(*trustedKeysPath)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	contract, err := store.GetContract(positional[0])
+	if err != nil {
+		return err
+	}
+	statuses, err := VerifySignatures(contract, trusted)
+	if err != nil {
+		return err
+	}
+	if statuses == nil {
+		statuses = []SignatureStatus{}
+	}
+
+	valid := 0
+	for _, status := range statuses {
+		if status.Status == signatureValid {
+			valid++
+		}
+	}
+	err = printResults(statuses, func() {
+		if len(statuses) > 0 {
+			writeResults(os.Stdout, outputTable, statuses)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// A non-zero exit status lets scripts require a fully signed, unmodified contract
+	if valid < len(contract.Parties) {
+		return fmt.Errorf("%d of %d parties have validly signed contract %s", valid, len(contract.Parties), contract.ID)
+	}
+	if extra := len(statuses) - len(contract.Parties); extra > 0 {
+		return fmt.Errorf("contract %s has %d signature(s) of names that are not a party", contract.ID, extra)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestKey generates an Ed25519 key or fails the test
+func newTestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+// trustKeys pins the public keys of parties given by name or email address
+func trustKeys(keys map[string]ed25519.PrivateKey) *TrustedKeys {
+	trusted := &TrustedKeys{Parties: make(map[string]string)}
+	for party, key := range keys {
+		trusted.Parties[party] = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	return trusted
+}
+
+// signatureStatuses formats the result of VerifySignatures as party=status pairs
+func signatureStatuses(t *testing.T, c *Contract, trusted *TrustedKeys) string {
+	t.Helper()
+	statuses, err := VerifySignatures(c, trusted)
+	if err != nil {
+		t.Fatalf("Failed to verify signatures: %v", err)
+	}
+	var pairs []string
+	for _, status := range statuses {
+		pairs = append(pairs, status.Party+"="+status.Status)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	contract := &Contract{
+		ID:      "TEST-001",
+		Title:   "R&D <Services>",
+		Status:  "active",
+		Parties: []Party{{Name: "Test Client", Role: "Client"}},
+		Terms:   Terms{StartDate: "2024-01-01", EndDate: "2024-12-31", Value: 1000.5, Currency: "USD"},
+	}
+	expected := `{"id":"TEST-001","parties":[{"email":"","name":"Test Client","role":"Client"}],` +
+		`"terms":{"currency":"USD","endDate":"2024-12-31","startDate":"2024-01-01","value":1000.5},"title":"R&D <Services>"}`
+
+	got, err := CanonicalJSON(contract)
+	if err != nil {
+		t.Fatalf("Failed to encode contract: %v", err)
+	}
+	if string(got) != expected {
+		t.Errorf("Unexpected canonical JSON\n--- got\n%s\n--- expected\n%s", got, expected)
+	}
+
+	t.Run("IgnoresSignaturesAndStatus", func(t *testing.T) {
+		signed := *contract
+		signed.Signatures = []Signature{{Party: "Test Client", PublicKey: "a2V5", Value: "c2ln"}}
+		signed.Status = "pending"
+		if got, _ := CanonicalJSON(&signed); string(got) != expected {
+			t.Errorf("Expected signatures and the status not to change the canonical JSON, got %s", got)
+		}
+		if len(signed.Signatures) != 1 {
+			t.Errorf("Expected the contract's signatures to be kept")
+		}
+	})
+
+	t.Run("EmptyListsAreLeftOut", func(t *testing.T) {
+		empty := *contract
+		empty.Amendments = []Amendment{}
+		empty.Terms.Payments = []Payment{}
+		if got, _ := CanonicalJSON(&empty); string(got) != expected {
+			t.Errorf("Expected empty lists to be left out, got %s", got)
+		}
+
+		noParties := *contract
+		noParties.Parties = nil
+		withEmpty := *contract
+		withEmpty.Parties = []Party{}
+		a, _ := CanonicalJSON(&noParties)
+		b, _ := CanonicalJSON(&withEmpty)
+		if string(a) != string(b) || strings.Contains(string(a), "parties") {
+			t.Errorf("Expected missing and empty parties to encode alike, got %s and %s", a, b)
+		}
+	})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	clientKey, providerKey := newTestKey(t), newTestKey(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = append(contract.Parties, Party{Name: "Test Provider", Role: "Provider", Email: "provider@example.com"})
+	trusted := trustKeys(map[string]ed25519.PrivateKey{"client@example.com": clientKey, "Test Provider": providerKey})
+
+	if got := signatureStatuses(t, contract, trusted); got != "Test Client=unsigned,Test Provider=unsigned" {
+		t.Errorf("Unexpected statuses before signing: %s", got)
+	}
+
+	if err := SignContract(contract, "CLIENT@example.com", clientKey, now); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := SignContract(contract, "test provider", providerKey, now); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if got := signatureStatuses(t, contract, trusted); got != "Test Client=valid,Test Provider=valid" {
+		t.Errorf("Unexpected statuses after signing: %s", got)
+	}
+	if contract.Signatures[0].Party != "Test Client" || !contract.Signatures[0].SignedAt.Equal(now) {
+		t.Errorf("Unexpected signature %+v", contract.Signatures[0])
+	}
+
+	t.Run("UnknownParty", func(t *testing.T) {
+		if err := SignContract(contract, "Someone Else", clientKey, now); err == nil || !strings.Contains(err.Error(), `no party "Someone Else"`) {
+			t.Errorf("Expected an unknown party error, got %v", err)
+		}
+	})
+
+	t.Run("ChangedAfterSigning", func(t *testing.T) {
+		changed, _ := copyContract(contract)
+		changed.Terms.Value = 999999
+		if got := signatureStatuses(t, changed, trusted); got != "Test Client=invalid,Test Provider=invalid" {
+			t.Errorf("Expected both signatures to be invalid, got %s", got)
+		}
+
+		// Signing again covers the new content
+		if err := SignContract(changed, "Test Client", clientKey, now); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		if got := signatureStatuses(t, changed, trusted); got != "Test Client=valid,Test Provider=invalid" {
+			t.Errorf("Expected only the new signature to be valid, got %s", got)
+		}
+		if len(changed.Signatures) != 2 {
+			t.Errorf("Expected signing again to replace the earlier signature, got %d signatures", len(changed.Signatures))
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		forged, _ := copyContract(contract)
+		forged.Signatures[1].PublicKey = forged.Signatures[0].PublicKey
+		if got := signatureStatuses(t, forged, trusted); got != "Test Client=valid,Test Provider=invalid" {
+			t.Errorf("Expected the signature with the wrong key to be invalid, got %s", got)
+		}
+	})
+
+	t.Run("SignedAgainWithOtherKeys", func(t *testing.T) {
+		forged, _ := copyContract(contract)
+		forged.Terms.Value = 1
+		for _, party := range forged.Parties {
+			if err := SignContract(forged, party.Name, newTestKey(t), now); err != nil {
+				t.Fatalf("Failed to sign: %v", err)
+			}
+		}
+		statuses, err := VerifySignatures(forged, trusted)
+		if err != nil {
+			t.Fatalf("Failed to verify signatures: %v", err)
+		}
+		for _, status := range statuses {
+			if status.Status != signatureInvalid || !strings.Contains(status.Problem, "is not the trusted key of "+status.Party) {
+				t.Errorf("Expected a signature with another key to be invalid, got %+v", status)
+			}
+		}
+	})
+
+	t.Run("NoTrustedKey", func(t *testing.T) {
+		if got := signatureStatuses(t, contract, trustKeys(map[string]ed25519.PrivateKey{"TEST CLIENT": clientKey})); got != "Test Client=valid,Test Provider=invalid" {
+			t.Errorf("Expected a party without a trusted key to be invalid, got %s", got)
+		}
+		if got := signatureStatuses(t, contract, nil); got != "Test Client=invalid,Test Provider=invalid" {
+			t.Errorf("Expected every signature to be invalid without trusted keys, got %s", got)
+		}
+	})
+
+	t.Run("CorruptSignature", func(t *testing.T) {
+		corrupt, _ := copyContract(contract)
+		corrupt.Signatures[0].Value = "not base64!"
+		corrupt.Signatures[1].PublicKey = "c2hvcnQ="
+		if got := signatureStatuses(t, corrupt, trusted); got != "Test Client=invalid,Test Provider=invalid" {
+			t.Errorf("Expected corrupt signatures to be invalid, got %s", got)
+		}
+	})
+
+	t.Run("SignatureOfFormerParty", func(t *testing.T) {
+		removed, _ := copyContract(contract)
+		removed.Parties = removed.Parties[:1]
+		if got := signatureStatuses(t, removed, trusted); got != "Test Client=invalid,Test Provider=invalid" {
+			t.Errorf("Expected the signatures to be invalid once a party is removed, got %s", got)
+		}
+	})
+}
+
+func TestSignedContractActivation(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	gate := NewApprovalGate(db, db, testApprovalConfig)
+
+	// The parties sign the draft, which is then approved and activated
+	key := newTestKey(t)
+	draft := newTestContract("TEST-001", "pending")
+	draft.Amendments = nil
+	draft.Terms.Value, draft.Terms.Currency = 60000, "EUR"
+	if err := SignContract(draft, "Test Client", key, time.Now()); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := gate.StoreContract(draft); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	requests, err := testApprovalConfig.Requests(draft)
+	if err != nil {
+		t.Fatalf("Failed to get required approvals: %v", err)
+	}
+	if err := db.RequestApprovals(draft.ID, requests); err != nil {
+		t.Fatalf("Failed to request approvals: %v", err)
+	}
+	approveAll(t, db, requests)
+	draft.Status = activeStatus
+	if err := gate.StoreContract(draft); err != nil {
+		t.Fatalf("Failed to activate contract: %v", err)
+	}
+
+	active, err := db.GetContract(draft.ID)
+	if err != nil {
+		t.Fatalf("Failed to get contract: %v", err)
+	}
+	trusted := trustKeys(map[string]ed25519.PrivateKey{"Test Client": key})
+	if got := signatureStatuses(t, active, trusted); got != "Test Client=valid" {
+		t.Errorf("Expected the signature to stay valid after activation, got %s", got)
+	}
+}
+
+// testSignedContractStore checks that signatures stay valid after a signed contract is stored and read back
+func testSignedContractStore(t *testing.T, store ContractStore) {
+	contract := newTestContract("TEST-001", "active")
+	contract.Parties = append(contract.Parties,
+		Party{Name: "Test Provider", Role: "Provider", Email: "provider@example.com"},
+		Party{Name: "No Email", Role: "Witness"},
+	)
+	contract.Terms.Payments = []Payment{
+		{DueDate: "2024-01-15", Amount: 600, Description: "First installment", PaidDate: "2024-01-12"},
+		{DueDate: "2024-07-15", Amount: 600, Description: "Second installment"},
+	}
+	keys := make(map[string]ed25519.PrivateKey)
+	for _, party := range contract.Parties {
+		keys[party.Name] = newTestKey(t)
+		if err := SignContract(contract, party.Name, keys[party.Name], time.Now()); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+	}
+	if err := store.StoreContract(contract); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+
+	stored, err := store.GetContract(contract.ID)
+	if err != nil {
+		t.Fatalf("Failed to get contract: %v", err)
+	}
+	if got := signatureStatuses(t, stored, trustKeys(keys)); got != "Test Client=valid,Test Provider=valid,No Email=valid" {
+		t.Errorf("Expected the signatures to stay valid after storing, got %s", got)
+	}
+}
+
+func TestSignaturesSurviveStores(t *testing.T) {
+	t.Run("SQLite", func(t *testing.T) {
+		db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+		testSignedContractStore(t, db)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		testSignedContractStore(t, NewMemoryStore())
+	})
+
+	t.Run("Dir", func(t *testing.T) {
+		dirStore, err := OpenDirStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open directory store: %v", err)
+		}
+		testSignedContractStore(t, dirStore)
+	})
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	key := newTestKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	path := filepath.Join(dir, "party.key")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	loaded, err := loadSigningKey(path)
+	if err != nil || !loaded.Equal(key) {
+		t.Errorf("Expected the key to load, got %v", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.key")
+	os.WriteFile(invalid, []byte("not a key"), 0600)
+	if _, err := loadSigningKey(invalid); err == nil || !strings.Contains(err.Error(), "expected a PEM encoded PRIVATE KEY") {
+		t.Errorf("Expected an invalid key error, got %v", err)
+	}
+	if _, err := loadSigningKey(filepath.Join(dir, "missing.key")); err == nil {
+		t.Errorf("Expected an error for a missing key")
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "trusted-keys.json")
+		os.WriteFile(path, []byte(content), 0600)
+		return path
+	}
+	key := newTestKey(t)
+	encoded := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	trusted, err := LoadTrustedKeys(write(`{"parties": {"Client@Example.com": "` + encoded + `"}}`))
+	if err != nil {
+		t.Fatalf("Failed to load trusted keys: %v", err)
+	}
+	if got := trusted.keyFor(Party{Name: "Test Client", Email: "client@example.com"}); got != encoded {
+		t.Errorf("Expected the key to be found by email address, got %q", got)
+	}
+	if got := trusted.keyFor(Party{Name: "Client@Example.com"}); got != encoded {
+		t.Errorf("Expected the key to be found by name, got %q", got)
+	}
+	if got := trusted.keyFor(Party{Name: "Test Provider", Email: "provider@example.com"}); got != "" {
+		t.Errorf("Expected no key for another party, got %q", got)
+	}
+
+	if _, err := LoadTrustedKeys(write(`{"parties": {"Test Client": "c2hvcnQ="}}`)); err == nil || !strings.Contains(err.Error(), "the key of Test Client is not a base64 encoded Ed25519 public key") {
+		t.Errorf("Expected an invalid key error, got %v", err)
+	}
+	if _, err := LoadTrustedKeys(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrContractNotFound is returned by stores when no contract has the requested ID
+var ErrContractNotFound = errors.New("contract not found")
+
+// ContractStore is implemented by every contract storage backend
+type ContractStore interface {
+	StoreContract(contract *Contract) error
+	GetContract(id string) (*Contract, error)
+	GetAllContracts() ([]*Contract, error)
+	DeleteContract(id string) error
+	Close() error
+}
+
+var (
+	_ ContractStore = (*DB)(nil)
+	_ ContractStore = (*MemoryStore)(nil)
+	_ ContractStore = (*DirStore)(nil)
+)
+
+// storeWrapper is implemented by stores that add behaviour to another store
+type storeWrapper interface {
+	Unwrap() ContractStore
+}
+
+// unwrapStore returns the first of a store and the stores it wraps that implements T
+func unwrapStore[T any](store ContractStore) (T, bool) {
+	for {
+		if found, ok := store.(T); ok {
+			return found, true
+		}
+		wrapper, ok := store.(storeWrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		store = wrapper.Unwrap()
+	}
+}
+
+// asRevisionStore returns the RevisionStore behind a store and the stores wrapping it
+func asRevisionStore(store ContractStore) (RevisionStore, bool) {
+	return unwrapStore[RevisionStore](store)
+}
+
+// OpenStore opens the contract store described by storeURL.
+//
+// Supported forms are sqlite:<path>, postgres://<dsn>, dir:<path> and memory:.
+// A value without a known scheme is treated as the path of a SQLite database,
+// so plain -db paths keep working.
+func OpenStore(storeURL string) (ContractStore, error) {
+	scheme, location, found := strings.Cut(storeURL, ":")
+	if !found {
+		return InitDB(storeURL)
+	}
+
+	switch scheme {
+	case "sqlite":
+		if location == "" {
+			return nil, fmt.Errorf("sqlite store requires a database path")
+		}
+		return InitDB(location)
+	case "postgres", "postgresql":
+		return InitPostgres(storeURL)
+	case "dir":
+		if location == "" {
+			return nil, fmt.Errorf("dir store requires a directory path")
+		}
+		return OpenDirStore(location)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		// Not a store scheme (e.g. a Windows drive letter), so treat it as a SQLite path
+		return InitDB(storeURL)
+	}
+}
+
+// copyContract returns a deep copy of the contract so stores never share state with callers
+func copyContract(contract *Contract) (*Contract, error) {
+	data, err := json.Marshal(contract)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling contract: %v", err)
+	}
+
+	var copied Contract
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("error unmarshaling contract: %v", err)
+	}
+	return &copied, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirStore is a ContractStore that keeps each contract as <id>.json in a directory.
+// The files use the same layout as config/contract.json so they can be reviewed and
+// versioned with git.
+type DirStore struct {
+	dir string
+}
+
+// OpenDirStore opens a directory-backed contract store, creating the directory if needed
+func OpenDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating contracts directory: %v", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// contractPath returns the file path used for the contract with the given ID
+func (s *DirStore) contractPath(id string) (string, error) {
+	name, err := contractFileName(id, ".json")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// contractFileName returns <id><ext>, rejecting IDs that are not safe file names
+func contractFileName(id, ext string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("contract ID %q cannot be used as a file name", id)
+	}
+	return id + ext, nil
+}
+
+// StoreContract writes the contract to <id>.json, replacing any existing file
+func (s *DirStore) StoreContract(contract *Contract) error {
+	path, err := s.contractPath(contract.ID)
+	if err != nil {
+		return err
+	}
+
+	return writeContractFile(path, contract)
+}
+
+// GetContract reads the contract with the given ID from its file
+func (s *DirStore) GetContract(id string) (*Contract, error) {
+	path, err := s.contractPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	contract, err := readContractFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrContractNotFound, id)
+		}
+		return nil, err
+	}
+	return contract, nil
+}
+
+// GetAllContracts reads every contract file in the directory, ordered by ID
+func (s *DirStore) GetAllContracts() ([]*Contract, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing contract files: %v", err)
+	}
+
+	var contracts []*Contract
+	for _, path := range paths {
+		// Hidden files hold tool state such as the sync state, not contracts
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+
+		contract, err := readContractFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, contract)
+	}
+
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ID < contracts[j].ID })
+	return contracts, nil
+}
+
+// DeleteContract removes the file of the contract with the given ID
+func (s *DirStore) DeleteContract(id string) error {
+	path, err := s.contractPath(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrContractNotFound, id)
+		}
+		return fmt.Errorf("error deleting contract: %v", err)
+	}
+	return nil
+}
+
+// Close is a no-op for the directory store
+func (s *DirStore) Close() error {
+	return nil
+}
+
+// readContractFile parses a single contract file without validating it
+func readContractFile(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var contract Contract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return nil, fmt.Errorf("error parsing contract file %s: %v", filepath.Base(path), err)
+	}
+	return &contract, nil
+}
+
+// writeContractFile atomically writes the contract as indented JSON to path
+func writeContractFile(path string, contract *Contract) error {
+	data, err := json.MarshalIndent(contract, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling contract: %v", err)
+	}
+
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing contract file: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// so a failed or interrupted write never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, path)
+}
+
+// writeFileExclusive is like writeFileAtomic but fails with an error matching
+// fs.ErrExist instead of replacing a file that already exists at path
+func writeFileExclusive(path string, data []byte) error {
+	tmp, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	// Unlike a rename, a hard link never replaces an existing file
+	return os.Link(tmp, path)
+}
+
+// writeTempFile writes data to a new temporary file in the directory of path and
+// returns its name once the data is on disk
+func writeTempFile(path string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a ContractStore that keeps contracts in memory.
+// It is mainly useful for tests and dry runs.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	contracts map[string]*Contract
+	revisions map[string][]memoryRevision
+}
+
+// memoryRevision is a stored version of a contract in a MemoryStore
+type memoryRevision struct {
+	ContractRevision
+	contract *Contract
+}
+
+// NewMemoryStore creates an empty in-memory contract store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		contracts: make(map[string]*Contract),
+		revisions: make(map[string][]memoryRevision),
+	}
+}
+
+// StoreContract stores a copy of the contract, replacing any contract with the same ID
+func (s *MemoryStore) StoreContract(contract *Contract) error {
+	copied, err := copyContract(contract)
+	if err != nil {
+		return fmt.Errorf("error storing contract: %v", err)
+	}
+
+	hash, err := copied.ContentHash()
+	if err != nil {
+		return fmt.Errorf("error storing contract: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contracts[contract.ID] = copied
+
+	// Record a revision unless the content is unchanged since the latest one
+	revisions := s.revisions[contract.ID]
+	if n := len(revisions); n == 0 || revisions[n-1].Hash != hash {
+		s.revisions[contract.ID] = append(revisions, memoryRevision{
+			ContractRevision: ContractRevision{ID: contract.ID, Version: n + 1, Hash: hash, StoredAt: time.Now().UTC()},
+			contract:         copied,
+		})
+	}
+	return nil
+}
+
+// GetContract retrieves a copy of the contract with the given ID
+func (s *MemoryStore) GetContract(id string) (*Contract, error) {
+	s.mu.RLock()
+	contract, ok := s.contracts[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, id)
+	}
+	return copyContract(contract)
+}
+
+// GetAllContracts retrieves copies of all contracts ordered by ID
+func (s *MemoryStore) GetAllContracts() ([]*Contract, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contracts := make([]*Contract, 0, len(s.contracts))
+	for _, contract := range s.contracts {
+		copied, err := copyContract(contract)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, copied)
+	}
+
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ID < contracts[j].ID })
+	return contracts, nil
+}
+
+// DeleteContract removes the contract with the given ID
+func (s *MemoryStore) DeleteContract(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.contracts[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrContractNotFound, id)
+	}
+	delete(s.contracts, id)
+	return nil
+}
+
+// ContractRevisions lists the stored versions of a contract, oldest first
+func (s *MemoryStore) ContractRevisions(id string) ([]ContractRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[id]
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, id)
+	}
+	revisions := make([]ContractRevision, len(stored))
+	for i, revision := range stored {
+		revisions[i] = revision.ContractRevision
+	}
+	return revisions, nil
+}
+
+// GetContractVersion retrieves a copy of a stored version of a contract
+func (s *MemoryStore) GetContractVersion(id string, version int) (*Contract, error) {
+	s.mu.RLock()
+	stored := s.revisions[id]
+	s.mu.RUnlock()
+	if version < 1 || version > len(stored) {
+		return nil, fmt.Errorf("%w: %s@%d", ErrContractNotFound, id, version)
+	}
+	return copyContract(stored[version-1].contract)
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testContractStore runs the conformance tests every ContractStore implementation must pass.
+// The store must be empty when it is passed in.
+func testContractStore(t *testing.T, store ContractStore) {
+	t.Helper()
+
+	first := &Contract{
+		ID:     "TEST-001",
+		Title:  "Test Contract",
+		Status: "active",
+		Parties: []Party{
+			{Name: "Test Party 1", Role: "Client", Email: "test1@example.com"},
+			{Name: "Test Party 2", Role: "Provider", Email: "test2@example.com"},
+		},
+		Terms: Terms{
+			StartDate: "2024-01-01",
+			EndDate:   "2024-12-31",
+			Value:     1000.00,
+			Currency:  "USD",
+		},
+		Amendments: []Amendment{
+			{
+				EffectiveDate: "2024-07-01",
+				Description:   "Extended scope",
+				Changes:       AmendmentChanges{Value: floatPtr(1500.00)},
+			},
+		},
+	}
+	second := &Contract{
+		ID:            "TEST-002",
+		Title:         "Second Contract",
+		Status:        "pending",
+		PredecessorID: "TEST-001",
+		Parties:       []Party{{Name: "Test Party 3", Role: "Client"}},
+		Terms:         Terms{Value: 250.50, Currency: "EUR"},
+	}
+
+	t.Run("EmptyStore", func(t *testing.T) {
+		contracts, err := store.GetAllContracts()
+		if err != nil {
+			t.Fatalf("Failed to list contracts: %v", err)
+		}
+		if len(contracts) != 0 {
+			t.Errorf("Expected empty store, got %d contracts", len(contracts))
+		}
+	})
+
+	t.Run("StoreAndGet", func(t *testing.T) {
+		if err := store.StoreContract(first); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+
+		contract, err := store.GetContract(first.ID)
+		if err != nil {
+			t.Fatalf("Failed to get contract: %v", err)
+		}
+		assertContractsEqual(t, first, contract)
+	})
+
+	t.Run("ReturnedContractIsACopy", func(t *testing.T) {
+		contract, err := store.GetContract(first.ID)
+		if err != nil {
+			t.Fatalf("Failed to get contract: %v", err)
+		}
+		contract.Title = "Changed"
+		contract.Parties[0].Name = "Changed"
+
+		again, err := store.GetContract(first.ID)
+		if err != nil {
+			t.Fatalf("Failed to get contract: %v", err)
+		}
+		assertContractsEqual(t, first, again)
+	})
+
+	t.Run("StoreReplacesExisting", func(t *testing.T) {
+		updated := *first
+		updated.Status = "terminated"
+		if err := store.StoreContract(&updated); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+
+		contract, err := store.GetContract(first.ID)
+		if err != nil {
+			t.Fatalf("Failed to get contract: %v", err)
+		}
+		if contract.Status != "terminated" {
+			t.Errorf("Expected status terminated, got %s", contract.Status)
+		}
+
+		if err := store.StoreContract(first); err != nil {
+			t.Fatalf("Failed to restore contract: %v", err)
+		}
+	})
+
+	t.Run("GetAllContracts", func(t *testing.T) {
+		if err := store.StoreContract(second); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+
+		contracts, err := store.GetAllContracts()
+		if err != nil {
+			t.Fatalf("Failed to list contracts: %v", err)
+		}
+		if len(contracts) != 2 {
+			t.Fatalf("Expected 2 contracts, got %d", len(contracts))
+		}
+
+		byID := make(map[string]*Contract)
+		for _, contract := range contracts {
+			byID[contract.ID] = contract
+		}
+		assertContractsEqual(t, first, byID[first.ID])
+		assertContractsEqual(t, second, byID[second.ID])
+	})
+
+	t.Run("GetNonExistentContract", func(t *testing.T) {
+		_, err := store.GetContract("NON-EXISTENT")
+		if !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected ErrContractNotFound, got %v", err)
+		}
+	})
+
+	t.Run("DeleteContract", func(t *testing.T) {
+		if err := store.DeleteContract(first.ID); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+
+		_, err := store.GetContract(first.ID)
+		if !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected ErrContractNotFound for deleted contract, got %v", err)
+		}
+
+		contracts, err := store.GetAllContracts()
+		if err != nil {
+			t.Fatalf("Failed to list contracts: %v", err)
+		}
+		if len(contracts) != 1 || contracts[0].ID != second.ID {
+			t.Errorf("Expected only %s to remain, got %d contracts", second.ID, len(contracts))
+		}
+	})
+
+	t.Run("DeleteNonExistentContract", func(t *testing.T) {
+		err := store.DeleteContract("NON-EXISTENT")
+		if !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected ErrContractNotFound, got %v", err)
+		}
+	})
+}
+
+// assertContractsEqual compares the stored fields of two contracts
+func assertContractsEqual(t *testing.T, expected, actual *Contract) {
+	t.Helper()
+
+	if actual == nil {
+		t.Fatalf("Expected contract %s, got nil", expected.ID)
+	}
+	if actual.ID != expected.ID {
+		t.Errorf("Expected ID %s, got %s", expected.ID, actual.ID)
+	}
+	if actual.Title != expected.Title {
+		t.Errorf("Expected Title %s, got %s", expected.Title, actual.Title)
+	}
+	if actual.Status != expected.Status {
+		t.Errorf("Expected Status %s, got %s", expected.Status, actual.Status)
+	}
+	if len(actual.Parties) != len(expected.Parties) {
+		t.Fatalf("Expected %d parties, got %d", len(expected.Parties), len(actual.Parties))
+	}
+	for i, party := range actual.Parties {
+		if party != expected.Parties[i] {
+			t.Errorf("Expected party %+v, got %+v", expected.Parties[i], party)
+		}
+	}
+	if !reflect.DeepEqual(actual.Terms, expected.Terms) {
+		t.Errorf("Expected terms %+v, got %+v", expected.Terms, actual.Terms)
+	}
+
+	// Catch any remaining field, such as amendments, through the content hash
+	expectedHash, _ := expected.ContentHash()
+	actualHash, _ := actual.ContentHash()
+	if actualHash != expectedHash {
+		t.Errorf("Expected content hash %s, got %s", expectedHash, actualHash)
+	}
+}
+
+// floatPtr returns a pointer to v
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// stringPtr returns a pointer to v
+func stringPtr(v string) *string {
+	return &v
+}
+
+// testRevisionStore runs the tests every RevisionStore implementation must pass.
+// The store must be empty when it is passed in.
+func testRevisionStore(t *testing.T, store interface {
+	ContractStore
+	RevisionStore
+}) {
+	t.Helper()
+
+	contract := &Contract{
+		ID:      "REV-001",
+		Title:   "Versioned Contract",
+		Status:  "pending",
+		Parties: []Party{{Name: "Ann", Role: "client", Email: "ann@example.com"}},
+		Terms:   Terms{StartDate: "2024-01-01", Value: 100, Currency: "EUR"},
+	}
+
+	t.Run("NoRevisions", func(t *testing.T) {
+		if _, err := store.ContractRevisions("REV-001"); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected ErrContractNotFound, got %v", err)
+		}
+	})
+
+	t.Run("StoringRecordsRevisions", func(t *testing.T) {
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		// Storing the same content again does not add a version
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		changed := *contract
+		changed.Status = "active"
+		changed.Terms.Value = 120.5
+		if err := store.StoreContract(&changed); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+
+		revisions, err := store.ContractRevisions("REV-001")
+		if err != nil {
+			t.Fatalf("Failed to list revisions: %v", err)
+		}
+		if len(revisions) != 2 {
+			t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+		}
+		for i, revision := range revisions {
+			if revision.ID != "REV-001" || revision.Version != i+1 || revision.StoredAt.IsZero() {
+				t.Errorf("Unexpected revision %+v", revision)
+			}
+		}
+		hash, _ := changed.ContentHash()
+		if revisions[1].Hash != hash {
+			t.Errorf("Expected hash %s of the latest version, got %s", hash, revisions[1].Hash)
+		}
+
+		first, err := store.GetContractVersion("REV-001", 1)
+		if err != nil {
+			t.Fatalf("Failed to get version 1: %v", err)
+		}
+		assertContractsEqual(t, contract, first)
+
+		second, err := store.GetContractVersion("REV-001", 2)
+		if err != nil {
+			t.Fatalf("Failed to get version 2: %v", err)
+		}
+		assertContractsEqual(t, &changed, second)
+	})
+
+	t.Run("UnknownVersion", func(t *testing.T) {
+		for _, version := range []int{0, 3} {
+			if _, err := store.GetContractVersion("REV-001", version); !errors.Is(err, ErrContractNotFound) {
+				t.Errorf("Expected ErrContractNotFound for version %d, got %v", version, err)
+			}
+		}
+	})
+
+	t.Run("HistorySurvivesDelete", func(t *testing.T) {
+		if err := store.DeleteContract("REV-001"); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+		if _, err := store.GetContractVersion("REV-001", 1); err != nil {
+			t.Errorf("Expected versions of a deleted contract to be kept: %v", err)
+		}
+	})
+}
+
+func TestGetContractRef(t *testing.T) {
+	store := NewMemoryStore()
+	contract := &Contract{ID: "REF-001", Title: "First", Status: "active"}
+	store.StoreContract(contract)
+	store.StoreContract(&Contract{ID: "REF-001", Title: "Second", Status: "active"})
+
+	tests := []struct {
+		ref   string
+		title string
+		err   string
+	}{
+		{ref: "REF-001", title: "Second"},
+		{ref: "REF-001@1", title: "First"},
+		{ref: "REF-001@2", title: "Second"},
+		{ref: "REF-001@3", err: "contract not found"},
+		{ref: "REF-001@0", err: "invalid contract reference"},
+		{ref: "REF-001@latest", err: "invalid contract reference"},
+		{ref: "@1", err: "invalid contract reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := getContractRef(store, tt.ref)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve %s: %v", tt.ref, err)
+			}
+			if got.Title != tt.title {
+				t.Errorf("Expected title %s, got %s", tt.title, got.Title)
+			}
+		})
+	}
+
+	t.Run("StoreWithoutVersions", func(t *testing.T) {
+		dirStore, err := OpenDirStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open directory store: %v", err)
+		}
+		if _, err := getContractRef(dirStore, "REF-001@1"); err == nil || !strings.Contains(err.Error(), "does not keep contract versions") {
+			t.Errorf("Expected error for a store without versions, got %v", err)
+		}
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testContractStore(t, db)
+}
+
+func TestSQLiteRevisions(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testRevisionStore(t, db)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testContractStore(t, NewMemoryStore())
+}
+
+func TestMemoryRevisions(t *testing.T) {
+	testRevisionStore(t, NewMemoryStore())
+}
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "contracts")
+	store, err := OpenDirStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open directory store: %v", err)
+	}
+
+	testContractStore(t, store)
+
+	t.Run("RejectsPathLikeIDs", func(t *testing.T) {
+		err := store.StoreContract(&Contract{ID: "../escape", Title: "Bad", Status: "active"})
+		if err == nil {
+			t.Error("Expected error for ID containing a path separator")
+		}
+	})
+
+	t.Run("FilesAreLoadable", func(t *testing.T) {
+		contract, err := LoadContract(filepath.Join(dir, "TEST-002.json"))
+		if err != nil {
+			t.Fatalf("Failed to load stored file with LoadContract: %v", err)
+		}
+		if contract.ID != "TEST-002" {
+			t.Errorf("Expected ID TEST-002, got %s", contract.ID)
+		}
+	})
+}
+
+func TestOpenStore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		storeURL string
+		check    func(ContractStore) bool
+	}{
+		{"PlainPath", filepath.Join(tmpDir, "plain.db"), func(s ContractStore) bool { _, ok := s.(*DB); return ok }},
+		{"SQLiteURL", "sqlite:" + filepath.Join(tmpDir, "url.db"), func(s ContractStore) bool { _, ok := s.(*DB); return ok }},
+		{"DirURL", "dir:" + filepath.Join(tmpDir, "contracts"), func(s ContractStore) bool { _, ok := s.(*DirStore); return ok }},
+		{"MemoryURL", "memory:", func(s ContractStore) bool { _, ok := s.(*MemoryStore); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := OpenStore(tt.storeURL)
+			if err != nil {
+				t.Fatalf("Failed to open store %s: %v", tt.storeURL, err)
+			}
+			defer store.Close()
+
+			if !tt.check(store) {
+				t.Errorf("Unexpected store type %T for %s", store, tt.storeURL)
+			}
+		})
+	}
+
+	t.Run("SQLiteFileCreated", func(t *testing.T) {
+		if _, err := os.Stat(filepath.Join(tmpDir, "url.db")); err != nil {
+			t.Errorf("Expected database file to exist: %v", err)
+		}
+	})
+
+	t.Run("MissingLocation", func(t *testing.T) {
+		if _, err := OpenStore("dir:"); err == nil {
+			t.Error("Expected error for dir store without a path")
+		}
+	})
+}
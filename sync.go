@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncDirection selects which side of a sync is authoritative
+type SyncDirection string
+
+const (
+	// SyncFileToDB makes the store match the contract files
+	SyncFileToDB SyncDirection = "file-to-db"
+	// SyncDBToFile makes the contract files match the store
+	SyncDBToFile SyncDirection = "db-to-file"
+	// SyncTwoWay copies changes in both directions and reports conflicts
+	SyncTwoWay SyncDirection = "two-way"
+)
+
+// SyncActionKind is the kind of change a sync action makes
+type SyncActionKind string
+
+const (
+	SyncCreate   SyncActionKind = "create"
+	SyncUpdate   SyncActionKind = "update"
+	SyncDelete   SyncActionKind = "delete"
+	SyncConflict SyncActionKind = "conflict"
+	// SyncSkip is a deletion that a one-way sync leaves out without -prune
+	SyncSkip SyncActionKind = "skip"
+)
+
+// Sync targets name the side a sync action changes
+const (
+	syncTargetDB   = "db"
+	syncTargetFile = "file"
+)
+
+// syncStateFile records the content hash of every contract at the last sync.
+// Two-way syncs use it to tell which side changed.
+const syncStateFile = ".sync-state.json"
+
+// SyncAction is a single step of a sync plan
+type SyncAction struct {
+	Kind     SyncActionKind
+	Target   string
+	ID       string
+	Path     string
+	Reason   string
+	contract *Contract
+}
+
+// SyncPlan lists the changes needed to bring a contracts directory and a store in sync
+type SyncPlan struct {
+	Dir       string
+	Direction SyncDirection
+	Actions   []SyncAction
+}
+
+// Conflicts returns the number of conflicts in the plan
+func (p *SyncPlan) Conflicts() int {
+	return p.count(SyncConflict)
+}
+
+// Changes returns the number of actions of the plan that change a side
+func (p *SyncPlan) Changes() int {
+	return len(p.Actions) - p.count(SyncConflict) - p.count(SyncSkip)
+}
+
+// count returns the number of actions of a kind in the plan
+func (p *SyncPlan) count(kind SyncActionKind) int {
+	count := 0
+	for _, action := range p.Actions {
+		if action.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// hashedContract is a contract with its content hash and, for files, the path it was read from
+type hashedContract struct {
+	path     string
+	contract *Contract
+	hash     string
+}
+
+// ParseSyncDirection converts a -direction value to a SyncDirection
+func ParseSyncDirection(value string) (SyncDirection, error) {
+	switch direction := SyncDirection(value); direction {
+	case SyncFileToDB, SyncDBToFile, SyncTwoWay:
+		return direction, nil
+	default:
+		return "", fmt.Errorf("invalid sync direction %q (use %s, %s or %s)", value, SyncFileToDB, SyncDBToFile, SyncTwoWay)
+	}
+}
+
+// PlanSync compares the contract files in dir with the store by ID and content hash.
+// A one-way sync only deletes what the other side lacks with prune; otherwise such
+// contracts are skipped. A two-way sync deletes what was deleted on the other side
+// since the last sync.
+func PlanSync(dir string, store ContractStore, direction SyncDirection, prune bool) (*SyncPlan, error) {
+	files, err := scanContractDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := hashStoredContracts(store)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := readSyncState(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for id := range files {
+		ids[id] = true
+	}
+	for id := range stored {
+		ids[id] = true
+	}
+
+	plan := &SyncPlan{Dir: dir, Direction: direction}
+	for id := range ids {
+		file, inFile := files[id]
+		db, inDB := stored[id]
+		if inFile && inDB && file.hash == db.hash {
+			continue
+		}
+
+		action, err := planContractSync(dir, direction, prune, id, file, inFile, db, inDB, base)
+		if err != nil {
+			return nil, err
+		}
+		if action != nil {
+			plan.Actions = append(plan.Actions, *action)
+		}
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].ID < plan.Actions[j].ID })
+	return plan, nil
+}
+
+// planContractSync decides what to do with a contract whose file and stored versions differ
+func planContractSync(dir string, direction SyncDirection, prune bool, id string, file hashedContract, inFile bool, db hashedContract, inDB bool, base map[string]string) (*SyncAction, error) {
+	toDB := func(kind SyncActionKind) *SyncAction {
+		return &SyncAction{Kind: kind, Target: syncTargetDB, ID: id, Path: file.path, contract: file.contract}
+	}
+	toFile := func(kind SyncActionKind) (*SyncAction, error) {
+		path := file.path
+		if path == "" {
+			name, err := contractFileName(id, ".json")
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(dir, name)
+		}
+		return &SyncAction{Kind: kind, Target: syncTargetFile, ID: id, Path: path, contract: db.contract}, nil
+	}
+	conflict := func(reason string) *SyncAction {
+		return &SyncAction{Kind: SyncConflict, ID: id, Path: file.path, Reason: reason}
+	}
+	// prunable deletes a contract that only one side of a one-way sync has, with -prune
+	prunable := func(target, reason string) *SyncAction {
+		if !prune {
+			return &SyncAction{Kind: SyncSkip, Target: target, ID: id, Path: file.path, Reason: reason + "; use -prune to delete it"}
+		}
+		return &SyncAction{Kind: SyncDelete, Target: target, ID: id, Path: file.path}
+	}
+
+	switch direction {
+	case SyncFileToDB:
+		switch {
+		case inFile && inDB:
+			return toDB(SyncUpdate), nil
+		case inFile:
+			return toDB(SyncCreate), nil
+		default:
+			return prunable(syncTargetDB, "no contract file"), nil
+		}
+
+	case SyncDBToFile:
+		switch {
+		case inFile && inDB:
+			return toFile(SyncUpdate)
+		case inDB:
+			return toFile(SyncCreate)
+		default:
+			return prunable(syncTargetFile, "not in the store"), nil
+		}
+
+	default:
+		baseHash, synced := base[id]
+		switch {
+		case inFile && inDB:
+			if synced && file.hash == baseHash {
+				return toFile(SyncUpdate)
+			}
+			if synced && db.hash == baseHash {
+				return toDB(SyncUpdate), nil
+			}
+			if synced {
+				return conflict("changed in both the file and the store"), nil
+			}
+			return conflict("file and store differ and were never synced"), nil
+		case inFile:
+			if !synced {
+				return toDB(SyncCreate), nil
+			}
+			if file.hash == baseHash {
+				return &SyncAction{Kind: SyncDelete, Target: syncTargetFile, ID: id, Path: file.path}, nil
+			}
+			return conflict("changed in the file but deleted from the store"), nil
+		default:
+			if !synced {
+				return toFile(SyncCreate)
+			}
+			if db.hash == baseHash {
+				return &SyncAction{Kind: SyncDelete, Target: syncTargetDB, ID: id}, nil
+			}
+			return conflict("changed in the store but the file was deleted"), nil
+		}
+	}
+}
+
+// ApplySync performs every non-conflicting action of the plan and, for a two-way sync
+// or a directory that was synced two-way before, records the new sync state
+func ApplySync(plan *SyncPlan, store ContractStore) error {
+	for _, action := range plan.Actions {
+		var err error
+		switch {
+		case action.Kind == SyncConflict || action.Kind == SyncSkip:
+			continue
+		case action.Target == syncTargetDB && action.Kind == SyncDelete:
+			err = store.DeleteContract(action.ID)
+		case action.Target == syncTargetDB:
+			err = store.StoreContract(action.contract)
+		case action.Kind == SyncDelete:
+			err = os.Remove(action.Path)
+		default:
+			err = writeContractFile(action.Path, action.contract)
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s of %s to %s: %v", action.Kind, action.ID, action.Target, err)
+		}
+	}
+
+	// One-way syncs do not need the state, but keep an existing one current so that
+	// the next two-way sync does not see their changes as conflicts
+	if plan.Direction != SyncTwoWay {
+		if _, err := os.Stat(filepath.Join(plan.Dir, syncStateFile)); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+	return updateSyncState(plan.Dir, store)
+}
+
+// scanContractDir reads and validates every contract file in dir, keyed by contract ID
+func scanContractDir(dir string) (map[string]hashedContract, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing contract files: %v", err)
+	}
+
+	files := make(map[string]hashedContract)
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+
+		contract, err := LoadContract(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %v", path, err)
+		}
+		if other, ok := files[contract.ID]; ok {
+			return nil, fmt.Errorf("contract %s is defined in both %s and %s", contract.ID, other.path, path)
+		}
+
+		hash, err := contract.ContentHash()
+		if err != nil {
+			return nil, err
+		}
+		files[contract.ID] = hashedContract{path: path, contract: contract, hash: hash}
+	}
+
+	return files, nil
+}
+
+// hashStoredContracts loads every stored contract together with its content hash
+func hashStoredContracts(store ContractStore) (map[string]hashedContract, error) {
+	contracts, err := store.GetAllContracts()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]hashedContract)
+	for _, contract := range contracts {
+		hash, err := contract.ContentHash()
+		if err != nil {
+			return nil, err
+		}
+		stored[contract.ID] = hashedContract{contract: contract, hash: hash}
+	}
+	return stored, nil
+}
+
+// readSyncState reads the content hashes recorded by the last sync of dir
+func readSyncState(dir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, syncStateFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("error reading sync state: %v", err)
+	}
+
+	state := make(map[string]string)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing sync state: %v", err)
+	}
+	return state, nil
+}
+
+// updateSyncState records the hash of every contract that is identical on both sides.
+// Contracts that still differ keep their previous hash so conflicts are reported again.
+func updateSyncState(dir string, store ContractStore) error {
+	files, err := scanContractDir(dir)
+	if err != nil {
+		return err
+	}
+	stored, err := hashStoredContracts(store)
+	if err != nil {
+		return err
+	}
+	previous, err := readSyncState(dir)
+	if err != nil {
+		return err
+	}
+
+	state := make(map[string]string)
+	for id, file := range files {
+		db, ok := stored[id]
+		switch {
+		case ok && db.hash == file.hash:
+			state[id] = file.hash
+		case previous[id] != "":
+			state[id] = previous[id]
+		}
+	}
+	for id := range stored {
+		if _, ok := files[id]; !ok && previous[id] != "" {
+			state[id] = previous[id]
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling sync state: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, syncStateFile), append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing sync state: %v", err)
+	}
+	return nil
+}
+
+// runSync implements the sync command
+func runSync(args []string) error {
+	fs := newFlagSet("sync")
+	dir := fs.String("dir", "config", "Directory containing the contract files")
+	directionFlag := fs.String("direction", string(SyncFileToDB), "Sync direction: file-to-db, db-to-file or two-way")
+	prune := fs.Bool("prune", false, "With file-to-db or db-to-file, delete the contracts the other side does not have")
+	dryRun := fs.Bool("dry-run", false, "Only show the sync plan without applying it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("sync takes no arguments, use -dir to select the directory")
+	}
+
+	direction, err := ParseSyncDirection(*directionFlag)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	plan, err := PlanSync(*dir, store, direction, *prune)
+	if err != nil {
+		return err
+	}
+
+	if structuredOutput() {
+		return applySyncResults(plan, store, !*dryRun)
+	}
+
+	printSyncPlan(plan)
+	if *dryRun || len(plan.Actions) == 0 {
+		return nil
+	}
+
+	if err := ApplySync(plan, store); err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d change(s)\n", plan.Changes())
+
+	if conflicts := plan.Conflicts(); conflicts > 0 {
+		return fmt.Errorf("%d conflict(s) need to be resolved by hand", conflicts)
+	}
+	return nil
+}
+
+// syncResult is the result record of a sync action
+type syncResult struct {
+	Action  SyncActionKind `json:"action"`
+	ID      string         `json:"id"`
+	Target  string         `json:"target"`
+	Path    string         `json:"path,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	Applied bool           `json:"applied"`
+}
+
+// applySyncResults applies the plan unless apply is false and prints one result per action
+func applySyncResults(plan *SyncPlan, store ContractStore, apply bool) error {
+	if apply && len(plan.Actions) > 0 {
+		if err := ApplySync(plan, store); err != nil {
+			return err
+		}
+	}
+
+	results := make([]syncResult, 0, len(plan.Actions))
+	for _, action := range plan.Actions {
+		results = append(results, syncResult{
+			Action:  action.Kind,
+			ID:      action.ID,
+			Target:  action.Target,
+			Path:    action.Path,
+			Reason:  action.Reason,
+			Applied: apply && action.Kind != SyncConflict && action.Kind != SyncSkip,
+		})
+	}
+	if err := printResults(results, nil); err != nil {
+		return err
+	}
+
+	if conflicts := plan.Conflicts(); conflicts > 0 && apply {
+		return fmt.Errorf("%d conflict(s) need to be resolved by hand", conflicts)
+	}
+	return nil
+}
+
+// printSyncPlan prints one line per planned action
+func printSyncPlan(plan *SyncPlan) {
+	fmt.Printf("Sync plan for %s (%s):\n", plan.Dir, plan.Direction)
+	if len(plan.Actions) == 0 {
+		fmt.Println("  Everything is in sync")
+		return
+	}
+
+	for _, action := range plan.Actions {
+		switch {
+		case action.Kind == SyncConflict || action.Kind == SyncSkip:
+			fmt.Printf("  %-8s %-15s %s\n", action.Kind, action.ID, action.Reason)
+		case action.Kind == SyncDelete && action.Target == syncTargetDB:
+			fmt.Printf("  %-8s %-15s from store\n", action.Kind, action.ID)
+		case action.Kind == SyncDelete:
+			fmt.Printf("  %-8s %-15s file %s\n", action.Kind, action.ID, action.Path)
+		case action.Target == syncTargetDB:
+			fmt.Printf("  %-8s %-15s store <- %s\n", action.Kind, action.ID, action.Path)
+		default:
+			fmt.Printf("  %-8s %-15s store -> %s\n", action.Kind, action.ID, action.Path)
+		}
+	}
+}
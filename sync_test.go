@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSyncFile writes a contract file into the sync test directory
+func writeSyncFile(t *testing.T, dir, name string, contract *Contract) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := writeContractFile(path, contract); err != nil {
+		t.Fatalf("Failed to write contract file: %v", err)
+	}
+	return path
+}
+
+// planActions returns the actions of a plan with -prune keyed by contract ID
+func planActions(t *testing.T, dir string, store ContractStore, direction SyncDirection) map[string]SyncAction {
+	t.Helper()
+	plan, err := PlanSync(dir, store, direction, true)
+	if err != nil {
+		t.Fatalf("Failed to plan sync: %v", err)
+	}
+	actions := make(map[string]SyncAction)
+	for _, action := range plan.Actions {
+		actions[action.ID] = action
+	}
+	return actions
+}
+
+// syncAndApply plans and applies a sync with -prune
+func syncAndApply(t *testing.T, dir string, store ContractStore, direction SyncDirection) *SyncPlan {
+	t.Helper()
+	plan, err := PlanSync(dir, store, direction, true)
+	if err != nil {
+		t.Fatalf("Failed to plan sync: %v", err)
+	}
+	if err := ApplySync(plan, store); err != nil {
+		t.Fatalf("Failed to apply sync: %v", err)
+	}
+	return plan
+}
+
+func TestSyncFileToDB(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+
+	writeSyncFile(t, dir, "contract.json", newTestContract("C-1", "active"))
+	writeSyncFile(t, dir, "C-2.json", newTestContract("C-2", "active"))
+	store.StoreContract(newTestContract("C-2", "pending"))
+	store.StoreContract(newTestContract("C-3", "active"))
+
+	actions := planActions(t, dir, store, SyncFileToDB)
+	expected := map[string]SyncActionKind{"C-1": SyncCreate, "C-2": SyncUpdate, "C-3": SyncDelete}
+	for id, kind := range expected {
+		if actions[id].Kind != kind || actions[id].Target != syncTargetDB {
+			t.Errorf("Expected %s of %s in db, got %+v", kind, id, actions[id])
+		}
+	}
+
+	syncAndApply(t, dir, store, SyncFileToDB)
+
+	contract, err := store.GetContract("C-2")
+	if err != nil {
+		t.Fatalf("Failed to get contract: %v", err)
+	}
+	if contract.Status != "active" {
+		t.Errorf("Expected C-2 to be updated to active, got %s", contract.Status)
+	}
+	if _, err := store.GetContract("C-3"); err == nil {
+		t.Error("Expected C-3 to be deleted from the store")
+	}
+
+	if actions := planActions(t, dir, store, SyncFileToDB); len(actions) != 0 {
+		t.Errorf("Expected nothing to do after sync, got %d actions", len(actions))
+	}
+	if _, err := os.Stat(filepath.Join(dir, syncStateFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected a one-way sync not to write %s, got %v", syncStateFile, err)
+	}
+}
+
+func TestSyncDBToFile(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+
+	existing := writeSyncFile(t, dir, "contract.json", newTestContract("C-1", "pending"))
+	writeSyncFile(t, dir, "old.json", newTestContract("C-9", "active"))
+	store.StoreContract(newTestContract("C-1", "active"))
+	store.StoreContract(newTestContract("C-2", "active"))
+
+	syncAndApply(t, dir, store, SyncDBToFile)
+
+	// Updates keep the existing file name, new contracts are written as <id>.json
+	contract, err := LoadContract(existing)
+	if err != nil {
+		t.Fatalf("Failed to load updated file: %v", err)
+	}
+	if contract.Status != "active" {
+		t.Errorf("Expected contract.json to be updated to active, got %s", contract.Status)
+	}
+	if _, err := LoadContract(filepath.Join(dir, "C-2.json")); err != nil {
+		t.Errorf("Expected C-2.json to be created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Error("Expected old.json to be deleted")
+	}
+}
+
+func TestSyncWithoutPrune(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	writeSyncFile(t, dir, "C-1.json", newTestContract("C-1", "active"))
+	store.StoreContract(newTestContract("C-2", "active"))
+
+	for _, direction := range []SyncDirection{SyncFileToDB, SyncDBToFile} {
+		plan, err := PlanSync(dir, store, direction, false)
+		if err != nil {
+			t.Fatalf("Failed to plan sync: %v", err)
+		}
+		for _, action := range plan.Actions {
+			if action.Kind == SyncDelete {
+				t.Errorf("Expected no deletion without -prune in %s, got %+v", direction, action)
+			}
+		}
+		if len(plan.Actions) != 2 || plan.Changes() != 1 {
+			t.Errorf("Expected a create and a skip in %s, got %+v", direction, plan.Actions)
+		}
+	}
+
+	plan, _ := PlanSync(dir, store, SyncFileToDB, false)
+	if err := ApplySync(plan, store); err != nil {
+		t.Fatalf("Failed to apply sync: %v", err)
+	}
+	if _, err := store.GetContract("C-2"); err != nil {
+		t.Errorf("Expected C-2 to be kept without -prune: %v", err)
+	}
+}
+
+func TestSyncTwoWay(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+
+	writeSyncFile(t, dir, "C-1.json", newTestContract("C-1", "active"))
+	writeSyncFile(t, dir, "C-2.json", newTestContract("C-2", "active"))
+	writeSyncFile(t, dir, "C-3.json", newTestContract("C-3", "active"))
+	store.StoreContract(newTestContract("C-4", "active"))
+
+	// The first sync creates everything on the other side
+	plan := syncAndApply(t, dir, store, SyncTwoWay)
+	if len(plan.Actions) != 4 || plan.Conflicts() != 0 {
+		t.Fatalf("Expected 4 creates, got %+v", plan.Actions)
+	}
+
+	// Change C-1 in the file, C-2 in the store, C-3 on both sides and delete C-4 from the store
+	writeSyncFile(t, dir, "C-1.json", newTestContract("C-1", "terminated"))
+	store.StoreContract(newTestContract("C-2", "terminated"))
+	writeSyncFile(t, dir, "C-3.json", newTestContract("C-3", "pending"))
+	store.StoreContract(newTestContract("C-3", "terminated"))
+	store.DeleteContract("C-4")
+
+	actions := planActions(t, dir, store, SyncTwoWay)
+	checks := []struct {
+		id     string
+		kind   SyncActionKind
+		target string
+	}{
+		{"C-1", SyncUpdate, syncTargetDB},
+		{"C-2", SyncUpdate, syncTargetFile},
+		{"C-3", SyncConflict, ""},
+		{"C-4", SyncDelete, syncTargetFile},
+	}
+	for _, check := range checks {
+		action := actions[check.id]
+		if action.Kind != check.kind || action.Target != check.target {
+			t.Errorf("Expected %s of %s on %q, got %+v", check.kind, check.id, check.target, action)
+		}
+	}
+
+	plan = syncAndApply(t, dir, store, SyncTwoWay)
+	if plan.Conflicts() != 1 {
+		t.Errorf("Expected 1 conflict, got %d", plan.Conflicts())
+	}
+
+	// The conflict is reported again until it is resolved
+	actions = planActions(t, dir, store, SyncTwoWay)
+	if len(actions) != 1 || actions["C-3"].Kind != SyncConflict {
+		t.Errorf("Expected only the C-3 conflict to remain, got %+v", actions)
+	}
+
+	t.Run("OneWayKeepsStateCurrent", func(t *testing.T) {
+		// Resolve the conflict with a one-way sync, then change the file
+		syncAndApply(t, dir, store, SyncFileToDB)
+		writeSyncFile(t, dir, "C-3.json", newTestContract("C-3", "expired"))
+		actions := planActions(t, dir, store, SyncTwoWay)
+		if len(actions) != 1 || actions["C-3"].Kind != SyncUpdate || actions["C-3"].Target != syncTargetDB {
+			t.Errorf("Expected the change of C-3 to be copied to the store, got %+v", actions)
+		}
+	})
+}
+
+func TestSyncRejectsDuplicateIDs(t *testing.T) {
+	dir := t.TempDir()
+	writeSyncFile(t, dir, "a.json", newTestContract("C-1", "active"))
+	writeSyncFile(t, dir, "b.json", newTestContract("C-1", "pending"))
+
+	if _, err := PlanSync(dir, NewMemoryStore(), SyncFileToDB, false); err == nil {
+		t.Error("Expected error for two files with the same contract ID")
+	}
+}
+
+func TestParseSyncDirection(t *testing.T) {
+	for _, value := range []string{"file-to-db", "db-to-file", "two-way"} {
+		if _, err := ParseSyncDirection(value); err != nil {
+			t.Errorf("Expected %s to be valid: %v", value, err)
+		}
+	}
+	if _, err := ParseSyncDirection("sideways"); err == nil {
+		t.Error("Expected error for invalid direction")
+	}
+}
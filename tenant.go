@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// defaultTenant owns the rows of a database that was never partitioned, and the
+// contracts of commands that select no tenant. Its admins operate the whole database.
+const defaultTenant = "default"
+
+// tenantEnv names the environment variable selecting the tenant when -tenant is not given
+const tenantEnv = "GOPLAYGROUND_TENANT"
+
+// tenantNamePattern matches valid tenant names
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// validateTenant checks that a tenant name is lowercase letters, digits, - and _
+func validateTenant(name string) error {
+	if !tenantNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid tenant %q: use up to 63 lowercase letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// configuredTenant returns the tenant given with -tenant or in the environment,
+// or "" when there is none
+func configuredTenant() string {
+	if *tenantName != "" {
+		return *tenantName
+	}
+	return os.Getenv(tenantEnv)
+}
+
+// selectTenant returns the tenant commands work in: the requested one, or else
+// the tenant of the acting user, or the default tenant. Users can only work in
+// their own tenant, except admins of the default tenant, who operate every tenant.
+func selectTenant(actor *User, requested string) (string, error) {
+	if requested == "" {
+		if actor != nil {
+			return actor.Tenant, nil
+		}
+		return defaultTenant, nil
+	}
+	if err := validateTenant(requested); err != nil {
+		return "", err
+	}
+	if actor == nil || actor.Tenant == requested || actor.isOperator() {
+		return requested, nil
+	}
+	return "", fmt.Errorf("%w: %s belongs to tenant %s and cannot work in tenant %s", ErrPermissionDenied, actor.Name, actor.Tenant, requested)
+}
+
+// UseTenant limits the contracts, revisions, webhooks and users read and written
+// through the database to those of a tenant
+func (db *DB) UseTenant(name string) error {
+	if err := validateTenant(name); err != nil {
+		return err
+	}
+	db.tenant = name
+	return nil
+}
+
+// Tenant returns the tenant the database works in
+func (db *DB) Tenant() string {
+	return db.tenant
+}
+
+// tenantSuffix returns what binds a hash or encrypted value to a tenant. It is
+// empty for the default tenant, so that values from before tenants existed stay valid.
+func tenantSuffix(tenant string) string {
+	if tenant == defaultTenant {
+		return ""
+	}
+	return "\n" + tenant
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTenant switches the database to a tenant or fails the test
+func useTenant(t *testing.T, db *DB, tenant string) {
+	t.Helper()
+	if err := db.UseTenant(tenant); err != nil {
+		t.Fatalf("Failed to use tenant %s: %v", tenant, err)
+	}
+}
+
+// testTenantIsolation runs the tenant isolation tests against an empty database
+func testTenantIsolation(t *testing.T, db *DB) {
+	// Both tenants use the ID SHARED-001, which only one of them can see at a time.
+	// Contracts are named after their tenant, so one read from the wrong tenant is recognized.
+	for _, tenant := range []string{"acme", "globex"} {
+		useTenant(t, db, tenant)
+		for _, id := range []string{"SHARED-001", strings.ToUpper(tenant) + "-001"} {
+			contract := newTestContract(id, "active")
+			contract.Title = "Contract of " + tenant
+			if err := db.StoreContract(contract); err != nil {
+				t.Fatalf("Failed to store contract for %s: %v", tenant, err)
+			}
+		}
+	}
+	useTenant(t, db, "acme")
+	amended := newTestContract("SHARED-001", "expired")
+	amended.Title = "Contract of acme"
+	if err := db.StoreContract(amended); err != nil {
+		t.Fatalf("Failed to update contract: %v", err)
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		t.Run(tenant, func(t *testing.T) {
+			useTenant(t, db, tenant)
+			other := "GLOBEX-001"
+			if tenant == "globex" {
+				other = "ACME-001"
+			}
+
+			t.Run("Get", func(t *testing.T) {
+				contract, err := db.GetContract("SHARED-001")
+				if err != nil || contract.Title != "Contract of "+tenant {
+					t.Errorf("Expected the contract of %s, got %+v: %v", tenant, contract, err)
+				}
+				if _, err := db.GetContract(other); !errors.Is(err, ErrContractNotFound) {
+					t.Errorf("Expected %s to be invisible, got %v", other, err)
+				}
+			})
+
+			t.Run("List", func(t *testing.T) {
+				contracts, err := db.GetAllContracts()
+				if err != nil {
+					t.Fatalf("Failed to list contracts: %v", err)
+				}
+				if len(contracts) != 2 {
+					t.Errorf("Expected 2 contracts, got %d", len(contracts))
+				}
+				for _, contract := range contracts {
+					if contract.Title != "Contract of "+tenant {
+						t.Errorf("Expected only contracts of %s, got %s", tenant, contract.Title)
+					}
+				}
+			})
+
+			t.Run("Search", func(t *testing.T) {
+				// Both tenants have contracts with this party and the ID pattern
+				found, err := FindContracts(db, ContractFilter{Party: "client", IDPattern: "*-001"})
+				if err != nil {
+					t.Fatalf("Failed to search contracts: %v", err)
+				}
+				if len(found) != 2 {
+					t.Errorf("Expected 2 contracts, got %d", len(found))
+				}
+				for _, contract := range found {
+					if contract.Title != "Contract of "+tenant {
+						t.Errorf("Expected only contracts of %s, got %s", tenant, contract.Title)
+					}
+				}
+			})
+
+			t.Run("History", func(t *testing.T) {
+				revisions, err := db.ContractRevisions("SHARED-001")
+				expected := map[string]int{"acme": 2, "globex": 1}[tenant]
+				if err != nil || len(revisions) != expected {
+					t.Errorf("Expected %d revisions, got %d: %v", expected, len(revisions), err)
+				}
+				if version, err := db.GetContractVersion("SHARED-001", 1); err != nil || version.Title != "Contract of "+tenant {
+					t.Errorf("Expected the first version of %s, got %+v: %v", tenant, version, err)
+				}
+				if _, err := db.ContractRevisions(other); !errors.Is(err, ErrContractNotFound) {
+					t.Errorf("Expected the history of %s to be invisible, got %v", other, err)
+				}
+			})
+		})
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		useTenant(t, db, "globex")
+		if err := db.DeleteContract("ACME-001"); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected deleting a contract of another tenant to fail, got %v", err)
+		}
+		if err := db.DeleteContract("SHARED-001"); err != nil {
+			t.Fatalf("Failed to delete contract: %v", err)
+		}
+		useTenant(t, db, "acme")
+		if _, err := db.GetContract("SHARED-001"); err != nil {
+			t.Errorf("Expected the contract of acme to survive, got %v", err)
+		}
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		useTenant(t, db, "acme")
+		webhook := &Webhook{URL: "https://acme.example/hook", Secret: "secret"}
+		if err := db.AddWebhook(webhook); err != nil {
+			t.Fatalf("Failed to add webhook: %v", err)
+		}
+		delivery := &WebhookDelivery{WebhookID: webhook.ID, Event: EventContractCreated, ContractID: "ACME-001", Status: deliveryPending, Payload: []byte(`{}`)}
+		if err := db.EnqueueDeliveries([]*WebhookDelivery{delivery}); err != nil {
+			t.Fatalf("Failed to enqueue delivery: %v", err)
+		}
+
+		useTenant(t, db, "globex")
+		if webhooks, err := db.Webhooks(); err != nil || len(webhooks) != 0 {
+			t.Errorf("Expected no webhooks for globex, got %d: %v", len(webhooks), err)
+		}
+		if deliveries, err := db.WebhookDeliveries(""); err != nil || len(deliveries) != 0 {
+			t.Errorf("Expected no deliveries for globex, got %d: %v", len(deliveries), err)
+		}
+		if _, err := db.GetWebhookDelivery(delivery.ID); !errors.Is(err, ErrWebhookNotFound) {
+			t.Errorf("Expected the delivery of acme to be invisible, got %v", err)
+		}
+		if err := db.RemoveWebhook(webhook.ID); !errors.Is(err, ErrWebhookNotFound) {
+			t.Errorf("Expected removing a webhook of acme to fail, got %v", err)
+		}
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		useTenant(t, db, "acme")
+		if err := db.AddUser(&User{Name: "wile", Role: roleAdmin}); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		useTenant(t, db, "globex")
+		if users, err := db.Users(); err != nil || len(users) != 0 {
+			t.Errorf("Expected no users for globex, got %+v: %v", users, err)
+		}
+		if found, err := db.HasUsers(); err != nil || !found {
+			t.Errorf("Expected users in some tenant, got %v: %v", found, err)
+		}
+		if err := db.RemoveUser("wile"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected removing a user of acme to fail, got %v", err)
+		}
+		if user, err := db.GetUser("wile"); err != nil || user.Tenant != "acme" {
+			t.Errorf("Expected the user to belong to acme, got %+v: %v", user, err)
+		}
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		report, problems := verifyChain(t, db)
+		// Five versions and the deletion of SHARED-001
+		if problems != "" || report.Revisions != 6 || report.Contracts != 3 {
+			t.Errorf("Expected the chain of both tenants to verify, got %+v:\n%s", report, problems)
+		}
+
+		// Moving a revision to another tenant breaks its record hash
+		exec(t, db, `UPDATE contract_revisions SET tenant = ? WHERE tenant = ? AND contract_id = ?;`, "globex", "acme", "ACME-001")
+		if _, problems := verifyChain(t, db); !strings.Contains(problems, "contract_revisions ACME-001 1: record hash does not match the revision") {
+			t.Errorf("Expected the moved revision to be reported, got:\n%s", problems)
+		}
+	})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testTenantIsolation(t, db)
+}
+
+func TestEncryptedColumnMovedToAnotherTenant(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Rekey(newTestEncryptionKey(t)); err != nil {
+		t.Fatalf("Failed to encrypt database: %v", err)
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		useTenant(t, db, tenant)
+		contract := newTestContract("SHARED-001", "active")
+		contract.Title = "Contract of " + tenant
+		if err := db.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+	}
+	exec(t, db, `UPDATE contracts SET terms_json = (SELECT terms_json FROM contracts WHERE tenant = ?) WHERE tenant = ?;`, "acme", "globex")
+
+	if _, err := db.GetContract("SHARED-001"); err == nil || !strings.Contains(err.Error(), "error decrypting terms_json") {
+		t.Errorf("Expected terms copied from another tenant not to decrypt, got %v", err)
+	}
+}
+
+func TestTenantMigration(t *testing.T) {
+	// Create a database with contracts from before revisions and tenants, which
+	// the migrations link in a chain and move to the default tenant
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	all := migrations
+	migrations = all[:5]
+	db, err := InitDB(dbPath)
+	migrations = all
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	for _, id := range []string{"CHAIN-A", "CHAIN-B", "CHAIN-C"} {
+		exec(t, db, `INSERT INTO contracts (id, title, status, parties_json, terms_json) VALUES (?, ?, ?, ?, ?);`, id, "Old", "active", "null", "{}")
+	}
+	db.Close()
+
+	db, err = InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	contracts, err := db.GetAllContracts()
+	if err != nil || len(contracts) != 3 {
+		t.Errorf("Expected the contracts to move to the default tenant, got %d: %v", len(contracts), err)
+	}
+	if _, problems := verifyChain(t, db); problems != "" {
+		t.Errorf("Expected the chain to survive the migration, got:\n%s", problems)
+	}
+	useTenant(t, db, "acme")
+	if err := db.StoreContract(&Contract{ID: "CHAIN-A", Title: "Other", Status: "draft"}); err != nil {
+		t.Errorf("Expected another tenant to reuse the ID, got %v", err)
+	}
+	if report, problems := verifyChain(t, db); problems != "" || report.HeadSeq != 4 {
+		t.Errorf("Expected the chain to continue across tenants, got %+v:\n%s", report, problems)
+	}
+}
+
+func TestSelectTenant(t *testing.T) {
+	operator := &User{Name: "root", Tenant: defaultTenant, Role: roleAdmin}
+	acmeAdmin := &User{Name: "wile", Tenant: "acme", Role: roleAdmin}
+	defaultViewer := &User{Name: "view", Tenant: defaultTenant, Role: roleViewer}
+
+	tests := []struct {
+		name      string
+		actor     *User
+		requested string
+		expected  string
+		err       string
+	}{
+		{"NoUsers", nil, "", defaultTenant, ""},
+		{"NoUsersRequested", nil, "acme", "acme", ""},
+		{"ActorTenant", acmeAdmin, "", "acme", ""},
+		{"OwnTenant", acmeAdmin, "acme", "acme", ""},
+		{"OtherTenant", acmeAdmin, "globex", "", "wile belongs to tenant acme and cannot work in tenant globex"},
+		{"Operator", operator, "globex", "globex", ""},
+		{"DefaultTenantViewer", defaultViewer, "acme", "", "permission denied"},
+		{"InvalidName", nil, "Acme Corp", "", `invalid tenant "Acme Corp"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, err := selectTenant(tt.actor, tt.requested)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || tenant != tt.expected {
+				t.Errorf("Expected tenant %s, got %s: %v", tt.expected, tenant, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validationResult is the result record of a validated contract file
+type validationResult struct {
+	Path  string `json:"path"`
+	ID    string `json:"id"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Violations are the business rules the contract fails, see RuleConfig
+	Violations []RuleViolation `json:"violations,omitempty"`
+}
+
+// validateContractFiles validates contract files and every contract file in directories,
+// checking the contracts that pass the built-in checks against the rules, if any
+func validateContractFiles(paths []string, rules *RuleConfig) ([]validationResult, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error accessing %s: %v", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing contract files: %v", err)
+		}
+		for _, match := range matches {
+			if !strings.HasPrefix(filepath.Base(match), ".") {
+				files = append(files, match)
+			}
+		}
+	}
+
+	results := make([]validationResult, 0, len(files))
+	for _, file := range files {
+		result := validationResult{Path: file, Valid: true}
+		contract, err := LoadContract(file)
+		if err != nil {
+			result.Valid = false
+			result.Error = err.Error()
+			// Report the ID even when the file does not validate
+			if unchecked, readErr := readContractFile(file); readErr == nil {
+				result.ID = unchecked.ID
+			}
+		} else {
+			result.ID = contract.ID
+			if result.Violations, err = rules.Evaluate(contract); err != nil {
+				return nil, err
+			}
+			if err := ruleError(result.Violations); err != nil {
+				result.Valid = false
+				result.Error = err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runValidate implements the validate command
+func runValidate(args []string) error {
+	fs := newFlagSet("validate")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		positional = []string{*contractFile}
+	}
+
+	rules, err := loadRulesFlag()
+	if err != nil {
+		return err
+	}
+	results, err := validateContractFiles(positional, rules)
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	for _, result := range results {
+		if !result.Valid {
+			invalid++
+		}
+	}
+
+	err = printResults(results, func() {
+		for _, result := range results {
+			if result.Valid {
+				fmt.Printf("%s: valid (contract %s)\n", result.Path, result.ID)
+			} else {
+				fmt.Printf("%s: INVALID: %s\n", result.Path, result.Error)
+			}
+			for _, v := range result.Violations {
+				if v.Severity != severityError {
+					fmt.Printf("  %s %s: %s\n", v.Severity, v.Rule, v.Message)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d contract file(s) are invalid", invalid, len(results))
+	}
+	return nil
+}
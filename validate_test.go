@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateContractFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeSyncFile(t, dir, "valid.json", newTestContract("C-1", "active"))
+	invalid := newTestContract("C-2", "active")
+	invalid.Title = ""
+	writeSyncFile(t, dir, "invalid.json", invalid)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644)
+	os.WriteFile(filepath.Join(dir, ".sync-state.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a contract"), 0644)
+
+	results, err := validateContractFiles([]string{dir}, nil)
+	if err != nil {
+		t.Fatalf("Failed to validate contract files: %v", err)
+	}
+
+	expected := map[string]validationResult{
+		"broken.json":  {ID: "", Valid: false},
+		"invalid.json": {ID: "C-2", Valid: false},
+		"valid.json":   {ID: "C-1", Valid: true},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for _, result := range results {
+		want, ok := expected[filepath.Base(result.Path)]
+		if !ok {
+			t.Errorf("Unexpected result for %s", result.Path)
+			continue
+		}
+		if result.ID != want.ID || result.Valid != want.Valid {
+			t.Errorf("%s: expected ID %q and valid %v, got %+v", result.Path, want.ID, want.Valid, result)
+		}
+		if !result.Valid && result.Error == "" {
+			t.Errorf("%s: expected an error message", result.Path)
+		}
+	}
+
+	if _, err := validateContractFiles([]string{filepath.Join(dir, "missing.json")}, nil); err == nil {
+		t.Error("Expected error for a missing path")
+	}
+}
+
+func TestValidateContractFilesWithRules(t *testing.T) {
+	rules, err := LoadRuleConfig(writeRuleConfig(t, `{"rules":[
+		{"id":"has-end","check":"terms.endDate != ''","message":"an end date is required"},
+		{"id":"has-email","severity":"warning","check":"all(parties, email != '')"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Failed to load rule config: %v", err)
+	}
+
+	dir := t.TempDir()
+	open := newTestContract("C-1", "active")
+	open.Terms.EndDate = ""
+	writeSyncFile(t, dir, "open.json", open)
+	anonymous := newTestContract("C-2", "active")
+	anonymous.Parties[0].Email = ""
+	writeSyncFile(t, dir, "anonymous.json", anonymous)
+
+	results, err := validateContractFiles([]string{dir}, rules)
+	if err != nil {
+		t.Fatalf("Failed to validate contract files: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+	// Files are validated in name order
+	if r := results[0]; !r.Valid || r.Error != "" || len(r.Violations) != 1 || r.Violations[0].Severity != severityWarning {
+		t.Errorf("Expected a valid contract with a warning, got %+v", r)
+	}
+	if r := results[1]; r.Valid || r.Error != "rule has-end: an end date is required" || len(r.Violations) != 1 {
+		t.Errorf("Expected the rule error to make the contract invalid, got %+v", r)
+	}
+}
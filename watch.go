@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchDebounce is how long to wait for further events before re-checking changed files.
+// Saving a file usually produces several events in quick succession.
+const watchDebounce = 100 * time.Millisecond
+
+// fileWatcher reports changes to the files directly inside a directory.
+// newFileWatcher is implemented with inotify on Linux and by polling elsewhere.
+type fileWatcher interface {
+	Changes() <-chan string
+	Err() error
+	Close() error
+}
+
+// contractWatcher re-validates contract files and optionally renders and stores them
+type contractWatcher struct {
+	target     string
+	isDir      bool
+	renderPath string
+	store      ContractStore
+	out        io.Writer
+	lastHash   map[string]string
+}
+
+// newContractWatcher creates a watcher for a contract file or a directory of contract files
+func newContractWatcher(target, renderPath string, store ContractStore, out io.Writer) (*contractWatcher, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing %s: %v", target, err)
+	}
+
+	// When watching a directory, -render is a directory or a pattern like out/{id}.md
+	if info.IsDir() && renderPath != "" && !(OutputDestination{Path: renderPath}).PerContract() {
+		if err := os.MkdirAll(renderPath, 0755); err != nil {
+			return nil, fmt.Errorf("error creating render directory: %v", err)
+		}
+	}
+
+	return &contractWatcher{
+		target:     filepath.Clean(target),
+		isDir:      info.IsDir(),
+		renderPath: renderPath,
+		store:      store,
+		out:        out,
+		lastHash:   make(map[string]string),
+	}, nil
+}
+
+// watchDir returns the directory that has to be watched for the target
+func (w *contractWatcher) watchDir() string {
+	if w.isDir {
+		return w.target
+	}
+	return filepath.Dir(w.target)
+}
+
+// matches reports whether a changed path is one of the watched contract files
+func (w *contractWatcher) matches(path string) bool {
+	if !w.isDir {
+		return filepath.Clean(path) == w.target
+	}
+	name := filepath.Base(path)
+	return filepath.Dir(path) == w.target && filepath.Ext(name) == ".json" && !strings.HasPrefix(name, ".")
+}
+
+// checkAll checks every watched contract file
+func (w *contractWatcher) checkAll() error {
+	if !w.isDir {
+		w.check(w.target)
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(w.target, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error listing contract files: %v", err)
+	}
+	for _, path := range paths {
+		if w.matches(path) {
+			w.check(path)
+		}
+	}
+	return nil
+}
+
+// check validates a single contract file and, when it is valid, renders and stores it.
+// Files whose content did not change since the last check are skipped.
+func (w *contractWatcher) check(path string) {
+	timestamp := time.Now().Format("15:04:05")
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if _, seen := w.lastHash[path]; seen {
+			delete(w.lastHash, path)
+			fmt.Fprintf(w.out, "[%s] %s: removed\n", timestamp, path)
+		}
+		return
+	}
+
+	contract, err := LoadContract(path)
+	if err != nil {
+		w.lastHash[path] = ""
+		fmt.Fprintf(w.out, "[%s] %s: INVALID: %v\n", timestamp, path, err)
+		return
+	}
+
+	hash, err := contract.ContentHash()
+	if err != nil {
+		fmt.Fprintf(w.out, "[%s] %s: %v\n", timestamp, path, err)
+		return
+	}
+	if w.lastHash[path] == hash {
+		return
+	}
+	w.lastHash[path] = hash
+	fmt.Fprintf(w.out, "[%s] %s: valid (contract %s)\n", timestamp, path, contract.ID)
+
+	if w.renderPath != "" {
+		dest := OutputDestination{Path: w.renderPath, Force: true}
+		markdown, err := contract.ToMarkdown()
+		var renderPath string
+		if err == nil {
+			renderPath, _, err = dest.Write(contract, formatMarkdown, []byte(markdown))
+		}
+		if err != nil {
+			fmt.Fprintf(w.out, "[%s]   error rendering: %v\n", timestamp, err)
+		} else {
+			fmt.Fprintf(w.out, "[%s]   rendered to %s\n", timestamp, renderPath)
+		}
+	}
+
+	if w.store != nil {
+		if err := w.store.StoreContract(contract); err != nil {
+			fmt.Fprintf(w.out, "[%s]   error storing contract: %v\n", timestamp, err)
+		} else {
+			fmt.Fprintf(w.out, "[%s]   stored contract %s\n", timestamp, contract.ID)
+		}
+	}
+}
+
+// run checks all files once and then re-checks changed files until stop is closed
+func (w *contractWatcher) run(watcher fileWatcher, stop <-chan struct{}) error {
+	if err := w.checkAll(); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+		case path, ok := <-watcher.Changes():
+			if !ok {
+				return watcher.Err()
+			}
+			if w.matches(path) {
+				pending[path] = true
+				debounce = time.After(watchDebounce)
+			}
+		case <-debounce:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				w.check(path)
+			}
+			pending = make(map[string]bool)
+			debounce = nil
+		}
+	}
+}
+
+// runWatch implements the watch command
+func runWatch(args []string) error {
+	fs := newFlagSet("watch")
+	renderPath := fs.String("render", "", "Write the rendered markdown here when a contract is valid (a directory or pattern like out/{id}.md when watching a directory)")
+	storeValid := fs.Bool("store", false, "Store the contract in the database when it is valid")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	target := *contractFile
+	if len(positional) > 0 {
+		target = positional[0]
+	}
+
+	var store ContractStore
+	if *storeValid {
+		store, err = openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	w, err := newContractWatcher(target, *renderPath, store, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := newFileWatcher(w.watchDir())
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	fmt.Printf("Watching %s (press Ctrl+C to stop)\n", target)
+	return w.run(watcher, stop)
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyWatcher reports changes to the files in a directory using inotify
+type inotifyWatcher struct {
+	fd      int
+	dir     string
+	changes chan string
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// newFileWatcher starts watching the files directly inside dir
+func newFileWatcher(dir string) (fileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing inotify: %v", err)
+	}
+
+	// Editors often save by writing a new file and renaming it over the old one,
+	// so watch the directory rather than the file itself
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE)
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("error watching %s: %v", dir, err)
+	}
+
+	w := &inotifyWatcher{
+		fd:      fd,
+		dir:     dir,
+		changes: make(chan string),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// Changes returns the channel of changed file paths; it is closed when the watcher stops
+func (w *inotifyWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Err returns the error that stopped the watcher, if any
+func (w *inotifyWatcher) Err() error {
+	<-w.stopped
+	return w.err
+}
+
+// Close stops the watcher and releases the inotify descriptor
+func (w *inotifyWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	<-w.stopped
+	return unix.Close(w.fd)
+}
+
+// readEvents polls the inotify descriptor until the watcher is closed
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.stopped)
+	defer close(w.changes)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		// Poll with a timeout so Close is noticed without blocking in read
+		fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 200)
+
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			w.err = fmt.Errorf("error polling inotify: %v", err)
+			return
+		}
+
+		n, err = unix.Read(w.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			w.err = fmt.Errorf("error reading inotify events: %v", err)
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 || name == "" {
+				continue
+			}
+
+			select {
+			case w.changes <- filepath.Join(w.dir, name):
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
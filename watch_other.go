@@ -0,0 +1,133 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often the polling watcher scans the directory
+const pollInterval = 500 * time.Millisecond
+
+// fileStamp identifies a version of a file by size and modification time
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// pollWatcher reports changes to the files in a directory by scanning it periodically.
+// It is used on platforms without inotify support.
+type pollWatcher struct {
+	dir      string
+	changes  chan string
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+	err      error
+	snapshot map[string]fileStamp
+}
+
+// newFileWatcher starts watching the files directly inside dir
+func newFileWatcher(dir string) (fileWatcher, error) {
+	snapshot, err := scanFileStamps(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error watching %s: %v", dir, err)
+	}
+
+	w := &pollWatcher{
+		dir:      dir,
+		changes:  make(chan string),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		snapshot: snapshot,
+	}
+	go w.poll()
+	return w, nil
+}
+
+// Changes returns the channel of changed file paths; it is closed when the watcher stops
+func (w *pollWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Err returns the error that stopped the watcher, if any
+func (w *pollWatcher) Err() error {
+	<-w.stopped
+	return w.err
+}
+
+// Close stops the watcher
+func (w *pollWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	<-w.stopped
+	return nil
+}
+
+// poll rescans the directory until the watcher is closed
+func (w *pollWatcher) poll() {
+	defer close(w.stopped)
+	defer close(w.changes)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		current, err := scanFileStamps(w.dir)
+		if err != nil {
+			w.err = fmt.Errorf("error scanning %s: %v", w.dir, err)
+			return
+		}
+
+		var changed []string
+		for name, stamp := range current {
+			if previous, ok := w.snapshot[name]; !ok || previous != stamp {
+				changed = append(changed, name)
+			}
+		}
+		for name := range w.snapshot {
+			if _, ok := current[name]; !ok {
+				changed = append(changed, name)
+			}
+		}
+		w.snapshot = current
+
+		for _, name := range changed {
+			select {
+			case w.changes <- filepath.Join(w.dir, name):
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// scanFileStamps records the size and modification time of every file in dir
+func scanFileStamps(dir string) (map[string]fileStamp, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stamps := make(map[string]fileStamp)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stamps[entry.Name()] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	return stamps, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWatcher is a fileWatcher driven by the test
+type fakeWatcher struct {
+	changes chan string
+}
+
+func (w *fakeWatcher) Changes() <-chan string { return w.changes }
+func (w *fakeWatcher) Err() error             { return nil }
+func (w *fakeWatcher) Close() error           { return nil }
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	watcher, err := newFileWatcher(dir)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	path := filepath.Join(dir, "contract.json")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changed := <-watcher.Changes():
+			if changed == path {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for change event")
+		}
+	}
+}
+
+func TestContractWatcherCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "contract.json")
+	renderPath := filepath.Join(dir, "contract.md")
+	store := NewMemoryStore()
+	var out bytes.Buffer
+
+	writeSyncFile(t, dir, "contract.json", newTestContract("C-1", "active"))
+	w, err := newContractWatcher(path, renderPath, store, &out)
+	if err != nil {
+		t.Fatalf("Failed to create contract watcher: %v", err)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		w.check(path)
+
+		if !strings.Contains(out.String(), "valid (contract C-1)") {
+			t.Errorf("Expected valid message, got %q", out.String())
+		}
+		if _, err := store.GetContract("C-1"); err != nil {
+			t.Errorf("Expected contract to be stored: %v", err)
+		}
+		rendered, err := os.ReadFile(renderPath)
+		if err != nil {
+			t.Fatalf("Expected rendered output: %v", err)
+		}
+		if !strings.Contains(string(rendered), "## Contract C-1") {
+			t.Errorf("Unexpected rendered output: %s", rendered)
+		}
+	})
+
+	t.Run("UnchangedIsSkipped", func(t *testing.T) {
+		out.Reset()
+		w.check(path)
+		if out.Len() != 0 {
+			t.Errorf("Expected no output for unchanged file, got %q", out.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		out.Reset()
+		invalid := newTestContract("C-1", "")
+		writeSyncFile(t, dir, "contract.json", invalid)
+		w.check(path)
+		if !strings.Contains(out.String(), "INVALID") {
+			t.Errorf("Expected invalid message, got %q", out.String())
+		}
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		out.Reset()
+		os.Remove(path)
+		w.check(path)
+		if !strings.Contains(out.String(), "removed") {
+			t.Errorf("Expected removed message, got %q", out.String())
+		}
+	})
+}
+
+func TestContractWatcherRun(t *testing.T) {
+	dir := t.TempDir()
+	writeSyncFile(t, dir, "C-1.json", newTestContract("C-1", "active"))
+	renderDir := filepath.Join(t.TempDir(), "rendered")
+
+	var out bytes.Buffer
+	w, err := newContractWatcher(dir, renderDir, nil, &out)
+	if err != nil {
+		t.Fatalf("Failed to create contract watcher: %v", err)
+	}
+
+	watcher := &fakeWatcher{changes: make(chan string)}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- w.run(watcher, stop) }()
+
+	// Only JSON files in the watched directory are checked
+	writeSyncFile(t, dir, "C-2.json", newTestContract("C-2", "active"))
+	watcher.changes <- filepath.Join(dir, "notes.txt")
+	watcher.changes <- filepath.Join(dir, "C-2.json")
+	watcher.changes <- filepath.Join(dir, "C-2.json")
+	time.Sleep(3 * watchDebounce)
+	close(stop)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Watcher returned error: %v", err)
+	}
+
+	for _, id := range []string{"C-1", "C-2"} {
+		if _, err := os.Stat(filepath.Join(renderDir, id+".md")); err != nil {
+			t.Errorf("Expected %s to be rendered: %v", id, err)
+		}
+	}
+	if count := strings.Count(out.String(), "valid (contract C-2)"); count != 1 {
+		t.Errorf("Expected C-2 to be checked once, got %d times in %q", count, out.String())
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWebhookNotFound is returned when no webhook or delivery has the requested ID
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook delivery statuses
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// HTTP headers of webhook requests
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// maxWebhookAttempts is the number of failed attempts after which a delivery is given up
+	maxWebhookAttempts = 10
+	// webhookRetryDelay is the delay after the first failed attempt; it doubles with every further one
+	webhookRetryDelay = time.Minute
+	// maxWebhookRetryDelay caps the delay between attempts
+	maxWebhookRetryDelay = 6 * time.Hour
+	// webhookTimeout limits how long an endpoint may take to answer
+	webhookTimeout = 10 * time.Second
+)
+
+// Webhook is an endpoint that receives contract events
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Events are the event types sent to the endpoint; empty means every type
+	Events []string `json:"events"`
+	// Secret is the key the payloads are signed with
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt" table:"created"`
+}
+
+// Wants reports whether the webhook receives events of the given type
+func (w Webhook) Wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, wanted := range w.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event waiting in the outbox to be sent to a webhook, or a
+// record of one that was sent or given up
+type WebhookDelivery struct {
+	ID         int64  `json:"id"`
+	WebhookID  int64  `json:"webhookId" table:"webhook"`
+	URL        string `json:"url"`
+	Event      string `json:"event"`
+	ContractID string `json:"contractId" table:"contract"`
+	// Status is pending, delivered or failed
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is when a pending delivery is due to be sent
+	NextAttempt time.Time `json:"nextAttempt" table:"next attempt"`
+	LastError   string    `json:"lastError,omitempty" table:"error"`
+	CreatedAt   time.Time `json:"createdAt" table:"created"`
+
+	// Payload is the JSON body sent to the webhook
+	Payload []byte `json:"-"`
+	secret  string
+}
+
+// WebhookStore is implemented by stores that keep webhooks and an outbox of their
+// deliveries, so that deliveries survive restarts until they succeed
+type WebhookStore interface {
+	// AddWebhook stores a new webhook and sets its ID and creation time
+	AddWebhook(webhook *Webhook) error
+	Webhooks() ([]Webhook, error)
+	// RemoveWebhook removes a webhook together with its deliveries
+	RemoveWebhook(id int64) error
+	// EnqueueDeliveries adds deliveries to the outbox and sets their IDs
+	EnqueueDeliveries(deliveries []*WebhookDelivery) error
+	// WebhookDeliveries returns the deliveries with the given status, or all of them, oldest first
+	WebhookDeliveries(status string) ([]*WebhookDelivery, error)
+	GetWebhookDelivery(id int64) (*WebhookDelivery, error)
+	// UpdateWebhookDelivery records the status, attempts, next attempt and error of a delivery
+	UpdateWebhookDelivery(delivery *WebhookDelivery) error
+}
+
+var _ WebhookStore = (*DB)(nil)
+
+// asWebhookStore returns the WebhookStore behind a store and the stores wrapping it
+func asWebhookStore(store ContractStore) (WebhookStore, bool) {
+	return unwrapStore[WebhookStore](store)
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute http or https URL
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: expected an http or https URL", rawURL)
+	}
+	return nil
+}
+
+// parseWebhookEvents parses a comma-separated list of event types; * or an empty
+// list selects every type
+func parseWebhookEvents(value string) ([]string, error) {
+	var events []string
+	for _, event := range strings.Split(value, ",") {
+		event = strings.TrimSpace(event)
+		switch {
+		case event == "":
+		case event == "*":
+			return nil, nil
+		case event == EventContractExpiring:
+			return nil, fmt.Errorf("%s events are not sent to webhooks", EventContractExpiring)
+		case !isEventType(event):
+			return nil, fmt.Errorf("unknown event %q (use %s)", event, strings.Join(EventTypes[:4], ", "))
+		default:
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// newWebhookSecret returns a random secret for signing payloads
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %v", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignWebhookPayload returns the signature sent in the X-Webhook-Signature header:
+// sha256= followed by the hex HMAC-SHA256, keyed with the secret, of the Unix
+// timestamp in X-Webhook-Timestamp, a dot and the payload
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the signature and timestamp headers of a webhook
+// request. Receivers should reject requests whose timestamp is more than a few
+// minutes away from now, so that captured requests cannot be replayed later.
+func VerifyWebhookSignature(secret string, payload []byte, timestamp, signature string, now time.Time, tolerance time.Duration) error {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("webhook timestamp is %s away from now", age.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignWebhookPayload(secret, sent, payload))) {
+		return fmt.Errorf("webhook signature does not match")
+	}
+	return nil
+}
+
+// webhookPayload is the JSON body of a webhook request
+type webhookPayload struct {
+	// ID identifies the event; it is the same for every webhook and every attempt,
+	// so that receivers can ignore events they have already processed
+	ID string `json:"id"`
+	Event
+}
+
+// webhookBackoff returns the delay before the next attempt after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
+
+// WebhookDispatcher puts contract events into the webhook outbox and sends them
+type WebhookDispatcher struct {
+	store  WebhookStore
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewWebhookDispatcher creates a dispatcher for the webhooks of a store
+func NewWebhookDispatcher(store WebhookStore) *WebhookDispatcher {
+	return &WebhookDispatcher{store: store, client: &http.Client{Timeout: webhookTimeout}, now: time.Now}
+}
+
+// Enqueue adds a delivery of the event to the outbox for every webhook that wants it
+func (d *WebhookDispatcher) Enqueue(event Event) ([]*WebhookDelivery, error) {
+	deliveries, err := d.deliveries(event)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	if err := d.store.EnqueueDeliveries(deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// deliveries returns a delivery of the event for every webhook that wants it,
+// without adding them to the outbox
+func (d *WebhookDispatcher) deliveries(event Event) ([]*WebhookDelivery, error) {
+	webhooks, err := d.store.Webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []*WebhookDelivery
+	var payload []byte
+	now := d.now().UTC()
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
+		}
+		if payload == nil {
+			id := make([]byte, 16)
+			rand.Read(id)
+			payload, err = json.Marshal(webhookPayload{ID: hex.EncodeToString(id), Event: event})
+			if err != nil {
+				return nil, fmt.Errorf("error encoding webhook payload: %v", err)
+			}
+		}
+		deliveries = append(deliveries, &WebhookDelivery{
+			WebhookID:   webhook.ID,
+			URL:         webhook.URL,
+			Event:       event.Type,
+			ContractID:  event.ContractID,
+			Status:      deliveryPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+			Payload:     payload,
+			secret:      webhook.Secret,
+		})
+	}
+	return deliveries, nil
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due and returns them
+func (d *WebhookDispatcher) DeliverDue() ([]*WebhookDelivery, error) {
+	pending, err := d.store.WebhookDeliveries(deliveryPending)
+	if err != nil {
+		return nil, err
+	}
+
+	var attempted []*WebhookDelivery
+	now := d.now()
+	for _, delivery := range pending {
+		if delivery.NextAttempt.After(now) {
+			continue
+		}
+		if err := d.Attempt(delivery); err != nil && !isDeliveryError(err) {
+			return attempted, err
+		}
+		attempted = append(attempted, delivery)
+	}
+	return attempted, nil
+}
+
+// OutboxStore is a ContractStore that adds a delivery of every change made through
+// it to the outbox of each webhook that wants it, in the transaction that makes the
+// change, so that a change is never stored without its deliveries or the other way
+// round. It wraps the database directly, below the stores that check changes.
+// Nothing is sent while storing: webhooks deliver sends the deliveries that are due.
+type OutboxStore struct {
+	ContractStore
+	db         *DB
+	dispatcher *WebhookDispatcher
+}
+
+// NewOutboxStore wraps a database so that changes made through it are put into the webhook outbox
+func NewOutboxStore(db *DB) *OutboxStore {
+	return &OutboxStore{ContractStore: db, db: db, dispatcher: NewWebhookDispatcher(db)}
+}
+
+// Unwrap returns the wrapped store
+func (s *OutboxStore) Unwrap() ContractStore {
+	return s.ContractStore
+}
+
+// StoreContract stores the contract together with the deliveries of its events
+func (s *OutboxStore) StoreContract(contract *Contract) error {
+	previous, err := s.db.GetContract(contract.ID)
+	if err != nil && !errors.Is(err, ErrContractNotFound) {
+		return err
+	}
+	events, err := storeEvents(previous, contract)
+	if err != nil {
+		return err
+	}
+	deliveries, err := s.deliveries(events)
+	if err != nil {
+		return err
+	}
+	return s.db.storeContract(contract, deliveries)
+}
+
+// DeleteContract deletes the contract together with the deliveries of its deletion
+func (s *OutboxStore) DeleteContract(id string) error {
+	previous, err := s.db.GetContract(id)
+	if err != nil {
+		return err
+	}
+	deliveries, err := s.deliveries([]Event{{Type: EventContractDeleted, ContractID: id, Previous: previous}})
+	if err != nil {
+		return err
+	}
+	return s.db.deleteContract(id, deliveries)
+}
+
+// deliveries returns the deliveries of the events to every webhook that wants them
+func (s *OutboxStore) deliveries(events []Event) ([]*WebhookDelivery, error) {
+	var all []*WebhookDelivery
+	for _, event := range events {
+		deliveries, err := s.dispatcher.deliveries(event)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, deliveries...)
+	}
+	return all, nil
+}
+
+// loadOutbox wraps a database in an OutboxStore when its tenant has webhooks and
+// returns it unchanged otherwise
+func loadOutbox(db *DB) (ContractStore, error) {
+	webhooks, err := db.Webhooks()
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return db, nil
+	}
+	return NewOutboxStore(db), nil
+}
+
+// Replay puts a delivery back into the outbox, whatever its status, and attempts it
+// right away. The same payload is sent again, with a fresh signature.
+func (d *WebhookDispatcher) Replay(id int64) (*WebhookDelivery, error) {
+	delivery, err := d.store.GetWebhookDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Status = deliveryPending
+	delivery.Attempts = 0
+	if err := d.Attempt(delivery); err != nil && !isDeliveryError(err) {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// deliveryError is the error of a failed delivery attempt, as opposed to an error of the outbox
+type deliveryError struct {
+	err error
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// isDeliveryError reports whether err is the error of a failed delivery attempt
+func isDeliveryError(err error) bool {
+	var target *deliveryError
+	return errors.As(err, &target)
+}
+
+// Attempt sends a delivery once and records the outcome in the outbox. After a
+// failure the delivery stays pending, with a delay that doubles after every failed
+// attempt, until it has failed maxWebhookAttempts times.
+func (d *WebhookDispatcher) Attempt(delivery *WebhookDelivery) error {
+	sendErr := d.send(delivery)
+	delivery.Attempts++
+	if sendErr == nil {
+		delivery.Status = deliveryDelivered
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = sendErr.Error()
+		if delivery.Attempts >= maxWebhookAttempts {
+			delivery.Status = deliveryFailed
+		} else {
+			delivery.NextAttempt = d.now().UTC().Add(webhookBackoff(delivery.Attempts))
+		}
+	}
+
+	if err := d.store.UpdateWebhookDelivery(delivery); err != nil {
+		return err
+	}
+	if sendErr != nil {
+		return &deliveryError{sendErr}
+	}
+	return nil
+}
+
+// send posts the signed payload of a delivery to its webhook; any response other than 2xx is an error
+func (d *WebhookDispatcher) send(delivery *WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goplayground-webhooks")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(webhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhookSignatureHeader, SignWebhookPayload(delivery.secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// parseWebhookIDs parses webhook or delivery IDs given as arguments
+func parseWebhookIDs(args []string) ([]int64, error) {
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid ID %q: expected a number", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// addWebhookResult is the result record of an added webhook. Secret is set when it
+// was generated, as this is the only time it is shown.
+type addWebhookResult struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt" table:"created"`
+}
+
+// removeWebhookResult is the result record of a removed webhook
+type removeWebhookResult struct {
+	ID      int64 `json:"id"`
+	Removed bool  `json:"removed"`
+}
+
+// runWebhooks implements the webhooks command and its subcommands
+func runWebhooks(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("webhooks requires a subcommand: add, list, remove, deliveries, deliver or replay")
+	}
+	subcommand, args := args[0], args[1:]
+
+	fs := newFlagSet("webhooks " + subcommand)
+	var events, secret, status *string
+	switch subcommand {
+	case "add":
+		events = fs.String("events", "*", "Comma-separated event types to send, or * for every type")
+		secret = fs.String("secret", "", "Secret to sign payloads with (default: a random secret, printed once)")
+	case "deliveries":
+		status = fs.String("status", "", "Only list deliveries with this status: pending, delivered or failed")
+	case "list", "remove", "deliver", "replay":
+	default:
+		return fmt.Errorf("unknown webhooks subcommand %q: use add, list, remove, deliveries, deliver or replay", subcommand)
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Webhooks are managed on the plain store, so that managing them publishes no events
+	store, err := openBareStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := requirePermission(store, permAdmin); err != nil {
+		return err
+	}
+	webhooks, ok := asWebhookStore(store)
+	if !ok {
+		return fmt.Errorf("webhooks require a SQLite or PostgreSQL store")
+	}
+	dispatcher := NewWebhookDispatcher(webhooks)
+
+	switch subcommand {
+	case "add":
+		if len(positional) != 1 {
+			return fmt.Errorf("webhooks add requires exactly one URL")
+		}
+		if err := validateWebhookURL(positional[0]); err != nil {
+			return err
+		}
+		wanted, err := parseWebhookEvents(*events)
+		if err != nil {
+			return err
+		}
+		webhook := &Webhook{URL: positional[0], Events: wanted, Secret: *secret}
+		var generated string
+		if webhook.Secret == "" {
+			if generated, err = newWebhookSecret(); err != nil {
+				return err
+			}
+			webhook.Secret = generated
+		}
+		if err := webhooks.AddWebhook(webhook); err != nil {
+			return err
+		}
+		result := addWebhookResult{ID: webhook.ID, URL: webhook.URL, Events: webhook.Events, Secret: generated, CreatedAt: webhook.CreatedAt}
+		return printResults(result, func() {
+			fmt.Printf("Webhook %d added for %s\n", webhook.ID, webhook.URL)
+			if generated != "" {
+				fmt.Printf("Signing secret (shown only once): %s\n", generated)
+			}
+		})
+
+	case "list":
+		list, err := webhooks.Webhooks()
+		if err != nil {
+			return err
+		}
+		if list == nil {
+			list = []Webhook{}
+		}
+		return printResults(list, func() {
+			if len(list) == 0 {
+				fmt.Println("No webhooks registered")
+				return
+			}
+			writeResults(os.Stdout, outputTable, list)
+		})
+
+	case "remove":
+		if len(positional) == 0 {
+			return fmt.Errorf("webhooks remove requires at least one webhook ID")
+		}
+		ids, err := parseWebhookIDs(positional)
+		if err != nil {
+			return err
+		}
+		results := make([]removeWebhookResult, 0, len(ids))
+		for _, id := range ids {
+			if err := webhooks.RemoveWebhook(id); err != nil {
+				return err
+			}
+			results = append(results, removeWebhookResult{ID: id, Removed: true})
+		}
+		return printResults(results, func() {
+			for _, result := range results {
+				fmt.Printf("Webhook %d removed\n", result.ID)
+			}
+		})
+
+	case "deliveries":
+		switch *status {
+		case "", deliveryPending, deliveryDelivered, deliveryFailed:
+		default:
+			return fmt.Errorf("unknown delivery status %q: use %s, %s or %s", *status, deliveryPending, deliveryDelivered, deliveryFailed)
+		}
+		deliveries, err := webhooks.WebhookDeliveries(*status)
+		if err != nil {
+			return err
+		}
+		if deliveries == nil {
+			deliveries = []*WebhookDelivery{}
+		}
+		return printResults(deliveries, func() {
+			if len(deliveries) == 0 {
+				fmt.Println("No deliveries")
+				return
+			}
+			writeResults(os.Stdout, outputTable, deliveries)
+		})
+
+	case "deliver":
+		attempted, err := dispatcher.DeliverDue()
+		if err != nil {
+			return err
+		}
+		return printDeliveries(attempted)
+
+	default: // replay
+		if len(positional) == 0 {
+			return fmt.Errorf("webhooks replay requires at least one delivery ID")
+		}
+		ids, err := parseWebhookIDs(positional)
+		if err != nil {
+			return err
+		}
+		var replayed []*WebhookDelivery
+		for _, id := range ids {
+			delivery, err := dispatcher.Replay(id)
+			if err != nil {
+				return err
+			}
+			replayed = append(replayed, delivery)
+		}
+		return printDeliveries(replayed)
+	}
+}
+
+// printDeliveries prints the outcome of delivery attempts, failing if any of them failed
+func printDeliveries(deliveries []*WebhookDelivery) error {
+	if deliveries == nil {
+		deliveries = []*WebhookDelivery{}
+	}
+	failed := 0
+	for _, delivery := range deliveries {
+		if delivery.Status != deliveryDelivered {
+			failed++
+		}
+	}
+
+	err := printResults(deliveries, func() {
+		if len(deliveries) == 0 {
+			fmt.Println("No deliveries are due")
+		}
+		for _, delivery := range deliveries {
+			switch delivery.Status {
+			case deliveryDelivered:
+				fmt.Printf("Delivered %s event for contract %s to %s\n", delivery.Event, delivery.ContractID, delivery.URL)
+			case deliveryFailed:
+				fmt.Printf("Gave up delivering %s event for contract %s to %s: %s\n", delivery.Event, delivery.ContractID, delivery.URL, delivery.LastError)
+			default:
+				fmt.Printf("Failed to deliver %s event for contract %s to %s, retrying after %s: %s\n",
+					delivery.Event, delivery.ContractID, delivery.URL, delivery.NextAttempt.Local().Format(time.DateTime), delivery.LastError)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d delivery attempt(s) failed", failed)
+	}
+	return nil
+}
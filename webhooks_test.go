@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a request received by a webhookReceiver
+type webhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// webhookReceiver is a test endpoint that answers with a configurable status and records the requests it receives
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []webhookRequest
+}
+
+func startWebhookReceiver(t *testing.T) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, webhookRequest{Header: req.Header, Body: body})
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// SetStatus changes the status the receiver answers with
+func (r *webhookReceiver) SetStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// Requests returns the requests received so far
+func (r *webhookReceiver) Requests() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+// testWebhookStore runs the webhook outbox tests against a store
+func testWebhookStore(t *testing.T, store WebhookStore) {
+	webhook := &Webhook{URL: "https://example.com/hook", Events: []string{EventContractCreated, EventContractDeleted}, Secret: "secret"}
+	if err := store.AddWebhook(webhook); err != nil {
+		t.Fatalf("Failed to add webhook: %v", err)
+	}
+	all := &Webhook{URL: "https://example.com/all", Secret: "other"}
+	if err := store.AddWebhook(all); err != nil {
+		t.Fatalf("Failed to add webhook: %v", err)
+	}
+	if webhook.ID == 0 || all.ID <= webhook.ID || webhook.CreatedAt.IsZero() {
+		t.Errorf("Expected increasing IDs and a creation time, got %+v and %+v", webhook, all)
+	}
+
+	webhooks, err := store.Webhooks()
+	if err != nil {
+		t.Fatalf("Failed to list webhooks: %v", err)
+	}
+	if len(webhooks) != 2 || webhooks[0].URL != webhook.URL || len(webhooks[0].Events) != 2 || webhooks[0].Secret != "secret" || webhooks[1].Events != nil {
+		t.Errorf("Unexpected webhooks %+v", webhooks)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	deliveries := []*WebhookDelivery{
+		{WebhookID: webhook.ID, Event: EventContractCreated, ContractID: "TEST-001", Status: deliveryPending, NextAttempt: now, CreatedAt: now, Payload: []byte(`{"id":"1"}`)},
+		{WebhookID: all.ID, Event: EventContractCreated, ContractID: "TEST-001", Status: deliveryPending, NextAttempt: now, CreatedAt: now, Payload: []byte(`{"id":"1"}`)},
+	}
+	if err := store.EnqueueDeliveries(deliveries); err != nil {
+		t.Fatalf("Failed to enqueue deliveries: %v", err)
+	}
+	if deliveries[0].ID == 0 || deliveries[1].ID <= deliveries[0].ID {
+		t.Errorf("Expected increasing delivery IDs, got %d and %d", deliveries[0].ID, deliveries[1].ID)
+	}
+
+	deliveries[0].Status = deliveryDelivered
+	deliveries[0].Attempts = 1
+	deliveries[1].Attempts = 1
+	deliveries[1].NextAttempt = now.Add(time.Minute)
+	deliveries[1].LastError = "unexpected response status 500 Internal Server Error"
+	for _, delivery := range deliveries {
+		if err := store.UpdateWebhookDelivery(delivery); err != nil {
+			t.Fatalf("Failed to update delivery: %v", err)
+		}
+	}
+
+	pending, err := store.WebhookDeliveries(deliveryPending)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected 1 pending delivery, got %d", len(pending))
+	}
+	got := pending[0]
+	if got.ID != deliveries[1].ID || got.URL != all.URL || got.secret != "other" || got.Attempts != 1 ||
+		!got.NextAttempt.Equal(now.Add(time.Minute)) || !got.CreatedAt.Equal(now) || got.LastError != deliveries[1].LastError ||
+		string(got.Payload) != `{"id":"1"}` {
+		t.Errorf("Unexpected pending delivery %+v", got)
+	}
+
+	delivered, err := store.GetWebhookDelivery(deliveries[0].ID)
+	if err != nil || delivered.Status != deliveryDelivered || delivered.URL != webhook.URL {
+		t.Errorf("Unexpected delivery %+v (%v)", delivered, err)
+	}
+	if _, err := store.GetWebhookDelivery(9999); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+
+	if err := store.RemoveWebhook(all.ID); err != nil {
+		t.Fatalf("Failed to remove webhook: %v", err)
+	}
+	if remaining, err := store.WebhookDeliveries(""); err != nil || len(remaining) != 1 || remaining[0].ID != deliveries[0].ID {
+		t.Errorf("Expected the deliveries of the removed webhook to be removed, got %+v (%v)", remaining, err)
+	}
+	if err := store.RemoveWebhook(all.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteWebhooks(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	testWebhookStore(t, db)
+}
+
+// newTestDispatcher returns a dispatcher for a fresh SQLite store whose clock the test controls
+func newTestDispatcher(t *testing.T) (*WebhookDispatcher, *DB, *time.Time) {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Now().UTC().Truncate(time.Second)
+	dispatcher := NewWebhookDispatcher(db)
+	dispatcher.now = func() time.Time { return now }
+	return dispatcher, db, &now
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	dispatcher, db, now := newTestDispatcher(t)
+	receiver := startWebhookReceiver(t)
+	webhook := &Webhook{URL: receiver.URL, Events: []string{EventStatusChanged}, Secret: "s3cret"}
+	if err := db.AddWebhook(webhook); err != nil {
+		t.Fatalf("Failed to add webhook: %v", err)
+	}
+	store := NewOutboxStore(db)
+	store.dispatcher = dispatcher
+	// storeAndDeliver stores the contract, checks that nothing is sent while storing and sends what is due
+	storeAndDeliver := func(contract *Contract) {
+		t.Helper()
+		sent := len(receiver.Requests())
+		if err := store.StoreContract(contract); err != nil {
+			t.Fatalf("Failed to store contract: %v", err)
+		}
+		if requests := receiver.Requests(); len(requests) != sent {
+			t.Errorf("Expected nothing to be sent while storing, got %d requests", len(requests)-sent)
+		}
+		if _, err := dispatcher.DeliverDue(); err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+	}
+
+	contract := newTestContract("TEST-001", "active")
+	storeAndDeliver(contract)
+	if requests := receiver.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no request for an event the webhook does not want, got %d", len(requests))
+	}
+
+	contract.Status = "terminated"
+	storeAndDeliver(contract)
+	requests := receiver.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+
+	t.Run("SignedPayload", func(t *testing.T) {
+		req := requests[0]
+		if req.Header.Get(webhookEventHeader) != EventStatusChanged || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected headers %v", req.Header)
+		}
+		err := VerifyWebhookSignature("s3cret", req.Body, req.Header.Get(webhookTimestampHeader), req.Header.Get(webhookSignatureHeader), *now, 5*time.Minute)
+		if err != nil {
+			t.Errorf("Failed to verify signature: %v", err)
+		}
+		if VerifyWebhookSignature("wrong", req.Body, req.Header.Get(webhookTimestampHeader), req.Header.Get(webhookSignatureHeader), *now, 5*time.Minute) == nil {
+			t.Errorf("Expected the signature to fail with the wrong secret")
+		}
+		if VerifyWebhookSignature("s3cret", req.Body, req.Header.Get(webhookTimestampHeader), req.Header.Get(webhookSignatureHeader), now.Add(time.Hour), 5*time.Minute) == nil {
+			t.Errorf("Expected an old timestamp to be rejected")
+		}
+
+		var payload struct {
+			ID         string    `json:"id"`
+			Type       string    `json:"type"`
+			ContractID string    `json:"contractId"`
+			Contract   *Contract `json:"contract"`
+			Previous   *Contract `json:"previous"`
+		}
+		if err := json.Unmarshal(req.Body, &payload); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if payload.ID == "" || payload.Type != EventStatusChanged || payload.ContractID != "TEST-001" ||
+			payload.Contract.Status != "terminated" || payload.Previous.Status != "active" {
+			t.Errorf("Unexpected payload %s", req.Body)
+		}
+	})
+
+	t.Run("RetryWithBackoff", func(t *testing.T) {
+		receiver.SetStatus(http.StatusInternalServerError)
+		contract.Status = "active"
+		storeAndDeliver(contract)
+
+		pending, err := db.WebhookDeliveries(deliveryPending)
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("Expected 1 pending delivery, got %+v (%v)", pending, err)
+		}
+		if pending[0].Attempts != 1 || !pending[0].NextAttempt.Equal(now.Add(time.Minute)) || pending[0].LastError != "unexpected response status 500 Internal Server Error" {
+			t.Errorf("Unexpected pending delivery %+v", pending[0])
+		}
+
+		// Nothing is due until the delay has passed
+		if attempted, err := dispatcher.DeliverDue(); err != nil || len(attempted) != 0 {
+			t.Errorf("Expected no attempts before the retry is due, got %+v (%v)", attempted, err)
+		}
+
+		*now = now.Add(time.Minute)
+		attempted, err := dispatcher.DeliverDue()
+		if err != nil || len(attempted) != 1 || attempted[0].Attempts != 2 || !attempted[0].NextAttempt.Equal(now.Add(2*time.Minute)) {
+			t.Fatalf("Expected a second attempt with a doubled delay, got %+v (%v)", attempted, err)
+		}
+
+		receiver.SetStatus(http.StatusOK)
+		*now = now.Add(2 * time.Minute)
+		attempted, err = dispatcher.DeliverDue()
+		if err != nil || len(attempted) != 1 || attempted[0].Status != deliveryDelivered || attempted[0].LastError != "" {
+			t.Fatalf("Expected the third attempt to succeed, got %+v (%v)", attempted, err)
+		}
+
+		// Every attempt sends the same event
+		requests := receiver.Requests()
+		first, last := requests[len(requests)-3], requests[len(requests)-1]
+		if string(first.Body) != string(last.Body) || first.Header.Get(webhookDeliveryHeader) != last.Header.Get(webhookDeliveryHeader) {
+			t.Errorf("Expected retries to send the same payload")
+		}
+	})
+
+	t.Run("GiveUp", func(t *testing.T) {
+		receiver.SetStatus(http.StatusBadGateway)
+		contract.Status = "terminated"
+		storeAndDeliver(contract)
+		for i := 1; i < maxWebhookAttempts; i++ {
+			*now = now.Add(maxWebhookRetryDelay)
+			if _, err := dispatcher.DeliverDue(); err != nil {
+				t.Fatalf("Failed to deliver: %v", err)
+			}
+		}
+
+		failed, err := db.WebhookDeliveries(deliveryFailed)
+		if err != nil || len(failed) != 1 || failed[0].Attempts != maxWebhookAttempts {
+			t.Fatalf("Expected the delivery to fail after %d attempts, got %+v (%v)", maxWebhookAttempts, failed, err)
+		}
+
+		receiver.SetStatus(http.StatusOK)
+		*now = now.Add(maxWebhookRetryDelay)
+		if attempted, _ := dispatcher.DeliverDue(); len(attempted) != 0 {
+			t.Errorf("Expected failed deliveries not to be retried, got %+v", attempted)
+		}
+
+		replayed, err := dispatcher.Replay(failed[0].ID)
+		if err != nil || replayed.Status != deliveryDelivered || replayed.Attempts != 1 {
+			t.Errorf("Expected the replay to succeed, got %+v (%v)", replayed, err)
+		}
+		requests := receiver.Requests()
+		last := requests[len(requests)-1]
+		if last.Header.Get(webhookDeliveryHeader) != strconv.FormatInt(failed[0].ID, 10) {
+			t.Errorf("Expected the replayed delivery, got %s", last.Header.Get(webhookDeliveryHeader))
+		}
+	})
+
+	t.Run("ReplayUnknown", func(t *testing.T) {
+		if _, err := dispatcher.Replay(9999); !errors.Is(err, ErrWebhookNotFound) {
+			t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+		}
+	})
+}
+
+func TestWebhookOutboxSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	receiver := startWebhookReceiver(t)
+	receiver.SetStatus(http.StatusServiceUnavailable)
+	db.AddWebhook(&Webhook{URL: receiver.URL, Secret: "secret"})
+
+	store := NewOutboxStore(db)
+	if err := store.StoreContract(newTestContract("TEST-001", "active")); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	db.Close()
+
+	db, err = InitDB(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	receiver.SetStatus(http.StatusOK)
+	dispatcher := NewWebhookDispatcher(db)
+	dispatcher.now = func() time.Time { return time.Now().Add(time.Hour) }
+	attempted, err := dispatcher.DeliverDue()
+	if err != nil || len(attempted) != 1 || attempted[0].Status != deliveryDelivered || attempted[0].Event != EventContractCreated {
+		t.Errorf("Expected the pending delivery to be sent after reopening, got %+v (%v)", attempted, err)
+	}
+}
+
+func TestOutboxStore(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	db.AddWebhook(&Webhook{URL: "http://127.0.0.1:1/hook", Secret: "secret"})
+
+	store, err := loadOutbox(db)
+	if err != nil {
+		t.Fatalf("Failed to load outbox: %v", err)
+	}
+	if _, ok := store.(*OutboxStore); !ok {
+		t.Fatalf("Expected an OutboxStore for a tenant with webhooks, got %T", store)
+	}
+	contract := newTestContract("TEST-001", "active")
+	if err := store.StoreContract(contract); err != nil {
+		t.Fatalf("Failed to store contract: %v", err)
+	}
+	if err := store.DeleteContract(contract.ID); err != nil {
+		t.Fatalf("Failed to delete contract: %v", err)
+	}
+	deliveries, err := db.WebhookDeliveries("")
+	if err != nil || len(deliveries) != 2 || deliveries[0].Event != EventContractCreated || deliveries[1].Event != EventContractDeleted {
+		t.Errorf("Expected deliveries of the creation and the deletion, got %+v (%v)", deliveries, err)
+	}
+
+	t.Run("RolledBackTogether", func(t *testing.T) {
+		if _, err := db.Exec(`DROP TABLE webhook_deliveries;`); err != nil {
+			t.Fatalf("Failed to drop the outbox: %v", err)
+		}
+		if err := store.StoreContract(contract); err == nil {
+			t.Fatalf("Expected storing to fail when the outbox cannot be written")
+		}
+		if _, err := db.GetContract(contract.ID); !errors.Is(err, ErrContractNotFound) {
+			t.Errorf("Expected the contract not to be stored without its deliveries, got %v", err)
+		}
+	})
+
+	t.Run("NoWebhooks", func(t *testing.T) {
+		if err := db.UseTenant("other"); err != nil {
+			t.Fatalf("Failed to switch tenant: %v", err)
+		}
+		if store, err := loadOutbox(db); err != nil || store != ContractStore(db) {
+			t.Errorf("Expected the database itself without webhooks, got %T (%v)", store, err)
+		}
+	})
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, delay := range expected {
+		if got := webhookBackoff(i + 1); got != delay {
+			t.Errorf("After %d attempts: expected %s, got %s", i+1, delay, got)
+		}
+	}
+	if got := webhookBackoff(100); got != maxWebhookRetryDelay {
+		t.Errorf("Expected the delay to be capped at %s, got %s", maxWebhookRetryDelay, got)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Computed independently with: printf '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	got := SignWebhookPayload("secret", 1700000000, []byte(`{"id":"1"}`))
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		valid    bool
+	}{
+		{"*", 0, true},
+		{"", 0, true},
+		{"contract.created, contract.deleted", 2, true},
+		{"contract.created,*", 0, true},
+		{"contract.expiring", 0, false},
+		{"contract.signed", 0, false},
+	}
+	for _, tt := range tests {
+		events, err := parseWebhookEvents(tt.value)
+		if tt.valid && (err != nil || len(events) != tt.expected) {
+			t.Errorf("parseWebhookEvents(%q): expected %d events, got %v (%v)", tt.value, tt.expected, events, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("parseWebhookEvents(%q): expected an error", tt.value)
+		}
+	}
+}